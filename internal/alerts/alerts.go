@@ -0,0 +1,267 @@
+package alerts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// Store errors
+var (
+	ErrInvalid      = errors.New("invalid alert")
+	ErrNotFound     = errors.New("alert not found")
+	ErrLimitReached = errors.New("alert limit reached")
+)
+
+// Reading fields a condition can compare
+const (
+	FieldTempC = "temp_C"
+	FieldTempF = "temp_F"
+	FieldTempK = "temp_K"
+)
+
+// Condition operators
+const (
+	OperatorGT  = "gt"
+	OperatorGTE = "gte"
+	OperatorLT  = "lt"
+	OperatorLTE = "lte"
+)
+
+// Condition compares one temperature of a reading with a threshold, e.g. temp_C gt 35
+type Condition struct {
+	Field    string  `json:"field"`
+	Operator string  `json:"operator"`
+	Value    float64 `json:"value"`
+}
+
+// Validate checks the field and operator
+func (c Condition) Validate() error {
+	switch c.Field {
+	case FieldTempC, FieldTempF, FieldTempK:
+	default:
+		return fmt.Errorf("%w: condition.field must be temp_C, temp_F or temp_K", ErrInvalid)
+	}
+	switch c.Operator {
+	case OperatorGT, OperatorGTE, OperatorLT, OperatorLTE:
+	default:
+		return fmt.Errorf("%w: condition.operator must be gt, gte, lt or lte", ErrInvalid)
+	}
+	return nil
+}
+
+// Reading returns the temperature of the reading the condition looks at
+func (c Condition) Reading(result *services.LookupResult) float64 {
+	tempC, tempF, tempK := result.Temperatures()
+	switch c.Field {
+	case FieldTempF:
+		return tempF
+	case FieldTempK:
+		return tempK
+	default:
+		return tempC
+	}
+}
+
+// Matches reports whether the value satisfies the condition
+func (c Condition) Matches(value float64) bool {
+	switch c.Operator {
+	case OperatorGT:
+		return value > c.Value
+	case OperatorGTE:
+		return value >= c.Value
+	case OperatorLT:
+		return value < c.Value
+	case OperatorLTE:
+		return value <= c.Value
+	}
+	return false
+}
+
+// Request is what a client sends to create an alert
+type Request struct {
+	CEP        string    `json:"cep"`
+	Condition  Condition `json:"condition"`
+	WebhookURL string    `json:"webhook_url"`
+}
+
+// Validate checks the CEP format, the condition and the webhook URL
+func (r *Request) Validate() error {
+	r.CEP = services.NormalizeCEP(r.CEP)
+	if !services.ValidateCEP(r.CEP) {
+		return services.ErrInvalidCEP
+	}
+	if err := r.Condition.Validate(); err != nil {
+		return err
+	}
+	u, err := url.Parse(r.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: webhook_url must be an absolute http or https URL", ErrInvalid)
+	}
+	return nil
+}
+
+// Alert is a registered condition on the weather of a CEP
+type Alert struct {
+	ID         string    `json:"id"`
+	CEP        string    `json:"cep"`
+	Condition  Condition `json:"condition"`
+	WebhookURL string    `json:"webhook_url"`
+	// Secret signs the webhook payloads; it is only shown when the alert is created
+	Secret string `json:"secret,omitempty"`
+	// Owner is the API client that created the alert (empty without authentication)
+	Owner     string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	// Triggered reports whether the condition held on the last evaluation
+	Triggered       bool       `json:"triggered"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+}
+
+// public returns a copy of the alert without its secret
+func (a *Alert) public() Alert {
+	alert := *a
+	alert.Secret = ""
+	return alert
+}
+
+// Store keeps the alerts in memory
+type Store struct {
+	mu           sync.Mutex
+	alerts       map[string]*Alert
+	maxPerClient int
+	now          func() time.Time
+}
+
+// NewStore creates an empty store allowing maxPerClient alerts per API client
+func NewStore(maxPerClient int) *Store {
+	return &Store{
+		alerts:       make(map[string]*Alert),
+		maxPerClient: maxPerClient,
+		now:          time.Now,
+	}
+}
+
+// SetMaxPerClient replaces the per-client limit; existing alerts are kept
+func (s *Store) SetMaxPerClient(maxPerClient int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPerClient = maxPerClient
+}
+
+// Create registers an alert for the owner, returning it with its signing secret
+func (s *Store) Create(owner string, req Request) (Alert, error) {
+	if err := req.Validate(); err != nil {
+		return Alert{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, alert := range s.alerts {
+		if alert.Owner == owner {
+			count++
+		}
+	}
+	if count >= s.maxPerClient {
+		return Alert{}, ErrLimitReached
+	}
+
+	alert := &Alert{
+		ID:         randomHex(16),
+		CEP:        req.CEP,
+		Condition:  req.Condition,
+		WebhookURL: req.WebhookURL,
+		Secret:     randomHex(32),
+		Owner:      owner,
+		CreatedAt:  s.now().UTC(),
+	}
+	s.alerts[alert.ID] = alert
+	return *alert, nil
+}
+
+// List returns the alerts of the owner, oldest first
+func (s *Store) List(owner string) []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alerts := []Alert{}
+	for _, alert := range s.alerts {
+		if alert.Owner == owner {
+			alerts = append(alerts, alert.public())
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].CreatedAt.Equal(alerts[j].CreatedAt) {
+			return alerts[i].CreatedAt.Before(alerts[j].CreatedAt)
+		}
+		return alerts[i].ID < alerts[j].ID
+	})
+	return alerts
+}
+
+// Get returns one alert of the owner
+func (s *Store) Get(owner, id string) (Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alert, ok := s.alerts[id]
+	if !ok || alert.Owner != owner {
+		return Alert{}, ErrNotFound
+	}
+	return alert.public(), nil
+}
+
+// Delete removes one alert of the owner
+func (s *Store) Delete(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alert, ok := s.alerts[id]
+	if !ok || alert.Owner != owner {
+		return ErrNotFound
+	}
+	delete(s.alerts, id)
+	return nil
+}
+
+// all returns every alert, with secrets, for evaluation
+func (s *Store) all() []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alerts := make([]Alert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		alerts = append(alerts, *alert)
+	}
+	return alerts
+}
+
+// record stores an evaluation and reports whether the condition just started to hold
+func (s *Store) record(id string, holds bool, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alert, ok := s.alerts[id]
+	if !ok {
+		// Deleted during the evaluation
+		return false
+	}
+	fired := holds && !alert.Triggered
+	alert.Triggered = holds
+	alert.LastEvaluatedAt = &at
+	if fired {
+		alert.LastTriggeredAt = &at
+	}
+	return fired
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+package alerts
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+func TestCondition_Matches(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    float64
+		expected bool
+	}{
+		{OperatorGT, 35.1, true},
+		{OperatorGT, 35, false},
+		{OperatorGTE, 35, true},
+		{OperatorLT, 34.9, true},
+		{OperatorLT, 35, false},
+		{OperatorLTE, 35, true},
+		{"eq", 35, false},
+	}
+
+	for _, tt := range tests {
+		condition := Condition{Field: FieldTempC, Operator: tt.operator, Value: 35}
+		if got := condition.Matches(tt.value); got != tt.expected {
+			t.Errorf("%s %v: expected %v, got %v", tt.operator, tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestRequest_Validate(t *testing.T) {
+	valid := func() Request {
+		return Request{
+			CEP:        "01310-100",
+			Condition:  Condition{Field: FieldTempC, Operator: OperatorGT, Value: 35},
+			WebhookURL: "https://example.com/hooks/weather",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*Request)
+		wantErr error
+	}{
+		{"valid", func(r *Request) {}, nil},
+		{"invalid cep", func(r *Request) { r.CEP = "0131" }, services.ErrInvalidCEP},
+		{"unknown field", func(r *Request) { r.Condition.Field = "humidity" }, ErrInvalid},
+		{"unknown operator", func(r *Request) { r.Condition.Operator = "eq" }, ErrInvalid},
+		{"relative webhook", func(r *Request) { r.WebhookURL = "/hooks" }, ErrInvalid},
+		{"non-http webhook", func(r *Request) { r.WebhookURL = "ftp://example.com/hooks" }, ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+			if err := req.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && req.CEP != "01310100" {
+				t.Errorf("expected the CEP to be normalized, got %s", req.CEP)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(2)
+	req := Request{
+		CEP:        "01310100",
+		Condition:  Condition{Field: FieldTempC, Operator: OperatorLT, Value: 5},
+		WebhookURL: "https://example.com/hooks",
+	}
+
+	created, err := store.Create("erp", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.ID == "" || len(created.Secret) != 64 {
+		t.Errorf("expected an id and a secret, got %+v", created)
+	}
+	if _, err := store.Create("erp", req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Create("erp", req); !errors.Is(err, ErrLimitReached) {
+		t.Errorf("expected %v, got %v", ErrLimitReached, err)
+	}
+	if _, err := store.Create("dashboard", req); err != nil {
+		t.Errorf("the limit is per client, got %v", err)
+	}
+
+	if alerts := store.List("erp"); len(alerts) != 2 || alerts[0].Secret != "" {
+		t.Errorf("expected 2 alerts without secrets, got %+v", alerts)
+	}
+	if _, err := store.Get("dashboard", created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected other clients not to see the alert, got %v", err)
+	}
+	if err := store.Delete("dashboard", created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected other clients not to delete the alert, got %v", err)
+	}
+	if err := store.Delete("erp", created.ID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := store.Get("erp", created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+}
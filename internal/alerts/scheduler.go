@@ -0,0 +1,112 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// maxConcurrentLookups bounds the CEPs looked up at once during an evaluation
+const maxConcurrentLookups = 8
+
+// Scheduler evaluates every alert periodically and delivers the ones that trigger
+type Scheduler struct {
+	store      *Store
+	lookup     *services.Lookup
+	dispatcher *Dispatcher
+
+	mu       sync.Mutex
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewScheduler creates a scheduler evaluating the store every interval
+func NewScheduler(store *Store, lookup *services.Lookup, dispatcher *Dispatcher, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		store:      store,
+		lookup:     lookup,
+		dispatcher: dispatcher,
+		interval:   interval,
+		now:        time.Now,
+	}
+}
+
+// SetInterval replaces the evaluation interval, starting with the next wait
+func (s *Scheduler) SetInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interval = interval
+}
+
+// Run evaluates the alerts until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		interval := s.interval
+		s.mu.Unlock()
+		if !sleep(ctx, interval) {
+			return
+		}
+		s.Evaluate(ctx)
+	}
+}
+
+// Evaluate looks every watched CEP up once and fires the alerts whose condition
+// started to hold. An alert fires again only after its condition stopped holding.
+func (s *Scheduler) Evaluate(ctx context.Context) {
+	byCEP := make(map[string][]Alert)
+	for _, alert := range s.store.all() {
+		byCEP[alert.CEP] = append(byCEP[alert.CEP], alert)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxConcurrentLookups)
+	for cep, alerts := range byCEP {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(cep string, alerts []Alert) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			s.evaluateCEP(ctx, cep, alerts)
+		}(cep, alerts)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) evaluateCEP(ctx context.Context, cep string, alerts []Alert) {
+	result, err := s.lookup.ByCEP(ctx, cep)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Error evaluating alerts for CEP %s: %v", cep, err)
+		}
+		return
+	}
+
+	now := s.now().UTC()
+	tempC, tempF, tempK := result.Temperatures()
+	for _, alert := range alerts {
+		value := alert.Condition.Reading(result)
+		if !s.store.record(alert.ID, alert.Condition.Matches(value), now) {
+			continue
+		}
+		payload := Payload{
+			AlertID:     alert.ID,
+			CEP:         alert.CEP,
+			Condition:   alert.Condition,
+			Value:       value,
+			Temperature: Temperature{Celsius: tempC, Fahrenheit: tempF, Kelvin: tempK},
+			TriggeredAt: now,
+		}
+		if !result.ObservedAt.IsZero() {
+			observed := result.ObservedAt.UTC()
+			payload.ObservedAt = &observed
+		}
+		s.dispatcher.Deliver(ctx, alert, payload)
+	}
+}
@@ -0,0 +1,89 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+type fakeCEPService struct{}
+
+func (fakeCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	return &models.ViaCEPResponse{CEP: cep, Localidade: "São Paulo", UF: "SP"}, nil
+}
+
+// fakeWeatherService returns a temperature the test can change, counting the calls
+type fakeWeatherService struct {
+	mu    sync.Mutex
+	tempC float64
+	calls int
+}
+
+func (f *fakeWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	weather := &models.WeatherAPIResponse{}
+	weather.Current.TempC = f.tempC
+	return weather, nil
+}
+
+func TestScheduler_Evaluate(t *testing.T) {
+	hook := &webhookServer{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	weather := &fakeWeatherService{tempC: 30}
+	store := NewStore(10)
+	dispatcher, _ := newTestDispatcher(Settings{MaxAttempts: 1, RetryBackoff: time.Second, Timeout: time.Second, AllowPrivateTargets: true})
+	scheduler := NewScheduler(store, services.NewLookup(fakeCEPService{}, weather), dispatcher, time.Minute)
+
+	hot, _ := store.Create("erp", Request{CEP: "01310100", Condition: Condition{Field: FieldTempC, Operator: OperatorGT, Value: 35}, WebhookURL: server.URL})
+	store.Create("erp", Request{CEP: "01310100", Condition: Condition{Field: FieldTempF, Operator: OperatorGT, Value: 200}, WebhookURL: server.URL})
+
+	evaluate := func(tempC float64) {
+		weather.mu.Lock()
+		weather.tempC = tempC
+		weather.mu.Unlock()
+		scheduler.Evaluate(context.Background())
+		dispatcher.Wait()
+	}
+
+	evaluate(30)
+	if len(hook.requests) != 0 {
+		t.Fatalf("expected no webhook below the threshold, got %d", len(hook.requests))
+	}
+	if weather.calls != 1 {
+		t.Errorf("expected one lookup for alerts sharing a CEP, got %d", weather.calls)
+	}
+
+	evaluate(36)
+	if len(hook.requests) != 1 {
+		t.Fatalf("expected 1 webhook once the threshold is crossed, got %d", len(hook.requests))
+	}
+	var payload Payload
+	json.Unmarshal(hook.bodies[0], &payload)
+	if payload.AlertID != hot.ID || payload.Value != 36 || payload.Temperature.Fahrenheit != 96.8 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	evaluate(37)
+	if len(hook.requests) != 1 {
+		t.Errorf("expected no new webhook while the condition keeps holding, got %d", len(hook.requests))
+	}
+	if alert, _ := store.Get("erp", hot.ID); !alert.Triggered || alert.LastTriggeredAt == nil {
+		t.Errorf("expected the alert to be triggered, got %+v", alert)
+	}
+
+	evaluate(30)
+	evaluate(38)
+	if len(hook.requests) != 2 {
+		t.Errorf("expected the alert to fire again after re-arming, got %d", len(hook.requests))
+	}
+}
@@ -0,0 +1,288 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Webhook request headers
+const (
+	HeaderAlertID   = "X-Alert-ID"
+	HeaderDelivery  = "X-Alert-Delivery"
+	HeaderTimestamp = "X-Alert-Timestamp"
+	// HeaderSignature carries sha256=<hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the alert secret>
+	HeaderSignature = "X-Alert-Signature"
+)
+
+const (
+	// maxBackoff caps the wait between two attempts
+	maxBackoff = 10 * time.Minute
+	// maxDeadLetters bounds the dead-letter list; the oldest entries are dropped first
+	maxDeadLetters = 1000
+)
+
+var errPrivateTarget = errors.New("webhook target is a loopback, private or link-local address")
+
+// Settings holds the webhook delivery settings
+type Settings struct {
+	// MaxAttempts is how many times a webhook is tried before going to the dead-letter list
+	MaxAttempts int
+	// RetryBackoff is the wait before the first retry, doubled on every further retry
+	RetryBackoff time.Duration
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// AllowPrivateTargets lets webhooks reach loopback and private networks
+	AllowPrivateTargets bool
+}
+
+// Payload is the body POSTed to the webhook when an alert triggers
+type Payload struct {
+	AlertID     string      `json:"alert_id"`
+	CEP         string      `json:"cep"`
+	Condition   Condition   `json:"condition"`
+	Value       float64     `json:"value"`
+	Temperature Temperature `json:"temperature"`
+	ObservedAt  *time.Time  `json:"observed_at,omitempty"`
+	TriggeredAt time.Time   `json:"triggered_at"`
+}
+
+// Temperature is the reading that triggered the alert
+type Temperature struct {
+	Celsius    float64 `json:"celsius"`
+	Fahrenheit float64 `json:"fahrenheit"`
+	Kelvin     float64 `json:"kelvin"`
+}
+
+// DeadLetter is a delivery that failed every attempt
+type DeadLetter struct {
+	DeliveryID string    `json:"delivery_id"`
+	AlertID    string    `json:"alert_id"`
+	WebhookURL string    `json:"webhook_url"`
+	Payload    Payload   `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error"`
+	FailedAt   time.Time `json:"failed_at"`
+	owner      string
+}
+
+// Dispatcher delivers signed webhooks in the background, retrying with exponential backoff
+type Dispatcher struct {
+	client *http.Client
+
+	mu          sync.Mutex
+	settings    Settings
+	deadLetters []DeadLetter
+	wg          sync.WaitGroup
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+// NewDispatcher creates a dispatcher with its own HTTP client
+func NewDispatcher(settings Settings) *Dispatcher {
+	d := &Dispatcher{
+		settings: settings,
+		now:      time.Now,
+		sleep:    sleep,
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: d.checkTarget}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	d.client = &http.Client{Transport: transport}
+	return d
+}
+
+// Configure replaces the settings; deliveries in progress keep their attempt count
+func (d *Dispatcher) Configure(settings Settings) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settings = settings
+}
+
+// Deliver sends the payload to the alert webhook in the background
+func (d *Dispatcher) Deliver(ctx context.Context, alert Alert, payload Payload) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(ctx, alert, payload)
+	}()
+}
+
+// Wait blocks until every delivery in progress has finished
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// DeadLetters returns the failed deliveries of the owner's alerts, most recent first
+func (d *Dispatcher) DeadLetters(owner string) []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	letters := []DeadLetter{}
+	for i := len(d.deadLetters) - 1; i >= 0; i-- {
+		if d.deadLetters[i].owner == owner {
+			letters = append(letters, d.deadLetters[i])
+		}
+	}
+	return letters
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, alert Alert, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding alert %s payload: %v", alert.ID, err)
+		return
+	}
+	deliveryID := randomHex(16)
+
+	attempts := 0
+	for {
+		d.mu.Lock()
+		settings := d.settings
+		d.mu.Unlock()
+
+		attempts++
+		err = d.post(ctx, alert, deliveryID, body, settings.Timeout)
+		if err == nil {
+			return
+		}
+		if attempts >= settings.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		backoff := settings.RetryBackoff << (attempts - 1)
+		if backoff > maxBackoff || backoff <= 0 {
+			backoff = maxBackoff
+		}
+		if !d.sleep(ctx, backoff) {
+			break
+		}
+	}
+
+	log.Printf("Alert %s webhook failed after %d attempts: %v", alert.ID, attempts, err)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadLetters = append(d.deadLetters, DeadLetter{
+		DeliveryID: deliveryID,
+		AlertID:    alert.ID,
+		WebhookURL: alert.WebhookURL,
+		Payload:    payload,
+		Attempts:   attempts,
+		LastError:  err.Error(),
+		FailedAt:   d.now().UTC(),
+		owner:      alert.Owner,
+	})
+	if len(d.deadLetters) > maxDeadLetters {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-maxDeadLetters:]
+	}
+}
+
+// post makes one attempt; only 2xx responses count as delivered
+func (d *Dispatcher) post(ctx context.Context, alert Alert, deliveryID string, body []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, alert.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "weather-by-cep-alerts")
+	req.Header.Set(HeaderAlertID, alert.ID)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(alert.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// nonGlobalPrefixes are the special-purpose ranges (RFC 6890) that net.IP has no
+// predicate for but that can still reach internal services, e.g. the carrier-grade NAT
+// range used inside cloud VPCs
+var nonGlobalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space (CGNAT)
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and the broadcast address
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which can embed any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// checkTarget refuses connections to internal addresses unless they are allowed. It
+// runs after DNS resolution, so hostnames pointing inside the network are refused too.
+func (d *Dispatcher) checkTarget(network, address string, _ syscall.RawConn) error {
+	d.mu.Lock()
+	allowed := d.settings.AllowPrivateTargets
+	d.mu.Unlock()
+	if allowed {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errPrivateTarget
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	addr = addr.Unmap()
+	for _, prefix := range nonGlobalPrefixes {
+		if prefix.Contains(addr) {
+			return errPrivateTarget
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature header value of a webhook body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sleep waits for d, returning false when ctx is cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,176 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer answers with the given statuses in order, then 200, recording the requests
+type webhookServer struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, body)
+	if len(s.statuses) > 0 {
+		w.WriteHeader(s.statuses[0])
+		s.statuses = s.statuses[1:]
+	}
+}
+
+func newTestDispatcher(settings Settings) (*Dispatcher, *[]time.Duration) {
+	d := NewDispatcher(settings)
+	var waits []time.Duration
+	d.sleep = func(ctx context.Context, wait time.Duration) bool {
+		waits = append(waits, wait)
+		return true
+	}
+	return d, &waits
+}
+
+func testAlert(webhookURL string) Alert {
+	return Alert{
+		ID:         "alert-1",
+		CEP:        "01310100",
+		Condition:  Condition{Field: FieldTempC, Operator: OperatorGT, Value: 35},
+		WebhookURL: webhookURL,
+		Secret:     "secret",
+		Owner:      "erp",
+	}
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	hook := &webhookServer{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	d, _ := newTestDispatcher(Settings{MaxAttempts: 3, RetryBackoff: time.Second, Timeout: time.Second, AllowPrivateTargets: true})
+	d.Deliver(context.Background(), testAlert(server.URL), Payload{AlertID: "alert-1", CEP: "01310100", Value: 36})
+	d.Wait()
+
+	if len(hook.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(hook.requests))
+	}
+	req, body := hook.requests[0], hook.bodies[0]
+	if expected := Sign("secret", req.Header.Get(HeaderTimestamp), body); req.Header.Get(HeaderSignature) != expected {
+		t.Errorf("expected signature %s, got %s", expected, req.Header.Get(HeaderSignature))
+	}
+	if req.Header.Get(HeaderAlertID) != "alert-1" || req.Header.Get(HeaderDelivery) == "" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Value != 36 {
+		t.Errorf("unexpected payload %s", body)
+	}
+	if letters := d.DeadLetters("erp"); len(letters) != 0 {
+		t.Errorf("unexpected dead letters %+v", letters)
+	}
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	hook := &webhookServer{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	d, waits := newTestDispatcher(Settings{MaxAttempts: 5, RetryBackoff: time.Second, Timeout: time.Second, AllowPrivateTargets: true})
+	d.Deliver(context.Background(), testAlert(server.URL), Payload{AlertID: "alert-1"})
+	d.Wait()
+
+	if len(hook.requests) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(hook.requests))
+	}
+	if got := *waits; len(got) != 2 || got[0] != time.Second || got[1] != 2*time.Second {
+		t.Errorf("unexpected backoff %v", got)
+	}
+	delivery := hook.requests[0].Header.Get(HeaderDelivery)
+	for _, req := range hook.requests {
+		if req.Header.Get(HeaderDelivery) != delivery {
+			t.Error("expected retries to keep the delivery id")
+		}
+	}
+}
+
+func TestDispatcher_DeadLetters(t *testing.T) {
+	hook := &webhookServer{statuses: []int{500, 500, 500}}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	t.Run("failing webhook", func(t *testing.T) {
+		d, _ := newTestDispatcher(Settings{MaxAttempts: 3, RetryBackoff: time.Second, Timeout: time.Second, AllowPrivateTargets: true})
+		d.Deliver(context.Background(), testAlert(server.URL), Payload{AlertID: "alert-1"})
+		d.Wait()
+
+		letters := d.DeadLetters("erp")
+		if len(letters) != 1 || letters[0].Attempts != 3 || !strings.Contains(letters[0].LastError, "500") {
+			t.Fatalf("unexpected dead letters %+v", letters)
+		}
+		if other := d.DeadLetters("dashboard"); len(other) != 0 {
+			t.Errorf("expected dead letters to be scoped to their owner, got %+v", other)
+		}
+	})
+
+	t.Run("private target", func(t *testing.T) {
+		d, _ := newTestDispatcher(Settings{MaxAttempts: 1, RetryBackoff: time.Second, Timeout: time.Second})
+		d.Deliver(context.Background(), testAlert(server.URL), Payload{AlertID: "alert-1"})
+		d.Wait()
+
+		letters := d.DeadLetters("erp")
+		if len(letters) != 1 || !strings.Contains(letters[0].LastError, errPrivateTarget.Error()) {
+			t.Errorf("expected the loopback webhook to be refused, got %+v", letters)
+		}
+	})
+}
+
+func TestDispatcher_CheckTarget(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700::1111]:443", true},
+		{"127.0.0.1:80", false},
+		{"10.0.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"0.0.0.0:80", false},
+		{"0.1.2.3:80", false},
+		{"100.64.0.1:80", false},
+		{"100.127.255.254:80", false},
+		{"192.0.0.8:80", false},
+		{"192.0.2.10:80", false},
+		{"198.18.0.1:80", false},
+		{"198.19.255.254:80", false},
+		{"198.51.100.7:80", false},
+		{"203.0.113.7:80", false},
+		{"240.0.0.1:80", false},
+		{"255.255.255.255:80", false},
+		{"[::ffff:100.64.0.1]:80", false},
+		{"[64:ff9b::a00:1]:80", false},
+		{"[64:ff9b:1::1]:80", false},
+		{"[2001:db8::1]:80", false},
+		{"[fd00::1]:80", false},
+	}
+
+	d := NewDispatcher(Settings{MaxAttempts: 1, RetryBackoff: time.Second, Timeout: time.Second})
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := d.checkTarget("tcp", tt.address, nil)
+			if allowed := err == nil; allowed != tt.allowed {
+				t.Errorf("expected allowed %t, got error %v", tt.allowed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+)
+
+// Client describes an API client allowed to call the protected endpoints
+type Client struct {
+	Name         string
+	Key          string
+	DailyQuota   int
+	MonthlyQuota int
+	Disabled     bool
+}
+
+// Settings controls where the API key is read from
+type Settings struct {
+	Enabled    bool
+	Header     string
+	QueryParam string
+}
+
+// Usage is a snapshot of one client's consumption
+type Usage struct {
+	Name           string     `json:"name"`
+	Disabled       bool       `json:"disabled"`
+	DailyQuota     int        `json:"daily_quota"`
+	MonthlyQuota   int        `json:"monthly_quota"`
+	DailyUsage     int        `json:"daily_usage"`
+	MonthlyUsage   int        `json:"monthly_usage"`
+	TotalRequests  int        `json:"total_requests"`
+	RejectedQuota  int        `json:"rejected_quota"`
+	LastRequestAt  *time.Time `json:"last_request_at,omitempty"`
+	DailyResetAt   time.Time  `json:"daily_reset_at"`
+	MonthlyResetAt time.Time  `json:"monthly_reset_at"`
+}
+
+type counters struct {
+	day           time.Time
+	month         time.Time
+	daily         int
+	monthly       int
+	total         int
+	rejectedQuota int
+	lastRequestAt time.Time
+}
+
+type contextKey struct{}
+
+// ClientFromContext returns the client authenticated for the request, if any
+func ClientFromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(contextKey{}).(*Client)
+	return client, ok
+}
+
+// Authenticator checks API keys and enforces per-client quotas
+type Authenticator struct {
+	mu       sync.Mutex
+	settings Settings
+	clients  map[[sha256.Size]byte]*Client
+	usage    map[string]*counters
+	now      func() time.Time
+}
+
+// NewAuthenticator creates an authenticator for the given clients
+func NewAuthenticator(settings Settings, clients []Client) *Authenticator {
+	a := &Authenticator{
+		usage: make(map[string]*counters),
+		now:   time.Now,
+	}
+	a.Configure(settings, clients)
+	return a
+}
+
+// Configure replaces the settings and clients; usage counters are kept per client name
+func (a *Authenticator) Configure(settings Settings, clients []Client) {
+	byKey := make(map[[sha256.Size]byte]*Client, len(clients))
+	for i := range clients {
+		client := clients[i]
+		byKey[sha256.Sum256([]byte(client.Key))] = &client
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.settings = settings
+	a.clients = byKey
+}
+
+// Middleware rejects requests without a valid API key (401), from disabled clients (403)
+// or over quota (429), and stores the authenticated client in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		settings := a.settings
+		a.mu.Unlock()
+
+		if !settings.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := a.extractKey(r, settings)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", a.challenge(settings))
+			render.JSONError(w, http.StatusUnauthorized, "missing API key")
+			return
+		}
+
+		client, usage, err := a.consume(key)
+		switch err {
+		case nil:
+		case ErrUnknownKey:
+			w.Header().Set("WWW-Authenticate", a.challenge(settings))
+			render.JSONError(w, http.StatusUnauthorized, "invalid API key")
+			return
+		case ErrClientDisabled:
+			render.JSONError(w, http.StatusForbidden, "API key disabled")
+			return
+		case ErrDailyQuota:
+			setQuotaHeaders(w, client, usage)
+			w.Header().Set("Retry-After", retryAfter(a.now(), usage.DailyResetAt))
+			render.JSONError(w, http.StatusTooManyRequests, fmt.Sprintf("daily quota of %d requests exceeded", client.DailyQuota))
+			return
+		case ErrMonthlyQuota:
+			setQuotaHeaders(w, client, usage)
+			w.Header().Set("Retry-After", retryAfter(a.now(), usage.MonthlyResetAt))
+			render.JSONError(w, http.StatusTooManyRequests, fmt.Sprintf("monthly quota of %d requests exceeded", client.MonthlyQuota))
+			return
+		}
+
+		setQuotaHeaders(w, client, usage)
+		next.ServeHTTP(w, r.WithContext(ContextWithClient(r.Context(), client)))
+	})
+}
+
+// Identify returns the enabled client whose API key the request carries, without counting
+// the request against its quotas. It returns false when authentication is disabled.
+func (a *Authenticator) Identify(r *http.Request) (*Client, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.settings.Enabled {
+		return nil, false
+	}
+	key := a.extractKey(r, a.settings)
+	if key == "" {
+		return nil, false
+	}
+	client := a.lookup(key)
+	if client == nil || client.Disabled {
+		return nil, false
+	}
+	return client, true
+}
+
+// Usage returns a snapshot of every configured client's consumption, sorted by name
+func (a *Authenticator) Usage() []Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	usages := make([]Usage, 0, len(a.clients))
+	for _, client := range a.clients {
+		usages = append(usages, a.snapshot(client, a.counters(client.Name, now), now))
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Name < usages[j].Name
+	})
+	return usages
+}
+
+type authError string
+
+func (e authError) Error() string { return string(e) }
+
+// Errors returned by Authenticate
+const (
+	ErrMissingKey     authError = "missing API key"
+	ErrUnknownKey     authError = "unknown API key"
+	ErrClientDisabled authError = "client disabled"
+	ErrDailyQuota     authError = "daily quota exceeded"
+	ErrMonthlyQuota   authError = "monthly quota exceeded"
+)
+
+// Authenticate checks a key received outside of HTTP (e.g. gRPC metadata) and counts
+// the request against the client's quotas. It returns a nil client and no error when
+// authentication is disabled.
+func (a *Authenticator) Authenticate(key string) (*Client, error) {
+	a.mu.Lock()
+	enabled := a.settings.Enabled
+	a.mu.Unlock()
+
+	if !enabled {
+		return nil, nil
+	}
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+	client, _, err := a.consume(key)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// ContextWithClient returns a copy of ctx carrying the authenticated client
+func ContextWithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// consume looks the key up and counts the request against the client's quotas
+func (a *Authenticator) consume(key string) (*Client, Usage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	client := a.lookup(key)
+	if client == nil {
+		return nil, Usage{}, ErrUnknownKey
+	}
+	if client.Disabled {
+		return client, Usage{}, ErrClientDisabled
+	}
+
+	usage, err := a.charge(client)
+	return client, usage, err
+}
+
+// Charge counts one more request of an authenticated client against its quotas, for
+// requests that do the work of several (e.g. a GraphQL query over many CEPs). It returns
+// ErrDailyQuota or ErrMonthlyQuota, without counting, when the client is over quota.
+func (a *Authenticator) Charge(client *Client) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err := a.charge(client)
+	return err
+}
+
+// charge counts a request against the client's quotas; a.mu must be held
+func (a *Authenticator) charge(client *Client) (Usage, error) {
+	now := a.now()
+	c := a.counters(client.Name, now)
+	if client.DailyQuota > 0 && c.daily >= client.DailyQuota {
+		c.rejectedQuota++
+		return a.snapshot(client, c, now), ErrDailyQuota
+	}
+	if client.MonthlyQuota > 0 && c.monthly >= client.MonthlyQuota {
+		c.rejectedQuota++
+		return a.snapshot(client, c, now), ErrMonthlyQuota
+	}
+
+	c.daily++
+	c.monthly++
+	c.total++
+	c.lastRequestAt = now
+	return a.snapshot(client, c, now), nil
+}
+
+// lookup compares key hashes so lookups take the same time whatever the key
+func (a *Authenticator) lookup(key string) *Client {
+	sum := sha256.Sum256([]byte(key))
+	for hash, client := range a.clients {
+		if subtle.ConstantTimeCompare(hash[:], sum[:]) == 1 {
+			return client
+		}
+	}
+	return nil
+}
+
+// counters returns the client's counters, resetting them when a new day or month started (UTC)
+func (a *Authenticator) counters(name string, now time.Time) *counters {
+	c, ok := a.usage[name]
+	if !ok {
+		c = &counters{}
+		a.usage[name] = c
+	}
+
+	day, month := startOfDay(now), startOfMonth(now)
+	if !c.day.Equal(day) {
+		c.day, c.daily = day, 0
+	}
+	if !c.month.Equal(month) {
+		c.month, c.monthly = month, 0
+	}
+	return c
+}
+
+func (a *Authenticator) snapshot(client *Client, c *counters, now time.Time) Usage {
+	usage := Usage{
+		Name:           client.Name,
+		Disabled:       client.Disabled,
+		DailyQuota:     client.DailyQuota,
+		MonthlyQuota:   client.MonthlyQuota,
+		DailyUsage:     c.daily,
+		MonthlyUsage:   c.monthly,
+		TotalRequests:  c.total,
+		RejectedQuota:  c.rejectedQuota,
+		DailyResetAt:   startOfDay(now).AddDate(0, 0, 1),
+		MonthlyResetAt: startOfMonth(now).AddDate(0, 1, 0),
+	}
+	if !c.lastRequestAt.IsZero() {
+		lastRequestAt := c.lastRequestAt
+		usage.LastRequestAt = &lastRequestAt
+	}
+	return usage
+}
+
+func (a *Authenticator) extractKey(r *http.Request, settings Settings) string {
+	if settings.Header != "" {
+		if key := r.Header.Get(settings.Header); key != "" {
+			return key
+		}
+	}
+	if settings.QueryParam != "" {
+		return r.URL.Query().Get(settings.QueryParam)
+	}
+	return ""
+}
+
+func (a *Authenticator) challenge(settings Settings) string {
+	if settings.Header != "" {
+		return fmt.Sprintf(`ApiKey header=%q`, settings.Header)
+	}
+	return fmt.Sprintf(`ApiKey query=%q`, settings.QueryParam)
+}
+
+func setQuotaHeaders(w http.ResponseWriter, client *Client, usage Usage) {
+	if client.DailyQuota > 0 {
+		w.Header().Set("X-Quota-Daily-Limit", strconv.Itoa(client.DailyQuota))
+		w.Header().Set("X-Quota-Daily-Remaining", strconv.Itoa(max(client.DailyQuota-usage.DailyUsage, 0)))
+	}
+	if client.MonthlyQuota > 0 {
+		w.Header().Set("X-Quota-Monthly-Limit", strconv.Itoa(client.MonthlyQuota))
+		w.Header().Set("X-Quota-Monthly-Remaining", strconv.Itoa(max(client.MonthlyQuota-usage.MonthlyUsage, 0)))
+	}
+}
+
+func retryAfter(now, resetAt time.Time) string {
+	seconds := int(resetAt.Sub(now).Seconds() + 0.5)
+	return strconv.Itoa(max(seconds, 1))
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	year, month, _ := t.UTC().Date()
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+}
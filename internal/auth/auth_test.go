@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+func newTestAuthenticator(clients ...Client) *Authenticator {
+	return NewAuthenticator(Settings{Enabled: true, Header: "X-API-Key", QueryParam: "api_key"}, clients)
+}
+
+func serve(a *Authenticator, req *http.Request) (*httptest.ResponseRecorder, *Client) {
+	var seen *Client
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = ClientFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, seen
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		query          string
+		expectedStatus int
+		expectedMsg    string
+	}{
+		{
+			name:           "missing key",
+			expectedStatus: http.StatusUnauthorized,
+			expectedMsg:    "missing API key",
+		},
+		{
+			name:           "unknown key",
+			header:         "nope",
+			expectedStatus: http.StatusUnauthorized,
+			expectedMsg:    "invalid API key",
+		},
+		{
+			name:           "disabled client",
+			header:         "revoked-key",
+			expectedStatus: http.StatusForbidden,
+			expectedMsg:    "API key disabled",
+		},
+		{
+			name:           "valid key in header",
+			header:         "erp-key",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "valid key in query",
+			query:          "erp-key",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuthenticator(
+				Client{Name: "erp", Key: "erp-key"},
+				Client{Name: "old", Key: "revoked-key", Disabled: true},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/weather/01310100?api_key="+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+
+			rec, client := serve(a, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				if client == nil || client.Name != "erp" {
+					t.Errorf("expected client erp in context, got %+v", client)
+				}
+				return
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Message != tt.expectedMsg {
+				t.Errorf("expected message %q, got %q", tt.expectedMsg, response.Message)
+			}
+			if tt.expectedStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAuthenticator_Middleware_Disabled(t *testing.T) {
+	a := NewAuthenticator(Settings{Enabled: false}, nil)
+
+	rec, _ := serve(a, httptest.NewRequest(http.MethodGet, "/weather/01310100", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected requests to pass through when disabled, got %d", rec.Code)
+	}
+}
+
+func TestAuthenticator_Quotas(t *testing.T) {
+	t.Run("daily quota", func(t *testing.T) {
+		now := time.Date(2024, time.May, 10, 23, 0, 0, 0, time.UTC)
+		a := newTestAuthenticator(Client{Name: "erp", Key: "erp-key", DailyQuota: 2})
+		a.now = func() time.Time { return now }
+
+		request := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+			req.Header.Set("X-API-Key", "erp-key")
+			rec, _ := serve(a, req)
+			return rec
+		}
+
+		request()
+		rec := request()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected second request to pass, got %d", rec.Code)
+		}
+		if rec.Header().Get("X-Quota-Daily-Remaining") != "0" {
+			t.Errorf("expected 0 remaining, got %q", rec.Header().Get("X-Quota-Daily-Remaining"))
+		}
+
+		rec = request()
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status 429, got %d", rec.Code)
+		}
+		if rec.Header().Get("Retry-After") != "3600" {
+			t.Errorf("expected Retry-After 3600, got %q", rec.Header().Get("Retry-After"))
+		}
+
+		now = now.Add(2 * time.Hour)
+		if rec := request(); rec.Code != http.StatusOK {
+			t.Errorf("expected quota to reset the next day, got %d", rec.Code)
+		}
+
+		usage := a.Usage()
+		if usage[0].TotalRequests != 3 || usage[0].RejectedQuota != 1 || usage[0].DailyUsage != 1 {
+			t.Errorf("unexpected usage: %+v", usage[0])
+		}
+	})
+
+	t.Run("monthly quota", func(t *testing.T) {
+		a := newTestAuthenticator(Client{Name: "erp", Key: "erp-key", MonthlyQuota: 1})
+
+		for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+			req.Header.Set("X-API-Key", "erp-key")
+			if rec, _ := serve(a, req); rec.Code != expected {
+				t.Errorf("request %d: expected status %d, got %d", i, expected, rec.Code)
+			}
+		}
+	})
+
+	t.Run("usage survives reconfiguration", func(t *testing.T) {
+		a := newTestAuthenticator(Client{Name: "erp", Key: "erp-key", DailyQuota: 1})
+
+		req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+		req.Header.Set("X-API-Key", "erp-key")
+		serve(a, req)
+
+		// Rotating the key must not reset the client's quota
+		a.Configure(Settings{Enabled: true, Header: "X-API-Key"}, []Client{{Name: "erp", Key: "new-key", DailyQuota: 1}})
+
+		req = httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+		req.Header.Set("X-API-Key", "new-key")
+		if rec, _ := serve(a, req); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status 429, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAuthenticator_Charge(t *testing.T) {
+	a := newTestAuthenticator(Client{Name: "erp", Key: "erp-key", DailyQuota: 3})
+	client, err := a.Authenticate("erp-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []error{nil, nil, ErrDailyQuota} {
+		if err := a.Charge(client); err != expected {
+			t.Errorf("charge %d: expected %v, got %v", i, expected, err)
+		}
+	}
+	usage := a.Usage()
+	if usage[0].DailyUsage != 3 || usage[0].RejectedQuota != 1 {
+		t.Errorf("unexpected usage: %+v", usage[0])
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	a := newTestAuthenticator(
+		Client{Name: "erp", Key: "erp-key", DailyQuota: 1},
+		Client{Name: "legacy", Key: "legacy-key", Disabled: true},
+	)
+
+	tests := []struct {
+		name         string
+		key          string
+		expectedName string
+		wantErr      error
+	}{
+		{"valid key", "erp-key", "erp", nil},
+		{"quota exceeded", "erp-key", "", ErrDailyQuota},
+		{"missing key", "", "", ErrMissingKey},
+		{"unknown key", "nope", "", ErrUnknownKey},
+		{"disabled client", "legacy-key", "", ErrClientDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := a.Authenticate(tt.key)
+			if err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.expectedName != "" && (client == nil || client.Name != tt.expectedName) {
+				t.Errorf("expected client %q, got %+v", tt.expectedName, client)
+			}
+		})
+	}
+
+	disabled := NewAuthenticator(Settings{}, nil)
+	if client, err := disabled.Authenticate(""); client != nil || err != nil {
+		t.Errorf("expected no client and no error when disabled, got %+v, %v", client, err)
+	}
+}
+
+func TestAuthenticator_Identify(t *testing.T) {
+	a := newTestAuthenticator(
+		Client{Name: "erp", Key: "erp-key", DailyQuota: 1},
+		Client{Name: "legacy", Key: "legacy-key", Disabled: true},
+	)
+
+	tests := []struct {
+		name         string
+		target       string
+		key          string
+		expectedName string
+	}{
+		{"header", "/v1/weather/01310100", "erp-key", "erp"},
+		{"query parameter", "/v1/weather/01310100?api_key=erp-key", "", "erp"},
+		{"unknown key", "/v1/weather/01310100", "nope", ""},
+		{"disabled client", "/v1/weather/01310100", "legacy-key", ""},
+		{"missing key", "/v1/weather/01310100", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			client, ok := a.Identify(req)
+			if ok != (tt.expectedName != "") || (ok && client.Name != tt.expectedName) {
+				t.Errorf("expected client %q, got %+v, %t", tt.expectedName, client, ok)
+			}
+		})
+	}
+
+	// Identifying does not count against the quota
+	if _, err := a.Authenticate("erp-key"); err != nil {
+		t.Errorf("expected the daily quota untouched, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "erp-key")
+	if _, ok := NewAuthenticator(Settings{Header: "X-API-Key"}, []Client{{Name: "erp", Key: "erp-key"}}).Identify(req); ok {
+		t.Error("expected no client when authentication is disabled")
+	}
+}
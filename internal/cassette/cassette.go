@@ -0,0 +1,312 @@
+// Package cassette records upstream HTTP interactions to files and replays them, so
+// tests and demos can run offline against real ViaCEP and WeatherAPI payloads
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mode selects what a Transport does with the traffic
+type Mode string
+
+const (
+	// ModeOff sends every request upstream
+	ModeOff Mode = "off"
+	// ModeRecord sends requests upstream and saves each interaction to the cassette
+	ModeRecord Mode = "record"
+	// ModeReplay answers from the cassette and never contacts the upstream
+	ModeReplay Mode = "replay"
+)
+
+// ErrNoInteraction is returned when replaying a request the cassette does not have
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+// Redacted replaces secrets in recorded interactions
+const Redacted = "REDACTED"
+
+// secretParams are the query parameters scrubbed from recorded URLs; WeatherAPI takes
+// its key in "key"
+var secretParams = []string{"key", "api_key", "apikey", "token", "access_token"}
+
+// ignoredHeaders are response headers not worth recording: they change on every call or
+// no longer match the recorded body
+var ignoredHeaders = []string{"Date", "Set-Cookie", "Content-Length", "Content-Encoding", "Transfer-Encoding", "Connection"}
+
+// Interaction is a request and the response it got
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request identifies a recorded request; secrets in the URL are redacted
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// Response is a recorded response. JSON bodies are stored as JSON so cassettes are easy
+// to read and edit; anything else is stored as text in Body.
+type Response struct {
+	Status  int             `json:"status"`
+	Headers http.Header     `json:"headers,omitempty"`
+	JSON    json.RawMessage `json:"json,omitempty"`
+	Body    string          `json:"body,omitempty"`
+}
+
+// body returns the recorded body, JSON compacted as the upstreams send it
+func (r Response) body() []byte {
+	if len(r.JSON) > 0 {
+		var compact bytes.Buffer
+		if json.Compact(&compact, r.JSON) == nil {
+			return compact.Bytes()
+		}
+		return r.JSON
+	}
+	return []byte(r.Body)
+}
+
+// Cassette is the list of interactions stored in a file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Load reads a cassette file
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette atomically, creating its directory
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("saving cassette: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("saving cassette: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("saving cassette: %w", err)
+	}
+	return nil
+}
+
+// Transport is an http.RoundTripper that records to or replays from a cassette file.
+//
+// When replaying, requests are matched by method and URL (query parameters in any
+// order, secrets ignored). Interactions recorded several times for the same request are
+// returned in order, the last one repeating.
+//
+// When recording, the file is rewritten after every interaction. The first recording
+// of a request replaces what older sessions recorded for it, so re-recording refreshes
+// a cassette instead of growing it.
+type Transport struct {
+	mode Mode
+	path string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	// replayed counts the times each request was replayed; recorded marks the requests
+	// recorded by this session
+	replayed map[string]int
+	recorded map[string]bool
+}
+
+// NewTransport returns a transport in the given mode over next (http.DefaultTransport
+// when nil). Replaying requires the cassette file; recording starts from it when it exists.
+func NewTransport(mode Mode, path string, next http.RoundTripper) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &Transport{
+		mode:     mode,
+		path:     path,
+		next:     next,
+		cassette: &Cassette{},
+		replayed: make(map[string]int),
+		recorded: make(map[string]bool),
+	}
+
+	switch mode {
+	case ModeOff:
+	case ModeReplay:
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		t.cassette = c
+	case ModeRecord:
+		c, err := Load(path)
+		if err == nil {
+			t.cassette = c
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q", mode)
+	}
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch t.mode {
+	case ModeReplay:
+		return t.replay(req)
+	case ModeRecord:
+		return t.record(req)
+	default:
+		return t.next.RoundTrip(req)
+	}
+}
+
+func (t *Transport) replay(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := requestKey(req.Method, ScrubURL(req.URL))
+
+	t.mu.Lock()
+	var matches []int
+	for i, interaction := range t.cassette.Interactions {
+		if requestKey(interaction.Request.Method, interaction.Request.URL) == key {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w for %s %s in %s", ErrNoInteraction, req.Method, ScrubURL(req.URL), t.path)
+	}
+	n := t.replayed[key]
+	t.replayed[key]++
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	recorded := t.cassette.Interactions[matches[n]].Response
+	t.mu.Unlock()
+
+	body := recorded.body()
+	header := recorded.Headers.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Request:  Request{Method: req.Method, URL: ScrubURL(req.URL)},
+		Response: Response{Status: resp.StatusCode, Headers: resp.Header.Clone()},
+	}
+	for _, name := range ignoredHeaders {
+		interaction.Response.Headers.Del(name)
+	}
+	// Upstreams may echo the key back, in error messages for instance
+	recordedBody := body
+	for _, secret := range secrets(req.URL) {
+		recordedBody = bytes.ReplaceAll(recordedBody, []byte(secret), []byte(Redacted))
+	}
+	if json.Valid(recordedBody) {
+		interaction.Response.JSON = recordedBody
+	} else {
+		interaction.Response.Body = string(recordedBody)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := requestKey(interaction.Request.Method, interaction.Request.URL)
+	if !t.recorded[key] {
+		kept := t.cassette.Interactions[:0]
+		for _, old := range t.cassette.Interactions {
+			if requestKey(old.Request.Method, old.Request.URL) != key {
+				kept = append(kept, old)
+			}
+		}
+		t.cassette.Interactions = kept
+		t.recorded[key] = true
+	}
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	if err := t.cassette.Save(t.path); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ScrubURL returns the URL with secret query parameters redacted and the query sorted
+func ScrubURL(u *url.URL) string {
+	scrubbed := *u
+	query := scrubbed.Query()
+	for _, name := range secretParams {
+		if query.Has(name) {
+			query.Set(name, Redacted)
+		}
+	}
+	scrubbed.RawQuery = query.Encode()
+	return scrubbed.String()
+}
+
+// secrets returns the values of the secret query parameters of a URL
+func secrets(u *url.URL) []string {
+	var values []string
+	query := u.Query()
+	for _, name := range secretParams {
+		for _, value := range query[name] {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// requestKey identifies a request regardless of the order of its query parameters
+func requestKey(method, rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		u.RawQuery = u.Query().Encode()
+		rawURL = u.String()
+	}
+	return strings.ToUpper(method) + " " + rawURL
+}
@@ -0,0 +1,147 @@
+package cassette
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// get sends a GET through the transport and returns the status and body
+func get(t *testing.T, transport http.RoundTripper, target string) (int, string) {
+	t.Helper()
+	resp, err := (&http.Client{Transport: transport}).Get(target)
+	if err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestTransport_RecordAndReplay(t *testing.T) {
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=1")
+		if r.URL.Query().Get("q") == "nowhere" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":{"code":1006,"message":"No matching location found for key %s."}}`, r.URL.Query().Get("key"))
+			return
+		}
+		fmt.Fprintf(w, `{"q":%q,"call":%d}`, r.URL.Query().Get("q"), n)
+	}))
+	defer upstream.Close()
+	path := filepath.Join(t.TempDir(), "cassettes", "weather.json")
+
+	recorder, err := NewTransport(ModeRecord, path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status, body := get(t, recorder, upstream.URL+"/current.json?key=secret-key&q=Campinas"); status != 200 || body != `{"q":"Campinas","call":1}` {
+		t.Fatalf("expected the upstream response while recording, got %d %s", status, body)
+	}
+	get(t, recorder, upstream.URL+"/current.json?q=Campinas&key=secret-key")
+	if status, _ := get(t, recorder, upstream.URL+"/current.json?key=secret-key&q=nowhere"); status != 400 {
+		t.Fatalf("expected errors to be recorded as they are, got %d", status)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected the cassette to be written: %v", err)
+	}
+	if strings.Contains(string(data), "secret-key") || !strings.Contains(string(data), "key="+Redacted) {
+		t.Errorf("expected the API key to be scrubbed from the cassette:\n%s", data)
+	}
+	if strings.Contains(string(data), "Set-Cookie") {
+		t.Errorf("expected volatile headers to be dropped:\n%s", data)
+	}
+
+	// Replaying never reaches the upstream, whatever the key, and keeps the recorded order
+	upstream.Close()
+	replayer, err := NewTransport(ModeReplay, path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`{"q":"Campinas","call":1}`, `{"q":"Campinas","call":2}`, `{"q":"Campinas","call":2}`} {
+		if status, body := get(t, replayer, upstream.URL+"/current.json?q=Campinas&key=other-key"); status != 200 || body != want {
+			t.Errorf("expected %s, got %d %s", want, status, body)
+		}
+	}
+	status, body := get(t, replayer, upstream.URL+"/current.json?key=k&q=nowhere")
+	if status != 400 || !strings.Contains(body, "for key REDACTED") {
+		t.Errorf("expected the scrubbed error, got %d %s", status, body)
+	}
+
+	_, err = (&http.Client{Transport: replayer}).Get(upstream.URL + "/current.json?q=Santos")
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction for an unrecorded request, got %v", err)
+	}
+}
+
+func TestTransport_RecordReplacesOlderSessions(t *testing.T) {
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "call %d", calls.Add(1))
+	}))
+	defer upstream.Close()
+	path := filepath.Join(t.TempDir(), "viacep.json")
+
+	first, _ := NewTransport(ModeRecord, path, nil)
+	get(t, first, upstream.URL+"/ws/01310100/json/")
+	get(t, first, upstream.URL+"/ws/20040020/json/")
+
+	second, err := NewTransport(ModeRecord, path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get(t, second, upstream.URL+"/ws/01310100/json/")
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Interactions) != 2 {
+		t.Fatalf("expected the re-recorded request to replace the old one, got %+v", c.Interactions)
+	}
+	if c.Interactions[0].Response.Body != "call 2" || c.Interactions[1].Response.Body != "call 3" {
+		t.Errorf("expected text bodies to be kept as text, got %+v", c.Interactions)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewTransport(ModeReplay, filepath.Join(dir, "missing.json"), nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected replaying a missing cassette to fail, got %v", err)
+	}
+	if _, err := NewTransport(ModeRecord, filepath.Join(dir, "missing.json"), nil); err != nil {
+		t.Errorf("expected recording to start a new cassette, got %v", err)
+	}
+	if _, err := NewTransport("rewind", filepath.Join(dir, "missing.json"), nil); err == nil {
+		t.Error("expected an unknown mode to fail")
+	}
+
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte("{"), 0o600)
+	if _, err := NewTransport(ModeRecord, broken, nil); err == nil {
+		t.Error("expected a corrupt cassette to fail")
+	}
+}
+
+func TestScrubURL(t *testing.T) {
+	u, _ := url.Parse("https://api.weatherapi.com/v1/current.json?q=S%C3%A3o+Paulo&key=abc&days=3")
+	if got, want := ScrubURL(u), "https://api.weatherapi.com/v1/current.json?days=3&key=REDACTED&q=S%C3%A3o+Paulo"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if u.RawQuery != "q=S%C3%A3o+Paulo&key=abc&days=3" {
+		t.Errorf("expected the original URL to be left alone, got %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,238 @@
+// Package chaos injects latency, timeouts, connection resets, error statuses and
+// truncated bodies into the upstream calls and the API responses, to test how the
+// service copes with failures. The server only wires it in binaries built with the
+// chaos tag.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault types
+const (
+	// FaultLatency delays the request by Latency
+	FaultLatency = "latency"
+	// FaultTimeout hangs until the caller gives up, or for Latency when set
+	FaultTimeout = "timeout"
+	// FaultReset drops the connection
+	FaultReset = "reset"
+	// FaultStatus answers with Status instead of the real response
+	FaultStatus = "status"
+	// FaultTruncate cuts the body after Bytes and breaks the connection
+	FaultTruncate = "truncate"
+)
+
+// Defaults of the fault parameters
+const (
+	DefaultStatus = 503
+	DefaultBytes  = 32
+	// DefaultHang bounds a timeout fault of a caller without a deadline
+	DefaultHang = 30 * time.Second
+)
+
+// Fault is a failure injected into a share of the requests
+type Fault struct {
+	Type string
+	// Probability is the share of requests affected, from 0 to 1
+	Probability float64
+	// Upstream restricts an upstream fault to the named client; empty matches all
+	Upstream string
+	// PathPrefix restricts a server fault to the paths under it; empty matches all
+	PathPrefix string
+	Latency    time.Duration
+	Status     int
+	Bytes      int
+}
+
+func (f Fault) status() int {
+	if f.Status == 0 {
+		return DefaultStatus
+	}
+	return f.Status
+}
+
+func (f Fault) bytes() int {
+	if f.Bytes == 0 {
+		return DefaultBytes
+	}
+	return f.Bytes
+}
+
+func (f Fault) hang() time.Duration {
+	if f.Latency == 0 {
+		return DefaultHang
+	}
+	return f.Latency
+}
+
+// Settings controls which faults are injected
+type Settings struct {
+	Enabled bool
+	// Header names the request header that triggers faults; empty disables triggers
+	Header string
+	// Upstream faults apply to the calls made through Transport
+	Upstream []Fault
+	// Server faults apply to the responses of Middleware
+	Server []Fault
+}
+
+// Injector holds the fault settings shared by the transports and the middleware
+type Injector struct {
+	mu       sync.RWMutex
+	settings Settings
+	// random draws the fault probabilities; replaced in tests
+	random func() float64
+}
+
+// New creates an injector with the given settings
+func New(settings Settings) *Injector {
+	i := &Injector{random: rand.Float64}
+	i.Configure(settings)
+	return i
+}
+
+// Configure replaces the settings; requests already delayed keep their faults
+func (i *Injector) Configure(settings Settings) {
+	settings.Upstream = append([]Fault(nil), settings.Upstream...)
+	settings.Server = append([]Fault(nil), settings.Server...)
+	i.mu.Lock()
+	i.settings = settings
+	i.mu.Unlock()
+}
+
+func (i *Injector) current() Settings {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.settings
+}
+
+// pick draws the faults that apply to a request: the sum of the latencies and the first
+// other fault that fires, nil when none does
+func (i *Injector) pick(faults []Fault, matches func(Fault) bool) (time.Duration, *Fault) {
+	var delay time.Duration
+	var fault *Fault
+	for n := range faults {
+		f := faults[n]
+		if !matches(f) || i.random() >= f.Probability {
+			continue
+		}
+		if f.Type == FaultLatency {
+			delay += f.Latency
+		} else if fault == nil {
+			fault = &f
+		}
+	}
+	return delay, fault
+}
+
+// ParseHeader reads the faults requested by a trigger header: a comma-separated list of
+// "type[=value]", where value is the latency or hang duration, the status code or the
+// bytes kept. A "viacep:", "weather:" or "upstream:" prefix aims the fault at the
+// upstream calls the request makes instead of its response. Triggered faults always fire.
+func ParseHeader(value string) (server, upstream []Fault, err error) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		scope, spec, scoped := strings.Cut(item, ":")
+		if !scoped {
+			spec = item
+		}
+		fault, err := parseFault(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !scoped {
+			server = append(server, fault)
+			continue
+		}
+		switch scope {
+		case "upstream":
+		case "viacep", "weather":
+			fault.Upstream = scope
+		default:
+			return nil, nil, fmt.Errorf("unknown fault target %q", scope)
+		}
+		upstream = append(upstream, fault)
+	}
+	return server, upstream, nil
+}
+
+func parseFault(spec string) (Fault, error) {
+	name, value, hasValue := strings.Cut(spec, "=")
+	fault := Fault{Type: name, Probability: 1}
+	switch name {
+	case FaultLatency, FaultTimeout:
+		if !hasValue {
+			if name == FaultLatency {
+				return Fault{}, fmt.Errorf("%s needs a duration, e.g. latency=500ms", name)
+			}
+			return fault, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return Fault{}, fmt.Errorf("invalid %s duration %q", name, value)
+		}
+		fault.Latency = d
+	case FaultStatus:
+		if !hasValue {
+			return fault, nil
+		}
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 400 || status > 599 {
+			return Fault{}, fmt.Errorf("invalid status %q", value)
+		}
+		fault.Status = status
+	case FaultTruncate:
+		if !hasValue {
+			return fault, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return Fault{}, fmt.Errorf("invalid truncate size %q", value)
+		}
+		fault.Bytes = n
+	case FaultReset:
+		if hasValue {
+			return Fault{}, fmt.Errorf("%s takes no value", name)
+		}
+	default:
+		return Fault{}, fmt.Errorf("unknown fault %q", name)
+	}
+	return fault, nil
+}
+
+type upstreamFaultsKey struct{}
+
+// withUpstreamFaults carries the upstream faults triggered by a request to the
+// transports of the calls it makes
+func withUpstreamFaults(ctx context.Context, faults []Fault) context.Context {
+	return context.WithValue(ctx, upstreamFaultsKey{}, faults)
+}
+
+func upstreamFaults(ctx context.Context) []Fault {
+	faults, _ := ctx.Value(upstreamFaultsKey{}).([]Fault)
+	return faults
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
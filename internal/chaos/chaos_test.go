@@ -0,0 +1,118 @@
+package chaos
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixed returns an injector whose probability draws always return draw
+func fixed(settings Settings, draw float64) *Injector {
+	i := New(settings)
+	i.random = func() float64 { return draw }
+	return i
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		wantServer   []Fault
+		wantUpstream []Fault
+		wantErr      string
+	}{
+		{
+			name:       "server faults",
+			value:      "latency=200ms, status=502",
+			wantServer: []Fault{{Type: FaultLatency, Probability: 1, Latency: 200 * time.Millisecond}, {Type: FaultStatus, Probability: 1, Status: 502}},
+		},
+		{
+			name:         "upstream faults",
+			value:        "weather:timeout=1s,upstream:reset,viacep:truncate=10",
+			wantUpstream: []Fault{{Type: FaultTimeout, Probability: 1, Upstream: "weather", Latency: time.Second}, {Type: FaultReset, Probability: 1}, {Type: FaultTruncate, Probability: 1, Upstream: "viacep", Bytes: 10}},
+		},
+		{
+			name:         "defaults",
+			value:        "status, truncate, viacep:timeout",
+			wantServer:   []Fault{{Type: FaultStatus, Probability: 1}, {Type: FaultTruncate, Probability: 1}},
+			wantUpstream: []Fault{{Type: FaultTimeout, Probability: 1, Upstream: "viacep"}},
+		},
+		{name: "unknown fault", value: "explode", wantErr: `unknown fault "explode"`},
+		{name: "unknown target", value: "ibge:reset", wantErr: `unknown fault target "ibge"`},
+		{name: "latency without a duration", value: "latency", wantErr: "needs a duration"},
+		{name: "invalid duration", value: "latency=soon", wantErr: "invalid latency duration"},
+		{name: "success status", value: "status=200", wantErr: "invalid status"},
+		{name: "reset with a value", value: "reset=1", wantErr: "takes no value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, upstream, err := ParseHeader(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(server, tt.wantServer) {
+				t.Errorf("expected server faults %+v, got %+v", tt.wantServer, server)
+			}
+			if !reflect.DeepEqual(upstream, tt.wantUpstream) {
+				t.Errorf("expected upstream faults %+v, got %+v", tt.wantUpstream, upstream)
+			}
+		})
+	}
+}
+
+func TestInjector_Pick(t *testing.T) {
+	faults := []Fault{
+		{Type: FaultLatency, Probability: 0.5, Latency: 100 * time.Millisecond},
+		{Type: FaultLatency, Probability: 1, Latency: 50 * time.Millisecond},
+		{Type: FaultStatus, Probability: 0.3, Status: 502},
+		{Type: FaultReset, Probability: 1, Upstream: "viacep"},
+		{Type: FaultStatus, Probability: 1, Status: 500},
+	}
+	all := func(Fault) bool { return true }
+
+	tests := []struct {
+		name       string
+		draw       float64
+		matches    func(Fault) bool
+		wantDelay  time.Duration
+		wantFault  string
+		wantStatus int
+	}{
+		{"every fault fires", 0, all, 150 * time.Millisecond, FaultStatus, 502},
+		{"only certain faults fire", 0.6, all, 50 * time.Millisecond, FaultReset, 0},
+		{"filtered", 0.6, func(f Fault) bool { return f.Upstream == "" }, 50 * time.Millisecond, FaultStatus, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, fault := fixed(Settings{}, tt.draw).pick(faults, tt.matches)
+			if delay != tt.wantDelay {
+				t.Errorf("expected delay %v, got %v", tt.wantDelay, delay)
+			}
+			if fault == nil || fault.Type != tt.wantFault || fault.Status != tt.wantStatus {
+				t.Errorf("expected a %s fault with status %d, got %+v", tt.wantFault, tt.wantStatus, fault)
+			}
+		})
+	}
+
+	if delay, fault := fixed(Settings{}, 0.99).pick(faults[:1], all); delay != 0 || fault != nil {
+		t.Errorf("expected nothing to fire, got %v and %+v", delay, fault)
+	}
+}
+
+func TestInjector_ConfigureCopiesFaults(t *testing.T) {
+	faults := []Fault{{Type: FaultReset, Probability: 1}}
+	i := New(Settings{Enabled: true, Server: faults})
+	faults[0].Type = FaultStatus
+	if got := i.current().Server[0].Type; got != FaultReset {
+		t.Errorf("expected the configured fault to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !chaos
+
+package chaos
+
+// Compiled reports whether the binary was built with the chaos tag, the only builds in
+// which the server injects faults
+const Compiled = false
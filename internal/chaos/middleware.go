@@ -0,0 +1,111 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+)
+
+// errTruncated is returned to handlers writing past a truncate fault
+var errTruncated = errors.New("chaos: response truncated")
+
+// Middleware injects the server faults into the responses of next, and hands the
+// upstream faults triggered by the request to the transports of the calls it makes
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := i.current()
+		if !settings.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		faults := settings.Server
+		if value := r.Header.Get(settings.Header); settings.Header != "" && value != "" {
+			server, upstream, err := ParseHeader(value)
+			if err != nil {
+				render.JSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s header: %v", settings.Header, err))
+				return
+			}
+			faults = append(append([]Fault(nil), faults...), server...)
+			if len(upstream) > 0 {
+				r = r.WithContext(withUpstreamFaults(r.Context(), upstream))
+			}
+		}
+
+		delay, fault := i.pick(faults, func(f Fault) bool {
+			return strings.HasPrefix(r.URL.Path, f.PathPrefix)
+		})
+		if sleep(r.Context(), delay) != nil {
+			return
+		}
+		if fault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch fault.Type {
+		case FaultTimeout:
+			if sleep(r.Context(), fault.hang()) != nil {
+				return
+			}
+			render.JSONError(w, http.StatusGatewayTimeout, "chaos: injected timeout")
+		case FaultReset:
+			reset(w)
+		case FaultStatus:
+			render.JSONError(w, fault.status(), fmt.Sprintf("chaos: injected status %d", fault.status()))
+		case FaultTruncate:
+			tw := &truncatingWriter{ResponseWriter: w, remaining: fault.bytes()}
+			next.ServeHTTP(tw, r)
+			http.NewResponseController(w).Flush()
+			// Abort without ending the body, so the client sees it cut short
+			panic(http.ErrAbortHandler)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// reset closes the connection without a response, as an RST when it is TCP
+func reset(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// HTTP/2 streams can't be hijacked; aborting resets the stream instead
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// truncatingWriter lets the first bytes of the response through and fails the rest
+type truncatingWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (t *truncatingWriter) Write(b []byte) (int, error) {
+	if t.remaining <= 0 {
+		return 0, errTruncated
+	}
+	if len(b) > t.remaining {
+		n, err := t.ResponseWriter.Write(b[:t.remaining])
+		t.remaining = 0
+		if err == nil {
+			err = errTruncated
+		}
+		return n, err
+	}
+	n, err := t.ResponseWriter.Write(b)
+	t.remaining -= n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (t *truncatingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
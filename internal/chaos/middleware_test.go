@@ -0,0 +1,188 @@
+package chaos
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const body = `{"temp_C":25,"temp_F":77,"temp_K":298,"location":{"city":"São Paulo","uf":"SP"}}`
+
+// serve runs the middleware of the injector in front of a handler that answers body and
+// reports the upstream faults it received in X-Upstream-Faults
+func serve(injector *Injector) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var types []string
+		for _, f := range upstreamFaults(r.Context()) {
+			types = append(types, f.Upstream+":"+f.Type)
+		}
+		w.Header().Set("X-Upstream-Faults", strings.Join(types, ","))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+	return httptest.NewServer(injector.Middleware(handler))
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		settings      Settings
+		header        string
+		path          string
+		wantStatus    int
+		wantBody      string
+		wantUpstream  string
+		wantReadError bool
+		wantConnError bool
+	}{
+		{
+			name:       "disabled ignores the header",
+			settings:   Settings{Header: "X-Chaos"},
+			header:     "status=500",
+			wantStatus: http.StatusOK,
+			wantBody:   body,
+		},
+		{
+			name:       "configured status",
+			settings:   Settings{Enabled: true, Server: []Fault{{Type: FaultStatus, Probability: 1, Status: 502}}},
+			wantStatus: http.StatusBadGateway,
+			wantBody:   `{"message":"chaos: injected status 502"}`,
+		},
+		{
+			name:       "other path",
+			settings:   Settings{Enabled: true, Server: []Fault{{Type: FaultStatus, Probability: 1, PathPrefix: "/v2"}}},
+			path:       "/v1/weather/01310100",
+			wantStatus: http.StatusOK,
+			wantBody:   body,
+		},
+		{
+			name:       "triggered status",
+			settings:   Settings{Enabled: true, Header: "X-Chaos"},
+			header:     "status",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "header triggers disabled",
+			settings:   Settings{Enabled: true},
+			header:     "status",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid header",
+			settings:   Settings{Enabled: true, Header: "X-Chaos"},
+			header:     "explode",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"message":"invalid X-Chaos header: unknown fault \"explode\""}`,
+		},
+		{
+			name:         "upstream faults reach the handler",
+			settings:     Settings{Enabled: true, Header: "X-Chaos"},
+			header:       "weather:timeout, upstream:reset",
+			wantStatus:   http.StatusOK,
+			wantUpstream: "weather:timeout,:reset",
+		},
+		{
+			name:       "timeout",
+			settings:   Settings{Enabled: true, Header: "X-Chaos"},
+			header:     "timeout=20ms",
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:          "reset",
+			settings:      Settings{Enabled: true, Header: "X-Chaos"},
+			header:        "reset",
+			wantConnError: true,
+		},
+		{
+			name:          "truncate",
+			settings:      Settings{Enabled: true, Header: "X-Chaos"},
+			header:        "truncate=12",
+			wantStatus:    http.StatusOK,
+			wantBody:      body[:12],
+			wantReadError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := serve(fixed(tt.settings, 0))
+			defer server.Close()
+
+			path := tt.path
+			if path == "" {
+				path = "/v2/weather/01310100"
+			}
+			req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Chaos", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if tt.wantConnError {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("expected the connection to be dropped")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if tt.wantReadError != (err != nil) {
+				t.Errorf("expected a read error: %t, got %v", tt.wantReadError, err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(string(got)) != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, got)
+			}
+			if upstream := resp.Header.Get("X-Upstream-Faults"); upstream != tt.wantUpstream {
+				t.Errorf("expected upstream faults %q, got %q", tt.wantUpstream, upstream)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Probability(t *testing.T) {
+	settings := Settings{Enabled: true, Server: []Fault{{Type: FaultStatus, Probability: 0.25}}}
+
+	for _, tt := range []struct {
+		draw       float64
+		wantStatus int
+	}{
+		{0.1, http.StatusServiceUnavailable},
+		{0.5, http.StatusOK},
+	} {
+		server := serve(fixed(settings, tt.draw))
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		server.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("draw %.1f: expected status %d, got %d", tt.draw, tt.wantStatus, resp.StatusCode)
+		}
+	}
+}
+
+func TestMiddleware_LatencyStopsWithTheClient(t *testing.T) {
+	server := serve(fixed(Settings{Enabled: true, Server: []Fault{{Type: FaultLatency, Probability: 1, Latency: time.Minute}}}, 0))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the client to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the client timeout to end the request, took %v", elapsed)
+	}
+}
@@ -0,0 +1,116 @@
+package chaos
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Transport returns an http.RoundTripper over next (http.DefaultTransport when nil)
+// injecting the upstream faults meant for the named upstream: the configured ones and
+// those triggered by the request being served
+func (i *Injector) Transport(upstream string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{injector: i, upstream: upstream, next: next}
+}
+
+type transport struct {
+	injector *Injector
+	upstream string
+	next     http.RoundTripper
+}
+
+// timeoutError is returned by a timeout fault of a caller without a deadline
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "chaos: injected timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	settings := t.injector.current()
+	if !settings.Enabled {
+		return t.next.RoundTrip(req)
+	}
+
+	faults := append(append([]Fault(nil), settings.Upstream...), upstreamFaults(req.Context())...)
+	delay, fault := t.injector.pick(faults, func(f Fault) bool {
+		return f.Upstream == "" || f.Upstream == t.upstream
+	})
+	if err := sleep(req.Context(), delay); err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	if fault == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	switch fault.Type {
+	case FaultTimeout:
+		closeBody(req)
+		if err := sleep(req.Context(), fault.hang()); err != nil {
+			return nil, err
+		}
+		return nil, timeoutError{}
+	case FaultReset:
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case FaultStatus:
+		closeBody(req)
+		return statusResponse(req, fault.status()), nil
+	case FaultTruncate:
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return truncate(resp, fault.bytes())
+	}
+	return t.next.RoundTrip(req)
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func statusResponse(req *http.Request, status int) *http.Response {
+	body := fmt.Sprintf("chaos: injected status %d\n", status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// truncate keeps the first n bytes of the body, at most half of it, and then fails the
+// read as a connection dropped mid-response does
+func truncate(resp *http.Response, n int) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if n > len(body)/2 {
+		n = len(body) / 2
+	}
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body[:n]), errReader{io.ErrUnexpectedEOF}))
+	return resp, nil
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
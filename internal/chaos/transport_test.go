@@ -0,0 +1,151 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTransport(t *testing.T) {
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"localidade":"São Paulo","uf":"SP","ibge":"3550308"}`))
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name      string
+		settings  Settings
+		ctx       context.Context
+		timeout   time.Duration
+		wantErr   func(error) bool
+		wantCode  int
+		wantBody  string
+		wantCalls int64
+	}{
+		{
+			name:      "disabled",
+			settings:  Settings{Upstream: []Fault{{Type: FaultReset, Probability: 1}}},
+			wantCode:  http.StatusOK,
+			wantBody:  `{"localidade":"São Paulo","uf":"SP","ibge":"3550308"}`,
+			wantCalls: 1,
+		},
+		{
+			name:      "other upstream",
+			settings:  Settings{Enabled: true, Upstream: []Fault{{Type: FaultReset, Probability: 1, Upstream: "weather"}}},
+			wantCode:  http.StatusOK,
+			wantCalls: 1,
+		},
+		{
+			name:     "reset",
+			settings: Settings{Enabled: true, Upstream: []Fault{{Type: FaultReset, Probability: 1, Upstream: "viacep"}}},
+			wantErr:  func(err error) bool { return errors.Is(err, syscall.ECONNRESET) },
+		},
+		{
+			name:     "status",
+			settings: Settings{Enabled: true, Upstream: []Fault{{Type: FaultStatus, Probability: 1, Status: 429}}},
+			wantCode: http.StatusTooManyRequests,
+			wantBody: "chaos: injected status 429\n",
+		},
+		{
+			name:     "timeout of a client with a deadline",
+			settings: Settings{Enabled: true, Upstream: []Fault{{Type: FaultTimeout, Probability: 1}}},
+			timeout:  50 * time.Millisecond,
+			wantErr: func(err error) bool {
+				var netErr net.Error
+				return errors.As(err, &netErr) && netErr.Timeout()
+			},
+		},
+		{
+			name:     "timeout bounded by the fault",
+			settings: Settings{Enabled: true, Upstream: []Fault{{Type: FaultTimeout, Probability: 1, Latency: 10 * time.Millisecond}}},
+			wantErr:  func(err error) bool { return errors.Is(err, timeoutError{}) },
+		},
+		{
+			name:      "truncate",
+			settings:  Settings{Enabled: true, Upstream: []Fault{{Type: FaultTruncate, Probability: 1, Bytes: 10}}},
+			wantCode:  http.StatusOK,
+			wantBody:  `{"localida`,
+			wantCalls: 1,
+			wantErr:   func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) },
+		},
+		{
+			name:      "triggered by the request",
+			settings:  Settings{Enabled: true},
+			ctx:       withUpstreamFaults(context.Background(), []Fault{{Type: FaultStatus, Probability: 1, Upstream: "viacep"}}),
+			wantCode:  http.StatusServiceUnavailable,
+			wantCalls: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			client := &http.Client{Transport: New(tt.settings).Transport("viacep", nil), Timeout: tt.timeout}
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/ws/01310100/json/", nil)
+
+			resp, err := client.Do(req)
+			var body []byte
+			if err == nil {
+				body, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantCode {
+					t.Errorf("expected status %d, got %d", tt.wantCode, resp.StatusCode)
+				}
+				if tt.wantBody != "" && string(body) != tt.wantBody {
+					t.Errorf("expected body %q, got %q", tt.wantBody, body)
+				}
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && (err == nil || !tt.wantErr(err)) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestTransport_Latency(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	injector := New(Settings{Enabled: true, Upstream: []Fault{{Type: FaultLatency, Probability: 1, Latency: 50 * time.Millisecond}}})
+	client := &http.Client{Transport: injector.Transport("weather", nil)}
+
+	start := time.Now()
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the call to take at least 50ms, took %v", elapsed)
+	}
+
+	injector.Configure(Settings{})
+	start = time.Now()
+	resp, err = client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("expected no latency after disabling, took %v", elapsed)
+	}
+}
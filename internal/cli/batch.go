@@ -0,0 +1,521 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// batchOptions are the flags of batch besides the resolver ones
+type batchOptions struct {
+	input           string
+	inputFormat     string
+	column          string
+	output          string
+	checkpoint      string
+	checkpointEvery int
+	resume          bool
+	concurrency     int
+	progress        time.Duration
+}
+
+// batch enriches a CSV or JSONL file with the temperature of the CEP of each record
+func batch(args []string, env Env) int {
+	var opts lookupOptions
+	var b batchOptions
+	fs := newFlagSet("batch", "[input file, default stdin]", env)
+	opts.register(fs, env)
+	fs.Float64Var(&opts.rate, "rate", 0, "maximum calls per second to each upstream, or to the remote instance (0 means unlimited)")
+	fs.StringVar(&b.inputFormat, "input-format", "", "csv or jsonl (default from the file extension, csv for stdin)")
+	fs.StringVar(&b.column, "column", "cep", "CSV column or JSON field holding the CEP")
+	fs.StringVar(&b.output, "output", "", "output file (default stdout); required for checkpoints")
+	fs.StringVar(&b.checkpoint, "checkpoint", "", "checkpoint file (default <output>.checkpoint)")
+	fs.IntVar(&b.checkpointEvery, "checkpoint-every", 1000, "records written between checkpoints")
+	fs.BoolVar(&b.resume, "resume", false, "continue after the records saved in the checkpoint")
+	fs.IntVar(&b.concurrency, "concurrency", 8, "simultaneous lookups")
+	fs.DurationVar(&b.progress, "progress", 5*time.Second, "interval between progress reports on stderr (0 disables them)")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExit(err)
+	}
+
+	b.input = "-"
+	if len(files) == 1 {
+		b.input = files[0]
+	}
+	if err := b.validate(len(files)); err != nil {
+		fmt.Fprintf(env.Stderr, "batch: %v\n", err)
+		fs.Usage()
+		return ExitUsage
+	}
+	units, err := parseUnits(opts.units)
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitUsage
+	}
+	r, err := opts.resolver(env)
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+
+	// An interrupted batch stops reading, writes what is in flight and saves a checkpoint
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	job := &batchJob{opts: b, resolver: newSharedResolver(r), units: units, timeout: opts.timeout, stdin: env.Stdin, stdout: env.Stdout, stderr: env.Stderr}
+	return job.run(ctx)
+}
+
+func (b *batchOptions) validate(files int) error {
+	if files > 1 {
+		return errors.New("at most one input file is accepted")
+	}
+	switch b.inputFormat {
+	case "":
+		b.inputFormat = FormatCSV
+		if ext := strings.ToLower(filepath.Ext(b.input)); ext == ".jsonl" || ext == ".ndjson" {
+			b.inputFormat = FormatJSONL
+		}
+	case FormatCSV, FormatJSONL:
+	default:
+		return fmt.Errorf("unknown input format %q: use csv or jsonl", b.inputFormat)
+	}
+	if b.concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	if b.checkpointEvery < 1 {
+		return errors.New("checkpoint-every must be at least 1")
+	}
+	if b.output == "" && (b.resume || b.checkpoint != "") {
+		return errors.New("checkpoints require an output file")
+	}
+	if b.output != "" && b.checkpoint == "" {
+		b.checkpoint = b.output + ".checkpoint"
+	}
+	return nil
+}
+
+// checkpoint records how much of the input has been written, so an interrupted batch
+// can resume without looking the same records up again
+type checkpoint struct {
+	Input string `json:"input"`
+	// Records is the number of input records written to the output
+	Records int64 `json:"records"`
+	Failed  int64 `json:"failed"`
+	// OutputBytes is the size of the output after those records; anything after it is
+	// discarded on resume
+	OutputBytes int64     `json:"output_bytes"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the checkpoint: %w", err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("reading the checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// save writes the checkpoint atomically
+func (cp *checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("saving the checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("saving the checkpoint: %w", err)
+	}
+	return nil
+}
+
+// sharedResolver makes concurrent lookups of the same CEP share one call, as the caches
+// only help once the first lookup has finished
+type sharedResolver struct {
+	next resolver
+
+	mu    sync.Mutex
+	calls map[string]*sharedCall
+}
+
+type sharedCall struct {
+	done   chan struct{}
+	result *reading
+	err    error
+}
+
+func newSharedResolver(next resolver) *sharedResolver {
+	return &sharedResolver{next: next, calls: make(map[string]*sharedCall)}
+}
+
+func (s *sharedResolver) Resolve(ctx context.Context, cep string) (*reading, error) {
+	key := services.NormalizeCEP(cep)
+	s.mu.Lock()
+	if call, ok := s.calls[key]; ok {
+		s.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &sharedCall{done: make(chan struct{})}
+	s.calls[key] = call
+	s.mu.Unlock()
+
+	call.result, call.err = s.next.Resolve(ctx, cep)
+	s.mu.Lock()
+	delete(s.calls, key)
+	s.mu.Unlock()
+	close(call.done)
+	return call.result, call.err
+}
+
+// countingWriter tracks the size of the output
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// batchJob is one run of the batch command
+type batchJob struct {
+	opts     batchOptions
+	resolver resolver
+	units    []unit
+	timeout  time.Duration
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+
+	// resumed holds the totals of the previous runs when resuming
+	resumed checkpoint
+	written atomic.Int64
+	failed  atomic.Int64
+	errors  map[string]int
+}
+
+// reportedFailures is how many failed records are listed individually on stderr
+const reportedFailures = 10
+
+func (j *batchJob) run(ctx context.Context) int {
+	if j.opts.resume {
+		cp, err := loadCheckpoint(j.opts.checkpoint)
+		if err != nil {
+			fmt.Fprintln(j.stderr, err)
+			return ExitFailure
+		}
+		if cp.Input != j.opts.input {
+			fmt.Fprintf(j.stderr, "the checkpoint is for %s, not %s\n", cp.Input, j.opts.input)
+			return ExitFailure
+		}
+		j.resumed = *cp
+	}
+
+	input := j.stdin
+	if j.opts.input != "-" {
+		file, err := os.Open(j.opts.input)
+		if err != nil {
+			fmt.Fprintln(j.stderr, err)
+			return ExitFailure
+		}
+		defer file.Close()
+		input = file
+	}
+
+	output, err := j.openOutput()
+	if err != nil {
+		fmt.Fprintln(j.stderr, err)
+		return ExitFailure
+	}
+	if closer, ok := output.w.(io.Closer); ok && j.opts.output != "" {
+		defer closer.Close()
+	}
+
+	reader, writer, err := j.open(input, output)
+	if err != nil {
+		fmt.Fprintln(j.stderr, err)
+		return ExitFailure
+	}
+	for i := int64(0); i < j.resumed.Records; i++ {
+		if _, err := reader.Read(); err != nil {
+			fmt.Fprintf(j.stderr, "skipping the %d records of the checkpoint: %v\n", j.resumed.Records, err)
+			return ExitFailure
+		}
+	}
+
+	save := func() error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if j.opts.checkpoint == "" {
+			return nil
+		}
+		cp := checkpoint{
+			Input:       j.opts.input,
+			Records:     j.resumed.Records + j.written.Load(),
+			Failed:      j.resumed.Failed + j.failed.Load(),
+			OutputBytes: output.n,
+			UpdatedAt:   time.Now().UTC(),
+		}
+		return cp.save(j.opts.checkpoint)
+	}
+
+	started := time.Now()
+	stopProgress := j.reportProgress(started)
+	completed, err := j.process(ctx, reader, writer, save)
+	stopProgress()
+
+	if completed && err == nil {
+		err = writer.Flush()
+		if err == nil && j.opts.checkpoint != "" {
+			if removeErr := os.Remove(j.opts.checkpoint); removeErr != nil && !os.IsNotExist(removeErr) {
+				err = removeErr
+			}
+		}
+	} else if saveErr := save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	j.summarize(time.Since(started))
+	switch {
+	case err != nil:
+		fmt.Fprintln(j.stderr, err)
+		return ExitFailure
+	case !completed:
+		fmt.Fprintln(j.stderr, "batch: interrupted; run again with -resume to continue")
+		return ExitFailure
+	case j.failed.Load() > 0:
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// openOutput opens the output, truncated to the checkpoint when resuming
+func (j *batchJob) openOutput() (*countingWriter, error) {
+	if j.opts.output == "" {
+		return &countingWriter{w: j.stdout}, nil
+	}
+	if !j.opts.resume {
+		file, err := os.Create(j.opts.output)
+		if err != nil {
+			return nil, err
+		}
+		return &countingWriter{w: file}, nil
+	}
+
+	file, err := os.OpenFile(j.opts.output, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(j.resumed.OutputBytes); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(j.resumed.OutputBytes, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &countingWriter{w: file, n: j.resumed.OutputBytes}, nil
+}
+
+// open creates the reader and writer of the input format
+func (j *batchJob) open(input io.Reader, output io.Writer) (rowReader, rowWriter, error) {
+	if j.opts.inputFormat == FormatJSONL {
+		return newJSONLReader(input, j.opts.column), newJSONLWriter(output, j.units), nil
+	}
+	reader, err := newCSVReader(input, j.opts.column)
+	if err != nil {
+		return nil, nil, err
+	}
+	writer, err := newCSVWriter(output, reader.header, j.units, !j.opts.resume)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, writer, nil
+}
+
+// process looks the records up concurrently and writes them in input order, saving a
+// checkpoint every checkpointEvery records. It reports whether the whole input was read.
+func (j *batchJob) process(ctx context.Context, reader rowReader, writer rowWriter, save func() error) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// pending holds the records in input order and bounds how many are in flight
+	work := make(chan *row)
+	pending := make(chan *row, j.opts.concurrency*16)
+	var completed bool
+	var readErr error
+	go func() {
+		defer close(pending)
+		defer close(work)
+		for ctx.Err() == nil {
+			r, err := reader.Read()
+			if err == io.EOF {
+				completed = true
+				return
+			}
+			if err != nil {
+				readErr = fmt.Errorf("reading the input: %w", err)
+				return
+			}
+			r.done = make(chan struct{})
+			pending <- r
+			work <- r
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < j.opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				j.resolve(r)
+				close(r.done)
+			}
+		}()
+	}
+
+	var writeErr error
+	for r := range pending {
+		<-r.done
+		if writeErr != nil {
+			continue
+		}
+		if err := writer.Write(r); err != nil {
+			writeErr = fmt.Errorf("writing the output: %w", err)
+			cancel()
+			continue
+		}
+		j.record(r)
+		if j.written.Load()%int64(j.opts.checkpointEvery) == 0 {
+			if err := save(); err != nil {
+				writeErr = err
+				cancel()
+			}
+		}
+	}
+	wg.Wait()
+
+	if writeErr != nil {
+		return false, writeErr
+	}
+	return completed, readErr
+}
+
+func (j *batchJob) resolve(r *row) {
+	if r.cep == "" {
+		r.err = errMissingCEP
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+	r.result, r.err = j.resolver.Resolve(ctx, r.cep)
+}
+
+// record counts a written record; only the writer goroutine calls it
+func (j *batchJob) record(r *row) {
+	j.written.Add(1)
+	if r.err == nil {
+		return
+	}
+	if j.errors == nil {
+		j.errors = make(map[string]int)
+	}
+	j.errors[r.err.Error()]++
+	if failed := j.failed.Add(1); failed <= reportedFailures {
+		fmt.Fprintf(j.stderr, "line %d: %s: %v\n", r.line, r.cep, r.err)
+	}
+}
+
+// reportProgress prints the progress every interval until the returned func is called
+func (j *batchJob) reportProgress(started time.Time) func() {
+	if j.opts.progress <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(j.opts.progress)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				written := j.written.Load()
+				fmt.Fprintf(j.stderr, "batch: %d records written, %d failed, %.1f records/s\n",
+					j.resumed.Records+written, j.resumed.Failed+j.failed.Load(), rate(written, time.Since(started)))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// summarize prints the totals and the most frequent errors of this run
+func (j *batchJob) summarize(elapsed time.Duration) {
+	written, failed := j.written.Load(), j.failed.Load()
+	fmt.Fprintf(j.stderr, "batch: %d records in %s (%.1f records/s): %d enriched, %d failed\n",
+		written, elapsed.Round(time.Millisecond), rate(written, elapsed), written-failed, failed)
+	if j.resumed.Records > 0 {
+		fmt.Fprintf(j.stderr, "batch: resumed after %d records (%d failed); %d records in total\n",
+			j.resumed.Records, j.resumed.Failed, j.resumed.Records+written)
+	}
+
+	messages := make([]string, 0, len(j.errors))
+	for message := range j.errors {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(a, b int) bool {
+		if j.errors[messages[a]] != j.errors[messages[b]] {
+			return j.errors[messages[a]] > j.errors[messages[b]]
+		}
+		return messages[a] < messages[b]
+	})
+	for i, message := range messages {
+		if i == reportedFailures {
+			fmt.Fprintf(j.stderr, "  ... %d more distinct errors\n", len(messages)-i)
+			break
+		}
+		fmt.Fprintf(j.stderr, "  %d × %s\n", j.errors[message], message)
+	}
+}
+
+func rate(count int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(count) / elapsed.Seconds()
+}
@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatch_CSV(t *testing.T) {
+	u := newUpstreams(t)
+	input := "id,name,CEP\n" +
+		"1,Paulista,01310-100\n" +
+		"2,Centro,20040020\n" +
+		"3,Unknown,99999-999\n" +
+		"4,Empty,\n" +
+		"5,\"Paulista, again\",01310100\n"
+
+	env, stdout, stderr := testEnv(u.vars, input)
+	code := Run([]string{"batch", "-units", "C,F", "-concurrency", "3", "-progress", "0"}, env)
+	if code != ExitFailure {
+		t.Errorf("expected exit code 1 for the failed records, got %d", code)
+	}
+
+	want := "id,name,CEP,temp_c,temp_f,error\n" +
+		"1,Paulista,01310-100,25,77,\n" +
+		"2,Centro,20040020,30,86,\n" +
+		"3,Unknown,99999-999,,,can not find zipcode\n" +
+		"4,Empty,,,,missing CEP\n" +
+		"5,\"Paulista, again\",01310100,25,77,\n"
+	if stdout.String() != want {
+		t.Errorf("expected output\n%s\ngot\n%s", want, stdout)
+	}
+	if calls := u.viaCEPCalls.Load(); calls != 3 {
+		t.Errorf("expected the repeated CEP to come from the cache, got %d ViaCEP calls", calls)
+	}
+	for _, line := range []string{
+		"line 4: 99999-999: can not find zipcode",
+		"line 5: : missing CEP",
+		"batch: 5 records in",
+		"3 enriched, 2 failed",
+		"  1 × can not find zipcode",
+	} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Errorf("expected stderr to contain %q, got %q", line, stderr)
+		}
+	}
+}
+
+func TestBatch_JSONL(t *testing.T) {
+	u := newUpstreams(t)
+	path := filepath.Join(t.TempDir(), "stores.jsonl")
+	input := `{"store":"Paulista","cep":"01310-100"}` + "\n\n" +
+		`{"cep":20040020,"tags":["rio"]}` + "\n" +
+		`{}` + "\n"
+	if err := os.WriteFile(path, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env, stdout, stderr := testEnv(u.vars, "")
+	if code := Run([]string{"batch", path, "-units", "K", "-progress", "0"}, env); code != ExitFailure {
+		t.Errorf("expected exit code 1, got %d (stderr %q)", code, stderr)
+	}
+
+	want := `{"store":"Paulista","cep":"01310-100","temp_k":298}` + "\n" +
+		`{"cep":20040020,"tags":["rio"],"temp_k":303}` + "\n" +
+		`{"temp_k":null,"error":"missing CEP"}` + "\n"
+	if stdout.String() != want {
+		t.Errorf("expected output\n%s\ngot\n%s", want, stdout)
+	}
+}
+
+func TestBatch_Resume(t *testing.T) {
+	u := newUpstreams(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "stores.csv")
+	output := filepath.Join(dir, "enriched.csv")
+	os.WriteFile(input, []byte("cep\n01310-100\n20040-020\n"), 0o600)
+
+	// A previous run wrote the first record, and part of the second after its last checkpoint
+	written := "cep,temp_c,error\n01310-100,25,\n"
+	os.WriteFile(output, []byte(written+"20040-0"), 0o600)
+	cp := checkpoint{Input: input, Records: 1, OutputBytes: int64(len(written))}
+	if err := cp.save(output + ".checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+
+	env, _, stderr := testEnv(u.vars, "")
+	if code := Run([]string{"batch", input, "-output", output, "-units", "C", "-resume", "-progress", "0"}, env); code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr)
+	}
+
+	got, _ := os.ReadFile(output)
+	if want := written + "20040-020,30,\n"; string(got) != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+	if calls := u.viaCEPCalls.Load(); calls != 1 {
+		t.Errorf("expected only the second record to be looked up, got %d ViaCEP calls", calls)
+	}
+	if _, err := os.Stat(output + ".checkpoint"); !os.IsNotExist(err) {
+		t.Errorf("expected the checkpoint to be removed once the input is done, got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "resumed after 1 records") {
+		t.Errorf("expected the resumed records in the summary, got %q", stderr)
+	}
+}
+
+func TestBatch_Checkpoints(t *testing.T) {
+	u := newUpstreams(t)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "enriched.csv")
+
+	// Without -resume an existing checkpoint is ignored and the output rewritten
+	os.WriteFile(output+".checkpoint", []byte(`{"input":"-","records":5}`), 0o600)
+	env, _, stderr := testEnv(u.vars, "cep\n01310100\n01310100\n20040020\n")
+	if code := Run([]string{"batch", "-output", output, "-checkpoint-every", "2", "-progress", "0"}, env); code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr)
+	}
+	got, _ := os.ReadFile(output)
+	if lines := strings.Count(string(got), "\n"); lines != 4 {
+		t.Errorf("expected a header and 3 records, got %q", got)
+	}
+	if _, err := os.Stat(output + ".checkpoint"); !os.IsNotExist(err) {
+		t.Errorf("expected no checkpoint after a complete run, got %v", err)
+	}
+
+	// An interrupted run saves a checkpoint to resume from
+	input := filepath.Join(dir, "stores.csv")
+	os.WriteFile(input, []byte("cep\n01310100\n"), 0o600)
+	env, _, stderr = testEnv(u.vars, "")
+	r, err := (&lookupOptions{timeout: time.Second}).resolver(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &batchJob{
+		opts:     batchOptions{input: input, inputFormat: FormatCSV, column: "cep", output: output, checkpoint: output + ".checkpoint", checkpointEvery: 1, concurrency: 1},
+		resolver: r,
+		units:    allUnits[:1],
+		timeout:  time.Second,
+		stderr:   stderr,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if code := job.run(ctx); code != ExitFailure || !strings.Contains(stderr.String(), "interrupted") {
+		t.Fatalf("expected the interrupted run to fail, got %d (stderr %q)", code, stderr)
+	}
+	cp, err := loadCheckpoint(output + ".checkpoint")
+	if err != nil || cp.Records != 0 || cp.OutputBytes != int64(len("cep,temp_c,error\n")) {
+		t.Fatalf("expected a checkpoint after the header, got %+v (%v)", cp, err)
+	}
+
+	env, _, stderr = testEnv(u.vars, "")
+	if code := Run([]string{"batch", input, "-output", output, "-units", "C", "-resume", "-progress", "0"}, env); code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr)
+	}
+	if got, _ := os.ReadFile(output); string(got) != "cep,temp_c,error\n01310100,25,\n" {
+		t.Errorf("unexpected resumed output %q", got)
+	}
+}
+
+func TestBatch_Errors(t *testing.T) {
+	u := newUpstreams(t)
+	missing := filepath.Join(t.TempDir(), "missing.csv")
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantCode   int
+		wantStderr string
+	}{
+		{"column not found", []string{"-column", "zip"}, "id,cep\n1,01310100\n", ExitFailure, `column "zip" not found`},
+		{"empty input", nil, "", ExitFailure, "the input is empty"},
+		{"malformed CSV", nil, "cep\n\"01310100\n", ExitFailure, "reading the input"},
+		{"malformed JSONL", []string{"-input-format", "jsonl"}, "[1]\n", ExitFailure, "line 1"},
+		{"missing input", []string{missing}, "", ExitFailure, "no such file"},
+		{"two inputs", []string{"a.csv", "b.csv"}, "", ExitUsage, "at most one input file"},
+		{"unknown format", []string{"-input-format", "xlsx"}, "", ExitUsage, `unknown input format "xlsx"`},
+		{"resume without output", []string{"-resume"}, "", ExitUsage, "checkpoints require an output file"},
+		{"resume without checkpoint", []string{"-resume", "-output", filepath.Join(t.TempDir(), "out.csv")}, "", ExitFailure, "reading the checkpoint"},
+		{"no concurrency", []string{"-concurrency", "0"}, "", ExitUsage, "concurrency must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, _, stderr := testEnv(u.vars, tt.stdin)
+			if code := Run(append([]string{"batch", "-progress", "0"}, tt.args...), env); code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d (stderr %q)", tt.wantCode, code, stderr)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Package cli implements the weather-by-cep subcommands
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Env is what a command reads from and writes to
+type Env struct {
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	LookupEnv func(string) (string, bool)
+}
+
+// Exit codes
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, env Env) int
+}
+
+var commands = []command{
+	{"serve", "start the HTTP and gRPC API (default)", serve},
+	{"lookup", "print the weather of one or more CEPs", lookup},
+	{"batch", "add the temperature to the records of a CSV or JSONL file", batch},
+	{"validate", "check a configuration and exit", validate},
+	{"mock-upstreams", "serve fake ViaCEP and WeatherAPI endpoints for offline use", mockUpstreams},
+	{"loadtest", "measure the latency and throughput of a running instance", loadTest},
+}
+
+// Run executes the subcommand named by args[0] and returns the exit code. Without a
+// subcommand, or when args start with a flag, the API is served as before subcommands
+// existed.
+func Run(args []string, env Env) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serve(args, env)
+	}
+
+	name := args[0]
+	if name == "help" {
+		usage(env.Stdout)
+		return ExitOK
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args[1:], env)
+		}
+	}
+
+	fmt.Fprintf(env.Stderr, "unknown command %q\n\n", name)
+	usage(env.Stderr)
+	return ExitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: weather-by-cep <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-15s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "weather-by-cep <command> -h" for the flags of a command.`)
+}
+
+// newFlagSet creates the flag set of a subcommand, printing its usage to stderr
+func newFlagSet(name, arguments string, env Env) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(env.Stderr, "Usage: weather-by-cep %s [flags] %s\n\nFlags:\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses flags placed before, between or after the positional arguments,
+// so "lookup 01310-100 -format json" works, and returns the positional arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// Everything after "--" is positional
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// flagExit maps a flag parsing error to the exit code of the command
+func flagExit(err error) int {
+	if err == flag.ErrHelp {
+		return ExitOK
+	}
+	return ExitUsage
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testEnv returns an environment reading the given variables and capturing the output
+func testEnv(vars map[string]string, stdin string) (Env, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	return Env{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		LookupEnv: func(key string) (string, bool) {
+			v, ok := vars[key]
+			return v, ok
+		},
+	}, &stdout, &stderr
+}
+
+// upstreams fakes ViaCEP and WeatherAPI: 01310100 is in São Paulo at 25 °C, 20040020 in
+// Rio de Janeiro at 30 °C and every other CEP is unknown
+type upstreams struct {
+	vars        map[string]string
+	viaCEPCalls atomic.Int64
+}
+
+func newUpstreams(t *testing.T) *upstreams {
+	t.Helper()
+	u := &upstreams{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/", func(w http.ResponseWriter, r *http.Request) {
+		u.viaCEPCalls.Add(1)
+		switch r.URL.Path {
+		case "/ws/01310100/json/":
+			w.Write([]byte(`{"cep":"01310-100","localidade":"São Paulo","uf":"SP"}`))
+		case "/ws/20040020/json/":
+			w.Write([]byte(`{"cep":"20040-020","localidade":"Rio de Janeiro","uf":"RJ"}`))
+		default:
+			w.Write([]byte(`{"erro":true}`))
+		}
+	})
+	mux.HandleFunc("/v1/current.json", func(w http.ResponseWriter, r *http.Request) {
+		temp := 25
+		if r.URL.Query().Get("q") == "Rio de Janeiro" {
+			temp = 30
+		}
+		fmt.Fprintf(w, `{"location":{"name":%q},"current":{"temp_c":%d,"last_updated_epoch":1773144000}}`, r.URL.Query().Get("q"), temp)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u.vars = map[string]string{
+		"VIACEP_BASE_URL":  server.URL + "/ws",
+		"WEATHER_BASE_URL": server.URL + "/v1",
+		"WEATHER_API_KEY":  "test-key",
+	}
+	return u
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"help", []string{"help"}, ExitOK, "lookup", ""},
+		{"unknown command", []string{"forecast"}, ExitUsage, "", `unknown command "forecast"`},
+		{"command help", []string{"lookup", "-h"}, ExitOK, "", "Usage: weather-by-cep lookup"},
+		{"serve prints the configuration", []string{"serve", "-print-config", "-weather-api-key", "secret"}, ExitOK, "weather", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, stdout, stderr := testEnv(nil, "")
+			if code := Run(tt.args, env); code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d (stderr %q)", tt.wantCode, code, stderr)
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("expected stdout to contain %q, got %q", tt.wantStdout, stdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	env, _, _ := testEnv(nil, "")
+	fs := newFlagSet("lookup", "<cep>...", env)
+	format := fs.String("format", "text", "")
+
+	args, err := parseFlags(fs, []string{"01310-100", "-format", "json", "20040-020", "--", "-30000"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *format != "json" {
+		t.Errorf("expected the flag after the first CEP to be parsed, got %q", *format)
+	}
+	if strings.Join(args, " ") != "01310-100 20040-020 -30000" {
+		t.Errorf("unexpected positional arguments %q", args)
+	}
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/loadtest"
+	"github.com/lhespanhol/weather-by-cep/internal/mockupstream"
+)
+
+// loadTest drives a running instance with concurrent weather requests and reports the
+// latency percentiles, throughput and errors. Interrupting it prints the report so far.
+func loadTest(args []string, env Env) int {
+	fs := newFlagSet("loadtest", "", env)
+	target, _ := env.LookupEnv("WEATHER_BY_CEP_URL")
+	if target == "" {
+		target = "http://localhost:8080"
+	}
+	apiKey, _ := env.LookupEnv("WEATHER_BY_CEP_API_KEY")
+	var opts loadtest.Options
+	var cepsFile, apiKeyHeader, format string
+	var progress time.Duration
+	fs.StringVar(&opts.Target, "target", target, "URL of the instance to test (env WEATHER_BY_CEP_URL)")
+	fs.StringVar(&opts.Path, "path", loadtest.DefaultPath, "path requested, with {cep} replaced by each CEP")
+	fs.IntVar(&opts.Concurrency, "concurrency", 16, "requests in flight at most")
+	fs.Float64Var(&opts.Rate, "rate", 0, "requests per second across all workers (0: as fast as the workers go)")
+	fs.DurationVar(&opts.Duration, "duration", 30*time.Second, "how long to send requests (0: until -requests are sent)")
+	fs.IntVar(&opts.Requests, "requests", 0, "stop after this many requests (0: no limit)")
+	fs.StringVar(&cepsFile, "ceps", "", "file with one CEP per line, most requested first (default: the CEPs of the mock upstreams)")
+	fs.StringVar(&opts.Distribution, "distribution", loadtest.Uniform, "how the CEPs are picked: uniform or zipf")
+	fs.Float64Var(&opts.ZipfS, "zipf-s", 1.1, "exponent of the zipf distribution, greater than 1; higher concentrates on the first CEPs")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "timeout of each request")
+	fs.Int64Var(&opts.Seed, "seed", 0, "seed of the CEP sequence, to repeat a test (0: random)")
+	fs.StringVar(&apiKey, "api-key", apiKey, "API key sent with each request (env WEATHER_BY_CEP_API_KEY)")
+	fs.StringVar(&apiKeyHeader, "api-key-header", "X-API-Key", "header carrying the API key")
+	fs.StringVar(&format, "format", FormatText, "report format: text or json")
+	fs.DurationVar(&progress, "progress", 5*time.Second, "interval of the progress lines on stderr (0: none)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExit(err)
+	}
+	if len(positional) > 0 {
+		fmt.Fprintf(env.Stderr, "unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return ExitUsage
+	}
+	if format != FormatText && format != FormatJSON {
+		fmt.Fprintf(env.Stderr, "unknown format %q: use text or json\n", format)
+		return ExitUsage
+	}
+
+	if cepsFile != "" {
+		if opts.CEPs, err = loadtest.LoadCEPs(cepsFile); err != nil {
+			fmt.Fprintln(env.Stderr, err)
+			return ExitFailure
+		}
+	} else {
+		opts.CEPs = fixtureCEPs()
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	if apiKey != "" {
+		opts.Header = http.Header{}
+		opts.Header.Set(apiKeyHeader, apiKey)
+	}
+	if progress > 0 {
+		opts.ProgressInterval = progress
+		opts.Progress = func(p loadtest.Progress) {
+			fmt.Fprintf(env.Stderr, "loadtest: %s elapsed, %d requests, %d failed, %d in flight\n",
+				p.Elapsed.Round(time.Second), p.Requests, p.Failed, p.InFlight)
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := loadtest.Run(ctx, opts, nil)
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+
+	if format == FormatJSON {
+		encoder := json.NewEncoder(env.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(env.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// fixtureCEPs returns the CEPs served by the built-in mock upstreams, in a stable order
+func fixtureCEPs() []string {
+	fixture := mockupstream.DefaultFixture()
+	ceps := make([]string, 0, len(fixture.CEPs))
+	for cep := range fixture.CEPs {
+		ceps = append(ceps, cep)
+	}
+	sort.Strings(ceps)
+	return ceps
+}
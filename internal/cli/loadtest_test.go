@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/loadtest"
+)
+
+func TestLoadTest_Flags(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "ceps.txt")
+	os.WriteFile(invalid, []byte("01310100\nabc\n"), 0o600)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"invalid CEPs file", []string{"-ceps", invalid}, ExitFailure, `invalid CEP "abc"`},
+		{"unknown format", []string{"-format", "table"}, ExitUsage, `unknown format "table"`},
+		{"unknown distribution", []string{"-distribution", "normal"}, ExitUsage, "distribution must be uniform or zipf"},
+		{"no bounds", []string{"-duration", "0"}, ExitUsage, "a duration or a number of requests is required"},
+		{"unexpected argument", []string{"01310100"}, ExitUsage, "unexpected arguments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, _, stderr := testEnv(nil, "")
+			if code := Run(append([]string{"loadtest"}, tt.args...), env); code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d (stderr %q)", tt.wantCode, code, stderr)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestLoadTest_Reports(t *testing.T) {
+	var requests, unauthorized atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("X-Key") != "secret" {
+			unauthorized.Add(1)
+		}
+		if !strings.HasPrefix(r.URL.Path, "/v2/weather/") {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	vars := map[string]string{"WEATHER_BY_CEP_URL": server.URL, "WEATHER_BY_CEP_API_KEY": "secret"}
+
+	env, stdout, stderr := testEnv(vars, "")
+	args := []string{"loadtest", "-requests", "20", "-path", "/v2/weather/{cep}", "-api-key-header", "X-Key", "-format", "json"}
+	if code := Run(args, env); code != ExitOK {
+		t.Fatalf("expected exit code %d, got %d (stderr %q)", ExitOK, code, stderr)
+	}
+	var report loadtest.Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON report: %v\n%s", err, stdout)
+	}
+	if report.Requests != 20 || report.Succeeded != 20 || report.Concurrency != 16 || report.CEPs != len(fixtureCEPs()) {
+		t.Errorf("report = %+v", report)
+	}
+	if requests.Load() != 20 || unauthorized.Load() != 0 {
+		t.Errorf("served %d requests, %d without the API key", requests.Load(), unauthorized.Load())
+	}
+
+	env, stdout, _ = testEnv(vars, "")
+	if code := Run([]string{"loadtest", "-requests", "5", "-concurrency", "1"}, env); code != ExitOK {
+		t.Fatalf("expected exit code %d, got %d", ExitOK, code)
+	}
+	for _, want := range []string{"Requests:    5 in", "5 failed", "Errors:\n  5 × HTTP 404 Not Found\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected the text report to contain %q, got:\n%s", want, stdout)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/config"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// Output formats
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatTable = "table"
+)
+
+// reading is the weather of a CEP, whether looked up in-process or by a remote instance
+type reading struct {
+	CEP        string
+	City       string
+	State      string
+	Celsius    float64
+	Fahrenheit float64
+	Kelvin     float64
+	ObservedAt time.Time
+}
+
+// resolver fetches the current weather of a CEP
+type resolver interface {
+	Resolve(ctx context.Context, cep string) (*reading, error)
+}
+
+// localResolver looks CEPs up with the same services the API uses
+type localResolver struct {
+	lookup *services.Lookup
+}
+
+func (r localResolver) Resolve(ctx context.Context, cep string) (*reading, error) {
+	result, err := r.lookup.ByCEP(ctx, cep)
+	if err != nil {
+		return nil, err
+	}
+	c, f, k := result.Temperatures()
+	return &reading{
+		CEP:        services.FormatCEP(result.CEP),
+		City:       result.Location.Localidade,
+		State:      result.Location.UF,
+		Celsius:    c,
+		Fahrenheit: f,
+		Kelvin:     k,
+		ObservedAt: result.ObservedAt,
+	}, nil
+}
+
+// remoteResolver asks a running instance through GET /v2/weather/{cep}
+type remoteResolver struct {
+	baseURL      string
+	apiKeyHeader string
+	apiKey       string
+	client       *http.Client
+}
+
+func (r remoteResolver) Resolve(ctx context.Context, cep string) (*reading, error) {
+	target := strings.TrimSuffix(r.baseURL, "/") + "/v2/weather/" + url.PathEscape(services.NormalizeCEP(cep))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set(r.apiKeyHeader, r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body models.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Message != "" {
+			return nil, fmt.Errorf("%s (%s)", body.Message, resp.Status)
+		}
+		return nil, fmt.Errorf("remote instance returned %s", resp.Status)
+	}
+
+	var body models.WeatherResponseV2
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding the remote response: %w", err)
+	}
+	result := &reading{
+		CEP:        body.Location.CEP,
+		City:       body.Location.City,
+		State:      body.Location.State,
+		Celsius:    body.Temperature.Celsius,
+		Fahrenheit: body.Temperature.Fahrenheit,
+		Kelvin:     body.Temperature.Kelvin,
+	}
+	if body.ObservedAt != nil {
+		result.ObservedAt = *body.ObservedAt
+	}
+	return result, nil
+}
+
+// lookupOptions are the flags of lookup; batch shares those selecting the resolver
+type lookupOptions struct {
+	configFile   string
+	remote       string
+	apiKey       string
+	apiKeyHeader string
+	format       string
+	units        string
+	timeout      time.Duration
+	// rate caps the calls per second to each upstream, or to the remote instance
+	rate float64
+}
+
+func (o *lookupOptions) register(fs *flag.FlagSet, env Env) {
+	remote, _ := env.LookupEnv("WEATHER_BY_CEP_URL")
+	apiKey, _ := env.LookupEnv("WEATHER_BY_CEP_API_KEY")
+	fs.StringVar(&o.configFile, "config", "", "config file of the in-process lookup (env CONFIG_FILE)")
+	fs.StringVar(&o.remote, "remote", remote, "URL of a running instance to query instead of looking up in-process (env WEATHER_BY_CEP_URL)")
+	fs.StringVar(&o.apiKey, "api-key", apiKey, "API key sent to the remote instance (env WEATHER_BY_CEP_API_KEY)")
+	fs.StringVar(&o.apiKeyHeader, "api-key-header", "X-API-Key", "header carrying the API key")
+	fs.StringVar(&o.units, "units", "C,F,K", "comma-separated temperature units to print: C, F, K")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "timeout of each lookup")
+}
+
+// printer validates the output flags and returns the printer they select
+func (o *lookupOptions) printer() (printer, error) {
+	switch o.format {
+	case FormatText, FormatJSON, FormatTable:
+	default:
+		return printer{}, fmt.Errorf("unknown format %q: use text, json or table", o.format)
+	}
+	units, err := parseUnits(o.units)
+	if err != nil {
+		return printer{}, err
+	}
+	return printer{format: o.format, units: units}, nil
+}
+
+// resolver builds the remote client, or the in-process services from the configuration
+func (o *lookupOptions) resolver(env Env) (resolver, error) {
+	if o.remote != "" {
+		if _, err := url.ParseRequestURI(o.remote); err != nil {
+			return nil, fmt.Errorf("invalid remote URL: %w", err)
+		}
+		remote := remoteResolver{
+			baseURL:      o.remote,
+			apiKeyHeader: o.apiKeyHeader,
+			apiKey:       o.apiKey,
+			client:       &http.Client{},
+		}
+		if o.rate > 0 {
+			return pacedResolver{next: remote, pacer: newPacer(o.rate)}, nil
+		}
+		return remote, nil
+	}
+
+	var args []string
+	if o.configFile != "" {
+		args = []string{"-config", o.configFile}
+	}
+	cfg, _, err := config.Load(args, env.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	viaCEPService, weatherService, err := newUpstreamServices(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Repeated CEPs and cities are answered from the caches; only misses are paced
+	cepService := services.NewCachedCEPService(pacedCEPService{next: viaCEPService, pacer: newPacer(o.rate)}, cfg.Cache.CEPTTL.Std())
+	cachedWeatherService := services.NewCachedWeatherService(pacedWeatherService{next: weatherService, pacer: newPacer(o.rate)}, cfg.Cache.WeatherTTL.Std())
+	return localResolver{lookup: services.NewLookup(cepService, cachedWeatherService)}, nil
+}
+
+// lookup prints the weather of the CEPs given as arguments
+func lookup(args []string, env Env) int {
+	var opts lookupOptions
+	fs := newFlagSet("lookup", "<cep>...", env)
+	opts.register(fs, env)
+	fs.StringVar(&opts.format, "format", FormatText, "output format: text, json or table")
+	ceps, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExit(err)
+	}
+	if len(ceps) == 0 {
+		fmt.Fprintln(env.Stderr, "lookup: at least one CEP is required")
+		fs.Usage()
+		return ExitUsage
+	}
+	return resolveAndPrint(ceps, &opts, env)
+}
+
+// resolveAndPrint looks the CEPs up in order and prints the readings found; failed
+// CEPs are reported on stderr and make the command fail
+func resolveAndPrint(ceps []string, opts *lookupOptions, env Env) int {
+	p, err := opts.printer()
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitUsage
+	}
+	r, err := opts.resolver(env)
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+
+	readings := make([]reading, 0, len(ceps))
+	failed := 0
+	for _, cep := range ceps {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+		result, err := r.Resolve(ctx, cep)
+		cancel()
+		if err != nil {
+			failed++
+			fmt.Fprintf(env.Stderr, "%s: %v\n", cep, err)
+			continue
+		}
+		readings = append(readings, *result)
+	}
+
+	if err := p.print(env.Stdout, readings, len(ceps) == 1); err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+	if failed > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// unit is a temperature scale the output may include
+type unit struct {
+	name   string
+	symbol string
+	value  func(reading) float64
+}
+
+var allUnits = []unit{
+	{"celsius", models.TemperatureUnits.Celsius, func(r reading) float64 { return r.Celsius }},
+	{"fahrenheit", models.TemperatureUnits.Fahrenheit, func(r reading) float64 { return r.Fahrenheit }},
+	{"kelvin", models.TemperatureUnits.Kelvin, func(r reading) float64 { return r.Kelvin }},
+}
+
+// parseUnits parses a list such as "C,F" or "celsius,kelvin", keeping the order given
+func parseUnits(value string) ([]unit, error) {
+	var units []unit
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		found := false
+		for _, u := range allUnits {
+			if item == u.name || item == u.name[:1] {
+				if !seen[u.name] {
+					units = append(units, u)
+					seen[u.name] = true
+				}
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown unit %q: use C, F or K", item)
+		}
+	}
+	if len(units) == 0 {
+		return nil, errors.New("at least one unit is required")
+	}
+	return units, nil
+}
+
+// printer writes readings in one of the output formats
+type printer struct {
+	format string
+	units  []unit
+}
+
+// jsonReading is the JSON output of a reading, with only the selected units
+type jsonReading struct {
+	CEP         string             `json:"cep"`
+	City        string             `json:"city"`
+	State       string             `json:"state"`
+	Temperature map[string]float64 `json:"temperature"`
+	ObservedAt  *time.Time         `json:"observed_at,omitempty"`
+}
+
+// print writes the readings; single prints a lone JSON object instead of an array
+func (p printer) print(w io.Writer, readings []reading, single bool) error {
+	switch p.format {
+	case FormatJSON:
+		out := make([]jsonReading, 0, len(readings))
+		for _, r := range readings {
+			out = append(out, p.jsonReading(r))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if single {
+			if len(out) == 0 {
+				return nil
+			}
+			return encoder.Encode(out[0])
+		}
+		return encoder.Encode(out)
+	case FormatTable:
+		if len(readings) == 0 {
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprint(tw, "CEP\tCITY\tSTATE")
+		for _, u := range p.units {
+			fmt.Fprintf(tw, "\t%s", u.symbol)
+		}
+		fmt.Fprintln(tw, "\tOBSERVED AT")
+		for _, r := range readings {
+			fmt.Fprintf(tw, "%s\t%s\t%s", r.CEP, r.City, r.State)
+			for _, u := range p.units {
+				fmt.Fprintf(tw, "\t%.1f", u.value(r))
+			}
+			observed := "-"
+			if !r.ObservedAt.IsZero() {
+				observed = r.ObservedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "\t%s\n", observed)
+		}
+		return tw.Flush()
+	default:
+		for _, r := range readings {
+			if _, err := fmt.Fprintln(w, p.text(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (p printer) jsonReading(r reading) jsonReading {
+	out := jsonReading{CEP: r.CEP, City: r.City, State: r.State, Temperature: make(map[string]float64, len(p.units))}
+	for _, u := range p.units {
+		out.Temperature[u.name] = u.value(r)
+	}
+	if !r.ObservedAt.IsZero() {
+		observed := r.ObservedAt.UTC()
+		out.ObservedAt = &observed
+	}
+	return out
+}
+
+// text formats a reading as "01310-100 São Paulo/SP: 25.5°C / 77.9°F / 298.5K"
+func (p printer) text(r reading) string {
+	temperatures := make([]string, 0, len(p.units))
+	for _, u := range p.units {
+		temperatures = append(temperatures, fmt.Sprintf("%.1f%s", u.value(r), u.symbol))
+	}
+	return fmt.Sprintf("%s %s/%s: %s", r.CEP, r.City, r.State, strings.Join(temperatures, " / "))
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookup_InProcess(t *testing.T) {
+	vars := newUpstreams(t).vars
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout []string
+		wantStderr string
+	}{
+		{
+			name:       "text",
+			args:       []string{"01310-100"},
+			wantStdout: []string{"01310-100 São Paulo/SP: 25.0°C / 77.0°F / 298.0K\n"},
+		},
+		{
+			name:       "units in the order given",
+			args:       []string{"01310100", "--units", "k,celsius"},
+			wantStdout: []string{"01310-100 São Paulo/SP: 298.0K / 25.0°C\n"},
+		},
+		{
+			name:       "table",
+			args:       []string{"-format", "table", "-units", "C", "01310-100"},
+			wantStdout: []string{"CEP        CITY       STATE  °C    OBSERVED AT", "01310-100  São Paulo  SP     25.0  2026-03-10T12:00:00Z"},
+		},
+		{
+			name:       "failed CEPs are reported and the others printed",
+			args:       []string{"01310-100", "99999-999", "123", "20040-020"},
+			wantCode:   ExitFailure,
+			wantStdout: []string{"01310-100 São Paulo/SP: 25.0°C / 77.0°F / 298.0K\n20040-020 Rio de Janeiro/RJ: 30.0°C / 86.0°F / 303.0K\n"},
+			wantStderr: "99999-999: can not find zipcode\n123: invalid zipcode\n",
+		},
+		{
+			name:       "no CEP",
+			args:       []string{"-format", "json"},
+			wantCode:   ExitUsage,
+			wantStderr: "at least one CEP is required",
+		},
+		{
+			name:       "unknown format",
+			args:       []string{"-format", "xml", "01310-100"},
+			wantCode:   ExitUsage,
+			wantStderr: `unknown format "xml"`,
+		},
+		{
+			name:       "unknown unit",
+			args:       []string{"-units", "C,R", "01310-100"},
+			wantCode:   ExitUsage,
+			wantStderr: `unknown unit "r"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, stdout, stderr := testEnv(vars, "")
+			if code := Run(append([]string{"lookup"}, tt.args...), env); code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %d (stderr %q)", tt.wantCode, code, stderr)
+			}
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("expected stdout to contain %q, got %q", want, stdout)
+				}
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestLookup_JSON(t *testing.T) {
+	env, stdout, stderr := testEnv(newUpstreams(t).vars, "")
+	if code := Run([]string{"lookup", "-format", "json", "-units", "C,F", "01310-100"}, env); code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr)
+	}
+
+	var body jsonReading
+	if err := json.Unmarshal(stdout.Bytes(), &body); err != nil {
+		t.Fatalf("expected a single JSON object: %v", err)
+	}
+	if body.CEP != "01310-100" || body.City != "São Paulo" || body.State != "SP" || body.ObservedAt == nil {
+		t.Errorf("unexpected reading %+v", body)
+	}
+	if len(body.Temperature) != 2 || body.Temperature["celsius"] != 25 || body.Temperature["fahrenheit"] != 77 {
+		t.Errorf("expected only celsius and fahrenheit, got %v", body.Temperature)
+	}
+
+	// Several CEPs print an array
+	env, stdout, _ = testEnv(newUpstreams(t).vars, "")
+	Run([]string{"lookup", "-format", "json", "01310-100", "01310100"}, env)
+	var readings []jsonReading
+	if err := json.Unmarshal(stdout.Bytes(), &readings); err != nil || len(readings) != 2 {
+		t.Errorf("expected an array of two readings, got %q (%v)", stdout, err)
+	}
+}
+
+func TestLookup_Remote(t *testing.T) {
+	var gotKey string
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-API-Key")
+		switch r.URL.Path {
+		case "/v2/weather/01310100":
+			w.Write([]byte(`{"location":{"cep":"01310-100","city":"São Paulo","state":"SP"},"temperature":{"celsius":25,"fahrenheit":77,"kelvin":298}}`))
+		case "/v2/weather/99999999":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"can not find zipcode"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer instance.Close()
+
+	// The remote instance is used even without upstream configuration
+	env, stdout, stderr := testEnv(map[string]string{"WEATHER_BY_CEP_API_KEY": "client-key"}, "")
+	code := Run([]string{"lookup", "-remote", instance.URL, "01310-100", "99999-999", "20040-020"}, env)
+	if code != ExitFailure {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if gotKey != "client-key" {
+		t.Errorf("expected the API key to be sent, got %q", gotKey)
+	}
+	if stdout.String() != "01310-100 São Paulo/SP: 25.0°C / 77.0°F / 298.0K\n" {
+		t.Errorf("unexpected stdout %q", stdout)
+	}
+	wantErrors := "99999-999: can not find zipcode (404 Not Found)\n20040-020: remote instance returned 502 Bad Gateway\n"
+	if stderr.String() != wantErrors {
+		t.Errorf("expected stderr %q, got %q", wantErrors, stderr)
+	}
+}
+
+func TestLookup_MissingConfiguration(t *testing.T) {
+	env, _, stderr := testEnv(nil, "")
+	if code := Run([]string{"lookup", "01310-100"}, env); code != ExitFailure {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "weather.api_key is required") {
+		t.Errorf("expected the configuration error, got %q", stderr)
+	}
+}
+
+func TestLookup_ReplayedCassettes(t *testing.T) {
+	// No API key or network is needed to replay the recorded traffic
+	env, stdout, stderr := testEnv(map[string]string{
+		"CASSETTE_MODE": "replay",
+		"CASSETTE_DIR":  filepath.Join("..", "..", "testdata", "cassettes"),
+	}, "")
+	if code := Run([]string{"lookup", "01310-100", "20040-020", "-units", "C"}, env); code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr)
+	}
+	if want := "01310-100 São Paulo/SP: 24.3°C\n20040-020 Rio de Janeiro/RJ: 28.9°C\n"; stdout.String() != want {
+		t.Errorf("expected %q, got %q", want, stdout)
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/mockupstream"
+)
+
+// mockUpstreams serves fake ViaCEP and WeatherAPI endpoints from a fixture until
+// interrupted, so the API can run without network access or a WeatherAPI key
+func mockUpstreams(args []string, env Env) int {
+	fs := newFlagSet("mock-upstreams", "", env)
+	addr := fs.String("addr", "127.0.0.1:8081", "address to listen on")
+	fixtureFile := fs.String("fixture", "", "YAML or JSON fixture with the CEPs, weather and behaviours to serve (default: built-in fixture)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExit(err)
+	}
+	if len(positional) > 0 {
+		fmt.Fprintf(env.Stderr, "unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return ExitUsage
+	}
+
+	fixture := mockupstream.DefaultFixture()
+	if *fixtureFile != "" {
+		if fixture, err = mockupstream.LoadFixture(*fixtureFile); err != nil {
+			fmt.Fprintln(env.Stderr, err)
+			return ExitFailure
+		}
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serveMockUpstreams(ctx, listener, mockupstream.New(fixture), env); err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// serveMockUpstreams serves the mock on the listener until ctx is done
+func serveMockUpstreams(ctx context.Context, listener net.Listener, handler http.Handler, env Env) error {
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	base := "http://" + listener.Addr().String()
+	fmt.Fprintf(env.Stderr, "Mock upstreams listening on %s\n", listener.Addr())
+	fmt.Fprintf(env.Stderr, "  VIACEP_BASE_URL=%s\n", mockupstream.ViaCEPURL(base))
+	fmt.Fprintf(env.Stderr, "  WEATHER_BASE_URL=%s\n", mockupstream.WeatherURL(base))
+
+	errc := make(chan error, 1)
+	go func() { errc <- server.Serve(listener) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdown); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/mockupstream"
+)
+
+func TestMockUpstreams_Flags(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "fixture.yaml")
+	os.WriteFile(invalid, []byte("behaviours: [{fault: slow}]\n"), 0o600)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"invalid fixture", []string{"-fixture", invalid}, ExitFailure, `unknown fault "slow"`},
+		{"missing fixture", []string{"-fixture", filepath.Join(dir, "missing.yaml")}, ExitFailure, "failed to read fixture"},
+		{"unexpected argument", []string{"01310100"}, ExitUsage, "unexpected arguments"},
+		{"unknown flag", []string{"-port", "1"}, ExitUsage, "flag provided but not defined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, _, stderr := testEnv(nil, "")
+			if code := Run(append([]string{"mock-upstreams"}, tt.args...), env); code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d (stderr %q)", tt.wantCode, code, stderr)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestMockUpstreams_ServesLookup(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	serverEnv, _, _ := testEnv(nil, "")
+	done := make(chan error, 1)
+	go func() { done <- serveMockUpstreams(ctx, listener, mockupstream.New(nil), serverEnv) }()
+
+	base := "http://" + listener.Addr().String()
+	env, stdout, stderr := testEnv(map[string]string{
+		"VIACEP_BASE_URL":  mockupstream.ViaCEPURL(base),
+		"WEATHER_BASE_URL": mockupstream.WeatherURL(base),
+		"WEATHER_API_KEY":  "mock",
+	}, "")
+	if code := Run([]string{"lookup", "20040-020", "-units", "C"}, env); code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr)
+	}
+	if want := "20040-020 Rio de Janeiro/RJ: 28.9°C"; !strings.Contains(stdout.String(), want) {
+		t.Errorf("expected %q, got %q", want, stdout)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// pacer spaces calls so they do not exceed a rate; a nil pacer never waits
+type pacer struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newPacer allows rate calls per second, or any number when rate is not positive
+func newPacer(rate float64) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &pacer{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// Wait blocks until the next call is allowed or ctx is done
+func (p *pacer) Wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	wait := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// pacedCEPService paces the calls to ViaCEP
+type pacedCEPService struct {
+	next  services.CEPService
+	pacer *pacer
+}
+
+func (s pacedCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	if err := s.pacer.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.next.GetLocation(ctx, cep)
+}
+
+// pacedWeatherService paces the calls to the weather provider
+type pacedWeatherService struct {
+	next  services.WeatherServiceInterface
+	pacer *pacer
+}
+
+func (s pacedWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	if err := s.pacer.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.next.GetTemperature(ctx, city)
+}
+
+// pacedResolver paces the calls to a remote instance
+type pacedResolver struct {
+	next  resolver
+	pacer *pacer
+}
+
+func (r pacedResolver) Resolve(ctx context.Context, cep string) (*reading, error) {
+	if err := r.pacer.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.next.Resolve(ctx, cep)
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPacer(t *testing.T) {
+	if p := newPacer(0); p != nil {
+		t.Fatalf("expected no pacer without a rate, got %+v", p)
+	}
+	var unlimited *pacer
+	if err := unlimited.Wait(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p := newPacer(100)
+	started := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := p.Wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("expected 6 calls at 100/s to take at least 50ms, took %v", elapsed)
+	}
+
+	slow := newPacer(0.1)
+	slow.Wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := slow.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Batch input and output formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// row is one input record on its way through the batch pipeline
+type row struct {
+	// line is where the record starts in the input, for error messages
+	line   int
+	cep    string
+	fields []string
+	raw    []byte
+
+	result *reading
+	err    error
+	done   chan struct{}
+}
+
+// rowReader reads the records of the input one at a time, returning io.EOF at the end
+type rowReader interface {
+	Read() (*row, error)
+}
+
+// rowWriter writes enriched records in the format of the input
+type rowWriter interface {
+	Write(r *row) error
+	Flush() error
+}
+
+// errMissingCEP marks records without a CEP, written with the error instead of looked up
+var errMissingCEP = errors.New("missing CEP")
+
+// enrichment returns the names and values of the columns added to a record
+func enrichment(units []unit, r *row) (names []string, values []*float64, message string) {
+	for _, u := range units {
+		names = append(names, "temp_"+u.name[:1])
+		if r.result == nil {
+			values = append(values, nil)
+			continue
+		}
+		v := math.Round(u.value(*r.result)*100) / 100
+		values = append(values, &v)
+	}
+	if r.err != nil {
+		message = r.err.Error()
+	}
+	return names, values, message
+}
+
+// csvReader reads a CSV with a header, taking the CEP from the named column
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+	column int
+}
+
+func newCSVReader(r io.Reader, column string) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the input is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the CSV header: %w", err)
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")), column) {
+			return &csvReader{reader: reader, header: header, column: i}, nil
+		}
+	}
+	return nil, fmt.Errorf("column %q not found in the CSV header %q", column, strings.Join(header, ","))
+}
+
+func (c *csvReader) Read() (*row, error) {
+	fields, err := c.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	line, _ := c.reader.FieldPos(0)
+	return &row{line: line, cep: strings.TrimSpace(fields[c.column]), fields: fields}, nil
+}
+
+// csvWriter appends the temperature columns and an error column to every record
+type csvWriter struct {
+	writer *csv.Writer
+	units  []unit
+}
+
+// newCSVWriter writes the header unless the output is being resumed
+func newCSVWriter(w io.Writer, header []string, units []unit, writeHeader bool) (*csvWriter, error) {
+	c := &csvWriter{writer: csv.NewWriter(w), units: units}
+	if !writeHeader {
+		return c, nil
+	}
+	names, _, _ := enrichment(units, &row{})
+	out := append(append(append([]string(nil), header...), names...), "error")
+	return c, c.writer.Write(out)
+}
+
+func (c *csvWriter) Write(r *row) error {
+	_, values, message := enrichment(c.units, r)
+	out := append([]string(nil), r.fields...)
+	for _, v := range values {
+		if v == nil {
+			out = append(out, "")
+			continue
+		}
+		out = append(out, strconv.FormatFloat(*v, 'f', -1, 64))
+	}
+	return c.writer.Write(append(out, message))
+}
+
+func (c *csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// jsonlReader reads one JSON object per line, taking the CEP from the named field.
+// Blank lines are skipped.
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	column  string
+	line    int
+}
+
+func newJSONLReader(r io.Reader, column string) *jsonlReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &jsonlReader{scanner: scanner, column: column}
+}
+
+func (j *jsonlReader) Read() (*row, error) {
+	for j.scanner.Scan() {
+		j.line++
+		raw := bytes.TrimSpace(j.scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("line %d: %w", j.line, err)
+		}
+		r := &row{line: j.line, raw: append([]byte(nil), raw...)}
+		r.cep = jsonCEP(fields[j.column])
+		return r, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// jsonCEP reads a CEP given as a string or as a number that lost its leading zeros
+func jsonCEP(value json.RawMessage) string {
+	var cep string
+	if json.Unmarshal(value, &cep) == nil {
+		return strings.TrimSpace(cep)
+	}
+	var number json.Number
+	if json.Unmarshal(value, &number) == nil {
+		if n, err := number.Int64(); err == nil && n > 0 {
+			return fmt.Sprintf("%08d", n)
+		}
+	}
+	return ""
+}
+
+// jsonlWriter adds the temperature fields, and an error field for failed records, to
+// every object, keeping its original fields and their order
+type jsonlWriter struct {
+	writer *bufio.Writer
+	units  []unit
+}
+
+func newJSONLWriter(w io.Writer, units []unit) *jsonlWriter {
+	return &jsonlWriter{writer: bufio.NewWriter(w), units: units}
+}
+
+func (j *jsonlWriter) Write(r *row) error {
+	names, values, message := enrichment(j.units, r)
+	var extra bytes.Buffer
+	for i, name := range names {
+		value, _ := json.Marshal(values[i])
+		fmt.Fprintf(&extra, `,%q:%s`, name, value)
+	}
+	if message != "" {
+		value, _ := json.Marshal(message)
+		fmt.Fprintf(&extra, `,"error":%s`, value)
+	}
+
+	object := bytes.TrimSuffix(r.raw, []byte("}"))
+	added := extra.Bytes()
+	if len(bytes.TrimSpace(object)) == 1 {
+		// An empty object takes the fields without the leading comma
+		added = added[1:]
+	}
+	j.writer.Write(object)
+	j.writer.Write(added)
+	_, err := j.writer.WriteString("}\n")
+	return err
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.writer.Flush()
+}
@@ -0,0 +1,462 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/lhespanhol/weather-by-cep/internal/alerts"
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/cassette"
+	"github.com/lhespanhol/weather-by-cep/internal/chaos"
+	"github.com/lhespanhol/weather-by-cep/internal/config"
+	"github.com/lhespanhol/weather-by-cep/internal/graphqlapi"
+	"github.com/lhespanhol/weather-by-cep/internal/grpcapi"
+	"github.com/lhespanhol/weather-by-cep/internal/handlers"
+	"github.com/lhespanhol/weather-by-cep/internal/middleware"
+	"github.com/lhespanhol/weather-by-cep/internal/observations"
+	"github.com/lhespanhol/weather-by-cep/internal/prewarm"
+	"github.com/lhespanhol/weather-by-cep/internal/ratelimit"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+// shutdownTimeout bounds how long the requests in flight may take to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// serve starts the HTTP (and optionally gRPC) API and blocks until SIGINT or SIGTERM
+func serve(args []string, env Env) int {
+	// Load configuration from defaults, config file, environment and flags
+	configManager, opts, err := config.NewManager(args, env.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+	cfg := configManager.Current()
+
+	if opts.PrintConfig {
+		fmt.Fprintln(env.Stdout, cfg)
+		return ExitOK
+	}
+
+	// Fault injection only exists in builds with the chaos tag
+	injector, err := chaosInjector(cfg.Chaos)
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+	if injector != nil {
+		log.Printf("Chaos fault injection compiled in (enabled: %t)", cfg.Chaos.Enabled)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runServer(ctx, configManager, injector); err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// runServer serves the APIs until ctx is done, then stops accepting requests, lets the
+// ones in flight finish and closes the observation store
+func runServer(ctx context.Context, configManager *config.Manager, injector *chaos.Injector) error {
+	cfg := configManager.Current()
+
+	// Background jobs outlive ctx until the servers have stopped, so the requests still
+	// in flight are recorded and the store is closed only once nothing writes to it
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Initialize services
+	viaCEPService, weatherService, err := newUpstreamServices(cfg, injector)
+	if err != nil {
+		return err
+	}
+	if cfg.Cassettes.Mode != config.CassetteModeOff {
+		log.Printf("Upstream traffic: %s cassettes in %s", cfg.Cassettes.Mode, cfg.Cassettes.Dir)
+	}
+
+	cepService := services.NewCachedCEPService(viaCEPService, cfg.Cache.CEPTTL.Std())
+	cachedWeatherService := services.NewCachedWeatherService(weatherService, cfg.Cache.WeatherTTL.Std())
+	forecastService := services.NewCachedForecastService(weatherService, cfg.Cache.WeatherTTL.Std())
+
+	// Scheduled jobs keep the weather of the configured CEPs in the cache
+	prewarmer := prewarm.New(cepService, cachedWeatherService, prewarmSettings(cfg.Prewarm))
+	if err := prewarmer.SetConfigJobs(prewarmJobs(cfg.Prewarm)); err != nil {
+		return err
+	}
+	go prewarmer.Run(jobs)
+
+	authenticator := auth.NewAuthenticator(authSettings(cfg.Auth), authClients(cfg.Auth))
+	adminHandler := handlers.NewAdminHandler(cfg.Admin.Token, weatherService.KeyPool(), authenticator, prewarmer)
+	limiter := ratelimit.New(rateLimitSettings(cfg, authenticator))
+	go limiter.RunCleanup(jobs, time.Minute)
+	cors := middleware.NewCORS(corsOptions(cfg.CORS))
+
+	// Initialize handlers
+	weatherHandler := handlers.NewWeatherHandler(cepService, cachedWeatherService)
+	weatherHandler.SetRefreshInterval(cfg.Cache.WeatherRefresh.Std())
+	lookup := services.NewLookup(cepService, cachedWeatherService)
+	hub := stream.NewHub(lookup, streamSettings(cfg.Stream))
+
+	observationStore, err := newObservationStore(cfg.Observations)
+	if err != nil {
+		return fmt.Errorf("opening the observation store: %w", err)
+	}
+	recorder := observations.NewRecorder(observationStore, cfg.Weather.Provider, cfg.Observations.Retention.Std())
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		recorder.Run(jobs)
+	}()
+	weatherHandler.SetRecorder(recorder)
+
+	alertStore := alerts.NewStore(cfg.Alerts.MaxPerClient)
+	dispatcher := alerts.NewDispatcher(alertSettings(cfg.Alerts))
+	scheduler := alerts.NewScheduler(alertStore, lookup, dispatcher, cfg.Alerts.Interval.Std())
+	go scheduler.Run(jobs)
+
+	// Apply reloaded configuration (SIGHUP or config file change) to the running services
+	configManager.Subscribe(func(prev, next *config.Config) {
+		reconfigureUpstreams(viaCEPService, weatherService, next)
+		authenticator.Configure(authSettings(next.Auth), authClients(next.Auth))
+		adminHandler.SetToken(next.Admin.Token)
+		limiter.Configure(rateLimitSettings(next, authenticator))
+		cors.Configure(corsOptions(next.CORS))
+		cepService.SetTTL(next.Cache.CEPTTL.Std())
+		cachedWeatherService.SetTTL(next.Cache.WeatherTTL.Std())
+		forecastService.SetTTL(next.Cache.WeatherTTL.Std())
+		prewarmer.Configure(prewarmSettings(next.Prewarm))
+		if err := prewarmer.SetConfigJobs(prewarmJobs(next.Prewarm)); err != nil {
+			log.Printf("Prewarm jobs not reloaded: %v", err)
+		}
+		weatherHandler.SetRefreshInterval(next.Cache.WeatherRefresh.Std())
+		hub.Configure(streamSettings(next.Stream))
+		recorder.SetRetention(next.Observations.Retention.Std())
+		alertStore.SetMaxPerClient(next.Alerts.MaxPerClient)
+		dispatcher.Configure(alertSettings(next.Alerts))
+		scheduler.SetInterval(next.Alerts.Interval.Std())
+		if injector != nil {
+			injector.Configure(chaosSettings(next.Chaos))
+		} else if next.Chaos.Enabled {
+			log.Printf("chaos.enabled ignored: the binary was built without the chaos tag")
+		}
+	})
+	go configManager.Watch(jobs, 5*time.Second)
+
+	graphQL := graphqlapi.NewHandler(cepService, cachedWeatherService, forecastService)
+	graphQL.SetAuthenticator(authenticator)
+	webSocket := handlers.NewWebSocketHandler(hub)
+	webSocket.SetAuthenticator(authenticator)
+
+	// Setup routes
+	mux := handlers.NewRouter(handlers.Routes{
+		Weather:       weatherHandler,
+		Stream:        handlers.NewStreamHandler(hub),
+		WebSocket:     webSocket,
+		Alerts:        handlers.NewAlertsHandler(alertStore, dispatcher, cepService),
+		Observations:  handlers.NewObservationsHandler(observationStore),
+		Stats:         handlers.NewStatsHandler(observationStore),
+		GraphQL:       graphQL,
+		Admin:         adminHandler,
+		Authenticator: authenticator,
+	})
+
+	// Middlewares run in the order listed, before the route handlers
+	middlewares := []middleware.Middleware{
+		middleware.Recover,
+		middleware.SecurityHeaders,
+		cors.Middleware,
+		middleware.Compress,
+		limiter.Middleware,
+	}
+	if injector != nil {
+		middlewares = append(middlewares, injector.Middleware)
+	}
+	handler := middleware.Chain(mux, middlewares...)
+
+	server := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      handler,
+		ReadTimeout:  cfg.Server.ReadTimeout.Std(),
+		WriteTimeout: cfg.Server.WriteTimeout.Std(),
+	}
+
+	log.Printf("Effective configuration:\n%s", cfg)
+
+	// Both servers report here when they stop on their own, which only happens on failure
+	errc := make(chan error, 2)
+
+	// The gRPC API shares the services and authenticator but listens on its own port
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Addr != "" {
+		listener, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			stopJobs()
+			<-recorded
+			return errors.Join(fmt.Errorf("gRPC server failed to listen: %w", err), observationStore.Close())
+		}
+		grpcServer = grpcapi.NewServer(grpcapi.NewWeatherServer(cepService, cachedWeatherService, hub), authenticator)
+		go func() {
+			log.Printf("gRPC server listening on %s", listener.Addr())
+			if err := grpcServer.Serve(listener); err != nil {
+				errc <- fmt.Errorf("gRPC server failed: %w", err)
+			}
+		}()
+	}
+
+	log.Printf("Server listening on %s", server.Addr)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errc <- fmt.Errorf("server failed: %w", err)
+		}
+	}()
+
+	var errs []error
+	select {
+	case err := <-errc:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdown); err != nil {
+		// Streams and long polls hold their requests open; cut them
+		log.Printf("Closing the connections still open after %s: %v", shutdownTimeout, err)
+		server.Close()
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+
+	stopJobs()
+	<-recorded
+	if err := observationStore.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("closing the observation store: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// newUpstreamServices builds the ViaCEP client and the client of the configured weather
+// provider, injecting the faults of the injector when it is not nil
+func newUpstreamServices(cfg *config.Config, injector *chaos.Injector) (*services.ViaCEPService, *services.WeatherService, error) {
+	viaCEPClient, err := upstreamClient(cfg.Cassettes, injector, config.UpstreamViaCEP, cfg.ViaCEP.Timeout.Std())
+	if err != nil {
+		return nil, nil, err
+	}
+	weatherClient, err := upstreamClient(cfg.Cassettes, injector, config.UpstreamWeather, cfg.Weather.Timeout.Std())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	viaCEPService := services.NewViaCEPServiceWithClient(cfg.ViaCEP.BaseURL, viaCEPClient)
+	switch cfg.Weather.Provider {
+	case config.ProviderWeatherAPI:
+		keyPool := services.NewKeyPool(weatherKeys(cfg.Weather), services.KeyStrategy(cfg.Weather.KeyStrategy), cfg.Weather.KeyMonthlyQuota)
+		return viaCEPService, services.NewWeatherServiceWithKeyPool(cfg.Weather.BaseURL, keyPool, weatherClient), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported weather provider %q", cfg.Weather.Provider)
+	}
+}
+
+// reconfigureUpstreams applies reloaded upstream URLs, timeouts and weather keys
+func reconfigureUpstreams(viaCEPService *services.ViaCEPService, weatherService *services.WeatherService, cfg *config.Config) {
+	viaCEPService.Reconfigure(cfg.ViaCEP.BaseURL, cfg.ViaCEP.Timeout.Std())
+	weatherService.Reconfigure(cfg.Weather.BaseURL, cfg.Weather.Timeout.Std())
+	weatherService.KeyPool().SetKeys(weatherKeys(cfg.Weather), services.KeyStrategy(cfg.Weather.KeyStrategy), cfg.Weather.KeyMonthlyQuota)
+}
+
+// weatherKeys returns the keys of the weather key pool. Replaying cassettes needs no
+// key, since validation allows none in replay mode, but the pool needs one to hand out.
+func weatherKeys(cfg config.WeatherConfig) []string {
+	keys := cfg.Keys()
+	if len(keys) == 0 {
+		return []string{cassette.Redacted}
+	}
+	return keys
+}
+
+// upstreamClient returns the HTTP client of an upstream, recording or replaying its
+// traffic in <cassettes.dir>/<name>.json when cassettes are enabled. Injected faults
+// happen before the cassette, so they are never recorded.
+func upstreamClient(cfg config.CassettesConfig, injector *chaos.Injector, name string, timeout time.Duration) (*http.Client, error) {
+	client := &http.Client{Timeout: timeout}
+	if cfg.Mode != config.CassetteModeOff {
+		transport, err := cassette.NewTransport(cassette.Mode(cfg.Mode), filepath.Join(cfg.Dir, name+".json"), nil)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+	if injector != nil {
+		client.Transport = injector.Transport(name, client.Transport)
+	}
+	return client, nil
+}
+
+// chaosInjector returns the fault injector of builds with the chaos tag and nil in any
+// other build, where enabling chaos is an error
+func chaosInjector(cfg config.ChaosConfig) (*chaos.Injector, error) {
+	if !chaos.Compiled {
+		if cfg.Enabled {
+			return nil, errors.New("chaos.enabled requires a binary built with -tags chaos")
+		}
+		return nil, nil
+	}
+	return chaos.New(chaosSettings(cfg)), nil
+}
+
+func chaosSettings(cfg config.ChaosConfig) chaos.Settings {
+	return chaos.Settings{
+		Enabled:  cfg.Enabled,
+		Header:   cfg.Header,
+		Upstream: chaosFaults(cfg.Upstream),
+		Server:   chaosFaults(cfg.Server),
+	}
+}
+
+func chaosFaults(cfg []config.ChaosFault) []chaos.Fault {
+	faults := make([]chaos.Fault, 0, len(cfg))
+	for _, f := range cfg {
+		faults = append(faults, chaos.Fault{
+			Type:        f.Type,
+			Probability: f.Probability,
+			Upstream:    f.Upstream,
+			PathPrefix:  f.PathPrefix,
+			Latency:     f.Latency.Std(),
+			Status:      f.Status,
+			Bytes:       f.Bytes,
+		})
+	}
+	return faults
+}
+
+func authSettings(cfg config.AuthConfig) auth.Settings {
+	return auth.Settings{
+		Enabled:    cfg.Enabled,
+		Header:     cfg.Header,
+		QueryParam: cfg.QueryParam,
+	}
+}
+
+func authClients(cfg config.AuthConfig) []auth.Client {
+	clients := make([]auth.Client, 0, len(cfg.Clients))
+	for _, c := range cfg.Clients {
+		clients = append(clients, auth.Client{
+			Name:         c.Name,
+			Key:          c.Key,
+			DailyQuota:   c.DailyQuota,
+			MonthlyQuota: c.MonthlyQuota,
+			Disabled:     c.Disabled,
+		})
+	}
+	return clients
+}
+
+func rateLimitSettings(cfg *config.Config, authenticator *auth.Authenticator) ratelimit.Settings {
+	routes := make([]ratelimit.Rule, 0, len(cfg.RateLimit.Routes))
+	for _, route := range cfg.RateLimit.Routes {
+		routes = append(routes, ratelimit.Rule{
+			Prefix:            route.Prefix,
+			RequestsPerSecond: route.RequestsPerSecond,
+			Burst:             route.Burst,
+		})
+	}
+
+	return ratelimit.Settings{
+		Enabled: cfg.RateLimit.Enabled,
+		Default: ratelimit.Rule{
+			Prefix:            "/",
+			RequestsPerSecond: cfg.RateLimit.RequestsPerSecond,
+			Burst:             cfg.RateLimit.Burst,
+		},
+		Routes: routes,
+		KeyBy:  cfg.RateLimit.KeyBy,
+		Identify: func(r *http.Request) (string, bool) {
+			client, ok := authenticator.Identify(r)
+			if !ok {
+				return "", false
+			}
+			return client.Name, true
+		},
+		TrustedProxyHops: cfg.RateLimit.TrustedProxyHops,
+		IdleTimeout:      cfg.RateLimit.IdleTimeout.Std(),
+	}
+}
+
+// newObservationStore opens the configured observation store
+func newObservationStore(cfg config.ObservationsConfig) (observations.Store, error) {
+	switch cfg.Store {
+	case config.ObservationStoreMemory:
+		return observations.NewMemoryStore(), nil
+	default:
+		return observations.OpenBoltStore(cfg.Path)
+	}
+}
+
+func prewarmSettings(cfg config.PrewarmConfig) prewarm.Settings {
+	return prewarm.Settings{
+		Jitter:      cfg.Jitter.Std(),
+		Concurrency: cfg.Concurrency,
+	}
+}
+
+func prewarmJobs(cfg config.PrewarmConfig) []prewarm.Job {
+	jobs := make([]prewarm.Job, 0, len(cfg.Jobs))
+	for _, job := range cfg.Jobs {
+		jobs = append(jobs, prewarm.Job{
+			Name:     job.Name,
+			Schedule: job.Schedule,
+			Interval: job.Interval.Std(),
+			Jitter:   job.Jitter.Std(),
+			CEPs:     job.CEPs,
+		})
+	}
+	return jobs
+}
+
+func alertSettings(cfg config.AlertsConfig) alerts.Settings {
+	return alerts.Settings{
+		MaxAttempts:         cfg.MaxAttempts,
+		RetryBackoff:        cfg.RetryBackoff.Std(),
+		Timeout:             cfg.Timeout.Std(),
+		AllowPrivateTargets: cfg.AllowPrivateWebhooks,
+	}
+}
+
+func streamSettings(cfg config.StreamConfig) stream.Settings {
+	return stream.Settings{
+		PollInterval:     cfg.PollInterval.Std(),
+		Heartbeat:        cfg.Heartbeat.Std(),
+		MaxStreams:       cfg.MaxConnections,
+		MaxSubscriptions: cfg.MaxSubscriptions,
+	}
+}
+
+func corsOptions(cfg config.CORSConfig) middleware.CORSOptions {
+	return middleware.CORSOptions{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge.Std(),
+	}
+}
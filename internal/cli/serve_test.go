@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/cassette"
+	"github.com/lhespanhol/weather-by-cep/internal/config"
+)
+
+func TestReconfigureUpstreams_ReplayWithoutKeys(t *testing.T) {
+	env := map[string]string{
+		"CASSETTE_MODE":   config.CassetteModeReplay,
+		"CASSETTE_DIR":    "../../testdata/cassettes",
+		"WEATHER_TIMEOUT": "5s",
+	}
+	manager, _, err := config.NewManager(nil, func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	viaCEPService, weatherService, err := newUpstreamServices(manager.Current(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manager.Subscribe(func(_, next *config.Config) {
+		reconfigureUpstreams(viaCEPService, weatherService, next)
+	})
+
+	// Any reload, e.g. a new timeout, must keep the placeholder key of the replay
+	env["WEATHER_TIMEOUT"] = "6s"
+	if err := manager.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := weatherService.KeyPool().Status().Keys
+	if len(keys) != 1 || keys[0].Key != "****" {
+		t.Fatalf("expected the %s placeholder key, got %+v", cassette.Redacted, keys)
+	}
+	if _, err := weatherService.GetTemperature(context.Background(), "São Paulo"); err != nil {
+		t.Errorf("expected the replayed lookup to work after the reload, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/lhespanhol/weather-by-cep/internal/config"
+)
+
+// validate loads the configuration the way serve does and reports whether it is valid.
+// It accepts the same flags as serve.
+func validate(args []string, env Env) int {
+	cfg, opts, err := config.Load(args, env.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+
+	if _, err := chaosInjector(cfg.Chaos); err != nil {
+		fmt.Fprintln(env.Stderr, err)
+		return ExitFailure
+	}
+
+	if opts.PrintConfig {
+		fmt.Fprintln(env.Stdout, cfg)
+	}
+	source := "defaults and environment"
+	if opts.ConfigFile != "" {
+		source = opts.ConfigFile
+	}
+	fmt.Fprintf(env.Stdout, "configuration is valid (%s)\n", source)
+	return ExitOK
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/chaos"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	os.WriteFile(valid, []byte("weather:\n  api_key: secret\n"), 0o600)
+	os.WriteFile(invalid, []byte("weather:\n  api_key: secret\nrate_limit:\n  key_by: user\n"), 0o600)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"valid file", []string{"-config", valid}, ExitOK, "configuration is valid (" + valid + ")", ""},
+		{"invalid file", []string{"-config", invalid}, ExitFailure, "", "rate_limit.key_by"},
+		{"flags are applied", []string{"-config", valid, "-weather-provider", "noaa"}, ExitFailure, "", "invalid configuration"},
+		{"print the configuration", []string{"-config", valid, "-print-config"}, ExitOK, "****", ""},
+		{"missing file", []string{"-config", filepath.Join(dir, "missing.yaml")}, ExitFailure, "", "failed to read config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, stdout, stderr := testEnv(nil, "")
+			if code := Run(append([]string{"validate"}, tt.args...), env); code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d (stderr %q)", tt.wantCode, code, stderr)
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("expected stdout to contain %q, got %q", tt.wantStdout, stdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestValidate_ChaosNeedsTheBuildTag(t *testing.T) {
+	env, _, stderr := testEnv(map[string]string{"WEATHER_API_KEY": "key", "CHAOS_ENABLED": "true"}, "")
+	code := Run([]string{"validate"}, env)
+	if chaos.Compiled {
+		if code != ExitOK {
+			t.Errorf("expected chaos to be accepted by a chaos build, got %d (stderr %q)", code, stderr)
+		}
+		return
+	}
+	if code != ExitFailure || !strings.Contains(stderr.String(), "-tags chaos") {
+		t.Errorf("expected chaos to be rejected without the build tag, got %d (stderr %q)", code, stderr)
+	}
+}
@@ -0,0 +1,683 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/lhespanhol/weather-by-cep/internal/secret"
+)
+
+// Supported weather providers
+const (
+	ProviderWeatherAPI = "weatherapi"
+)
+
+// Supported observation stores
+const (
+	ObservationStoreBolt   = "bolt"
+	ObservationStoreMemory = "memory"
+)
+
+// Cassette modes for the upstream HTTP clients
+const (
+	CassetteModeOff    = "off"
+	CassetteModeRecord = "record"
+	CassetteModeReplay = "replay"
+)
+
+// Faults injected by the chaos settings
+const (
+	ChaosLatency  = "latency"
+	ChaosTimeout  = "timeout"
+	ChaosReset    = "reset"
+	ChaosStatus   = "status"
+	ChaosTruncate = "truncate"
+)
+
+// Upstreams chaos faults can target
+const (
+	UpstreamViaCEP  = "viacep"
+	UpstreamWeather = "weather"
+)
+
+// Supported API key selection strategies
+const (
+	KeyStrategyRoundRobin = "round_robin"
+	KeyStrategyLeastUsed  = "least_used"
+)
+
+// Config holds the effective configuration of the service
+type Config struct {
+	Server       ServerConfig       `json:"server"`
+	GRPC         GRPCConfig         `json:"grpc"`
+	ViaCEP       ViaCEPConfig       `json:"viacep"`
+	Weather      WeatherConfig      `json:"weather"`
+	Cassettes    CassettesConfig    `json:"cassettes"`
+	Cache        CacheConfig        `json:"cache"`
+	Stream       StreamConfig       `json:"stream"`
+	Alerts       AlertsConfig       `json:"alerts"`
+	Observations ObservationsConfig `json:"observations"`
+	Prewarm      PrewarmConfig      `json:"prewarm"`
+	RateLimit    RateLimitConfig    `json:"rate_limit"`
+	Auth         AuthConfig         `json:"auth"`
+	CORS         CORSConfig         `json:"cors"`
+	Admin        AdminConfig        `json:"admin"`
+	Chaos        ChaosConfig        `json:"chaos"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Addr         string   `json:"addr"`
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+}
+
+// GRPCConfig holds the gRPC server settings
+type GRPCConfig struct {
+	// Addr is where the gRPC API listens; it is disabled when empty
+	Addr string `json:"addr"`
+}
+
+// ViaCEPConfig holds the viaCEP client settings
+type ViaCEPConfig struct {
+	BaseURL string   `json:"base_url"`
+	Timeout Duration `json:"timeout"`
+}
+
+// WeatherConfig holds the weather provider settings
+type WeatherConfig struct {
+	Provider string   `json:"provider"`
+	BaseURL  string   `json:"base_url"`
+	APIKey   string   `json:"api_key"`
+	APIKeys  []string `json:"api_keys"`
+	// KeyStrategy picks the next key from the pool: round_robin or least_used
+	KeyStrategy string `json:"key_strategy"`
+	// KeyMonthlyQuota takes a key out of rotation after this many calls in a month (0 means unlimited)
+	KeyMonthlyQuota int      `json:"key_monthly_quota"`
+	Timeout         Duration `json:"timeout"`
+}
+
+// Keys returns every configured API key, without duplicates, in configuration order
+func (w WeatherConfig) Keys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, key := range append([]string{w.APIKey}, w.APIKeys...) {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// CassettesConfig records the traffic to ViaCEP and the weather provider to files, or
+// replays it from them without going to the network
+type CassettesConfig struct {
+	// Mode is off, record or replay
+	Mode string `json:"mode"`
+	// Dir holds one cassette per upstream, viacep.json and weather.json
+	Dir string `json:"dir"`
+}
+
+// CacheConfig holds the TTLs of the upstream lookup caches (0 disables caching)
+type CacheConfig struct {
+	CEPTTL     Duration `json:"cep_ttl"`
+	WeatherTTL Duration `json:"weather_ttl"`
+	// WeatherRefresh is how often the provider publishes a new reading; it bounds
+	// the Cache-Control max-age sent to clients
+	WeatherRefresh Duration `json:"weather_refresh"`
+}
+
+// StreamConfig holds the settings of the live update streams
+type StreamConfig struct {
+	// PollInterval is how often each watched CEP is looked up, whatever the number of clients
+	PollInterval Duration `json:"poll_interval"`
+	// Heartbeat is how often idle streams get a keep-alive comment
+	Heartbeat Duration `json:"heartbeat"`
+	// MaxConnections caps the concurrent streams
+	MaxConnections int `json:"max_connections"`
+	// MaxSubscriptions caps the CEPs watched over one WebSocket connection
+	MaxSubscriptions int `json:"max_subscriptions"`
+}
+
+// AlertsConfig holds the temperature alert settings. Alerts belong to API clients, so
+// /alerts requires auth to be enabled; they live in memory only and are lost on restart.
+type AlertsConfig struct {
+	// Interval is how often every alert is evaluated
+	Interval Duration `json:"interval"`
+	// MaxPerClient caps the alerts of each API client
+	MaxPerClient int `json:"max_per_client"`
+	// MaxAttempts is how many times a webhook is tried before going to the dead-letter list
+	MaxAttempts int `json:"max_attempts"`
+	// RetryBackoff is the wait before the first retry, doubled on every further retry
+	RetryBackoff Duration `json:"retry_backoff"`
+	// Timeout bounds each webhook attempt
+	Timeout Duration `json:"timeout"`
+	// AllowPrivateWebhooks lets webhooks target loopback and private networks
+	AllowPrivateWebhooks bool `json:"allow_private_webhooks"`
+}
+
+// ObservationsConfig holds the settings of the observation history
+type ObservationsConfig struct {
+	// Store is bolt (a file at Path) or memory (lost on restart)
+	Store string `json:"store"`
+	Path  string `json:"path"`
+	// Retention is how long observations are kept (0 keeps them forever)
+	Retention Duration `json:"retention"`
+}
+
+// PrewarmConfig holds the scheduled cache warming settings
+type PrewarmConfig struct {
+	// Jitter is the default random delay added to each run, so jobs sharing a schedule
+	// do not hit the weather provider at the same moment
+	Jitter Duration `json:"jitter"`
+	// Concurrency caps the simultaneous weather lookups of a run
+	Concurrency int                `json:"concurrency"`
+	Jobs        []PrewarmJobConfig `json:"jobs"`
+}
+
+// PrewarmJobConfig describes one warming job; it runs on start and then either on a
+// cron schedule or every interval
+type PrewarmJobConfig struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"`
+	Interval Duration `json:"interval"`
+	// Jitter overrides prewarm.jitter when set
+	Jitter Duration `json:"jitter"`
+	CEPs   []string `json:"ceps"`
+	// CEPsFile is an optional YAML or JSON file with a list of ceps, merged with CEPs
+	CEPsFile string `json:"ceps_file"`
+}
+
+// RateLimitConfig holds the request rate limiting settings
+type RateLimitConfig struct {
+	Enabled           bool    `json:"enabled"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+	// KeyBy identifies clients by "ip" or "api_key" (the client of a valid key, else the IP)
+	KeyBy string `json:"key_by"`
+	// TrustedProxyHops is how many proxies append to X-Forwarded-For (1 on Cloud Run)
+	TrustedProxyHops int `json:"trusted_proxy_hops"`
+	// IdleTimeout drops buckets of clients not seen for this long
+	IdleTimeout Duration `json:"idle_timeout"`
+	// Routes overrides the limits for path prefixes; requests_per_second 0 means unlimited
+	Routes []RouteRateLimit `json:"routes"`
+}
+
+// RouteRateLimit holds the limits of one path prefix
+type RouteRateLimit struct {
+	Prefix            string  `json:"prefix"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+}
+
+// AuthConfig holds the API key authentication settings of the public endpoints
+type AuthConfig struct {
+	Enabled bool `json:"enabled"`
+	// Header and QueryParam name where clients may send their key
+	Header     string `json:"header"`
+	QueryParam string `json:"query_param"`
+	// ClientsFile is an optional YAML or JSON file with a list of clients, merged with Clients
+	ClientsFile string         `json:"clients_file"`
+	Clients     []ClientConfig `json:"clients"`
+}
+
+// ClientConfig describes one API client and its quotas (0 means unlimited)
+type ClientConfig struct {
+	Name         string `json:"name"`
+	Key          string `json:"key"`
+	DailyQuota   int    `json:"daily_quota"`
+	MonthlyQuota int    `json:"monthly_quota"`
+	Disabled     bool   `json:"disabled"`
+}
+
+// CORSConfig holds the cross-origin settings; CORS is disabled when AllowedOrigins is empty
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	ExposedHeaders   []string `json:"exposed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	// MaxAge is how long browsers may cache preflight responses
+	MaxAge Duration `json:"max_age"`
+}
+
+// AdminConfig holds the settings of the /admin endpoints
+type AdminConfig struct {
+	// Token is required as a bearer token on admin endpoints; they are disabled when empty
+	Token string `json:"token"`
+}
+
+// ChaosConfig injects faults into the upstream calls and the API responses for
+// resilience testing. Only binaries built with the chaos tag honour it.
+type ChaosConfig struct {
+	Enabled bool `json:"enabled"`
+	// Header lets a request trigger faults, e.g. "X-Chaos: status=503, weather:timeout";
+	// empty disables header triggers
+	Header string `json:"header"`
+	// Upstream faults apply to the calls to ViaCEP and the weather provider
+	Upstream []ChaosFault `json:"upstream"`
+	// Server faults apply to the API responses
+	Server []ChaosFault `json:"server"`
+}
+
+// ChaosFault is a fault injected into a share of the requests
+type ChaosFault struct {
+	// Type is latency, timeout, reset, status or truncate
+	Type string `json:"type"`
+	// Probability is the share of requests affected, from 0 to 1
+	Probability float64 `json:"probability"`
+	// Upstream restricts an upstream fault to viacep or weather
+	Upstream string `json:"upstream"`
+	// PathPrefix restricts a server fault to the paths under it
+	PathPrefix string `json:"path_prefix"`
+	// Latency is the delay of a latency fault and how long a timeout fault hangs
+	Latency Duration `json:"latency"`
+	// Status is the status code of a status fault
+	Status int `json:"status"`
+	// Bytes is how much of the body a truncate fault lets through
+	Bytes int `json:"bytes"`
+}
+
+// cepPattern matches a CEP with or without the dash
+var cepPattern = regexp.MustCompile(`^\d{5}-?\d{3}$`)
+
+// Default returns the configuration used when nothing else is provided
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:         "0.0.0.0:8080",
+			ReadTimeout:  Duration(15 * time.Second),
+			WriteTimeout: Duration(30 * time.Second),
+		},
+		ViaCEP: ViaCEPConfig{
+			BaseURL: "https://viacep.com.br/ws",
+			Timeout: Duration(10 * time.Second),
+		},
+		Weather: WeatherConfig{
+			Provider:    ProviderWeatherAPI,
+			BaseURL:     "https://api.weatherapi.com/v1",
+			KeyStrategy: KeyStrategyRoundRobin,
+			Timeout:     Duration(10 * time.Second),
+		},
+		Cassettes: CassettesConfig{
+			Mode: CassetteModeOff,
+			Dir:  "testdata/cassettes",
+		},
+		Cache: CacheConfig{
+			CEPTTL:         Duration(24 * time.Hour),
+			WeatherTTL:     Duration(5 * time.Minute),
+			WeatherRefresh: Duration(15 * time.Minute),
+		},
+		Observations: ObservationsConfig{
+			Store:     ObservationStoreBolt,
+			Path:      "data/observations.db",
+			Retention: Duration(30 * 24 * time.Hour),
+		},
+		Prewarm: PrewarmConfig{
+			Jitter:      Duration(30 * time.Second),
+			Concurrency: 4,
+		},
+		Alerts: AlertsConfig{
+			Interval:     Duration(5 * time.Minute),
+			MaxPerClient: 100,
+			MaxAttempts:  5,
+			RetryBackoff: Duration(2 * time.Second),
+			Timeout:      Duration(10 * time.Second),
+		},
+		Stream: StreamConfig{
+			PollInterval:     Duration(time.Minute),
+			Heartbeat:        Duration(15 * time.Second),
+			MaxConnections:   1000,
+			MaxSubscriptions: 50,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:           false,
+			RequestsPerSecond: 10,
+			Burst:             20,
+			KeyBy:             "ip",
+			IdleTimeout:       Duration(10 * time.Minute),
+		},
+		Auth: AuthConfig{
+			Enabled:    false,
+			Header:     "X-API-Key",
+			QueryParam: "api_key",
+		},
+		CORS: CORSConfig{
+			// Every method routed by the API: DELETE /alerts/{id} and PUT /admin/prewarm included
+			AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-API-Key"},
+			ExposedHeaders: []string{
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+				"X-Quota-Daily-Remaining", "X-Quota-Monthly-Remaining",
+			},
+			MaxAge: Duration(10 * time.Minute),
+		},
+		Chaos: ChaosConfig{
+			Header: "X-Chaos",
+		},
+	}
+}
+
+// Validate checks that the configuration is usable, reporting every problem found
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr: %w", err))
+	}
+	if c.Server.ReadTimeout <= 0 {
+		errs = append(errs, errors.New("server.read_timeout must be positive"))
+	}
+	if c.Server.WriteTimeout <= 0 {
+		errs = append(errs, errors.New("server.write_timeout must be positive"))
+	}
+	if c.GRPC.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.GRPC.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("grpc.addr: %w", err))
+		} else if c.GRPC.Addr == c.Server.Addr {
+			errs = append(errs, errors.New("grpc.addr must differ from server.addr"))
+		}
+	}
+
+	if err := validateBaseURL(c.ViaCEP.BaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("viacep.base_url: %w", err))
+	}
+	if c.ViaCEP.Timeout <= 0 {
+		errs = append(errs, errors.New("viacep.timeout must be positive"))
+	}
+
+	switch c.Weather.Provider {
+	case ProviderWeatherAPI:
+	default:
+		errs = append(errs, fmt.Errorf("weather.provider: unsupported provider %q", c.Weather.Provider))
+	}
+	if err := validateBaseURL(c.Weather.BaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("weather.base_url: %w", err))
+	}
+	// Replayed cassettes have the key redacted, so none is needed to replay them
+	if len(c.Weather.Keys()) == 0 && c.Cassettes.Mode != CassetteModeReplay {
+		errs = append(errs, errors.New("weather.api_key is required (set WEATHER_API_KEY)"))
+	}
+	switch c.Weather.KeyStrategy {
+	case KeyStrategyRoundRobin, KeyStrategyLeastUsed:
+	default:
+		errs = append(errs, fmt.Errorf("weather.key_strategy: unsupported strategy %q", c.Weather.KeyStrategy))
+	}
+	if c.Weather.KeyMonthlyQuota < 0 {
+		errs = append(errs, errors.New("weather.key_monthly_quota must not be negative"))
+	}
+	if c.Weather.Timeout <= 0 {
+		errs = append(errs, errors.New("weather.timeout must be positive"))
+	}
+
+	switch c.Cassettes.Mode {
+	case CassetteModeOff:
+	case CassetteModeRecord, CassetteModeReplay:
+		if c.Cassettes.Dir == "" {
+			errs = append(errs, fmt.Errorf("cassettes.dir is required in %s mode", c.Cassettes.Mode))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cassettes.mode must be %s, %s or %s", CassetteModeOff, CassetteModeRecord, CassetteModeReplay))
+	}
+
+	if c.Cache.CEPTTL < 0 {
+		errs = append(errs, errors.New("cache.cep_ttl must not be negative"))
+	}
+	if c.Cache.WeatherTTL < 0 {
+		errs = append(errs, errors.New("cache.weather_ttl must not be negative"))
+	}
+	if c.Cache.WeatherRefresh < 0 {
+		errs = append(errs, errors.New("cache.weather_refresh must not be negative"))
+	}
+
+	if c.Stream.PollInterval < Duration(time.Second) {
+		errs = append(errs, errors.New("stream.poll_interval must be at least 1s"))
+	}
+	if c.Stream.Heartbeat <= 0 {
+		errs = append(errs, errors.New("stream.heartbeat must be positive"))
+	}
+	if c.Stream.MaxConnections < 1 {
+		errs = append(errs, errors.New("stream.max_connections must be at least 1"))
+	}
+	if c.Stream.MaxSubscriptions < 1 {
+		errs = append(errs, errors.New("stream.max_subscriptions must be at least 1"))
+	}
+
+	switch c.Observations.Store {
+	case ObservationStoreBolt:
+		if c.Observations.Path == "" {
+			errs = append(errs, errors.New("observations.path is required by the bolt store"))
+		}
+	case ObservationStoreMemory:
+	default:
+		errs = append(errs, fmt.Errorf("observations.store must be %s or %s", ObservationStoreBolt, ObservationStoreMemory))
+	}
+	if c.Observations.Retention < 0 {
+		errs = append(errs, errors.New("observations.retention must not be negative"))
+	}
+
+	if c.Prewarm.Jitter < 0 {
+		errs = append(errs, errors.New("prewarm.jitter must not be negative"))
+	}
+	if c.Prewarm.Concurrency < 1 {
+		errs = append(errs, errors.New("prewarm.concurrency must be at least 1"))
+	}
+	jobs := make(map[string]bool)
+	for i, job := range c.Prewarm.Jobs {
+		if job.Name == "" {
+			errs = append(errs, fmt.Errorf("prewarm.jobs[%d].name is required", i))
+		} else if jobs[job.Name] {
+			errs = append(errs, fmt.Errorf("prewarm.jobs[%d]: duplicate name %q", i, job.Name))
+		}
+		jobs[job.Name] = true
+		switch {
+		case job.Schedule != "" && job.Interval != 0:
+			errs = append(errs, fmt.Errorf("prewarm.jobs[%d]: schedule and interval are mutually exclusive", i))
+		case job.Schedule != "":
+			if _, err := cron.ParseStandard(job.Schedule); err != nil {
+				errs = append(errs, fmt.Errorf("prewarm.jobs[%d].schedule: %w", i, err))
+			}
+		case job.Interval < Duration(time.Minute):
+			errs = append(errs, fmt.Errorf("prewarm.jobs[%d]: schedule or an interval of at least 1m is required", i))
+		}
+		if job.Jitter < 0 {
+			errs = append(errs, fmt.Errorf("prewarm.jobs[%d].jitter must not be negative", i))
+		}
+		if len(job.CEPs) == 0 {
+			errs = append(errs, fmt.Errorf("prewarm.jobs[%d]: at least one CEP is required", i))
+		}
+		for _, cep := range job.CEPs {
+			if !cepPattern.MatchString(strings.TrimSpace(cep)) {
+				errs = append(errs, fmt.Errorf("prewarm.jobs[%d]: invalid CEP %q", i, cep))
+			}
+		}
+	}
+
+	if c.Alerts.Interval < Duration(time.Second) {
+		errs = append(errs, errors.New("alerts.interval must be at least 1s"))
+	}
+	if c.Alerts.MaxPerClient < 1 {
+		errs = append(errs, errors.New("alerts.max_per_client must be at least 1"))
+	}
+	if c.Alerts.MaxAttempts < 1 {
+		errs = append(errs, errors.New("alerts.max_attempts must be at least 1"))
+	}
+	if c.Alerts.RetryBackoff <= 0 {
+		errs = append(errs, errors.New("alerts.retry_backoff must be positive"))
+	}
+	if c.Alerts.Timeout <= 0 {
+		errs = append(errs, errors.New("alerts.timeout must be positive"))
+	}
+
+	if c.RateLimit.Enabled {
+		if c.RateLimit.RequestsPerSecond <= 0 {
+			errs = append(errs, errors.New("rate_limit.requests_per_second must be positive"))
+		}
+		if c.RateLimit.Burst < 1 {
+			errs = append(errs, errors.New("rate_limit.burst must be at least 1"))
+		}
+	}
+	if c.RateLimit.KeyBy != "ip" && c.RateLimit.KeyBy != "api_key" {
+		errs = append(errs, fmt.Errorf("rate_limit.key_by: must be ip or api_key, got %q", c.RateLimit.KeyBy))
+	}
+	if c.RateLimit.TrustedProxyHops < 0 {
+		errs = append(errs, errors.New("rate_limit.trusted_proxy_hops must not be negative"))
+	}
+	if c.RateLimit.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("rate_limit.idle_timeout must be positive"))
+	}
+	for i, route := range c.RateLimit.Routes {
+		if !strings.HasPrefix(route.Prefix, "/") {
+			errs = append(errs, fmt.Errorf("rate_limit.routes[%d].prefix must start with /", i))
+		}
+		if route.RequestsPerSecond < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.routes[%d].requests_per_second must not be negative", i))
+		}
+		if route.RequestsPerSecond > 0 && route.Burst < 1 {
+			errs = append(errs, fmt.Errorf("rate_limit.routes[%d].burst must be at least 1", i))
+		}
+	}
+
+	if c.Auth.Enabled {
+		if c.Auth.Header == "" && c.Auth.QueryParam == "" {
+			errs = append(errs, errors.New("auth: header or query_param is required"))
+		}
+		if len(c.Auth.Clients) == 0 {
+			errs = append(errs, errors.New("auth: at least one client is required when enabled"))
+		}
+	}
+	if c.CORS.AllowCredentials {
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New("cors.allow_credentials can't be used with the * origin"))
+			}
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, errors.New("cors.max_age must not be negative"))
+	}
+
+	for i, fault := range c.Chaos.Upstream {
+		errs = append(errs, validateChaosFault(fmt.Sprintf("chaos.upstream[%d]", i), fault)...)
+		switch fault.Upstream {
+		case "", UpstreamViaCEP, UpstreamWeather:
+		default:
+			errs = append(errs, fmt.Errorf("chaos.upstream[%d].upstream must be %s or %s", i, UpstreamViaCEP, UpstreamWeather))
+		}
+		if fault.PathPrefix != "" {
+			errs = append(errs, fmt.Errorf("chaos.upstream[%d]: path_prefix only applies to server faults", i))
+		}
+	}
+	for i, fault := range c.Chaos.Server {
+		errs = append(errs, validateChaosFault(fmt.Sprintf("chaos.server[%d]", i), fault)...)
+		if fault.PathPrefix != "" && !strings.HasPrefix(fault.PathPrefix, "/") {
+			errs = append(errs, fmt.Errorf("chaos.server[%d].path_prefix must start with /", i))
+		}
+		if fault.Upstream != "" {
+			errs = append(errs, fmt.Errorf("chaos.server[%d]: upstream only applies to upstream faults", i))
+		}
+	}
+
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for i, client := range c.Auth.Clients {
+		if client.Name == "" {
+			errs = append(errs, fmt.Errorf("auth.clients[%d].name is required", i))
+		} else if names[client.Name] {
+			errs = append(errs, fmt.Errorf("auth.clients[%d]: duplicate name %q", i, client.Name))
+		}
+		if client.Key == "" {
+			errs = append(errs, fmt.Errorf("auth.clients[%d].key is required", i))
+		} else if keys[client.Key] {
+			errs = append(errs, fmt.Errorf("auth.clients[%d]: duplicate key", i))
+		}
+		if client.DailyQuota < 0 || client.MonthlyQuota < 0 {
+			errs = append(errs, fmt.Errorf("auth.clients[%d]: quotas must not be negative", i))
+		}
+		names[client.Name] = true
+		keys[client.Key] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// Masked returns a copy of the configuration with secrets masked, safe for logging
+func (c *Config) Masked() *Config {
+	masked := *c
+	masked.Weather.APIKey = secret.Mask(c.Weather.APIKey)
+	if c.Weather.APIKeys != nil {
+		masked.Weather.APIKeys = make([]string, len(c.Weather.APIKeys))
+		for i, key := range c.Weather.APIKeys {
+			masked.Weather.APIKeys[i] = secret.Mask(key)
+		}
+	}
+	if c.Auth.Clients != nil {
+		masked.Auth.Clients = make([]ClientConfig, len(c.Auth.Clients))
+		for i, client := range c.Auth.Clients {
+			client.Key = secret.Mask(client.Key)
+			masked.Auth.Clients[i] = client
+		}
+	}
+	masked.Admin.Token = secret.Mask(c.Admin.Token)
+	return &masked
+}
+
+// String renders the masked configuration as indented JSON
+func (c *Config) String() string {
+	data, err := json.MarshalIndent(c.Masked(), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("<invalid config: %v>", err)
+	}
+	return string(data)
+}
+
+func validateChaosFault(name string, fault ChaosFault) []error {
+	var errs []error
+	switch fault.Type {
+	case ChaosLatency:
+		if fault.Latency <= 0 {
+			errs = append(errs, fmt.Errorf("%s.latency must be positive", name))
+		}
+	case ChaosTimeout, ChaosReset, ChaosTruncate:
+	case ChaosStatus:
+		if fault.Status < 400 || fault.Status > 599 {
+			errs = append(errs, fmt.Errorf("%s.status must be an error status", name))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s.type must be %s, %s, %s, %s or %s", name, ChaosLatency, ChaosTimeout, ChaosReset, ChaosStatus, ChaosTruncate))
+	}
+	if fault.Probability <= 0 || fault.Probability > 1 {
+		errs = append(errs, fmt.Errorf("%s.probability must be greater than 0 and at most 1", name))
+	}
+	if fault.Latency < 0 {
+		errs = append(errs, fmt.Errorf("%s.latency must not be negative", name))
+	}
+	if fault.Bytes < 0 {
+		errs = append(errs, fmt.Errorf("%s.bytes must not be negative", name))
+	}
+	return errs
+}
+
+func validateBaseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("host is required")
+	}
+	return nil
+}
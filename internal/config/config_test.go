@@ -0,0 +1,385 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envMap(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, opts, err := Load(nil, envMap(map[string]string{"WEATHER_API_KEY": "key"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Server.Addr != "0.0.0.0:8080" {
+		t.Errorf("expected default addr, got %q", cfg.Server.Addr)
+	}
+	if cfg.Weather.Timeout.Std() != 10*time.Second {
+		t.Errorf("expected default weather timeout 10s, got %v", cfg.Weather.Timeout)
+	}
+	if opts.PrintConfig {
+		t.Error("expected print-config to be false by default")
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  addr: "127.0.0.1:9000"
+weather:
+  api_key: file-key
+  timeout: 3s
+cache:
+  weather_ttl: 1m
+`)
+
+	t.Run("file overrides defaults", func(t *testing.T) {
+		cfg, _, err := Load([]string{"-config", yamlFile}, envMap(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.Server.Addr != "127.0.0.1:9000" {
+			t.Errorf("expected addr from file, got %q", cfg.Server.Addr)
+		}
+		if cfg.Weather.APIKey != "file-key" {
+			t.Errorf("expected api key from file, got %q", cfg.Weather.APIKey)
+		}
+		if cfg.Cache.WeatherTTL.Std() != time.Minute {
+			t.Errorf("expected weather ttl 1m, got %v", cfg.Cache.WeatherTTL)
+		}
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		cfg, _, err := Load(nil, envMap(map[string]string{
+			"CONFIG_FILE":     yamlFile,
+			"PORT":            "7000",
+			"WEATHER_API_KEY": "env-key",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.Server.Addr != "0.0.0.0:7000" {
+			t.Errorf("expected addr from PORT, got %q", cfg.Server.Addr)
+		}
+		if cfg.Weather.APIKey != "env-key" {
+			t.Errorf("expected api key from env, got %q", cfg.Weather.APIKey)
+		}
+	})
+
+	t.Run("flags override env", func(t *testing.T) {
+		cfg, _, err := Load(
+			[]string{"-config", yamlFile, "-weather-timeout", "7s", "-addr", ":9100"},
+			envMap(map[string]string{"WEATHER_TIMEOUT": "5s"}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.Weather.Timeout.Std() != 7*time.Second {
+			t.Errorf("expected weather timeout from flag, got %v", cfg.Weather.Timeout)
+		}
+		if cfg.Server.Addr != ":9100" {
+			t.Errorf("expected addr from flag, got %q", cfg.Server.Addr)
+		}
+	})
+}
+
+func TestLoad_JSONFile(t *testing.T) {
+	jsonFile := writeFile(t, "config.json", `{"weather": {"api_key": "json-key", "timeout": 2}}`)
+
+	cfg, _, err := Load([]string{"--config", jsonFile, "--print-config"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Weather.Timeout.Std() != 2*time.Second {
+		t.Errorf("expected numeric timeout as seconds, got %v", cfg.Weather.Timeout)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		wantErr string
+	}{
+		{
+			name:    "missing api key",
+			wantErr: "weather.api_key is required",
+		},
+		{
+			name:    "unknown field in file",
+			file:    "weather:\n  api_kye: typo\n",
+			env:     map[string]string{"WEATHER_API_KEY": "key"},
+			wantErr: "unknown field",
+		},
+		{
+			name:    "invalid env duration",
+			env:     map[string]string{"WEATHER_API_KEY": "key", "VIACEP_TIMEOUT": "soon"},
+			wantErr: "env VIACEP_TIMEOUT",
+		},
+		{
+			name:    "unsupported provider",
+			args:    []string{"-weather-provider", "openweather"},
+			env:     map[string]string{"WEATHER_API_KEY": "key"},
+			wantErr: "unsupported provider",
+		},
+		{
+			name:    "invalid base url",
+			args:    []string{"-viacep-base-url", "viacep.com.br"},
+			env:     map[string]string{"WEATHER_API_KEY": "key"},
+			wantErr: "viacep.base_url",
+		},
+		{
+			name:    "invalid rate limit",
+			args:    []string{"-rate-limit-enabled", "true", "-rate-limit-burst", "0"},
+			env:     map[string]string{"WEATHER_API_KEY": "key"},
+			wantErr: "rate_limit.burst",
+		},
+		{
+			name:    "unknown observation store",
+			env:     map[string]string{"WEATHER_API_KEY": "key", "OBSERVATIONS_STORE": "sqlite"},
+			wantErr: "observations.store",
+		},
+		{
+			name:    "unknown cassette mode",
+			env:     map[string]string{"WEATHER_API_KEY": "key", "CASSETTE_MODE": "rewind"},
+			wantErr: "cassettes.mode",
+		},
+		{
+			name:    "cassettes without a directory",
+			args:    []string{"-cassette-mode", "record", "-cassette-dir", ""},
+			env:     map[string]string{"WEATHER_API_KEY": "key"},
+			wantErr: "cassettes.dir is required in record mode",
+		},
+		{
+			name:    "recording needs the api key",
+			env:     map[string]string{"CASSETTE_MODE": "record"},
+			wantErr: "weather.api_key is required",
+		},
+		{
+			name:    "invalid prewarm concurrency",
+			env:     map[string]string{"WEATHER_API_KEY": "key", "PREWARM_CONCURRENCY": "0"},
+			wantErr: "prewarm.concurrency",
+		},
+		{
+			name:    "invalid alert attempts",
+			env:     map[string]string{"WEATHER_API_KEY": "key", "ALERTS_MAX_ATTEMPTS": "0"},
+			wantErr: "alerts.max_attempts",
+		},
+		{
+			name:    "invalid stream limit",
+			env:     map[string]string{"WEATHER_API_KEY": "key", "STREAM_MAX_CONNECTIONS": "0"},
+			wantErr: "stream.max_connections",
+		},
+		{
+			name:    "grpc on the http address",
+			args:    []string{"-addr", "0.0.0.0:8080", "-grpc-addr", "0.0.0.0:8080"},
+			env:     map[string]string{"WEATHER_API_KEY": "key"},
+			wantErr: "grpc.addr must differ",
+		},
+		{
+			name:    "credentials with any origin",
+			file:    "cors:\n  allowed_origins: [\"*\"]\n  allow_credentials: true\n",
+			env:     map[string]string{"WEATHER_API_KEY": "key"},
+			wantErr: "cors.allow_credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "config.yaml", tt.file)}, args...)
+			}
+
+			_, _, err := Load(args, envMap(tt.env))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %q", tt.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoad_ReplayNeedsNoKey(t *testing.T) {
+	cfg, _, err := Load([]string{"-cassette-mode", "replay"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Cassettes.Dir != "testdata/cassettes" {
+		t.Errorf("expected the default cassette directory, got %q", cfg.Cassettes.Dir)
+	}
+}
+
+func TestConfig_String_MasksSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Weather.APIKey = "abcdefghijkl1234"
+
+	out := cfg.String()
+	if strings.Contains(out, "abcdefghijkl") {
+		t.Errorf("expected api key to be masked, got %s", out)
+	}
+	if !strings.Contains(out, "****1234") {
+		t.Errorf("expected masked api key suffix, got %s", out)
+	}
+	if cfg.Weather.APIKey != "abcdefghijkl1234" {
+		t.Error("masking must not modify the original config")
+	}
+}
+
+func TestLoad_ClientsFile(t *testing.T) {
+	clientsFile := writeFile(t, "clients.yaml", `
+clients:
+  - name: erp
+    key: erp-key
+    daily_quota: 1000
+`)
+	configFile := writeFile(t, "config.yaml", `
+auth:
+  enabled: true
+  clients_file: `+clientsFile+`
+  clients:
+    - name: dashboard
+      key: dashboard-key
+`)
+
+	cfg, _, err := Load([]string{"-config", configFile}, envMap(map[string]string{"WEATHER_API_KEY": "key"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Auth.Clients) != 2 {
+		t.Fatalf("expected clients from config and clients file, got %+v", cfg.Auth.Clients)
+	}
+	if cfg.Auth.Clients[1].Name != "erp" || cfg.Auth.Clients[1].DailyQuota != 1000 {
+		t.Errorf("unexpected client from file: %+v", cfg.Auth.Clients[1])
+	}
+	if strings.Contains(cfg.String(), "dashboard-key") {
+		t.Error("expected client keys to be masked")
+	}
+
+	_, _, err = Load([]string{"-auth-enabled", "true"}, envMap(map[string]string{"WEATHER_API_KEY": "key"}))
+	if err == nil || !strings.Contains(err.Error(), "at least one client") {
+		t.Errorf("expected error for auth without clients, got %v", err)
+	}
+}
+
+func TestLoad_PrewarmJobs(t *testing.T) {
+	cepsFile := writeFile(t, "ceps.yaml", `
+ceps:
+  - 20040-020
+  - "30130010"
+`)
+	configFile := writeFile(t, "config.yaml", `
+prewarm:
+  jobs:
+    - name: distribution-centers
+      schedule: "*/15 * * * *"
+      ceps: ["01310-100"]
+      ceps_file: `+cepsFile+`
+    - name: stores
+      interval: 10m
+      jitter: 1m
+      ceps: ["01311000"]
+`)
+
+	cfg, _, err := Load([]string{"-config", configFile}, envMap(map[string]string{"WEATHER_API_KEY": "key"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jobs := cfg.Prewarm.Jobs
+	if len(jobs) != 2 || len(jobs[0].CEPs) != 3 || jobs[0].CEPs[2] != "30130010" {
+		t.Fatalf("expected CEPs from the config and the CEPs file, got %+v", jobs)
+	}
+	if jobs[1].Interval.Std() != 10*time.Minute || jobs[1].Jitter.Std() != time.Minute {
+		t.Errorf("unexpected interval job %+v", jobs[1])
+	}
+
+	tests := []struct {
+		name    string
+		job     string
+		wantErr string
+	}{
+		{"no schedule", `{name: a, ceps: ["01310100"]}`, "schedule or an interval"},
+		{"both", `{name: a, schedule: "@hourly", interval: 1h, ceps: ["01310100"]}`, "mutually exclusive"},
+		{"bad cron", `{name: a, schedule: "every day", ceps: ["01310100"]}`, "schedule"},
+		{"bad cep", `{name: a, interval: 1h, ceps: ["0131"]}`, "invalid CEP"},
+		{"no ceps", `{name: a, interval: 1h}`, "at least one CEP"},
+		{"missing file", `{name: a, interval: 1h, ceps_file: /nonexistent/ceps.yaml}`, "CEPs file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := writeFile(t, "config.yaml", "prewarm:\n  jobs:\n    - "+tt.job+"\n")
+			_, _, err := Load([]string{"-config", configFile}, envMap(map[string]string{"WEATHER_API_KEY": "key"}))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoad_ChaosFaults(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", `
+chaos:
+  enabled: true
+  upstream:
+    - {type: latency, probability: 0.5, upstream: weather, latency: 2s}
+    - {type: reset, probability: 0.01}
+  server:
+    - {type: status, probability: 0.1, status: 503, path_prefix: /v2}
+`)
+	cfg, _, err := Load([]string{"-config", configFile}, envMap(map[string]string{"WEATHER_API_KEY": "key"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Chaos.Header != "X-Chaos" {
+		t.Errorf("expected the default trigger header, got %q", cfg.Chaos.Header)
+	}
+	if len(cfg.Chaos.Upstream) != 2 || cfg.Chaos.Upstream[0].Latency.Std() != 2*time.Second {
+		t.Errorf("unexpected upstream faults %+v", cfg.Chaos.Upstream)
+	}
+
+	tests := []struct {
+		name    string
+		chaos   string
+		wantErr string
+	}{
+		{"unknown type", `upstream: [{type: slow, probability: 1}]`, "chaos.upstream[0].type"},
+		{"no probability", `server: [{type: reset}]`, "chaos.server[0].probability"},
+		{"latency without a duration", `upstream: [{type: latency, probability: 1}]`, "chaos.upstream[0].latency must be positive"},
+		{"status out of range", `server: [{type: status, probability: 1, status: 200}]`, "chaos.server[0].status"},
+		{"unknown upstream", `upstream: [{type: reset, probability: 1, upstream: ibge}]`, "chaos.upstream[0].upstream"},
+		{"path on an upstream fault", `upstream: [{type: reset, probability: 1, path_prefix: /v1}]`, "path_prefix only applies"},
+		{"relative path", `server: [{type: reset, probability: 1, path_prefix: v1}]`, "must start with /"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := writeFile(t, "config.yaml", "chaos:\n  "+tt.chaos+"\n")
+			_, _, err := Load([]string{"-config", configFile}, envMap(map[string]string{"WEATHER_API_KEY": "key"}))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Options holds command-line switches that control loading rather than the service itself
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+// setting describes one overridable configuration value and where it can come from
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"addr", "LISTEN_ADDR", "listen address (host:port)", func(c *Config, v string) error {
+		c.Server.Addr = v
+		return nil
+	}},
+	{"read-timeout", "SERVER_READ_TIMEOUT", "HTTP server read timeout", func(c *Config, v string) error {
+		return setDuration(&c.Server.ReadTimeout, v)
+	}},
+	{"write-timeout", "SERVER_WRITE_TIMEOUT", "HTTP server write timeout", func(c *Config, v string) error {
+		return setDuration(&c.Server.WriteTimeout, v)
+	}},
+	{"grpc-addr", "GRPC_ADDR", "gRPC listen address (host:port, empty disables)", func(c *Config, v string) error {
+		c.GRPC.Addr = v
+		return nil
+	}},
+	{"viacep-base-url", "VIACEP_BASE_URL", "viaCEP API base URL", func(c *Config, v string) error {
+		c.ViaCEP.BaseURL = v
+		return nil
+	}},
+	{"viacep-timeout", "VIACEP_TIMEOUT", "viaCEP request timeout", func(c *Config, v string) error {
+		return setDuration(&c.ViaCEP.Timeout, v)
+	}},
+	{"weather-provider", "WEATHER_PROVIDER", "weather provider (weatherapi)", func(c *Config, v string) error {
+		c.Weather.Provider = v
+		return nil
+	}},
+	{"weather-base-url", "WEATHER_BASE_URL", "weather provider base URL", func(c *Config, v string) error {
+		c.Weather.BaseURL = v
+		return nil
+	}},
+	{"weather-api-key", "WEATHER_API_KEY", "weather provider API key", func(c *Config, v string) error {
+		c.Weather.APIKey = v
+		return nil
+	}},
+	{"weather-api-keys", "WEATHER_API_KEYS", "comma-separated pool of weather provider API keys", func(c *Config, v string) error {
+		c.Weather.APIKeys = splitList(v)
+		return nil
+	}},
+	{"weather-key-strategy", "WEATHER_KEY_STRATEGY", "API key selection strategy (round_robin, least_used)", func(c *Config, v string) error {
+		c.Weather.KeyStrategy = v
+		return nil
+	}},
+	{"weather-key-monthly-quota", "WEATHER_KEY_MONTHLY_QUOTA", "monthly calls allowed per API key (0 means unlimited)", func(c *Config, v string) error {
+		quota, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Weather.KeyMonthlyQuota = quota
+		return nil
+	}},
+	{"weather-timeout", "WEATHER_TIMEOUT", "weather provider request timeout", func(c *Config, v string) error {
+		return setDuration(&c.Weather.Timeout, v)
+	}},
+	{"cassette-mode", "CASSETTE_MODE", "record or replay the upstream traffic: off, record or replay", func(c *Config, v string) error {
+		c.Cassettes.Mode = v
+		return nil
+	}},
+	{"cassette-dir", "CASSETTE_DIR", "directory of the upstream cassettes", func(c *Config, v string) error {
+		c.Cassettes.Dir = v
+		return nil
+	}},
+	{"cache-cep-ttl", "CACHE_CEP_TTL", "TTL of cached CEP lookups (0 disables)", func(c *Config, v string) error {
+		return setDuration(&c.Cache.CEPTTL, v)
+	}},
+	{"cache-weather-ttl", "CACHE_WEATHER_TTL", "TTL of cached weather lookups (0 disables)", func(c *Config, v string) error {
+		return setDuration(&c.Cache.WeatherTTL, v)
+	}},
+	{"cache-weather-refresh", "CACHE_WEATHER_REFRESH", "provider refresh interval, bounds Cache-Control max-age (0 disables client caching)", func(c *Config, v string) error {
+		return setDuration(&c.Cache.WeatherRefresh, v)
+	}},
+	{"stream-poll-interval", "STREAM_POLL_INTERVAL", "how often streamed CEPs are looked up", func(c *Config, v string) error {
+		return setDuration(&c.Stream.PollInterval, v)
+	}},
+	{"stream-heartbeat", "STREAM_HEARTBEAT", "keep-alive interval of idle streams", func(c *Config, v string) error {
+		return setDuration(&c.Stream.Heartbeat, v)
+	}},
+	{"stream-max-connections", "STREAM_MAX_CONNECTIONS", "maximum concurrent streams", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Stream.MaxConnections = n
+		return nil
+	}},
+	{"stream-max-subscriptions", "STREAM_MAX_SUBSCRIPTIONS", "maximum CEPs per WebSocket connection", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Stream.MaxSubscriptions = n
+		return nil
+	}},
+	{"observations-store", "OBSERVATIONS_STORE", "observation store: bolt or memory", func(c *Config, v string) error {
+		c.Observations.Store = v
+		return nil
+	}},
+	{"observations-path", "OBSERVATIONS_PATH", "file of the bolt observation store", func(c *Config, v string) error {
+		c.Observations.Path = v
+		return nil
+	}},
+	{"observations-retention", "OBSERVATIONS_RETENTION", "how long observations are kept (0 keeps them forever)", func(c *Config, v string) error {
+		return setDuration(&c.Observations.Retention, v)
+	}},
+	{"prewarm-jitter", "PREWARM_JITTER", "maximum random delay added to each prewarm run", func(c *Config, v string) error {
+		return setDuration(&c.Prewarm.Jitter, v)
+	}},
+	{"prewarm-concurrency", "PREWARM_CONCURRENCY", "simultaneous weather lookups of a prewarm run", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Prewarm.Concurrency = n
+		return nil
+	}},
+	{"alerts-interval", "ALERTS_INTERVAL", "how often alerts are evaluated", func(c *Config, v string) error {
+		return setDuration(&c.Alerts.Interval, v)
+	}},
+	{"alerts-max-per-client", "ALERTS_MAX_PER_CLIENT", "maximum alerts per API client", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Alerts.MaxPerClient = n
+		return nil
+	}},
+	{"alerts-max-attempts", "ALERTS_MAX_ATTEMPTS", "webhook attempts before dead-lettering", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Alerts.MaxAttempts = n
+		return nil
+	}},
+	{"alerts-retry-backoff", "ALERTS_RETRY_BACKOFF", "wait before the first webhook retry, doubled on each retry", func(c *Config, v string) error {
+		return setDuration(&c.Alerts.RetryBackoff, v)
+	}},
+	{"alerts-timeout", "ALERTS_TIMEOUT", "timeout of each webhook attempt", func(c *Config, v string) error {
+		return setDuration(&c.Alerts.Timeout, v)
+	}},
+	{"alerts-allow-private-webhooks", "ALERTS_ALLOW_PRIVATE_WEBHOOKS", "allow webhooks to loopback and private addresses", func(c *Config, v string) error {
+		allowed, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.Alerts.AllowPrivateWebhooks = allowed
+		return nil
+	}},
+	{"rate-limit-enabled", "RATE_LIMIT_ENABLED", "enable request rate limiting", func(c *Config, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.RateLimit.Enabled = enabled
+		return nil
+	}},
+	{"rate-limit-rps", "RATE_LIMIT_RPS", "allowed requests per second", func(c *Config, v string) error {
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		c.RateLimit.RequestsPerSecond = rps
+		return nil
+	}},
+	{"rate-limit-burst", "RATE_LIMIT_BURST", "allowed request burst", func(c *Config, v string) error {
+		burst, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.RateLimit.Burst = burst
+		return nil
+	}},
+	{"auth-enabled", "AUTH_ENABLED", "require an API key on public endpoints", func(c *Config, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.Auth.Enabled = enabled
+		return nil
+	}},
+	{"auth-clients-file", "AUTH_CLIENTS_FILE", "YAML or JSON file with the API clients", func(c *Config, v string) error {
+		c.Auth.ClientsFile = v
+		return nil
+	}},
+	{"rate-limit-key-by", "RATE_LIMIT_KEY_BY", "identify rate limited clients by ip or api_key", func(c *Config, v string) error {
+		c.RateLimit.KeyBy = v
+		return nil
+	}},
+	{"rate-limit-trusted-proxy-hops", "RATE_LIMIT_TRUSTED_PROXY_HOPS", "proxies appending to X-Forwarded-For (1 on Cloud Run)", func(c *Config, v string) error {
+		hops, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.RateLimit.TrustedProxyHops = hops
+		return nil
+	}},
+	{"cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma-separated origins allowed by CORS (* for any)", func(c *Config, v string) error {
+		c.CORS.AllowedOrigins = splitList(v)
+		return nil
+	}},
+	{"admin-token", "ADMIN_TOKEN", "bearer token for /admin endpoints (disabled when empty)", func(c *Config, v string) error {
+		c.Admin.Token = v
+		return nil
+	}},
+	{"chaos-enabled", "CHAOS_ENABLED", "inject the configured faults (only in builds with the chaos tag)", func(c *Config, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		c.Chaos.Enabled = enabled
+		return nil
+	}},
+	{"chaos-header", "CHAOS_HEADER", "request header that triggers faults (empty disables header triggers)", func(c *Config, v string) error {
+		c.Chaos.Header = v
+		return nil
+	}},
+}
+
+// Load builds the effective configuration from defaults, the config file, environment
+// variables and command-line flags, in increasing order of precedence, and validates it.
+// The config file is taken from -config or CONFIG_FILE and may be YAML or JSON.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, *Options, error) {
+	fs := flag.NewFlagSet("weather-by-cep", flag.ContinueOnError)
+
+	opts := &Options{}
+	fs.StringVar(&opts.ConfigFile, "config", "", "path to a YAML or JSON config file (env CONFIG_FILE)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration (secrets masked) and exit")
+
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if opts.ConfigFile == "" {
+		opts.ConfigFile, _ = lookupEnv("CONFIG_FILE")
+	}
+
+	cfg := Default()
+	if opts.ConfigFile != "" {
+		if err := loadFile(cfg, opts.ConfigFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := applyEnv(cfg, lookupEnv); err != nil {
+		return nil, nil, err
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(cfg, *flagValues[s.flag]); err != nil {
+					flagErr = fmt.Errorf("flag -%s: %w", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	if cfg.Auth.ClientsFile != "" {
+		if err := loadClientsFile(cfg, cfg.Auth.ClientsFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for i := range cfg.Prewarm.Jobs {
+		if err := loadCEPsFile(&cfg.Prewarm.Jobs[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, opts, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := Decode(cfg, data); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadClientsFile appends the clients listed in a YAML or JSON file to the configured ones
+func loadClientsFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read clients file: %w", err)
+	}
+
+	var file struct {
+		Clients []ClientConfig `json:"clients"`
+	}
+	if err := Decode(&file, data); err != nil {
+		return fmt.Errorf("failed to parse clients file %s: %w", path, err)
+	}
+
+	cfg.Auth.Clients = append(cfg.Auth.Clients, file.Clients...)
+	return nil
+}
+
+// loadCEPsFile appends the CEPs listed in the YAML or JSON file of a prewarm job to its configured ones
+func loadCEPsFile(job *PrewarmJobConfig) error {
+	if job.CEPsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(job.CEPsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CEPs file: %w", err)
+	}
+
+	var file struct {
+		CEPs []string `json:"ceps"`
+	}
+	if err := Decode(&file, data); err != nil {
+		return fmt.Errorf("failed to parse CEPs file %s: %w", job.CEPsFile, err)
+	}
+
+	job.CEPs = append(job.CEPs, file.CEPs...)
+	return nil
+}
+
+// Decode parses YAML (and therefore JSON) and applies it through the JSON tags,
+// so both formats share the same field names and strict unknown-field checks.
+func Decode(target interface{}, data []byte) error {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		return nil
+	}
+
+	normalized, err := json.Marshal(normalizeYAML(raw))
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(normalized))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(target); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} nodes yaml may produce into JSON-encodable maps
+func normalizeYAML(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = normalizeYAML(item)
+		}
+		return value
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[fmt.Sprint(k)] = normalizeYAML(item)
+		}
+		return out
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeYAML(item)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+func applyEnv(cfg *Config, lookupEnv func(string) (string, bool)) error {
+	// PORT is what Cloud Run and docker-compose set; LISTEN_ADDR wins when both exist
+	if port, ok := lookupEnv("PORT"); ok && port != "" {
+		cfg.Server.Addr = "0.0.0.0:" + port
+	}
+
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.set(cfg, value); err != nil {
+			return fmt.Errorf("env %s: %w", s.env, err)
+		}
+	}
+	return nil
+}
+
+// splitList parses a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func setDuration(d *Duration, value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
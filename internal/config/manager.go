@@ -0,0 +1,264 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ReloadFunc is called after a new configuration has been validated and published
+type ReloadFunc func(prev, next *Config)
+
+// Manager holds the current configuration and reloads it from the same sources used at startup
+type Manager struct {
+	args      []string
+	lookupEnv func(string) (string, bool)
+	path      string
+
+	current     atomic.Pointer[Config]
+	mu          sync.Mutex
+	subscribers []ReloadFunc
+	fileHash    [sha256.Size]byte
+}
+
+// NewManager loads the configuration and returns a manager able to reload it
+func NewManager(args []string, lookupEnv func(string) (string, bool)) (*Manager, *Options, error) {
+	cfg, opts, err := Load(args, lookupEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := &Manager{
+		args:      args,
+		lookupEnv: lookupEnv,
+		path:      opts.ConfigFile,
+	}
+	m.current.Store(cfg)
+	m.fileHash, _ = m.hashFile()
+
+	return m, opts, nil
+}
+
+// Current returns the configuration in effect; callers must not modify it
+func (m *Manager) Current() *Config {
+	return m.current.Load()
+}
+
+// Subscribe registers a function to apply reloaded configurations
+func (m *Manager) Subscribe(fn ReloadFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// Reload re-reads every configuration source, validates the result and, when it
+// differs from the current one, publishes it to subscribers. An invalid configuration
+// is rejected and the current one stays in effect.
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg, _, err := Load(m.args, m.lookupEnv)
+	if err != nil {
+		return err
+	}
+
+	old := m.current.Load()
+	changes := Diff(old, cfg)
+	if len(changes) == 0 {
+		m.fileHash, _ = m.hashFile()
+		log.Printf("Configuration reloaded, no changes")
+		return nil
+	}
+
+	for _, change := range changes {
+		if restart, ok := restartRequired[change.Path]; ok && restart {
+			log.Printf("Configuration change to %s requires a restart to take effect", change.Path)
+		}
+	}
+	log.Printf("Configuration reloaded:\n%s", formatChanges(changes))
+
+	m.current.Store(cfg)
+	m.fileHash, _ = m.hashFile()
+	for _, fn := range m.subscribers {
+		fn(old, cfg)
+	}
+	return nil
+}
+
+// Watch reloads the configuration on SIGHUP and whenever the config file content
+// changes, checking the file every interval. It blocks until ctx is cancelled.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if len(watchedFiles(m.path, m.Current())) > 0 && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("Received SIGHUP, reloading configuration")
+			if err := m.Reload(); err != nil {
+				log.Printf("Configuration reload rejected: %v", err)
+			}
+		case <-tick:
+			if !m.fileChanged() {
+				continue
+			}
+			log.Printf("Config file %s changed, reloading configuration", m.path)
+			if err := m.Reload(); err != nil {
+				log.Printf("Configuration reload rejected: %v", err)
+			}
+		}
+	}
+}
+
+func (m *Manager) fileChanged() bool {
+	hash, err := m.hashFile()
+	if err != nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hash == m.fileHash {
+		return false
+	}
+	// Remember the content even if it turns out invalid, so it is not retried every tick
+	m.fileHash = hash
+	return true
+}
+
+// watchedFiles lists the config file and the files it points to
+func watchedFiles(path string, cfg *Config) []string {
+	var files []string
+	if path != "" {
+		files = append(files, path)
+	}
+	if cfg.Auth.ClientsFile != "" {
+		files = append(files, cfg.Auth.ClientsFile)
+	}
+	for _, job := range cfg.Prewarm.Jobs {
+		if job.CEPsFile != "" {
+			files = append(files, job.CEPsFile)
+		}
+	}
+	return files
+}
+
+// hashFile fingerprints the config file and the clients and CEPs files it points to
+func (m *Manager) hashFile() ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, path := range watchedFiles(m.path, m.Current()) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		h.Write(data)
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// restartRequired lists settings that are only read at startup
+var restartRequired = map[string]bool{
+	"server.addr":          true,
+	"server.read_timeout":  true,
+	"server.write_timeout": true,
+	"grpc.addr":            true,
+	"weather.provider":     true,
+	"cassettes.mode":       true,
+	"cassettes.dir":        true,
+	"observations.store":   true,
+	"observations.path":    true,
+}
+
+// Change describes one setting that differs between two configurations
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+// Diff lists the settings that differ between two configurations, with secrets masked
+func Diff(prev, next *Config) []Change {
+	oldValues := flatten(prev)
+	newValues := flatten(next)
+	oldMasked := flatten(prev.Masked())
+	newMasked := flatten(next.Masked())
+
+	var changes []Change
+	for path, newValue := range newValues {
+		if oldValue := oldValues[path]; oldValue != newValue {
+			change := Change{Path: path, Old: oldMasked[path], New: newMasked[path]}
+			if change.Old == change.New {
+				change.New += " (changed)"
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func formatChanges(changes []Change) string {
+	var buf bytes.Buffer
+	for _, c := range changes {
+		fmt.Fprintf(&buf, "  %s: %s -> %s\n", c.Path, c.Old, c.New)
+	}
+	return buf.String()
+}
+
+// flatten renders a configuration as dotted paths mapped to their JSON values
+func flatten(cfg *Config) map[string]string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil
+	}
+
+	out := make(map[string]string)
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		if node, ok := v.(map[string]interface{}); ok {
+			for k, child := range node {
+				path := k
+				if prefix != "" {
+					path = prefix + "." + k
+				}
+				walk(path, child)
+			}
+			return
+		}
+		encoded, _ := json.Marshal(v)
+		out[prefix] = string(encoded)
+	}
+	walk("", tree)
+	return out
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestManager_Reload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "weather:\n  api_key: first-key-0001\n")
+
+	manager, _, err := NewManager([]string{"-config", path, "-viacep-timeout", "4s"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var calls int
+	var prevKey, nextKey string
+	manager.Subscribe(func(prev, next *Config) {
+		calls++
+		prevKey, nextKey = prev.Weather.APIKey, next.Weather.APIKey
+	})
+
+	t.Run("applies valid changes", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("weather:\n  api_key: second-key-0002\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if !manager.fileChanged() {
+			t.Error("expected file change to be detected")
+		}
+		if err := manager.Reload(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if calls != 1 {
+			t.Fatalf("expected 1 subscriber call, got %d", calls)
+		}
+		if prevKey != "first-key-0001" || nextKey != "second-key-0002" {
+			t.Errorf("unexpected keys passed to subscriber: %q -> %q", prevKey, nextKey)
+		}
+		if manager.Current().Weather.APIKey != "second-key-0002" {
+			t.Errorf("expected current config to be swapped, got %q", manager.Current().Weather.APIKey)
+		}
+		if manager.Current().ViaCEP.Timeout.String() != "4s" {
+			t.Errorf("expected flags to still apply after reload, got %v", manager.Current().ViaCEP.Timeout)
+		}
+	})
+
+	t.Run("skips subscribers when nothing changed", func(t *testing.T) {
+		if err := manager.Reload(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected no new subscriber call, got %d calls", calls)
+		}
+	})
+
+	t.Run("rejects invalid configuration", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("weather:\n  timeout: -1s\n  api_key: third-key-0003\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := manager.Reload(); err == nil {
+			t.Fatal("expected error for invalid configuration")
+		}
+		if manager.Current().Weather.APIKey != "second-key-0002" {
+			t.Errorf("expected previous config to stay in effect, got %q", manager.Current().Weather.APIKey)
+		}
+		if calls != 1 {
+			t.Errorf("expected no subscriber call for rejected config, got %d calls", calls)
+		}
+	})
+}
+
+func TestDiff(t *testing.T) {
+	prev := Default()
+	prev.Weather.APIKey = "abcdefghijkl1111"
+	next := Default()
+	next.Weather.APIKey = "abcdefghijkl2222"
+	next.Cache.WeatherTTL = Duration(0)
+
+	changes := Diff(prev, next)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d: %+v", len(changes), changes)
+	}
+
+	if changes[0].Path != "cache.weather_ttl" || changes[0].New != `"0s"` {
+		t.Errorf("unexpected first change: %+v", changes[0])
+	}
+	if changes[1].Path != "weather.api_key" {
+		t.Errorf("unexpected second change: %+v", changes[1])
+	}
+
+	out := formatChanges(changes)
+	if strings.Contains(out, "abcdefghijkl") {
+		t.Errorf("expected secrets to be masked in diff, got %s", out)
+	}
+}
+
+func TestDiff_ShortSecretChange(t *testing.T) {
+	prev := Default()
+	prev.Weather.APIKey = "short1"
+	next := Default()
+	next.Weather.APIKey = "short2"
+
+	changes := Diff(prev, next)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	if !strings.HasSuffix(changes[0].New, "(changed)") {
+		t.Errorf("expected change marker for indistinguishable masked values, got %q", changes[0].New)
+	}
+}
@@ -0,0 +1,141 @@
+package graphqlapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+//go:embed schema.graphql
+var schema string
+
+const (
+	// maxDepth bounds field nesting, since Location and Weather reference each other
+	maxDepth = 8
+	// maxBodyBytes bounds the size of a POSTed query
+	maxBodyBytes = 1 << 20
+	// maxCEPsPerRequest bounds the distinct CEPs a query looks up, since aliases let one
+	// query repeat a field with as many CEPs as it likes
+	maxCEPsPerRequest = 20
+)
+
+// Handler serves GraphQL queries over the CEP, weather and forecast services
+type Handler struct {
+	schema          *graphql.Schema
+	cepService      services.CEPService
+	weatherService  services.WeatherServiceInterface
+	forecastService services.ForecastService
+	authenticator   *auth.Authenticator
+}
+
+// NewHandler creates the GraphQL handler
+func NewHandler(cepService services.CEPService, weatherService services.WeatherServiceInterface, forecastService services.ForecastService) *Handler {
+	return &Handler{
+		schema:          graphql.MustParseSchema(schema, &queryResolver{}, graphql.UseStringDescriptions(), graphql.MaxDepth(maxDepth)),
+		cepService:      cepService,
+		weatherService:  weatherService,
+		forecastService: forecastService,
+	}
+}
+
+// SetAuthenticator makes every distinct CEP of a query after the first count against the
+// quota of the authenticated client, as if it were a request of its own
+func (h *Handler) SetAuthenticator(authenticator *auth.Authenticator) {
+	h.authenticator = authenticator
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// ServeHTTP handles GET /graphql?query=... and POST /graphql with a JSON body
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				respondWithError(w, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		respondWithError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if req.Query == "" {
+		respondWithError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), loadersKey{}, h.newLoaders(r.Context()))
+	response := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	render.JSON(w, http.StatusOK, response)
+}
+
+// loaders batch and deduplicate the upstream calls of one request
+type loaders struct {
+	locations *loader[string, *models.ViaCEPResponse]
+	weather   *loader[string, *models.WeatherAPIResponse]
+	// forecasts hold the longest forecast of each city, so asking for several lengths
+	// costs one upstream call; each field keeps the days it asked for
+	forecasts *loader[string, *models.WeatherAPIForecastResponse]
+}
+
+type loadersKey struct{}
+
+func (h *Handler) newLoaders(ctx context.Context) *loaders {
+	locations := newLoader(ctx, h.cepService.GetLocation)
+	locations.maxKeys = maxCEPsPerRequest
+	if client, ok := auth.ClientFromContext(ctx); ok && h.authenticator != nil {
+		// The HTTP request already paid for the first CEP
+		var resolved atomic.Int32
+		locations.fetch = func(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+			if resolved.Add(1) > 1 {
+				if err := h.authenticator.Charge(client); err != nil {
+					return nil, errQuotaExceeded
+				}
+			}
+			return h.cepService.GetLocation(ctx, cep)
+		}
+	}
+
+	return &loaders{
+		locations: locations,
+		weather:   newLoader(ctx, h.weatherService.GetTemperature),
+		forecasts: newLoader(ctx, func(ctx context.Context, city string) (*models.WeatherAPIForecastResponse, error) {
+			return h.forecastService.GetForecast(ctx, city, maxForecastDays)
+		}),
+	}
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// respondWithError writes a request-level error in the GraphQL response shape
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	render.JSON(w, statusCode, map[string]interface{}{
+		"errors": []models.ErrorResponse{{Message: message}},
+	})
+}
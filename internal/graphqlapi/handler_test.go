@@ -0,0 +1,325 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+// countingServices fakes the upstreams and counts the calls per key
+type countingServices struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newCountingServices() *countingServices {
+	return &countingServices{calls: make(map[string]int)}
+}
+
+func (s *countingServices) count(key string) {
+	s.mu.Lock()
+	s.calls[key]++
+	s.mu.Unlock()
+}
+
+func (s *countingServices) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	s.count("cep:" + cep)
+	switch cep {
+	case "99999999":
+		return nil, nil
+	case "00000000":
+		return nil, errors.New("viaCEP unavailable")
+	case "20040020":
+		return &models.ViaCEPResponse{CEP: "20040-020", Localidade: "Rio de Janeiro", UF: "RJ"}, nil
+	default:
+		return &models.ViaCEPResponse{CEP: cep[:5] + "-" + cep[5:], Logradouro: "Avenida Paulista", Localidade: "São Paulo", UF: "SP", IBGE: "3550308"}, nil
+	}
+}
+
+func (s *countingServices) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	s.count("weather:" + city)
+	weather := &models.WeatherAPIResponse{}
+	weather.Location.Name = city
+	weather.Current.TempC = 25
+	weather.Current.LastUpdatedEpoch = 1773153000
+	return weather, nil
+}
+
+func (s *countingServices) GetForecast(ctx context.Context, city string, days int) (*models.WeatherAPIForecastResponse, error) {
+	s.count("forecast:" + city)
+	forecast := &models.WeatherAPIForecastResponse{}
+	forecast.Forecast.ForecastDay = make([]models.WeatherAPIForecastDay, days)
+	for i := range forecast.Forecast.ForecastDay {
+		forecast.Forecast.ForecastDay[i].Date = "2026-03-1" + string(rune('0'+i))
+		forecast.Forecast.ForecastDay[i].Day.MaxTempC = 30
+		forecast.Forecast.ForecastDay[i].Day.Condition.Text = "Sunny"
+	}
+	return forecast, nil
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func post(t *testing.T, h http.Handler, query string) (*httptest.ResponseRecorder, response) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return rec, resp
+}
+
+func TestHandler_Query(t *testing.T) {
+	services := newCountingServices()
+	h := NewHandler(services, services, services)
+
+	rec, resp := post(t, h, `{
+		location(cep: "01310-100") {
+			cep city state
+			weather { temperature { celsius fahrenheit kelvin } observedAt provider { query name } }
+			forecast(days: 2) { days { date max { celsius } condition } }
+		}
+	}`)
+
+	if rec.Code != http.StatusOK || len(resp.Errors) != 0 {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	expected := `{"cep":"01310-100","city":"São Paulo","state":"SP",` +
+		`"weather":{"temperature":{"celsius":25,"fahrenheit":77,"kelvin":298},"observedAt":"2026-03-10T14:30:00Z","provider":{"query":"São Paulo","name":"São Paulo"}},` +
+		`"forecast":{"days":[{"date":"2026-03-10","max":{"celsius":30},"condition":"Sunny"},{"date":"2026-03-11","max":{"celsius":30},"condition":"Sunny"}]}}`
+	if got := string(resp.Data["location"]); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestHandler_BatchesUpstreamCalls(t *testing.T) {
+	services := newCountingServices()
+	h := NewHandler(services, services, services)
+
+	// Five fields over three distinct CEPs in two cities
+	_, resp := post(t, h, `{
+		a: weather(cep: "01310100") { temperature { celsius } }
+		b: weather(cep: "01310-100") { temperature { celsius } }
+		c: weather(cep: "01311000") { temperature { celsius } }
+		d: location(cep: "20040020") { city weather { temperature { celsius } } }
+		e: forecast(cep: "01311000", days: 3) { days { date } }
+	}`)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("unexpected errors %+v", resp.Errors)
+	}
+
+	expected := map[string]int{
+		"cep:01310100":           1,
+		"cep:01311000":           1,
+		"cep:20040020":           1,
+		"weather:São Paulo":      1,
+		"weather:Rio de Janeiro": 1,
+		"forecast:São Paulo":     1,
+	}
+	for key, calls := range expected {
+		if services.calls[key] != calls {
+			t.Errorf("expected %d calls for %s, got %d", calls, key, services.calls[key])
+		}
+	}
+	if len(services.calls) != len(expected) {
+		t.Errorf("unexpected upstream calls %v", services.calls)
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"invalid cep", `{ weather(cep: "0131") { temperature { celsius } } }`, "INVALID_CEP"},
+		{"unknown cep", `{ location(cep: "99999999") { city } }`, "NOT_FOUND"},
+		{"upstream failure", `{ location(cep: "00000000") { city } }`, "INTERNAL"},
+		{"invalid days", `{ forecast(cep: "01310100", days: 30) { days { date } } }`, "INVALID_ARGUMENT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := newCountingServices()
+			_, resp := post(t, NewHandler(services, services, services), tt.query)
+
+			if len(resp.Errors) != 1 {
+				t.Fatalf("expected one error, got %+v", resp.Errors)
+			}
+			if code := resp.Errors[0].Extensions["code"]; code != tt.expectedCode {
+				t.Errorf("expected code %s, got %v (%s)", tt.expectedCode, code, resp.Errors[0].Message)
+			}
+		})
+	}
+
+	t.Run("failures stay on their field", func(t *testing.T) {
+		services := newCountingServices()
+		_, resp := post(t, NewHandler(services, services, services), `{
+			ok: location(cep: "01310100") { city }
+			missing: location(cep: "99999999") { city }
+		}`)
+		if len(resp.Errors) != 1 || string(resp.Data["missing"]) != "null" || string(resp.Data["ok"]) != `{"city":"São Paulo"}` {
+			t.Errorf("unexpected partial response %+v", resp)
+		}
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		services := newCountingServices()
+		_, resp := post(t, NewHandler(services, services, services), `{
+			location(cep: "01310100") { weather { location { weather { location { weather { location { weather { location { city } } } } } } } } }
+		}`)
+		if len(resp.Errors) == 0 || len(services.calls) != 0 {
+			t.Errorf("expected the query to be rejected before any upstream call, got %+v", resp)
+		}
+	})
+}
+
+func TestHandler_OneForecastPerCity(t *testing.T) {
+	services := newCountingServices()
+	var query strings.Builder
+	query.WriteString(`{ location(cep: "01310100") {`)
+	for days := 1; days <= maxForecastDays; days++ {
+		fmt.Fprintf(&query, ` f%d: forecast(days: %d) { days { date } }`, days, days)
+	}
+	query.WriteString(" } }")
+
+	_, resp := post(t, NewHandler(services, services, services), query.String())
+	if len(resp.Errors) != 0 {
+		t.Fatalf("unexpected errors %+v", resp.Errors)
+	}
+
+	// Every length is cut from the one 14-day forecast of the city
+	if calls := services.calls["forecast:São Paulo"]; calls != 1 {
+		t.Errorf("expected one forecast call, got %d", calls)
+	}
+	var location map[string]struct {
+		Days []json.RawMessage `json:"days"`
+	}
+	json.Unmarshal(resp.Data["location"], &location)
+	for days := 1; days <= maxForecastDays; days++ {
+		if got := len(location[fmt.Sprintf("f%d", days)].Days); got != days {
+			t.Errorf("forecast(days: %d): got %d days", days, got)
+		}
+	}
+}
+
+// aliasedQuery looks up n distinct CEPs, each under its own alias
+func aliasedQuery(n int) string {
+	var query strings.Builder
+	query.WriteString("{")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&query, ` l%d: location(cep: "%08d") { city }`, i, 1310100+i)
+	}
+	query.WriteString(" }")
+	return query.String()
+}
+
+func codes(resp response) map[string]int {
+	counts := map[string]int{}
+	for _, e := range resp.Errors {
+		counts[fmt.Sprint(e.Extensions["code"])]++
+	}
+	return counts
+}
+
+func TestHandler_LimitsCEPs(t *testing.T) {
+	services := newCountingServices()
+	_, resp := post(t, NewHandler(services, services, services), aliasedQuery(maxCEPsPerRequest+5))
+
+	if got := codes(resp); got["TOO_MANY_CEPS"] != 5 || len(resp.Errors) != 5 {
+		t.Errorf("expected 5 TOO_MANY_CEPS errors, got %v", got)
+	}
+	if len(services.calls) != maxCEPsPerRequest {
+		t.Errorf("expected %d upstream lookups, got %d", maxCEPsPerRequest, len(services.calls))
+	}
+}
+
+func TestHandler_ChargesQuotaPerCEP(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.Settings{Enabled: true, Header: "X-API-Key"}, []auth.Client{{Name: "erp", Key: "erp-key", DailyQuota: 4}})
+	services := newCountingServices()
+	h := NewHandler(services, services, services)
+	h.SetAuthenticator(authenticator)
+	protected := authenticator.Middleware(h)
+
+	body, _ := json.Marshal(map[string]string{"query": aliasedQuery(6)})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("X-API-Key", "erp-key")
+	rec := httptest.NewRecorder()
+	protected.ServeHTTP(rec, req)
+
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	// The request pays for one CEP and the quota of 4 for three more
+	if got := codes(resp); got["QUOTA_EXCEEDED"] != 2 || len(resp.Errors) != 2 {
+		t.Errorf("expected 2 QUOTA_EXCEEDED errors, got %v", got)
+	}
+	if len(services.calls) != 4 {
+		t.Errorf("expected 4 upstream lookups, got %v", services.calls)
+	}
+	if usage := authenticator.Usage()[0]; usage.DailyUsage != 4 {
+		t.Errorf("expected a daily usage of 4, got %d", usage.DailyUsage)
+	}
+}
+
+func TestHandler_HTTP(t *testing.T) {
+	services := newCountingServices()
+	h := NewHandler(services, services, services)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "get",
+			method:         http.MethodGet,
+			target:         "/graphql?query=" + url.QueryEscape(`query($cep: String!) { location(cep: $cep) { city } }`) + "&variables=" + url.QueryEscape(`{"cep":"01310100"}`),
+			expectedStatus: http.StatusOK,
+		},
+		{name: "invalid body", method: http.MethodPost, target: "/graphql", body: "{", expectedStatus: http.StatusBadRequest},
+		{name: "missing query", method: http.MethodPost, target: "/graphql", body: "{}", expectedStatus: http.StatusBadRequest},
+		{name: "invalid variables", method: http.MethodGet, target: "/graphql?query=%7Bx%7D&variables=nope", expectedStatus: http.StatusBadRequest},
+		{name: "method not allowed", method: http.MethodDelete, target: "/graphql", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("unexpected Content-Type %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// batchWait is how long a loader collects keys before dispatching them together
+	batchWait = time.Millisecond
+	// fetchConcurrency bounds the upstream calls of one batch running at the same time
+	fetchConcurrency = 8
+)
+
+// errTooManyKeys is returned by Load for keys past the loader's limit
+var errTooManyKeys = errors.New("too many distinct keys")
+
+// loader batches the keys requested while a query executes and memoizes the results
+// for the rest of the request, so every distinct key reaches the upstream at most once
+// however many fields ask for it
+type loader[K comparable, V any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, key K) (V, error)
+	// maxKeys bounds the distinct keys fetched per request; 0 means no limit
+	maxKeys int
+
+	mu      sync.Mutex
+	calls   map[K]*call[V]
+	pending []K
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func newLoader[K comparable, V any](ctx context.Context, fetch func(ctx context.Context, key K) (V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		ctx:   ctx,
+		fetch: fetch,
+		calls: make(map[K]*call[V]),
+	}
+}
+
+// Load returns the value of the key, waiting for the batch it joined. Keys past maxKeys
+// fail with errTooManyKeys without reaching fetch.
+func (l *loader[K, V]) Load(key K) (V, error) {
+	l.mu.Lock()
+	c, ok := l.calls[key]
+	if !ok {
+		if l.maxKeys > 0 && len(l.calls) >= l.maxKeys {
+			l.mu.Unlock()
+			var zero V
+			return zero, errTooManyKeys
+		}
+		c = &call[V]{done: make(chan struct{})}
+		l.calls[key] = c
+		l.pending = append(l.pending, key)
+		if len(l.pending) == 1 {
+			time.AfterFunc(batchWait, l.dispatch)
+		}
+	}
+	l.mu.Unlock()
+
+	<-c.done
+	return c.value, c.err
+}
+
+// dispatch fetches the pending keys concurrently; neither ViaCEP nor WeatherAPI has a
+// bulk endpoint, so a batch is a bounded fan-out over the distinct keys
+func (l *loader[K, V]) dispatch() {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	calls := make([]*call[V], len(keys))
+	for i, key := range keys {
+		calls[i] = l.calls[key]
+	}
+	l.mu.Unlock()
+
+	sem := make(chan struct{}, fetchConcurrency)
+	for i, key := range keys {
+		sem <- struct{}{}
+		go func(c *call[V], key K) {
+			defer func() { <-sem }()
+			c.value, c.err = l.fetch(l.ctx, key)
+			close(c.done)
+		}(calls[i], key)
+	}
+}
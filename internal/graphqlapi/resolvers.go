@@ -0,0 +1,221 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// maxForecastDays is the longest forecast WeatherAPI provides
+const maxForecastDays = 14
+
+// queryError is a resolver error carrying a machine-readable code in its extensions
+type queryError struct {
+	code    string
+	message string
+}
+
+func (e *queryError) Error() string { return e.message }
+
+// Extensions is reported by graphql-go as the "extensions" member of the error
+func (e *queryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+var (
+	errInvalidCEP  = &queryError{code: "INVALID_CEP", message: services.ErrInvalidCEP.Error()}
+	errCEPNotFound = &queryError{code: "NOT_FOUND", message: services.ErrCEPNotFound.Error()}
+	errInvalidDays = &queryError{code: "INVALID_ARGUMENT", message: "days must be between 1 and 14"}
+	errTooManyCEPs = &queryError{code: "TOO_MANY_CEPS", message: fmt.Sprintf("a query may look up at most %d distinct CEPs", maxCEPsPerRequest)}
+	// errQuotaExceeded is returned for the CEPs a client can no longer pay for
+	errQuotaExceeded = &queryError{code: "QUOTA_EXCEEDED", message: "API key quota exceeded"}
+)
+
+// upstreamError logs the failure and hides its details from clients
+func upstreamError(what string, err error) error {
+	log.Printf("Error fetching %s: %v", what, err)
+	return &queryError{code: "INTERNAL", message: "internal server error"}
+}
+
+// queryResolver resolves the Query type; per-request state lives in the context
+type queryResolver struct{}
+
+type cepArgs struct {
+	CEP string
+}
+
+type daysArgs struct {
+	Days int32
+}
+
+func (*queryResolver) Location(ctx context.Context, args cepArgs) (*locationResolver, error) {
+	return resolveLocation(ctx, args.CEP)
+}
+
+func (*queryResolver) Weather(ctx context.Context, args cepArgs) (*weatherResolver, error) {
+	location, err := resolveLocation(ctx, args.CEP)
+	if err != nil {
+		return nil, err
+	}
+	return location.Weather(ctx)
+}
+
+func (*queryResolver) Forecast(ctx context.Context, args struct {
+	CEP  string
+	Days int32
+}) (*forecastResolver, error) {
+	location, err := resolveLocation(ctx, args.CEP)
+	if err != nil {
+		return nil, err
+	}
+	return location.Forecast(ctx, daysArgs{Days: args.Days})
+}
+
+func resolveLocation(ctx context.Context, cep string) (*locationResolver, error) {
+	cep = services.NormalizeCEP(cep)
+	if !services.ValidateCEP(cep) {
+		return nil, errInvalidCEP
+	}
+
+	location, err := loadersFrom(ctx).locations.Load(cep)
+	switch {
+	case errors.Is(err, errTooManyKeys):
+		return nil, errTooManyCEPs
+	case errors.Is(err, errQuotaExceeded):
+		return nil, errQuotaExceeded
+	case err != nil:
+		return nil, upstreamError("location", err)
+	}
+	if location == nil {
+		return nil, errCEPNotFound
+	}
+	return &locationResolver{cep: cep, location: location}, nil
+}
+
+type locationResolver struct {
+	cep      string
+	location *models.ViaCEPResponse
+}
+
+func (r *locationResolver) CEP() string         { return services.FormatCEP(r.cep) }
+func (r *locationResolver) Logradouro() string  { return r.location.Logradouro }
+func (r *locationResolver) Complemento() string { return r.location.Complemento }
+func (r *locationResolver) Bairro() string      { return r.location.Bairro }
+func (r *locationResolver) City() string        { return r.location.Localidade }
+func (r *locationResolver) State() string       { return r.location.UF }
+func (r *locationResolver) IBGE() string        { return r.location.IBGE }
+func (r *locationResolver) DDD() string         { return r.location.DDD }
+
+func (r *locationResolver) Weather(ctx context.Context) (*weatherResolver, error) {
+	weather, err := loadersFrom(ctx).weather.Load(r.location.Localidade)
+	if err != nil {
+		return nil, upstreamError("weather", err)
+	}
+	return &weatherResolver{location: r, weather: weather}, nil
+}
+
+func (r *locationResolver) Forecast(ctx context.Context, args daysArgs) (*forecastResolver, error) {
+	if args.Days < 1 || args.Days > maxForecastDays {
+		return nil, errInvalidDays
+	}
+	forecast, err := loadersFrom(ctx).forecasts.Load(r.location.Localidade)
+	if err != nil {
+		return nil, upstreamError("forecast", err)
+	}
+	days := forecast.Forecast.ForecastDay
+	if len(days) > int(args.Days) {
+		days = days[:args.Days]
+	}
+	return &forecastResolver{location: r, days: days}, nil
+}
+
+type weatherResolver struct {
+	location *locationResolver
+	weather  *models.WeatherAPIResponse
+}
+
+func (r *weatherResolver) Location() *locationResolver { return r.location }
+
+func (r *weatherResolver) Temperature() temperatureResolver {
+	return temperatureResolver(r.weather.Current.TempC)
+}
+
+func (r *weatherResolver) ObservedAt() *string {
+	if r.weather.Current.LastUpdatedEpoch <= 0 {
+		return nil
+	}
+	observed := time.Unix(r.weather.Current.LastUpdatedEpoch, 0).UTC().Format(time.RFC3339)
+	return &observed
+}
+
+func (r *weatherResolver) Provider() *providerResolver {
+	return &providerResolver{query: r.location.location.Localidade, location: r.weather.Location}
+}
+
+// temperatureResolver is a reading in Celsius
+type temperatureResolver float64
+
+func (t temperatureResolver) Celsius() float64 {
+	return float64(t)
+}
+
+func (t temperatureResolver) Fahrenheit() float64 {
+	return services.ConvertCelsiusToFahrenheit(float64(t))
+}
+
+func (t temperatureResolver) Kelvin() float64 {
+	return services.ConvertCelsiusToKelvin(float64(t))
+}
+
+type providerResolver struct {
+	query    string
+	location models.WeatherAPILocation
+}
+
+func (r *providerResolver) Query() string   { return r.query }
+func (r *providerResolver) Name() string    { return r.location.Name }
+func (r *providerResolver) Region() string  { return r.location.Region }
+func (r *providerResolver) Country() string { return r.location.Country }
+func (r *providerResolver) Lat() float64    { return r.location.Lat }
+func (r *providerResolver) Lon() float64    { return r.location.Lon }
+
+type forecastResolver struct {
+	location *locationResolver
+	days     []models.WeatherAPIForecastDay
+}
+
+func (r *forecastResolver) Location() *locationResolver { return r.location }
+
+func (r *forecastResolver) Days() []*forecastDayResolver {
+	days := make([]*forecastDayResolver, len(r.days))
+	for i := range r.days {
+		days[i] = &forecastDayResolver{day: &r.days[i]}
+	}
+	return days
+}
+
+type forecastDayResolver struct {
+	day *models.WeatherAPIForecastDay
+}
+
+func (r *forecastDayResolver) Date() string             { return r.day.Date }
+func (r *forecastDayResolver) PrecipitationMm() float64 { return r.day.Day.TotalPrecipMM }
+func (r *forecastDayResolver) ChanceOfRain() int32      { return int32(r.day.Day.DailyChanceOfRain) }
+func (r *forecastDayResolver) Condition() string        { return r.day.Day.Condition.Text }
+
+func (r *forecastDayResolver) Max() temperatureResolver {
+	return temperatureResolver(r.day.Day.MaxTempC)
+}
+
+func (r *forecastDayResolver) Min() temperatureResolver {
+	return temperatureResolver(r.day.Day.MinTempC)
+}
+
+func (r *forecastDayResolver) Avg() temperatureResolver {
+	return temperatureResolver(r.day.Day.AvgTempC)
+}
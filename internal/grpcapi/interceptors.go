@@ -0,0 +1,110 @@
+package grpcapi
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/grpcapi/weatherv1"
+)
+
+// APIKeyMetadata is the metadata key where clients send their API key
+const APIKeyMetadata = "x-api-key"
+
+// unaryRecover turns a panic in a handler into an Internal error instead of a crashed server
+func unaryRecover(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func streamRecover(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+func recoverPanic(method string, err *error) {
+	if p := recover(); p != nil {
+		log.Printf("Panic serving %s: %v\n%s", method, p, debug.Stack())
+		*err = status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// unaryAuth requires a valid API key on weather calls; health and reflection stay open.
+// Each call counts as one request against the client's quotas; BatchGetWeather charges
+// its further CEPs itself.
+func unaryAuth(authenticator *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !protected(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, authenticator)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamAuth is unaryAuth for streaming calls. Opening a stream counts as one request;
+// StreamWeather charges its further CEPs and every interval itself.
+func streamAuth(authenticator *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !protected(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, err := authenticate(ss.Context(), authenticator)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func protected(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+weatherv1.WeatherService_ServiceDesc.ServiceName+"/")
+}
+
+// authenticate checks the API key in the incoming metadata and returns a context carrying the client
+func authenticate(ctx context.Context, authenticator *auth.Authenticator) (context.Context, error) {
+	var key string
+	if values := metadata.ValueFromIncomingContext(ctx, APIKeyMetadata); len(values) > 0 {
+		key = values[0]
+	}
+
+	client, err := authenticator.Authenticate(key)
+	switch err {
+	case nil:
+	case auth.ErrMissingKey:
+		return nil, status.Error(codes.Unauthenticated, "missing API key")
+	case auth.ErrUnknownKey:
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	case auth.ErrClientDisabled:
+		return nil, status.Error(codes.PermissionDenied, "API key disabled")
+	case auth.ErrDailyQuota, auth.ErrMonthlyQuota:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	if client == nil {
+		return ctx, nil
+	}
+	return auth.ContextWithClient(ctx, client), nil
+}
+
+// authenticatedStream overrides the stream context with the one carrying the client
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
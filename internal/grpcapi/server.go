@@ -0,0 +1,326 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/grpcapi/weatherv1"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+const (
+	// maxCEPs bounds the CEPs of one batch or stream request
+	maxCEPs = 100
+	// batchConcurrency bounds the lookups of one batch running at the same time
+	batchConcurrency = 8
+
+	defaultStreamInterval = time.Minute
+)
+
+// WeatherServer implements the gRPC WeatherService on top of the same lookup as the HTTP
+// handlers; streams share the pollers of the SSE and WebSocket hub
+type WeatherServer struct {
+	weatherv1.UnimplementedWeatherServiceServer
+
+	lookup *services.Lookup
+	hub    *stream.Hub
+	// authenticator charges the CEPs of batches and streams; set by NewServer
+	authenticator *auth.Authenticator
+	// minInterval is the shortest update interval a stream may ask for
+	minInterval time.Duration
+}
+
+// NewWeatherServer creates the gRPC weather service
+func NewWeatherServer(cepService services.CEPService, weatherService services.WeatherServiceInterface, hub *stream.Hub) *WeatherServer {
+	return &WeatherServer{
+		lookup:      services.NewLookup(cepService, weatherService),
+		hub:         hub,
+		minInterval: 10 * time.Second,
+	}
+}
+
+// NewServer creates a gRPC server exposing the weather service, the standard health
+// service and server reflection. Weather calls are authenticated like the HTTP API.
+func NewServer(weather *WeatherServer, authenticator *auth.Authenticator) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryRecover, unaryAuth(authenticator)),
+		grpc.ChainStreamInterceptor(streamRecover, streamAuth(authenticator)),
+	)
+	weather.authenticator = authenticator
+	weatherv1.RegisterWeatherServiceServer(server, weather)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(weatherv1.WeatherService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server
+}
+
+// GetWeather returns the current weather of one CEP
+func (s *WeatherServer) GetWeather(ctx context.Context, req *weatherv1.GetWeatherRequest) (*weatherv1.Weather, error) {
+	return s.get(ctx, req.GetCep(), req.GetIncludeLocation())
+}
+
+// BatchGetWeather looks up every CEP concurrently, reporting failures per CEP. Each CEP
+// after the first counts as one more request against the client's quotas; the CEPs the
+// client can no longer pay for fail with ResourceExhausted.
+func (s *WeatherServer) BatchGetWeather(ctx context.Context, req *weatherv1.BatchGetWeatherRequest) (*weatherv1.BatchGetWeatherResponse, error) {
+	if err := validateCEPs(req.GetCeps()); err != nil {
+		return nil, err
+	}
+
+	results := make([]*weatherv1.BatchResult, len(req.GetCeps()))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, cep := range req.GetCeps() {
+		result := &weatherv1.BatchResult{Cep: cep}
+		results[i] = result
+		// The call itself paid for the first CEP
+		if i > 0 {
+			if err := s.charge(ctx, 1); err != nil {
+				result.Result = &weatherv1.BatchResult_Error{Error: toError(err)}
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(cep string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if weather, err := s.get(ctx, cep, req.GetIncludeLocation()); err != nil {
+				result.Result = &weatherv1.BatchResult_Error{Error: toError(err)}
+			} else {
+				result.Result = &weatherv1.BatchResult_Weather{Weather: weather}
+			}
+		}(cep)
+	}
+	wg.Wait()
+
+	return &weatherv1.BatchGetWeatherResponse{Results: results}, nil
+}
+
+// StreamWeather sends the weather of every CEP right away, then every interval sends an
+// update only for the CEPs whose weather changed. The CEPs are watched through the hub,
+// so identical streams share one poller per CEP and count towards stream.max_streams.
+// Each CEP after the first, and then every CEP at every interval, counts as one more
+// request against the client's quotas; the stream ends with ResourceExhausted when the
+// client can no longer pay.
+func (s *WeatherServer) StreamWeather(req *weatherv1.StreamWeatherRequest, srv weatherv1.WeatherService_StreamWeatherServer) error {
+	if err := validateCEPs(req.GetCeps()); err != nil {
+		return err
+	}
+	interval := defaultStreamInterval
+	if req.GetInterval() != nil {
+		interval = req.GetInterval().AsDuration()
+	}
+	if interval < s.minInterval {
+		return status.Errorf(codes.InvalidArgument, "interval must be at least %s", s.minInterval)
+	}
+
+	ctx := srv.Context()
+	ceps := req.GetCeps()
+	if err := s.charge(ctx, len(ceps)-1); err != nil {
+		return err
+	}
+	subs, errs := s.subscribe(ctx, ceps)
+	defer func() {
+		for _, sub := range subs {
+			if sub != nil {
+				sub.Close()
+			}
+		}
+	}()
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	last := make(map[string]*weatherv1.WeatherUpdate)
+	send := func(update *weatherv1.WeatherUpdate) error {
+		if proto.Equal(update, last[update.GetCep()]) {
+			return nil
+		}
+		if err := srv.Send(update); err != nil {
+			return err
+		}
+		last[update.GetCep()] = update
+		return nil
+	}
+
+	// Failed CEPs are reported once and not watched
+	watched := 0
+	for i, cep := range ceps {
+		update := &weatherv1.WeatherUpdate{Cep: cep}
+		if subs[i] != nil {
+			watched++
+			update.Result = &weatherv1.WeatherUpdate_Weather{Weather: toWeather(subs[i].Current(), req.GetIncludeLocation())}
+		} else {
+			update.Result = &weatherv1.WeatherUpdate_Error{Error: toError(errs[i])}
+		}
+		if err := send(update); err != nil {
+			return err
+		}
+	}
+	if watched == 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+
+		if err := s.charge(ctx, watched); err != nil {
+			return err
+		}
+		for i, cep := range ceps {
+			if subs[i] == nil {
+				continue
+			}
+			update := &weatherv1.WeatherUpdate{Cep: cep, Result: &weatherv1.WeatherUpdate_Weather{Weather: toWeather(subs[i].Current(), req.GetIncludeLocation())}}
+			if err := send(update); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// subscribe watches the CEPs through the hub concurrently, returning for each CEP either
+// its subscription or its error as a gRPC status
+func (s *WeatherServer) subscribe(ctx context.Context, ceps []string) ([]*stream.Subscription, []error) {
+	subs := make([]*stream.Subscription, len(ceps))
+	errs := make([]error, len(ceps))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, cep := range ceps {
+		wg.Add(1)
+		go func(i int, cep string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			sub, err := s.hub.Subscribe(ctx, cep)
+			if errors.Is(err, stream.ErrTooManyStreams) {
+				errs[i] = status.Error(codes.Unavailable, err.Error())
+				return
+			}
+			if err != nil {
+				errs[i] = lookupStatus(ctx, err)
+				return
+			}
+			subs[i] = sub
+		}(i, cep)
+	}
+	wg.Wait()
+	return subs, errs
+}
+
+// charge counts n more requests against the quotas of the authenticated client, if any
+func (s *WeatherServer) charge(ctx context.Context, n int) error {
+	client, ok := auth.ClientFromContext(ctx)
+	if !ok || s.authenticator == nil {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if err := s.authenticator.Charge(client); err != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+	}
+	return nil
+}
+
+// get looks up one CEP, converting lookup failures into gRPC status errors
+func (s *WeatherServer) get(ctx context.Context, cep string, includeLocation bool) (*weatherv1.Weather, error) {
+	result, err := s.lookup.ByCEP(ctx, cep)
+	if err != nil {
+		return nil, lookupStatus(ctx, err)
+	}
+	return toWeather(result, includeLocation), nil
+}
+
+// lookupStatus converts a lookup failure into a gRPC status error
+func lookupStatus(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidCEP):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, services.ErrCEPNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	default:
+		log.Printf("Error looking up weather: %v", err)
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
+
+func validateCEPs(ceps []string) error {
+	if len(ceps) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one CEP is required")
+	}
+	if len(ceps) > maxCEPs {
+		return status.Errorf(codes.InvalidArgument, "at most %d CEPs are allowed", maxCEPs)
+	}
+	return nil
+}
+
+func toWeather(result *services.LookupResult, includeLocation bool) *weatherv1.Weather {
+	tempC, tempF, tempK := result.Temperatures()
+	weather := &weatherv1.Weather{
+		Location: &weatherv1.Location{
+			Cep:   services.FormatCEP(result.CEP),
+			City:  result.Location.Localidade,
+			State: result.Location.UF,
+		},
+		Temperature: &weatherv1.Temperature{
+			Celsius:    tempC,
+			Fahrenheit: tempF,
+			Kelvin:     tempK,
+		},
+	}
+	if includeLocation {
+		details := result.Details()
+		weather.Location.Details = &weatherv1.LocationDetails{
+			Logradouro: details.Logradouro,
+			Bairro:     details.Bairro,
+			Ibge:       details.IBGE,
+			Ddd:        details.DDD,
+			WeatherQuery: &weatherv1.ProviderLocation{
+				Query:   details.WeatherQuery.Query,
+				Name:    details.WeatherQuery.Name,
+				Region:  details.WeatherQuery.Region,
+				Country: details.WeatherQuery.Country,
+				Lat:     details.WeatherQuery.Lat,
+				Lon:     details.WeatherQuery.Lon,
+			},
+		}
+	}
+	if !result.ObservedAt.IsZero() {
+		weather.ObservedAt = timestamppb.New(result.ObservedAt)
+	}
+	return weather
+}
+
+func toError(err error) *weatherv1.Error {
+	st := status.Convert(err)
+	return &weatherv1.Error{Code: int32(st.Code()), Message: st.Message()}
+}
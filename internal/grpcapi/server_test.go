@@ -0,0 +1,426 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/grpcapi/weatherv1"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+type stubCEPService struct{}
+
+func (stubCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	switch cep {
+	case "99999999":
+		return nil, nil
+	case "00000000":
+		return nil, errors.New("viaCEP unavailable")
+	default:
+		return &models.ViaCEPResponse{CEP: cep[:5] + "-" + cep[5:], Localidade: "São Paulo", UF: "SP", IBGE: "3550308"}, nil
+	}
+}
+
+// stubWeatherService reports a temperature tests can change between polls
+type stubWeatherService struct {
+	mu    sync.Mutex
+	tempC float64
+	calls int
+}
+
+func (s *stubWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+
+	weather := &models.WeatherAPIResponse{}
+	weather.Location.Name = city
+	weather.Current.TempC = s.tempC
+	weather.Current.LastUpdatedEpoch = time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC).Unix()
+	return weather, nil
+}
+
+func (s *stubWeatherService) set(tempC float64) {
+	s.mu.Lock()
+	s.tempC = tempC
+	s.mu.Unlock()
+}
+
+func (s *stubWeatherService) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// testHubSettings polls fast enough for the stream tests
+var testHubSettings = stream.Settings{PollInterval: 10 * time.Millisecond, Heartbeat: time.Minute, MaxStreams: 10, MaxSubscriptions: 10}
+
+// newTestClient serves the API on an in-memory listener and returns a connection to it
+func newTestClient(t *testing.T, weather *stubWeatherService, authenticator *auth.Authenticator) *grpc.ClientConn {
+	t.Helper()
+	return newTestClientWithHub(t, weather, authenticator, testHubSettings)
+}
+
+func newTestClientWithHub(t *testing.T, weather *stubWeatherService, authenticator *auth.Authenticator, hubSettings stream.Settings) *grpc.ClientConn {
+	t.Helper()
+
+	hub := stream.NewHub(services.NewLookup(stubCEPService{}, weather), hubSettings)
+	weatherServer := NewWeatherServer(stubCEPService{}, weather, hub)
+	weatherServer.minInterval = 10 * time.Millisecond
+	server := NewServer(weatherServer, authenticator)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dialing bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func disabledAuth() *auth.Authenticator {
+	return auth.NewAuthenticator(auth.Settings{}, nil)
+}
+
+func TestGetWeather(t *testing.T) {
+	client := weatherv1.NewWeatherServiceClient(newTestClient(t, &stubWeatherService{tempC: 25}, disabledAuth()))
+
+	tests := []struct {
+		name         string
+		req          *weatherv1.GetWeatherRequest
+		expectedCode codes.Code
+	}{
+		{"found", &weatherv1.GetWeatherRequest{Cep: "01310-100"}, codes.OK},
+		{"invalid", &weatherv1.GetWeatherRequest{Cep: "0131"}, codes.InvalidArgument},
+		{"not found", &weatherv1.GetWeatherRequest{Cep: "99999999"}, codes.NotFound},
+		{"upstream failure", &weatherv1.GetWeatherRequest{Cep: "00000000"}, codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weather, err := client.GetWeather(context.Background(), tt.req)
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %v, got %v (%v)", tt.expectedCode, code, err)
+			}
+			if err != nil {
+				return
+			}
+			if weather.GetLocation().GetCep() != "01310-100" || weather.GetLocation().GetCity() != "São Paulo" {
+				t.Errorf("unexpected location %v", weather.GetLocation())
+			}
+			if temp := weather.GetTemperature(); temp.GetCelsius() != 25 || temp.GetFahrenheit() != 77 || temp.GetKelvin() != 298 {
+				t.Errorf("unexpected temperature %v", temp)
+			}
+			if weather.GetObservedAt().AsTime().Unix() != time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC).Unix() {
+				t.Errorf("unexpected observed_at %v", weather.GetObservedAt())
+			}
+			if weather.GetLocation().GetDetails() != nil {
+				t.Error("expected no details unless include_location is set")
+			}
+		})
+	}
+
+	t.Run("include location", func(t *testing.T) {
+		weather, err := client.GetWeather(context.Background(), &weatherv1.GetWeatherRequest{Cep: "01310100", IncludeLocation: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		details := weather.GetLocation().GetDetails()
+		if details.GetIbge() != "3550308" || details.GetWeatherQuery().GetQuery() != "São Paulo" {
+			t.Errorf("unexpected details %v", details)
+		}
+	})
+}
+
+func TestBatchGetWeather(t *testing.T) {
+	client := weatherv1.NewWeatherServiceClient(newTestClient(t, &stubWeatherService{tempC: 20}, disabledAuth()))
+
+	resp, err := client.BatchGetWeather(context.Background(), &weatherv1.BatchGetWeatherRequest{
+		Ceps: []string{"01310100", "99999999", "abc"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := resp.GetResults()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].GetCep() != "01310100" || results[0].GetWeather().GetTemperature().GetCelsius() != 20 {
+		t.Errorf("unexpected first result %v", results[0])
+	}
+	if code := codes.Code(results[1].GetError().GetCode()); code != codes.NotFound {
+		t.Errorf("expected NotFound for the second result, got %v", code)
+	}
+	if code := codes.Code(results[2].GetError().GetCode()); code != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for the third result, got %v", code)
+	}
+
+	if _, err := client.BatchGetWeather(context.Background(), &weatherv1.BatchGetWeatherRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an empty batch, got %v", err)
+	}
+}
+
+func TestStreamWeather(t *testing.T) {
+	weather := &stubWeatherService{tempC: 20}
+	client := weatherv1.NewWeatherServiceClient(newTestClient(t, weather, disabledAuth()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.StreamWeather(ctx, &weatherv1.StreamWeatherRequest{
+		Ceps:     []string{"01310100", "99999999"},
+		Interval: durationpb.New(10 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Every CEP is sent right away, errors included
+	first := map[string]*weatherv1.WeatherUpdate{}
+	for i := 0; i < 2; i++ {
+		update, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("receiving update: %v", err)
+		}
+		first[update.GetCep()] = update
+	}
+	if first["01310100"].GetWeather().GetTemperature().GetCelsius() != 20 {
+		t.Errorf("unexpected first update %v", first["01310100"])
+	}
+	if codes.Code(first["99999999"].GetError().GetCode()) != codes.NotFound {
+		t.Errorf("expected a NotFound update, got %v", first["99999999"])
+	}
+
+	// Only the changed CEP is sent again
+	weather.set(30)
+	update, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("receiving update: %v", err)
+	}
+	if update.GetCep() != "01310100" || update.GetWeather().GetTemperature().GetCelsius() != 30 {
+		t.Errorf("expected the changed reading, got %v", update)
+	}
+}
+
+func TestStreamWeather_SharesPollers(t *testing.T) {
+	settings := testHubSettings
+	settings.PollInterval = time.Hour
+	weather := &stubWeatherService{tempC: 20}
+	client := weatherv1.NewWeatherServiceClient(newTestClientWithHub(t, weather, disabledAuth(), settings))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		stream, err := client.StreamWeather(ctx, &weatherv1.StreamWeatherRequest{
+			Ceps:     []string{"01310100"},
+			Interval: durationpb.New(10 * time.Millisecond),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("receiving update: %v", err)
+		}
+	}
+
+	// Five streams of one CEP share the lookup of one poller
+	if calls := weather.callCount(); calls != 1 {
+		t.Errorf("expected one lookup for the five streams, got %d", calls)
+	}
+}
+
+func TestStreamWeather_TooManyStreams(t *testing.T) {
+	settings := testHubSettings
+	settings.MaxStreams = 1
+	client := weatherv1.NewWeatherServiceClient(newTestClientWithHub(t, &stubWeatherService{tempC: 20}, disabledAuth(), settings))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.StreamWeather(ctx, &weatherv1.StreamWeatherRequest{Ceps: []string{"01310100", "01311000"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	codesByCEP := map[string]codes.Code{}
+	for i := 0; i < 2; i++ {
+		update, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("receiving update: %v", err)
+		}
+		codesByCEP[update.GetCep()] = codes.Code(update.GetError().GetCode())
+	}
+	if codesByCEP["01310100"] == codesByCEP["01311000"] || (codesByCEP["01310100"] != codes.Unavailable && codesByCEP["01311000"] != codes.Unavailable) {
+		t.Errorf("expected one CEP over the stream limit, got %v", codesByCEP)
+	}
+}
+
+func TestStreamWeather_InvalidInterval(t *testing.T) {
+	client := weatherv1.NewWeatherServiceClient(newTestClient(t, &stubWeatherService{}, disabledAuth()))
+
+	stream, err := client.StreamWeather(context.Background(), &weatherv1.StreamWeatherRequest{
+		Ceps:     []string{"01310100"},
+		Interval: durationpb.New(time.Millisecond),
+	})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.Settings{Enabled: true, Header: "X-API-Key"}, []auth.Client{
+		{Name: "erp", Key: "erp-key"},
+		{Name: "legacy", Key: "legacy-key", Disabled: true},
+	})
+	conn := newTestClient(t, &stubWeatherService{tempC: 20}, authenticator)
+	client := weatherv1.NewWeatherServiceClient(conn)
+
+	tests := []struct {
+		name         string
+		key          string
+		expectedCode codes.Code
+	}{
+		{"missing key", "", codes.Unauthenticated},
+		{"unknown key", "nope", codes.Unauthenticated},
+		{"disabled client", "legacy-key", codes.PermissionDenied},
+		{"valid key", "erp-key", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.key != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, APIKeyMetadata, tt.key)
+			}
+			_, err := client.GetWeather(ctx, &weatherv1.GetWeatherRequest{Cep: "01310100"})
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Errorf("expected code %v, got %v (%v)", tt.expectedCode, code, err)
+			}
+		})
+	}
+
+	t.Run("health stays open", func(t *testing.T) {
+		resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+			Service: weatherv1.WeatherService_ServiceDesc.ServiceName,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("expected SERVING, got %v", resp.GetStatus())
+		}
+	})
+}
+
+func TestQuotaPerCEP(t *testing.T) {
+	newClient := func(t *testing.T, quota int) (weatherv1.WeatherServiceClient, *auth.Authenticator, context.Context) {
+		authenticator := auth.NewAuthenticator(auth.Settings{Enabled: true, Header: "X-API-Key"}, []auth.Client{
+			{Name: "erp", Key: "erp-key", DailyQuota: quota},
+		})
+		client := weatherv1.NewWeatherServiceClient(newTestClient(t, &stubWeatherService{tempC: 20}, authenticator))
+		ctx := metadata.AppendToOutgoingContext(context.Background(), APIKeyMetadata, "erp-key")
+		return client, authenticator, ctx
+	}
+
+	t.Run("batch", func(t *testing.T) {
+		client, authenticator, ctx := newClient(t, 3)
+		resp, err := client.BatchGetWeather(ctx, &weatherv1.BatchGetWeatherRequest{
+			Ceps: []string{"01310100", "01311000", "01312000", "01313000"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The call pays for the first CEP and the quota of 3 for two more
+		for i, result := range resp.GetResults() {
+			expected := codes.OK
+			if i == 3 {
+				expected = codes.ResourceExhausted
+			}
+			if code := codes.Code(result.GetError().GetCode()); code != expected {
+				t.Errorf("result %d: expected %v, got %v", i, expected, code)
+			}
+		}
+		if usage := authenticator.Usage()[0]; usage.DailyUsage != 3 {
+			t.Errorf("expected a daily usage of 3, got %d", usage.DailyUsage)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		client, authenticator, ctx := newClient(t, 6)
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		stream, err := client.StreamWeather(ctx, &weatherv1.StreamWeatherRequest{
+			Ceps:     []string{"01310100", "01311000"},
+			Interval: durationpb.New(10 * time.Millisecond),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// 2 units to open the stream, then 2 per interval: the third interval is refused
+		for {
+			if _, err = stream.Recv(); err != nil {
+				break
+			}
+		}
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("expected ResourceExhausted, got %v", err)
+		}
+		if usage := authenticator.Usage()[0]; usage.DailyUsage != 6 {
+			t.Errorf("expected a daily usage of 6, got %d", usage.DailyUsage)
+		}
+	})
+}
+
+func TestReflection(t *testing.T) {
+	conn := newTestClient(t, &stubWeatherService{}, disabledAuth())
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatalf("sending request: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("receiving response: %v", err)
+	}
+
+	var found bool
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		found = found || service.GetName() == weatherv1.WeatherService_ServiceDesc.ServiceName
+	}
+	if !found {
+		t.Errorf("expected the weather service to be listed, got %v", resp.GetListServicesResponse())
+	}
+}
@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: weather/v1/weather.proto
+
+package weatherv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WeatherService_GetWeather_FullMethodName      = "/weatherbycep.v1.WeatherService/GetWeather"
+	WeatherService_BatchGetWeather_FullMethodName = "/weatherbycep.v1.WeatherService/BatchGetWeather"
+	WeatherService_StreamWeather_FullMethodName   = "/weatherbycep.v1.WeatherService/StreamWeather"
+)
+
+// WeatherServiceClient is the client API for WeatherService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// WeatherService resolves Brazilian CEPs to their current temperature
+type WeatherServiceClient interface {
+	// GetWeather returns the current weather of one CEP
+	GetWeather(ctx context.Context, in *GetWeatherRequest, opts ...grpc.CallOption) (*Weather, error)
+	// BatchGetWeather looks up several CEPs; failures are reported per CEP
+	BatchGetWeather(ctx context.Context, in *BatchGetWeatherRequest, opts ...grpc.CallOption) (*BatchGetWeatherResponse, error)
+	// StreamWeather sends the weather of the CEPs now and again whenever it changes
+	StreamWeather(ctx context.Context, in *StreamWeatherRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WeatherUpdate], error)
+}
+
+type weatherServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWeatherServiceClient(cc grpc.ClientConnInterface) WeatherServiceClient {
+	return &weatherServiceClient{cc}
+}
+
+func (c *weatherServiceClient) GetWeather(ctx context.Context, in *GetWeatherRequest, opts ...grpc.CallOption) (*Weather, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Weather)
+	err := c.cc.Invoke(ctx, WeatherService_GetWeather_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *weatherServiceClient) BatchGetWeather(ctx context.Context, in *BatchGetWeatherRequest, opts ...grpc.CallOption) (*BatchGetWeatherResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetWeatherResponse)
+	err := c.cc.Invoke(ctx, WeatherService_BatchGetWeather_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *weatherServiceClient) StreamWeather(ctx context.Context, in *StreamWeatherRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WeatherUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WeatherService_ServiceDesc.Streams[0], WeatherService_StreamWeather_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamWeatherRequest, WeatherUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeatherService_StreamWeatherClient = grpc.ServerStreamingClient[WeatherUpdate]
+
+// WeatherServiceServer is the server API for WeatherService service.
+// All implementations must embed UnimplementedWeatherServiceServer
+// for forward compatibility.
+//
+// WeatherService resolves Brazilian CEPs to their current temperature
+type WeatherServiceServer interface {
+	// GetWeather returns the current weather of one CEP
+	GetWeather(context.Context, *GetWeatherRequest) (*Weather, error)
+	// BatchGetWeather looks up several CEPs; failures are reported per CEP
+	BatchGetWeather(context.Context, *BatchGetWeatherRequest) (*BatchGetWeatherResponse, error)
+	// StreamWeather sends the weather of the CEPs now and again whenever it changes
+	StreamWeather(*StreamWeatherRequest, grpc.ServerStreamingServer[WeatherUpdate]) error
+	mustEmbedUnimplementedWeatherServiceServer()
+}
+
+// UnimplementedWeatherServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWeatherServiceServer struct{}
+
+func (UnimplementedWeatherServiceServer) GetWeather(context.Context, *GetWeatherRequest) (*Weather, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWeather not implemented")
+}
+func (UnimplementedWeatherServiceServer) BatchGetWeather(context.Context, *BatchGetWeatherRequest) (*BatchGetWeatherResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetWeather not implemented")
+}
+func (UnimplementedWeatherServiceServer) StreamWeather(*StreamWeatherRequest, grpc.ServerStreamingServer[WeatherUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamWeather not implemented")
+}
+func (UnimplementedWeatherServiceServer) mustEmbedUnimplementedWeatherServiceServer() {}
+func (UnimplementedWeatherServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeWeatherServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WeatherServiceServer will
+// result in compilation errors.
+type UnsafeWeatherServiceServer interface {
+	mustEmbedUnimplementedWeatherServiceServer()
+}
+
+func RegisterWeatherServiceServer(s grpc.ServiceRegistrar, srv WeatherServiceServer) {
+	// If the following call pancis, it indicates UnimplementedWeatherServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WeatherService_ServiceDesc, srv)
+}
+
+func _WeatherService_GetWeather_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWeatherRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WeatherServiceServer).GetWeather(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WeatherService_GetWeather_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WeatherServiceServer).GetWeather(ctx, req.(*GetWeatherRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WeatherService_BatchGetWeather_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetWeatherRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WeatherServiceServer).BatchGetWeather(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WeatherService_BatchGetWeather_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WeatherServiceServer).BatchGetWeather(ctx, req.(*BatchGetWeatherRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WeatherService_StreamWeather_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamWeatherRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WeatherServiceServer).StreamWeather(m, &grpc.GenericServerStream[StreamWeatherRequest, WeatherUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeatherService_StreamWeatherServer = grpc.ServerStreamingServer[WeatherUpdate]
+
+// WeatherService_ServiceDesc is the grpc.ServiceDesc for WeatherService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WeatherService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "weatherbycep.v1.WeatherService",
+	HandlerType: (*WeatherServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetWeather",
+			Handler:    _WeatherService_GetWeather_Handler,
+		},
+		{
+			MethodName: "BatchGetWeather",
+			Handler:    _WeatherService_BatchGetWeather_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamWeather",
+			Handler:       _WeatherService_StreamWeather_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "weather/v1/weather.proto",
+}
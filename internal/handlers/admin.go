@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/prewarm"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// maxPrewarmBodyBytes bounds the size of a prewarm job, which may list thousands of CEPs
+const maxPrewarmBodyBytes = 1 << 20
+
+// AdminHandler serves operational endpoints under /admin, guarded by a bearer token
+type AdminHandler struct {
+	mu            sync.RWMutex
+	token         string
+	keyPool       *services.KeyPool
+	authenticator *auth.Authenticator
+	prewarmer     *prewarm.Prewarmer
+}
+
+// NewAdminHandler creates a new admin handler; an empty token disables every admin endpoint
+func NewAdminHandler(token string, keyPool *services.KeyPool, authenticator *auth.Authenticator, prewarmer *prewarm.Prewarmer) *AdminHandler {
+	return &AdminHandler{
+		token:         token,
+		keyPool:       keyPool,
+		authenticator: authenticator,
+		prewarmer:     prewarmer,
+	}
+}
+
+// SetToken replaces the admin token, e.g. after a configuration reload
+func (h *AdminHandler) SetToken(token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.token = token
+}
+
+// GetKeyPool handles GET /admin/keys
+func (h *AdminHandler) GetKeyPool(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, h.keyPool.Status())
+}
+
+// GetClients handles GET /admin/clients
+func (h *AdminHandler) GetClients(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, h.authenticator.Usage())
+}
+
+// prewarmJobRequest is the body of PUT /admin/prewarm/{name}
+type prewarmJobRequest struct {
+	Schedule string   `json:"schedule"`
+	Interval string   `json:"interval"`
+	Jitter   string   `json:"jitter"`
+	CEPs     []string `json:"ceps"`
+}
+
+// Prewarm handles /admin/prewarm and /admin/prewarm/{name}: GET lists the jobs or shows
+// one, PUT creates or replaces a job and DELETE removes it. Jobs from the configuration
+// can only be changed there.
+func (h *AdminHandler) Prewarm(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/prewarm"), "/")
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		respondWithJSON(w, r, http.StatusOK, h.prewarmer.Status())
+	case name == "":
+		w.Header().Set("Allow", http.MethodGet)
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	case r.Method == http.MethodGet:
+		status, ok := h.prewarmStatus(name)
+		if !ok {
+			respondWithError(w, r, http.StatusNotFound, prewarm.ErrNotFound.Error())
+			return
+		}
+		respondWithJSON(w, r, http.StatusOK, status)
+	case r.Method == http.MethodPut:
+		h.putPrewarmJob(w, r, name)
+	case r.Method == http.MethodDelete:
+		switch err := h.prewarmer.Delete(name); {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, prewarm.ErrNotFound):
+			respondWithError(w, r, http.StatusNotFound, err.Error())
+		default:
+			respondWithError(w, r, http.StatusConflict, err.Error())
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *AdminHandler) putPrewarmJob(w http.ResponseWriter, r *http.Request, name string) {
+	var req prewarmJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPrewarmBodyBytes)).Decode(&req); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	job := prewarm.Job{Name: name, Schedule: req.Schedule, CEPs: req.CEPs}
+	var err error
+	if job.Interval, err = parseOptionalDuration(req.Interval); err != nil {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "interval: "+err.Error())
+		return
+	}
+	if job.Jitter, err = parseOptionalDuration(req.Jitter); err != nil {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "jitter: "+err.Error())
+		return
+	}
+
+	created, err := h.prewarmer.Put(job)
+	switch {
+	case errors.Is(err, prewarm.ErrConfigured):
+		respondWithError(w, r, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	status, _ := h.prewarmStatus(name)
+	if created {
+		w.Header().Set("Location", "/admin/prewarm/"+name)
+		respondWithJSON(w, r, http.StatusCreated, status)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, status)
+}
+
+// parseOptionalDuration parses a duration such as "5m", treating "" as zero
+func parseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func (h *AdminHandler) prewarmStatus(name string) (prewarm.Status, bool) {
+	for _, status := range h.prewarmer.Status() {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return prewarm.Status{}, false
+}
+
+// authorize writes an error response and returns false unless the request carries the admin token
+func (h *AdminHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	h.mu.RLock()
+	token := h.token
+	h.mu.RUnlock()
+
+	if token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		respondWithError(w, r, http.StatusUnauthorized, "unauthorized")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/prewarm"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+func TestAdminHandler_GetKeyPool(t *testing.T) {
+	pool := services.NewKeyPool([]string{"abcdefghijkl1234", "abcdefghijkl5678"}, services.KeyStrategyRoundRobin, 1000)
+
+	tests := []struct {
+		name           string
+		token          string
+		authorization  string
+		expectedStatus int
+	}{
+		{
+			name:           "disabled without token",
+			token:          "",
+			authorization:  "Bearer anything",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "missing credentials",
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong token",
+			token:          "secret",
+			authorization:  "Bearer wrong",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "valid token",
+			token:          "secret",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAdminHandler(tt.token, pool, auth.NewAuthenticator(auth.Settings{}, nil), nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.GetKeyPool(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var status services.KeyPoolStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(status.Keys) != 2 || status.Keys[0].Key != "****1234" {
+				t.Errorf("unexpected pool status: %+v", status)
+			}
+			if status.MonthlyQuota != 1000 {
+				t.Errorf("expected monthly quota 1000, got %d", status.MonthlyQuota)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_GetClients(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.Settings{Enabled: true, Header: "X-API-Key"}, []auth.Client{
+		{Name: "erp", Key: "erp-key", DailyQuota: 100},
+		{Name: "dashboard", Key: "dashboard-key"},
+	})
+	handler := NewAdminHandler("secret", nil, authenticator, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/clients", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+
+	handler.GetClients(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var usage []auth.Usage
+	if err := json.NewDecoder(rec.Body).Decode(&usage); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(usage) != 2 || usage[0].Name != "dashboard" || usage[1].DailyQuota != 100 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+	if strings.Contains(rec.Body.String(), "erp-key") {
+		t.Error("expected client keys not to be exposed")
+	}
+}
+
+type refreshWeatherService struct{}
+
+func (refreshWeatherService) Refresh(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	return &models.WeatherAPIResponse{}, nil
+}
+
+func TestAdminHandler_Prewarm(t *testing.T) {
+	prewarmer := prewarm.New(stubCEPService{}, refreshWeatherService{}, prewarm.Settings{Concurrency: 1})
+	prewarmer.SetConfigJobs([]prewarm.Job{{Name: "dcs", Schedule: "*/15 * * * *", CEPs: []string{"01310100"}}})
+	handler := NewAdminHandler("secret", nil, nil, prewarmer)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+	}{
+		{"list", http.MethodGet, "/admin/prewarm", "", http.StatusOK},
+		{"show", http.MethodGet, "/admin/prewarm/dcs", "", http.StatusOK},
+		{"unknown", http.MethodGet, "/admin/prewarm/stores", "", http.StatusNotFound},
+		{"create", http.MethodPut, "/admin/prewarm/stores", `{"interval": "10m", "jitter": "1m", "ceps": ["01310-100"]}`, http.StatusCreated},
+		{"replace", http.MethodPut, "/admin/prewarm/stores", `{"schedule": "@hourly", "ceps": ["01310100", "20040020"]}`, http.StatusOK},
+		{"invalid job", http.MethodPut, "/admin/prewarm/stores", `{"ceps": ["01310100"]}`, http.StatusUnprocessableEntity},
+		{"invalid duration", http.MethodPut, "/admin/prewarm/stores", `{"interval": "often", "ceps": ["01310100"]}`, http.StatusUnprocessableEntity},
+		{"invalid body", http.MethodPut, "/admin/prewarm/stores", `{`, http.StatusBadRequest},
+		{"configured job", http.MethodPut, "/admin/prewarm/dcs", `{"interval": "10m", "ceps": ["01310100"]}`, http.StatusConflict},
+		{"delete configured", http.MethodDelete, "/admin/prewarm/dcs", "", http.StatusConflict},
+		{"delete", http.MethodDelete, "/admin/prewarm/stores", "", http.StatusNoContent},
+		{"delete again", http.MethodDelete, "/admin/prewarm/stores", "", http.StatusNotFound},
+		{"method not allowed", http.MethodPost, "/admin/prewarm", "", http.StatusMethodNotAllowed},
+	}
+
+	// The cases run in order: create, replace and delete act on the same job
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+
+			handler.Prewarm(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("status", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/prewarm", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.Prewarm(rec, req)
+
+		var statuses []prewarm.Status
+		if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].Name != "dcs" || statuses[0].Source != prewarm.SourceConfig || statuses[0].Schedule != "*/15 * * * *" {
+			t.Errorf("unexpected statuses %+v", statuses)
+		}
+	})
+
+	t.Run("requires the token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.Prewarm(rec, httptest.NewRequest(http.MethodGet, "/admin/prewarm", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rec.Code)
+		}
+	})
+}
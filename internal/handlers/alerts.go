@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lhespanhol/weather-by-cep/internal/alerts"
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// maxAlertBodyBytes bounds the size of an alert registration
+const maxAlertBodyBytes = 64 << 10
+
+// AlertsHandler manages the temperature alerts of the calling API client
+type AlertsHandler struct {
+	store      *alerts.Store
+	dispatcher *alerts.Dispatcher
+	cepService services.CEPService
+}
+
+// NewAlertsHandler creates an alerts handler
+func NewAlertsHandler(store *alerts.Store, dispatcher *alerts.Dispatcher, cepService services.CEPService) *AlertsHandler {
+	return &AlertsHandler{
+		store:      store,
+		dispatcher: dispatcher,
+		cepService: cepService,
+	}
+}
+
+// ServeHTTP handles /alerts, /alerts/dead-letters and /alerts/{id}. Alerts belong to the
+// calling API client, so the routes answer 401 while authentication is disabled.
+func (h *AlertsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client, ok := auth.ClientFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, "alerts require authentication to be enabled")
+		return
+	}
+	owner := client.Name
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/alerts"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		respondWithJSON(w, r, http.StatusOK, h.store.List(owner))
+	case id == "" && r.Method == http.MethodPost:
+		h.create(w, r, owner)
+	case id == "":
+		w.Header().Set("Allow", "GET, POST")
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	case id == "dead-letters" && r.Method == http.MethodGet:
+		respondWithJSON(w, r, http.StatusOK, h.dispatcher.DeadLetters(owner))
+	case id == "dead-letters":
+		w.Header().Set("Allow", http.MethodGet)
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	case r.Method == http.MethodGet:
+		alert, err := h.store.Get(owner, id)
+		if err != nil {
+			respondWithError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		respondWithJSON(w, r, http.StatusOK, alert)
+	case r.Method == http.MethodDelete:
+		if err := h.store.Delete(owner, id); err != nil {
+			respondWithError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// create registers an alert after checking that ViaCEP knows its CEP
+func (h *AlertsHandler) create(w http.ResponseWriter, r *http.Request, owner string) {
+	var req alerts.Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertBodyBytes)).Decode(&req); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	location, err := h.cepService.GetLocation(r.Context(), req.CEP)
+	if err != nil {
+		log.Printf("Error fetching location: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if location == nil {
+		respondWithError(w, r, http.StatusNotFound, services.ErrCEPNotFound.Error())
+		return
+	}
+
+	alert, err := h.store.Create(owner, req)
+	switch {
+	case err == nil:
+	case errors.Is(err, alerts.ErrLimitReached):
+		respondWithError(w, r, http.StatusConflict, err.Error())
+		return
+	default:
+		respondWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/alerts/"+alert.ID)
+	respondWithJSON(w, r, http.StatusCreated, alert)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/alerts"
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+)
+
+func newAlertsHandler() *AlertsHandler {
+	dispatcher := alerts.NewDispatcher(alerts.Settings{MaxAttempts: 1, RetryBackoff: time.Second, Timeout: time.Second})
+	return NewAlertsHandler(alerts.NewStore(2), dispatcher, streamCEPService{})
+}
+
+func serveAlerts(h http.Handler, client, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if client != "" {
+		req = req.WithContext(auth.ContextWithClient(req.Context(), &auth.Client{Name: client}))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAlertsHandler_Lifecycle(t *testing.T) {
+	h := newAlertsHandler()
+	body := `{"cep": "01310-100", "condition": {"field": "temp_C", "operator": "gt", "value": 35}, "webhook_url": "https://example.com/hooks"}`
+
+	rec := serveAlerts(h, "erp", http.MethodPost, "/alerts", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created alerts.Alert
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.CEP != "01310100" || created.Secret == "" || rec.Header().Get("Location") != "/alerts/"+created.ID {
+		t.Errorf("unexpected alert %+v (Location %q)", created, rec.Header().Get("Location"))
+	}
+
+	rec = serveAlerts(h, "erp", http.MethodGet, "/alerts", "")
+	var listed []alerts.Alert
+	json.Unmarshal(rec.Body.Bytes(), &listed)
+	if rec.Code != http.StatusOK || len(listed) != 1 || listed[0].ID != created.ID || listed[0].Secret != "" {
+		t.Errorf("unexpected list %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAlerts(h, "dashboard", http.MethodGet, "/alerts", ""); strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("expected other clients to see no alerts, got %s", rec.Body.String())
+	}
+
+	if rec := serveAlerts(h, "erp", http.MethodGet, "/alerts/"+created.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	if rec := serveAlerts(h, "dashboard", http.MethodDelete, "/alerts/"+created.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+	if rec := serveAlerts(h, "erp", http.MethodDelete, "/alerts/"+created.ID, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", rec.Code)
+	}
+	if rec := serveAlerts(h, "erp", http.MethodGet, "/alerts/"+created.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+	if rec := serveAlerts(h, "erp", http.MethodGet, "/alerts/dead-letters", ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("unexpected dead letters %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAlertsHandler_Errors(t *testing.T) {
+	valid := `{"cep": "01310100", "condition": {"field": "temp_C", "operator": "lt", "value": 5}, "webhook_url": "https://example.com/hooks"}`
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+	}{
+		{"invalid body", http.MethodPost, "/alerts", "{", http.StatusBadRequest},
+		{"invalid cep", http.MethodPost, "/alerts", strings.Replace(valid, "01310100", "0131", 1), http.StatusUnprocessableEntity},
+		{"unknown cep", http.MethodPost, "/alerts", strings.Replace(valid, "01310100", "99999999", 1), http.StatusNotFound},
+		{"invalid condition", http.MethodPost, "/alerts", strings.Replace(valid, `"lt"`, `"between"`, 1), http.StatusUnprocessableEntity},
+		{"invalid webhook", http.MethodPost, "/alerts", strings.Replace(valid, "https://", "", 1), http.StatusUnprocessableEntity},
+		{"method not allowed", http.MethodPut, "/alerts", "", http.StatusMethodNotAllowed},
+		{"alert method not allowed", http.MethodPost, "/alerts/abc", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveAlerts(newAlertsHandler(), "erp", tt.method, tt.target, tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		// Without auth every caller would share the same alerts
+		h := newAlertsHandler()
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			if rec := serveAlerts(h, "", method, "/alerts", valid); rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s: expected status 401, got %d", method, rec.Code)
+			}
+		}
+		if len(h.store.List("")) != 0 {
+			t.Error("expected no alert to be stored")
+		}
+	})
+
+	t.Run("limit reached", func(t *testing.T) {
+		h := newAlertsHandler()
+		for i, expected := range []int{http.StatusCreated, http.StatusCreated, http.StatusConflict} {
+			if rec := serveAlerts(h, "erp", http.MethodPost, "/alerts", valid); rec.Code != expected {
+				t.Errorf("request %d: expected status %d, got %d", i, expected, rec.Code)
+			}
+		}
+	})
+}
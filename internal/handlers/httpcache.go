@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+)
+
+// cacheValidators describes how long a response stays fresh and when its data was observed
+type cacheValidators struct {
+	lastModified time.Time
+	maxAge       time.Duration
+}
+
+// respondWithCacheable writes a 200 response in the negotiated format with a strong ETag
+// over the body, Cache-Control and Last-Modified, answering matching conditional requests with 304.
+// Responses to authenticated requests are private, so a shared cache cannot serve them to
+// clients without a key, and outside their quota.
+func respondWithCacheable(w http.ResponseWriter, r *http.Request, data interface{}, v cacheValidators) {
+	format, ok := render.Acceptable(w, r)
+	if !ok {
+		return
+	}
+	body, err := render.Encode(format, data)
+	if err != nil {
+		log.Printf("Error rendering %s response: %v", format, err)
+		respondWithError(w, r, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	h := w.Header()
+	h.Set("ETag", computeETag(body))
+	scope := "public"
+	if _, ok := auth.ClientFromContext(r.Context()); ok {
+		scope = "private"
+	}
+	h.Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, int(v.maxAge.Seconds())))
+	if !v.lastModified.IsZero() {
+		h.Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, h.Get("ETag"), v.lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// computeETag returns a strong entity tag derived from the body's SHA-256
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified evaluates If-None-Match and, only when it is absent, If-Modified-Since (RFC 9110 §13.2.2)
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// If-None-Match uses the weak comparison, so W/ tags added by
+			// compressing proxies still match
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// freshness derives the response max-age from when the reading was observed: the
+// provider publishes a new reading every refresh interval, so clients may reuse the
+// response until the next one is due.
+func freshness(observed, now time.Time, refresh time.Duration) time.Duration {
+	if observed.IsZero() {
+		return 0
+	}
+	remaining := refresh - now.Sub(observed)
+	if remaining < 0 {
+		return 0
+	}
+	if remaining > refresh {
+		return refresh
+	}
+	return remaining
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+type stubCEPService struct{}
+
+func (stubCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	return &models.ViaCEPResponse{
+		CEP:        cep,
+		Logradouro: "Avenida Paulista",
+		Bairro:     "Bela Vista",
+		Localidade: "São Paulo",
+		UF:         "SP",
+		IBGE:       "3550308",
+		DDD:        "11",
+	}, nil
+}
+
+type stubWeatherService struct {
+	tempC    float64
+	observed time.Time
+}
+
+func (s stubWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	weather := &models.WeatherAPIResponse{}
+	weather.Location.Name = city
+	weather.Location.Region = "Sao Paulo"
+	weather.Location.Country = "Brazil"
+	weather.Location.Lat = -23.53
+	weather.Location.Lon = -46.62
+	weather.Current.TempC = s.tempC
+	if !s.observed.IsZero() {
+		weather.Current.LastUpdatedEpoch = s.observed.Unix()
+	}
+	return weather, nil
+}
+
+func newCachingHandler(observed, now time.Time) *WeatherHandler {
+	handler := NewWeatherHandler(stubCEPService{}, stubWeatherService{tempC: 28.5, observed: observed})
+	handler.now = func() time.Time { return now }
+	return handler
+}
+
+func TestWeatherHandler_CachingHeaders(t *testing.T) {
+	observed := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	handler := newCachingHandler(observed, observed.Add(5*time.Minute))
+
+	rec := httptest.NewRecorder()
+	handler.GetWeatherByCEP(rec, httptest.NewRequest(http.MethodGet, "/weather/01310100", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		t.Errorf("expected strong ETag, got %q", etag)
+	}
+	if etag != computeETag(rec.Body.Bytes()) {
+		t.Errorf("ETag %q does not match the body", etag)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=600" {
+		t.Errorf("expected max-age of the remaining refresh interval, got %q", got)
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "Tue, 10 Mar 2026 14:30:00 GMT" {
+		t.Errorf("unexpected Last-Modified %q", got)
+	}
+}
+
+func TestWeatherHandler_CachingHeaders_Authenticated(t *testing.T) {
+	observed := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	handler := newCachingHandler(observed, observed.Add(5*time.Minute))
+
+	tests := []struct {
+		name     string
+		settings auth.Settings
+		want     string
+	}{
+		{"auth disabled", auth.Settings{Header: "X-API-Key"}, "public, max-age=600"},
+		{"auth enabled", auth.Settings{Enabled: true, Header: "X-API-Key"}, "private, max-age=600"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := auth.NewAuthenticator(tt.settings, []auth.Client{{Name: "erp", Key: "erp-key"}})
+			req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+			req.Header.Set("X-API-Key", "erp-key")
+			rec := httptest.NewRecorder()
+
+			authenticator.Middleware(http.HandlerFunc(handler.GetWeatherByCEP)).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("expected Cache-Control %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWeatherHandler_ConditionalGet(t *testing.T) {
+	observed := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	handler := newCachingHandler(observed, observed.Add(time.Minute))
+
+	rec := httptest.NewRecorder()
+	handler.GetWeatherByCEP(rec, httptest.NewRequest(http.MethodGet, "/weather/01310100", nil))
+	etag := rec.Header().Get("ETag")
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"weak matching etag", map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+		{"etag in list", map[string]string{"If-None-Match": `"other", ` + etag}, http.StatusNotModified},
+		{"wildcard", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"stale etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": "Tue, 10 Mar 2026 14:30:00 GMT"}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": "Tue, 10 Mar 2026 14:00:00 GMT"}, http.StatusOK},
+		{"invalid date", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{
+			name:           "if-none-match takes precedence",
+			headers:        map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": "Tue, 10 Mar 2026 14:30:00 GMT"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.GetWeatherByCEP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Header().Get("ETag") != etag {
+				t.Errorf("expected ETag %q, got %q", etag, rec.Header().Get("ETag"))
+			}
+			if tt.expectedStatus == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("expected empty body on 304, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	observed := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		observed time.Time
+		now      time.Time
+		expected time.Duration
+	}{
+		{"fresh reading", observed, observed.Add(5 * time.Minute), 10 * time.Minute},
+		{"overdue reading", observed, observed.Add(20 * time.Minute), 0},
+		{"clock skew", observed, observed.Add(-time.Minute), 15 * time.Minute},
+		{"unknown observation", time.Time{}, observed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := freshness(tt.observed, tt.now, 15*time.Minute); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
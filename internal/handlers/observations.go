@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/observations"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+const (
+	// defaultObservationRange is the period returned when ?from= is omitted
+	defaultObservationRange = 24 * time.Hour
+	defaultObservationLimit = 1000
+	maxObservationLimit     = 10000
+)
+
+// errEnoughObservations stops a scan once a page is full
+var errEnoughObservations = errors.New("page full")
+
+// ObservationsHandler serves the recorded readings
+type ObservationsHandler struct {
+	store observations.Store
+	now   func() time.Time
+}
+
+// NewObservationsHandler creates an observations handler over the store
+func NewObservationsHandler(store observations.Store) *ObservationsHandler {
+	return &ObservationsHandler{store: store, now: time.Now}
+}
+
+// GetObservations handles GET /observations/{cep}?from=&to=&limit=. Observations come
+// oldest first; when more remain, a Link header with rel="next" points to the next page.
+func (h *ObservationsHandler) GetObservations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	cep := services.NormalizeCEP(strings.TrimPrefix(r.URL.Path, "/observations/"))
+	if !services.ValidateCEP(cep) {
+		respondWithError(w, r, http.StatusUnprocessableEntity, services.ErrInvalidCEP.Error())
+		return
+	}
+	from, to, err := timeRange(r.URL.Query(), h.now(), defaultObservationRange)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := defaultObservationLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxObservationLimit {
+			respondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxObservationLimit))
+			return
+		}
+	}
+
+	page := make([]observations.Observation, 0)
+	more := false
+	err = h.store.Scan(r.Context(), observations.Filter{CEP: cep, From: from, To: to}, func(o observations.Observation) error {
+		if len(page) == limit {
+			more = true
+			return errEnoughObservations
+		}
+		page = append(page, o)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEnoughObservations) {
+		log.Printf("Error reading observations: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if more {
+		// A CEP has at most one observation per instant, so the next page starts right after the last one
+		next := url.Values{}
+		next.Set("from", page[len(page)-1].ObservedAt.Add(time.Nanosecond).Format(time.RFC3339Nano))
+		next.Set("to", to.Format(time.RFC3339Nano))
+		next.Set("limit", strconv.Itoa(limit))
+		w.Header().Add("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.EscapedPath(), next.Encode()))
+	}
+	respondWithJSON(w, r, http.StatusOK, page)
+}
+
+// timeRange parses the ?from= and ?to= parameters, given as RFC 3339 timestamps or
+// dates. The range ends now and spans defaultRange unless the parameters say otherwise.
+func timeRange(query url.Values, now time.Time, defaultRange time.Duration) (from, to time.Time, err error) {
+	to = now.UTC()
+	if value := query.Get("to"); value != "" {
+		if to, err = parseTimeParam(value); err != nil {
+			return from, to, fmt.Errorf("to: %w", err)
+		}
+	}
+	from = to.Add(-defaultRange)
+	if value := query.Get("from"); value != "" {
+		if from, err = parseTimeParam(value); err != nil {
+			return from, to, fmt.Errorf("from: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or a YYYY-MM-DD date (midnight UTC)
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a YYYY-MM-DD date", value)
+}
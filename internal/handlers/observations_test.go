@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/observations"
+)
+
+func newObservationsHandler(t *testing.T) *ObservationsHandler {
+	t.Helper()
+	store := observations.NewMemoryStore()
+	start := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		store.Record(context.Background(), observations.Observation{CEP: "01310100", TempC: float64(20 + i), ObservedAt: start.Add(time.Duration(i) * time.Hour)})
+	}
+	store.Record(context.Background(), observations.Observation{CEP: "01311000", TempC: 30, ObservedAt: start})
+
+	h := NewObservationsHandler(store)
+	h.now = func() time.Time { return start.Add(12 * time.Hour) }
+	return h
+}
+
+func TestObservationsHandler_GetObservations(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		expected     []float64
+		expectedNext string
+	}{
+		{"last 24 hours", "/observations/01310-100", []float64{20, 21, 22, 23, 24}, ""},
+		{"range", "/observations/01310100?from=2026-03-10T01:00:00Z&to=2026-03-10T03:00:00Z", []float64{21, 22}, ""},
+		{"dates", "/observations/01310100?from=2026-03-11", nil, "invalid"},
+		{
+			"paginated",
+			"/observations/01310100?from=2026-03-10&limit=2",
+			[]float64{20, 21},
+			"/observations/01310100?from=2026-03-10T01%3A00%3A00.000000001Z&limit=2&to=2026-03-10T12%3A00%3A00Z",
+		},
+		{"last page", "/observations/01310100?from=2026-03-10T01:00:00.000000001Z&to=2026-03-10T12:00:00Z&limit=3", []float64{22, 23, 24}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newObservationsHandler(t).GetObservations(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if tt.expectedNext == "invalid" {
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("expected status 400 for from after to, got %d", rec.Code)
+				}
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var page []observations.Observation
+			json.Unmarshal(rec.Body.Bytes(), &page)
+			var temps []float64
+			for _, o := range page {
+				temps = append(temps, o.TempC)
+			}
+			if len(temps) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, temps)
+			}
+			for i := range temps {
+				if temps[i] != tt.expected[i] {
+					t.Fatalf("expected %v, got %v", tt.expected, temps)
+				}
+			}
+
+			link := rec.Header().Get("Link")
+			if tt.expectedNext == "" && link != "" {
+				t.Errorf("unexpected Link %q", link)
+			}
+			if tt.expectedNext != "" && link != "<"+tt.expectedNext+`>; rel="next"` {
+				t.Errorf("unexpected Link %q", link)
+			}
+		})
+	}
+}
+
+func TestObservationsHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{"invalid cep", http.MethodGet, "/observations/0131", http.StatusUnprocessableEntity},
+		{"invalid from", http.MethodGet, "/observations/01310100?from=yesterday", http.StatusBadRequest},
+		{"invalid limit", http.MethodGet, "/observations/01310100?limit=0", http.StatusBadRequest},
+		{"limit too large", http.MethodGet, "/observations/01310100?limit=10001", http.StatusBadRequest},
+		{"method not allowed", http.MethodPost, "/observations/01310100", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newObservationsHandler(t).GetObservations(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWeatherHandler_RecordsObservations(t *testing.T) {
+	store := observations.NewMemoryStore()
+	recorder := observations.NewRecorder(store, "weatherapi", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go recorder.Run(ctx)
+
+	observed := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	handler := NewWeatherHandler(stubCEPService{}, stubWeatherService{tempC: 28.5, observed: observed})
+	handler.SetRecorder(recorder)
+	handler.GetWeatherByCEPV2(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/weather/01310100", nil))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var recorded []observations.Observation
+		store.Scan(context.Background(), observations.Filter{CEP: "01310100"}, func(o observations.Observation) error {
+			recorded = append(recorded, o)
+			return nil
+		})
+		if len(recorded) == 1 {
+			o := recorded[0]
+			if o.IBGE != "3550308" || o.Provider != "weatherapi" || o.TempC != 28.5 || !o.ObservedAt.Equal(observed) {
+				t.Errorf("unexpected observation %+v", o)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected one observation, got %d", len(recorded))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
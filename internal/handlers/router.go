@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/openapi"
+)
+
+// Routes holds the handlers mounted by NewRouter
+type Routes struct {
+	Weather       *WeatherHandler
+	Stream        *StreamHandler
+	WebSocket     *WebSocketHandler
+	GraphQL       http.Handler
+	Alerts        *AlertsHandler
+	Observations  *ObservationsHandler
+	Stats         *StatsHandler
+	Admin         *AdminHandler
+	Authenticator *auth.Authenticator
+}
+
+// The unversioned /weather/{cep} route is an alias of /v1, kept for existing integrators
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// NewRouter registers every HTTP route of the service
+func NewRouter(routes Routes) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", Root)
+	mux.HandleFunc("/health", Health)
+	mux.HandleFunc("/openapi.json", openapi.Handler)
+	v1 := withStream(routes.Weather.GetWeatherByCEP, routes.Stream.StreamV1)
+	v2 := withStream(routes.Weather.GetWeatherByCEPV2, routes.Stream.StreamV2)
+	mux.Handle("/v1/weather/", routes.Authenticator.Middleware(v1))
+	mux.Handle("/v2/weather/", routes.Authenticator.Middleware(v2))
+	mux.Handle("/v2/weather/ws", routes.Authenticator.Middleware(routes.WebSocket))
+	mux.Handle("/weather/", deprecated(routes.Authenticator.Middleware(v1), "/v1"))
+	mux.Handle("/graphql", routes.Authenticator.Middleware(routes.GraphQL))
+	mux.Handle("/alerts", routes.Authenticator.Middleware(routes.Alerts))
+	mux.Handle("/alerts/", routes.Authenticator.Middleware(routes.Alerts))
+	mux.Handle("/observations/", routes.Authenticator.Middleware(http.HandlerFunc(routes.Observations.GetObservations)))
+	mux.Handle("/stats", routes.Authenticator.Middleware(http.HandlerFunc(routes.Stats.GetStats)))
+	mux.HandleFunc("/admin/keys", routes.Admin.GetKeyPool)
+	mux.HandleFunc("/admin/clients", routes.Admin.GetClients)
+	mux.HandleFunc("/admin/prewarm", routes.Admin.Prewarm)
+	mux.HandleFunc("/admin/prewarm/", routes.Admin.Prewarm)
+	return mux
+}
+
+// Root handles GET /
+func Root(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("weather-by-cep service is running"))
+}
+
+// Health handles GET /health
+func Health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// deprecated announces the deprecation (RFC 9745) and sunset (RFC 8594) of a route,
+// linking to the same resource under the successor version prefix
+func deprecated(next http.Handler, successorPrefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecatedAt.Unix(), 10))
+		h.Set("Sunset", legacySunset.Format(http.TimeFormat))
+		h.Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successorPrefix, r.URL.EscapedPath()))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+)
+
+func TestNewRouter_WeatherVersions(t *testing.T) {
+	observed := time.Now().Add(-time.Minute)
+	router := NewRouter(Routes{
+		Weather:       newCachingHandler(observed, time.Now()),
+		Admin:         NewAdminHandler("", nil, nil, nil),
+		Authenticator: auth.NewAuthenticator(auth.Settings{}, nil),
+	})
+
+	tests := []struct {
+		name              string
+		target            string
+		expectDeprecation bool
+		expectedLink      string
+	}{
+		{"v1", "/v1/weather/01310100", false, ""},
+		{"v2", "/v2/weather/01310100", false, ""},
+		{"legacy alias", "/weather/01310-100", true, `</v1/weather/01310-100>; rel="successor-version"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Deprecation") != ""; got != tt.expectDeprecation {
+				t.Errorf("expected Deprecation header present = %v", tt.expectDeprecation)
+			}
+			if tt.expectDeprecation {
+				if got := rec.Header().Get("Deprecation"); got != "@1792368000" {
+					t.Errorf("unexpected Deprecation %q", got)
+				}
+				if got := rec.Header().Get("Sunset"); got != "Fri, 30 Apr 2027 00:00:00 GMT" {
+					t.Errorf("unexpected Sunset %q", got)
+				}
+				if got := rec.Header().Get("Link"); got != tt.expectedLink {
+					t.Errorf("expected Link %q, got %q", tt.expectedLink, got)
+				}
+			}
+		})
+	}
+}
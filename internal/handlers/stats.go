@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/observations"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+const (
+	// defaultStatsRange is the period summarized when ?from= is omitted
+	defaultStatsRange = 7 * 24 * time.Hour
+	// maxStatsBuckets bounds the size of a report
+	maxStatsBuckets = 1000
+)
+
+var (
+	ibgePattern = regexp.MustCompile(`^\d{7}$`)
+	ufPattern   = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// StatsHandler aggregates the recorded readings
+type StatsHandler struct {
+	store observations.Store
+	now   func() time.Time
+}
+
+// NewStatsHandler creates a stats handler over the store
+func NewStatsHandler(store observations.Store) *StatsHandler {
+	return &StatsHandler{store: store, now: time.Now}
+}
+
+// GetStats handles GET /stats?cep=|ibge=|uf=&from=&to=&bucket=, summarizing the
+// observations of a CEP, a city (IBGE code) or a state per hour, day or week
+func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		respondWithError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	report := observations.Report{
+		CEP:  query.Get("cep"),
+		IBGE: query.Get("ibge"),
+		UF:   strings.ToUpper(query.Get("uf")),
+	}
+	selectors := 0
+	for _, value := range []string{report.CEP, report.IBGE, report.UF} {
+		if value != "" {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		respondWithError(w, r, http.StatusBadRequest, "exactly one of cep, ibge or uf is required")
+		return
+	}
+	if report.CEP != "" {
+		report.CEP = services.NormalizeCEP(report.CEP)
+		if !services.ValidateCEP(report.CEP) {
+			respondWithError(w, r, http.StatusUnprocessableEntity, services.ErrInvalidCEP.Error())
+			return
+		}
+	}
+	if report.IBGE != "" && !ibgePattern.MatchString(report.IBGE) {
+		respondWithError(w, r, http.StatusBadRequest, "ibge must be a 7-digit IBGE city code")
+		return
+	}
+	if report.UF != "" && !ufPattern.MatchString(report.UF) {
+		respondWithError(w, r, http.StatusBadRequest, "uf must be a 2-letter state code")
+		return
+	}
+
+	var err error
+	report.Bucket = observations.Day
+	if value := query.Get("bucket"); value != "" {
+		if report.Bucket, err = observations.ParseInterval(value); err != nil {
+			respondWithError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if report.From, report.To, err = timeRange(query, h.now(), defaultStatsRange); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if report.Bucket.Buckets(report.From, report.To) > maxStatsBuckets {
+		respondWithError(w, r, http.StatusBadRequest,
+			fmt.Sprintf("the range spans more than %d buckets; use a shorter range or a wider bucket", maxStatsBuckets))
+		return
+	}
+
+	filter := observations.Filter{CEP: report.CEP, IBGE: report.IBGE, UF: report.UF, From: report.From, To: report.To}
+	report.Buckets, err = observations.Aggregate(r.Context(), h.store, filter, report.Bucket)
+	if err != nil {
+		log.Printf("Error aggregating observations: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, report)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/observations"
+)
+
+func newStatsHandler(t *testing.T) *StatsHandler {
+	t.Helper()
+	store := observations.NewMemoryStore()
+	start := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	readings := []observations.Observation{
+		{CEP: "01310100", IBGE: "3550308", UF: "SP", TempC: 20, ObservedAt: start.Add(1 * time.Hour)},
+		{CEP: "01310100", IBGE: "3550308", UF: "SP", TempC: 24, ObservedAt: start.Add(2 * time.Hour)},
+		{CEP: "01311000", IBGE: "3550308", UF: "SP", TempC: 30, ObservedAt: start.Add(26 * time.Hour)},
+		{CEP: "20040020", IBGE: "3304557", UF: "RJ", TempC: 35, ObservedAt: start.Add(3 * time.Hour)},
+	}
+	for _, o := range readings {
+		store.Record(context.Background(), o)
+	}
+
+	h := NewStatsHandler(store)
+	h.now = func() time.Time { return start.Add(48 * time.Hour) }
+	return h
+}
+
+func TestStatsHandler_GetStats(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        string
+		expectedMeans []float64
+		expectedCount []int
+	}{
+		{"cep per day", "/stats?cep=01310-100", []float64{22}, []int{2}},
+		{"cep per hour", "/stats?cep=01310100&bucket=hour", []float64{20, 24}, []int{1, 1}},
+		{"city", "/stats?ibge=3550308", []float64{22, 30}, []int{2, 1}},
+		{"state per week", "/stats?uf=sp&bucket=week", []float64{24.67}, []int{3}},
+		{"range", "/stats?uf=SP&from=2026-03-11&to=2026-03-12", []float64{30}, []int{1}},
+		{"no observations", "/stats?uf=MG", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newStatsHandler(t).GetStats(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			var report observations.Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(report.Buckets) != len(tt.expectedMeans) {
+				t.Fatalf("expected %d buckets, got %+v", len(tt.expectedMeans), report.Buckets)
+			}
+			for i, bucket := range report.Buckets {
+				if bucket.TempC.Mean != tt.expectedMeans[i] || bucket.Count != tt.expectedCount[i] {
+					t.Errorf("bucket %d: expected mean %v over %d, got %v over %d",
+						i, tt.expectedMeans[i], tt.expectedCount[i], bucket.TempC.Mean, bucket.Count)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{"no selector", http.MethodGet, "/stats", http.StatusBadRequest},
+		{"two selectors", http.MethodGet, "/stats?cep=01310100&uf=SP", http.StatusBadRequest},
+		{"invalid cep", http.MethodGet, "/stats?cep=0131", http.StatusUnprocessableEntity},
+		{"invalid ibge", http.MethodGet, "/stats?ibge=355", http.StatusBadRequest},
+		{"invalid uf", http.MethodGet, "/stats?uf=Sao", http.StatusBadRequest},
+		{"invalid bucket", http.MethodGet, "/stats?uf=SP&bucket=month", http.StatusBadRequest},
+		{"invalid range", http.MethodGet, "/stats?uf=SP&from=2026-03-12&to=2026-03-11", http.StatusBadRequest},
+		{"too many buckets", http.MethodGet, "/stats?uf=SP&bucket=hour&from=2026-01-01", http.StatusBadRequest},
+		{"method not allowed", http.MethodPost, "/stats?uf=SP", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newStatsHandler(t).GetStats(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+// StreamHandler pushes live weather readings as Server-Sent Events
+type StreamHandler struct {
+	hub *stream.Hub
+}
+
+// NewStreamHandler creates a stream handler over the hub
+func NewStreamHandler(hub *stream.Hub) *StreamHandler {
+	return &StreamHandler{hub: hub}
+}
+
+// StreamV1 handles GET /v1/weather/{cep}/stream with /v1 payloads
+func (h *StreamHandler) StreamV1(w http.ResponseWriter, r *http.Request) {
+	includeLocation := includes(r, "location")
+	h.serve(w, r, func(result *services.LookupResult) interface{} {
+		return weatherV1(result, includeLocation)
+	})
+}
+
+// StreamV2 handles GET /v2/weather/{cep}/stream with /v2 payloads
+func (h *StreamHandler) StreamV2(w http.ResponseWriter, r *http.Request) {
+	includeLocation := includes(r, "location")
+	h.serve(w, r, func(result *services.LookupResult) interface{} {
+		return weatherV2(result, includeLocation)
+	})
+}
+
+// serve keeps the connection open, sending a weather event whenever the reading
+// changes and a comment as heartbeat while it does not. Events are identified by a
+// hash of their data, so a client resuming with Last-Event-ID only gets the current
+// reading when it differs from the last one it saw.
+func (h *StreamHandler) serve(w http.ResponseWriter, r *http.Request, payload func(*services.LookupResult) interface{}) {
+	// Errors are always JSON: event stream clients send Accept: text/event-stream, which
+	// the format negotiation of render.Error would refuse
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		render.JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	_, cep, _ := strings.Cut(strings.TrimSuffix(r.URL.Path, "/stream"), "/weather/")
+	sub, err := h.hub.Subscribe(r.Context(), cep)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrInvalidCEP):
+		render.JSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	case errors.Is(err, services.ErrCEPNotFound):
+		render.JSONError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, stream.ErrTooManyStreams):
+		w.Header().Set("Retry-After", "30")
+		render.JSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case r.Context().Err() != nil:
+		return
+	default:
+		log.Printf("Error looking up weather: %v", err)
+		render.JSONError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	defer sub.Close()
+
+	// Streams outlive the server write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	send := func(result *services.LookupResult) error {
+		data, err := json.Marshal(payload(result))
+		if err != nil {
+			return err
+		}
+		id := strings.Trim(computeETag(data), `"`)
+		if id == lastID {
+			return nil
+		}
+		lastID = id
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: weather\ndata: %s\n\n", id, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := send(sub.Current()); err != nil {
+		return
+	}
+	// Commit the headers even when a resuming client is already up to date
+	rc.Flush()
+
+	heartbeat := time.NewTicker(h.hub.Settings().Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case result := <-sub.Updates():
+			if err := send(result); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// withStream routes paths ending in /stream to the stream handler
+func withStream(next, live http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stream") {
+			live(w, r)
+			return
+		}
+		next(w, r)
+	})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+// streamCEPService knows every CEP but 99999999
+type streamCEPService struct{}
+
+func (streamCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	if cep == "99999999" {
+		return nil, nil
+	}
+	return stubCEPService{}.GetLocation(ctx, cep)
+}
+
+// liveWeatherService returns a temperature the test can change
+type liveWeatherService struct {
+	mu    sync.Mutex
+	tempC float64
+}
+
+func (s *liveWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	weather := &models.WeatherAPIResponse{}
+	weather.Location.Name = city
+	weather.Current.TempC = s.tempC
+	return weather, nil
+}
+
+func (s *liveWeatherService) set(tempC float64) {
+	s.mu.Lock()
+	s.tempC = tempC
+	s.mu.Unlock()
+}
+
+func newStreamServer(t *testing.T, weather services.WeatherServiceInterface, settings stream.Settings) *httptest.Server {
+	t.Helper()
+	hub := stream.NewHub(services.NewLookup(streamCEPService{}, weather), settings)
+	h := NewStreamHandler(hub)
+	server := httptest.NewServer(withStream(http.NotFound, h.StreamV1))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openStream connects and returns the response with a reader of its lines
+func openStream(t *testing.T, url, lastEventID string) (*http.Response, *bufio.Scanner) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewScanner(resp.Body)
+}
+
+// nextEvent reads until the end of the next event or comment
+func nextEvent(t *testing.T, lines *bufio.Scanner) []string {
+	t.Helper()
+	var event []string
+	for lines.Scan() {
+		if lines.Text() == "" {
+			return event
+		}
+		event = append(event, lines.Text())
+	}
+	t.Fatalf("stream ended: %v", lines.Err())
+	return nil
+}
+
+func TestStreamHandler_Events(t *testing.T) {
+	weather := &liveWeatherService{tempC: 25}
+	server := newStreamServer(t, weather, stream.Settings{PollInterval: 10 * time.Millisecond, Heartbeat: time.Hour, MaxStreams: 10})
+
+	resp, lines := openStream(t, server.URL+"/v1/weather/01310-100/stream", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("unexpected Content-Type %q", got)
+	}
+
+	first := nextEvent(t, lines)
+	if len(first) != 3 || !strings.HasPrefix(first[0], "id: ") || first[1] != "event: weather" ||
+		first[2] != `data: {"temp_C":25,"temp_F":77,"temp_K":298}` {
+		t.Fatalf("unexpected event %q", first)
+	}
+
+	weather.set(30)
+	second := nextEvent(t, lines)
+	if len(second) != 3 || second[0] == first[0] || second[2] != `data: {"temp_C":30,"temp_F":86,"temp_K":303}` {
+		t.Errorf("unexpected event %q", second)
+	}
+}
+
+func TestStreamHandler_Resume(t *testing.T) {
+	weather := &liveWeatherService{tempC: 25}
+	server := newStreamServer(t, weather, stream.Settings{PollInterval: time.Hour, Heartbeat: 10 * time.Millisecond, MaxStreams: 10})
+
+	_, lines := openStream(t, server.URL+"/v1/weather/01310100/stream", "")
+	id := strings.TrimPrefix(nextEvent(t, lines)[0], "id: ")
+
+	// Already up to date: the client only gets heartbeats
+	_, lines = openStream(t, server.URL+"/v1/weather/01310100/stream", id)
+	if event := nextEvent(t, lines); len(event) != 1 || event[0] != ": heartbeat" {
+		t.Errorf("expected a heartbeat, got %q", event)
+	}
+
+	_, lines = openStream(t, server.URL+"/v1/weather/01310100/stream", "stale")
+	if event := nextEvent(t, lines); len(event) != 3 || event[0] != "id: "+id {
+		t.Errorf("expected the current reading, got %q", event)
+	}
+}
+
+func TestStreamHandler_Errors(t *testing.T) {
+	server := newStreamServer(t, &liveWeatherService{}, stream.Settings{PollInterval: time.Hour, Heartbeat: time.Hour, MaxStreams: 1})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"invalid cep", http.MethodGet, "/v1/weather/0131/stream", http.StatusUnprocessableEntity},
+		{"unknown cep", http.MethodGet, "/v1/weather/99999999/stream", http.StatusNotFound},
+		{"method not allowed", http.MethodPost, "/v1/weather/01310100/stream", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+tt.path, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("unexpected Content-Type %q", got)
+			}
+		})
+	}
+
+	t.Run("too many streams", func(t *testing.T) {
+		resp, _ := openStream(t, server.URL+"/v1/weather/01310100/stream", "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		resp, err := http.Get(server.URL + "/v1/weather/01311000/stream")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+			t.Errorf("expected 503 with Retry-After, got %d", resp.StatusCode)
+		}
+	})
+}
@@ -1,88 +1,164 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/observations"
+	"github.com/lhespanhol/weather-by-cep/internal/render"
 	"github.com/lhespanhol/weather-by-cep/internal/services"
 )
 
+// defaultWeatherRefresh is how often WeatherAPI publishes a new current reading
+const defaultWeatherRefresh = 15 * time.Minute
+
 // WeatherHandler handles weather-related HTTP requests
 type WeatherHandler struct {
-	viaCEPService  *services.ViaCEPService
-	weatherService *services.WeatherService
+	lookup   *services.Lookup
+	recorder *observations.Recorder
+	refresh  atomic.Int64
+	now      func() time.Time
 }
 
 // NewWeatherHandler creates a new weather handler
-func NewWeatherHandler(viaCEPService *services.ViaCEPService, weatherService *services.WeatherService) *WeatherHandler {
-	return &WeatherHandler{
-		viaCEPService:  viaCEPService,
-		weatherService: weatherService,
+func NewWeatherHandler(viaCEPService services.CEPService, weatherService services.WeatherServiceInterface) *WeatherHandler {
+	h := &WeatherHandler{
+		lookup: services.NewLookup(viaCEPService, weatherService),
+		now:    time.Now,
 	}
+	h.SetRefreshInterval(defaultWeatherRefresh)
+	return h
 }
 
-// GetWeatherByCEP handles GET /weather/{cep}
-func (h *WeatherHandler) GetWeatherByCEP(w http.ResponseWriter, r *http.Request) {
-	// Extract CEP from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/weather/")
-	cep := strings.TrimSpace(path)
+// SetRefreshInterval sets how often the provider publishes a new reading, which bounds
+// the Cache-Control max-age of weather responses (0 makes clients revalidate every time)
+func (h *WeatherHandler) SetRefreshInterval(refresh time.Duration) {
+	h.refresh.Store(int64(refresh))
+}
 
-	// Remove any dashes from CEP (e.g., "01310-100" -> "01310100")
-	cep = strings.ReplaceAll(cep, "-", "")
+// SetRecorder records every reading served from now on; call it before serving requests
+func (h *WeatherHandler) SetRecorder(recorder *observations.Recorder) {
+	h.recorder = recorder
+}
 
-	// Validate CEP format
-	if !services.ValidateCEP(cep) {
-		h.respondWithError(w, http.StatusUnprocessableEntity, "invalid zipcode")
+// GetWeatherByCEP handles GET /v1/weather/{cep} and the legacy GET /weather/{cep}
+func (h *WeatherHandler) GetWeatherByCEP(w http.ResponseWriter, r *http.Request) {
+	result, ok := h.fetch(w, r)
+	if !ok {
 		return
 	}
 
-	// Fetch location from viaCEP
-	location, err := h.viaCEPService.GetLocation(r.Context(), cep)
-	if err != nil {
-		log.Printf("Error fetching location: %v", err)
-		h.respondWithError(w, http.StatusInternalServerError, "internal server error")
-		return
-	}
+	h.respond(w, r, result, weatherV1(result, includes(r, "location")))
+}
 
-	if location == nil {
-		h.respondWithError(w, http.StatusNotFound, "can not find zipcode")
+// GetWeatherByCEPV2 handles GET /v2/weather/{cep}
+func (h *WeatherHandler) GetWeatherByCEPV2(w http.ResponseWriter, r *http.Request) {
+	result, ok := h.fetch(w, r)
+	if !ok {
 		return
 	}
 
-	// Fetch weather for the location
-	weather, err := h.weatherService.GetTemperature(r.Context(), location.Localidade)
-	if err != nil {
-		log.Printf("Error fetching weather: %v", err)
-		h.respondWithError(w, http.StatusInternalServerError, "internal server error")
-		return
-	}
+	h.respond(w, r, result, weatherV2(result, includes(r, "location")))
+}
 
+// weatherV1 builds the /v1 representation of a lookup
+func weatherV1(result *services.LookupResult, includeLocation bool) models.WeatherResponse {
 	// Convert temperatures
-	tempC := weather.Current.TempC
-	tempF := services.ConvertCelsiusToFahrenheit(tempC)
-	tempK := services.ConvertCelsiusToKelvin(tempC)
-
-	// Respond with success
+	tempC, tempF, tempK := result.Temperatures()
 	response := models.WeatherResponse{
 		TempC: tempC,
 		TempF: tempF,
 		TempK: tempK,
 	}
+	if includeLocation {
+		response.Location = result.Details()
+	}
+	return response
+}
+
+// weatherV2 builds the /v2 representation of a lookup
+func weatherV2(result *services.LookupResult, includeLocation bool) models.WeatherResponseV2 {
+	tempC, tempF, tempK := result.Temperatures()
+	response := models.WeatherResponseV2{
+		Location: models.LocationV2{
+			CEP:   services.FormatCEP(result.CEP),
+			City:  result.Location.Localidade,
+			State: result.Location.UF,
+		},
+		Temperature: models.TemperatureV2{
+			Celsius:    tempC,
+			Fahrenheit: tempF,
+			Kelvin:     tempK,
+		},
+		Units: models.TemperatureUnits,
+	}
+	if includeLocation {
+		response.Location.Details = result.Details()
+	}
+	if !result.ObservedAt.IsZero() {
+		observed := result.ObservedAt.UTC()
+		response.ObservedAt = &observed
+	}
+	return response
+}
+
+// fetch looks up the CEP in the path. On failure it writes the error response and returns false.
+func (h *WeatherHandler) fetch(w http.ResponseWriter, r *http.Request) (*services.LookupResult, bool) {
+	// Refuse unsupported formats before calling the upstream services
+	if _, ok := render.Acceptable(w, r); !ok {
+		return nil, false
+	}
+
+	// Extract CEP from URL path (/weather/{cep}, /v1/weather/{cep} or /v2/weather/{cep})
+	_, cep, _ := strings.Cut(r.URL.Path, "/weather/")
+
+	result, err := h.lookup.ByCEP(r.Context(), cep)
+	switch {
+	case err == nil:
+		if h.recorder != nil {
+			h.recorder.Record(result)
+		}
+		return result, true
+	case errors.Is(err, services.ErrInvalidCEP):
+		respondWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrCEPNotFound):
+		respondWithError(w, r, http.StatusNotFound, err.Error())
+	default:
+		log.Printf("Error looking up weather: %v", err)
+		respondWithError(w, r, http.StatusInternalServerError, "internal server error")
+	}
+	return nil, false
+}
+
+// includes reports whether the comma-separated ?include= parameter asks for the block
+func includes(r *http.Request, block string) bool {
+	for _, value := range r.URL.Query()["include"] {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) == block {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	h.respondWithJSON(w, http.StatusOK, response)
+// respond writes a successful weather response with HTTP caching headers
+func (h *WeatherHandler) respond(w http.ResponseWriter, r *http.Request, result *services.LookupResult, response interface{}) {
+	respondWithCacheable(w, r, response, cacheValidators{
+		lastModified: result.ObservedAt,
+		maxAge:       freshness(result.ObservedAt, h.now(), time.Duration(h.refresh.Load())),
+	})
 }
 
-func (h *WeatherHandler) respondWithError(w http.ResponseWriter, statusCode int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(models.ErrorResponse{Message: message})
+func respondWithError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	render.Error(w, r, statusCode, message)
 }
 
-func (h *WeatherHandler) respondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(data)
+func respondWithJSON(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	render.Write(w, r, statusCode, data)
 }
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lhespanhol/weather-by-cep/internal/models"
 	"github.com/lhespanhol/weather-by-cep/internal/services"
@@ -204,3 +206,137 @@ func TestWeatherHandler_GetWeatherByCEP_NotFound(t *testing.T) {
 		t.Errorf("expected message 'can not find zipcode', got %q", response.Message)
 	}
 }
+
+func TestWeatherHandler_GetWeatherByCEPV2(t *testing.T) {
+	observed := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	handler := newCachingHandler(observed, observed.Add(time.Minute))
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/weather/01310-100", nil)
+	rec := httptest.NewRecorder()
+
+	handler.GetWeatherByCEPV2(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d. Body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var response models.WeatherResponseV2
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	expectedLocation := models.LocationV2{CEP: "01310-100", City: "São Paulo", State: "SP"}
+	if response.Location != expectedLocation {
+		t.Errorf("expected location %+v, got %+v", expectedLocation, response.Location)
+	}
+	if response.Temperature.Celsius != 28.5 || response.Temperature.Kelvin != 301.5 {
+		t.Errorf("unexpected temperature %+v", response.Temperature)
+	}
+	if response.Units != models.TemperatureUnits {
+		t.Errorf("unexpected units %+v", response.Units)
+	}
+	if response.ObservedAt == nil || !response.ObservedAt.Equal(observed) {
+		t.Errorf("expected observed_at %v, got %v", observed, response.ObservedAt)
+	}
+}
+
+func TestWeatherHandler_IncludeLocation(t *testing.T) {
+	expected := &models.LocationDetails{
+		CEP:        "01310-100",
+		Logradouro: "Avenida Paulista",
+		Bairro:     "Bela Vista",
+		City:       "São Paulo",
+		UF:         "SP",
+		IBGE:       "3550308",
+		DDD:        "11",
+		WeatherQuery: models.ProviderLocation{
+			Query:   "São Paulo",
+			Name:    "São Paulo",
+			Region:  "Sao Paulo",
+			Country: "Brazil",
+			Lat:     -23.53,
+			Lon:     -46.62,
+		},
+	}
+	handler := newCachingHandler(time.Time{}, time.Now())
+
+	tests := []struct {
+		name     string
+		target   string
+		expected *models.LocationDetails
+	}{
+		{"v1 without include", "/v1/weather/01310100", nil},
+		{"v1 with include", "/v1/weather/01310100?include=location", expected},
+		{"v1 with include list", "/v1/weather/01310100?include=forecast,location", expected},
+		{"v2 without include", "/v2/weather/01310100", nil},
+		{"v2 with include", "/v2/weather/01310100?include=location", expected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rec := httptest.NewRecorder()
+
+			var got *models.LocationDetails
+			if strings.HasPrefix(tt.target, "/v2/") {
+				handler.GetWeatherByCEPV2(rec, req)
+				var response models.WeatherResponseV2
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				got = response.Location.Details
+			} else {
+				handler.GetWeatherByCEP(rec, req)
+				var response models.WeatherResponse
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				got = response.Location
+			}
+
+			if (got == nil) != (tt.expected == nil) || got != nil && *got != *tt.expected {
+				t.Errorf("expected location %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWeatherHandler_Formats(t *testing.T) {
+	handler := newCachingHandler(time.Time{}, time.Now())
+
+	tests := []struct {
+		name                string
+		target              string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"csv", "/v1/weather/01310100?format=csv", "", http.StatusOK, "text/csv; charset=utf-8", "temp_C,temp_F,temp_K\n28.5,83.3,301.5\n"},
+		{"text with location", "/v1/weather/01310100?include=location", "text/plain", http.StatusOK, "text/plain; charset=utf-8", "São Paulo/SP: 28.5°C / 83.3°F / 301.5K\n"},
+		{"error as xml", "/v1/weather/123?format=xml", "", http.StatusUnprocessableEntity, "application/xml; charset=utf-8", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<response>\n  <message>invalid zipcode</message>\n</response>\n"},
+		{"not acceptable", "/v1/weather/01310100", "application/pdf", http.StatusNotAcceptable, "application/json", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.GetWeatherByCEP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.expectedContentType, got)
+			}
+			if tt.expectedBody != "" && rec.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
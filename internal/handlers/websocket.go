@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+const (
+	// wsWriteWait bounds each write, so a client that stops reading is dropped
+	wsWriteWait = 10 * time.Second
+	// wsMaxMessageBytes bounds the size of client messages
+	wsMaxMessageBytes = 4096
+	// wsControlBuffer is how many errors may wait for a slow client before it is dropped
+	wsControlBuffer = 32
+)
+
+// Error codes of WebSocket error messages
+const (
+	wsCodeBadRequest     = "bad_request"
+	wsCodeInvalidCEP     = "invalid_cep"
+	wsCodeNotFound       = "not_found"
+	wsCodeLimitExceeded  = "limit_exceeded"
+	wsCodeTooManyStreams = "too_many_streams"
+	wsCodeInternal       = "internal"
+)
+
+// WebSocketHandler serves live weather updates for a changing set of CEPs over
+// one WebSocket connection
+type WebSocketHandler struct {
+	hub           *stream.Hub
+	authenticator *auth.Authenticator
+	upgrader      websocket.Upgrader
+}
+
+// NewWebSocketHandler creates a WebSocket handler over the hub
+func NewWebSocketHandler(hub *stream.Hub) *WebSocketHandler {
+	return &WebSocketHandler{hub: hub}
+}
+
+// SetAuthenticator makes every subscription of a connection after the first count against
+// the quota of the authenticated client, as if it were a request of its own
+func (h *WebSocketHandler) SetAuthenticator(authenticator *auth.Authenticator) {
+	h.authenticator = authenticator
+}
+
+// wsClientMessage is a subscribe or unsubscribe command
+type wsClientMessage struct {
+	Type string   `json:"type"`
+	CEPs []string `json:"ceps"`
+}
+
+// wsServerMessage is a weather update or an error
+type wsServerMessage struct {
+	Type    string      `json:"type"`
+	CEP     string      `json:"cep,omitempty"`
+	Weather interface{} `json:"weather,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// ServeHTTP handles GET /v2/weather/ws
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		render.JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	client, _ := auth.ClientFromContext(r.Context())
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already answered with the reason
+		return
+	}
+
+	s := &wsSession{
+		hub:             h.hub,
+		authenticator:   h.authenticator,
+		conn:            conn,
+		settings:        h.hub.Settings(),
+		includeLocation: includes(r, "location"),
+		client:          client,
+		subs:            make(map[string]*wsSubscription),
+		pending:         make(map[string]*services.LookupResult),
+		wake:            make(chan struct{}, 1),
+		control:         make(chan wsServerMessage, wsControlBuffer),
+	}
+	s.run()
+}
+
+// wsSession is one WebSocket connection
+type wsSession struct {
+	hub             *stream.Hub
+	conn            *websocket.Conn
+	settings        stream.Settings
+	includeLocation bool
+	// client pays for the subscriptions when authentication is enabled
+	authenticator *auth.Authenticator
+	client        *auth.Client
+	// subscribed counts the subscriptions made; the upgrade request paid for the first
+	subscribed int
+
+	mu   sync.Mutex
+	subs map[string]*wsSubscription
+	// pending holds the latest reading of each CEP not written yet, so a slow client
+	// skips intermediate readings instead of queueing them
+	pending map[string]*services.LookupResult
+	wake    chan struct{}
+	control chan wsServerMessage
+}
+
+// wsSubscription is one CEP of a session; sub is nil until the first reading arrives
+type wsSubscription struct {
+	sub  *stream.Subscription
+	done chan struct{}
+}
+
+func (s *wsSession) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		s.writeLoop(ctx)
+		// Unblock the read loop when writing fails
+		s.conn.Close()
+	}()
+
+	s.readLoop(ctx)
+	cancel()
+	s.conn.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for cep, entry := range s.subs {
+		close(entry.done)
+		if entry.sub != nil {
+			entry.sub.Close()
+		}
+		delete(s.subs, cep)
+	}
+}
+
+// readLoop handles client commands until the connection fails or the client goes
+// quiet for two heartbeats without answering pings
+func (s *wsSession) readLoop(ctx context.Context) {
+	pongWait := 2 * s.settings.Heartbeat
+	s.conn.SetReadLimit(wsMaxMessageBytes)
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.sendError("", wsCodeBadRequest, "invalid message")
+			continue
+		}
+		switch msg.Type {
+		case "subscribe":
+			for _, cep := range msg.CEPs {
+				s.subscribe(ctx, cep)
+			}
+		case "unsubscribe":
+			for _, cep := range msg.CEPs {
+				s.unsubscribe(services.NormalizeCEP(cep))
+			}
+		default:
+			s.sendError("", wsCodeBadRequest, `type must be "subscribe" or "unsubscribe"`)
+		}
+	}
+}
+
+func (s *wsSession) subscribe(ctx context.Context, cep string) {
+	cep = services.NormalizeCEP(cep)
+	if !services.ValidateCEP(cep) {
+		s.sendError(cep, wsCodeInvalidCEP, services.ErrInvalidCEP.Error())
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.subs[cep]; ok {
+		s.mu.Unlock()
+		return
+	}
+	if len(s.subs) >= s.settings.MaxSubscriptions {
+		s.mu.Unlock()
+		s.sendError(cep, wsCodeLimitExceeded, "subscription limit reached")
+		return
+	}
+	s.mu.Unlock()
+
+	// Subscriptions come one at a time from the read loop
+	if s.subscribed > 0 && s.client != nil && s.authenticator != nil {
+		if err := s.authenticator.Charge(s.client); err != nil {
+			s.sendError(cep, wsCodeLimitExceeded, "API key quota exceeded")
+			return
+		}
+	}
+	s.subscribed++
+
+	entry := &wsSubscription{done: make(chan struct{})}
+	s.mu.Lock()
+	s.subs[cep] = entry
+	s.mu.Unlock()
+
+	// The first lookup may take a while; keep reading commands meanwhile
+	go s.forward(ctx, cep, entry)
+}
+
+// forward subscribes to the hub and queues the readings of the CEP until it is unsubscribed
+func (s *wsSession) forward(ctx context.Context, cep string, entry *wsSubscription) {
+	sub, err := s.hub.Subscribe(ctx, cep)
+
+	s.mu.Lock()
+	if s.subs[cep] != entry {
+		// Unsubscribed, or the connection closed, while waiting
+		s.mu.Unlock()
+		if sub != nil {
+			sub.Close()
+		}
+		return
+	}
+	if err != nil {
+		delete(s.subs, cep)
+		s.mu.Unlock()
+		s.sendLookupError(cep, err)
+		return
+	}
+	entry.sub = sub
+	s.queue(cep, sub.Current())
+	s.mu.Unlock()
+
+	for {
+		select {
+		case <-entry.done:
+			return
+		case result := <-sub.Updates():
+			s.mu.Lock()
+			s.queue(cep, result)
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *wsSession) unsubscribe(cep string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.subs[cep]
+	if !ok {
+		return
+	}
+	delete(s.subs, cep)
+	delete(s.pending, cep)
+	close(entry.done)
+	if entry.sub != nil {
+		entry.sub.Close()
+	}
+}
+
+// queue replaces the unwritten reading of the CEP; s.mu is held
+func (s *wsSession) queue(cep string, result *services.LookupResult) {
+	s.pending[cep] = result
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *wsSession) sendLookupError(cep string, err error) {
+	switch {
+	case errors.Is(err, services.ErrCEPNotFound):
+		s.sendError(cep, wsCodeNotFound, err.Error())
+	case errors.Is(err, stream.ErrTooManyStreams):
+		s.sendError(cep, wsCodeTooManyStreams, err.Error())
+	case errors.Is(err, context.Canceled):
+	default:
+		log.Printf("Error looking up weather: %v", err)
+		s.sendError(cep, wsCodeInternal, "internal server error")
+	}
+}
+
+// sendError queues an error message, dropping the connection when the client has
+// stopped reading them
+func (s *wsSession) sendError(cep, code, message string) {
+	select {
+	case s.control <- wsServerMessage{Type: "error", CEP: cep, Code: code, Message: message}:
+	default:
+		s.conn.Close()
+	}
+}
+
+// writeLoop is the only writer of the connection: it sends errors, the pending
+// readings and a ping every heartbeat
+func (s *wsSession) writeLoop(ctx context.Context) {
+	ping := time.NewTicker(s.settings.Heartbeat)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+			return
+		case msg := <-s.control:
+			if err := s.write(msg); err != nil {
+				return
+			}
+		case <-s.wake:
+			for _, msg := range s.takePending() {
+				if err := s.write(msg); err != nil {
+					return
+				}
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// takePending empties the pending readings, ordered by CEP
+func (s *wsSession) takePending() []wsServerMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]wsServerMessage, 0, len(s.pending))
+	for cep, result := range s.pending {
+		messages = append(messages, wsServerMessage{Type: "weather", CEP: cep, Weather: weatherV2(result, s.includeLocation)})
+		delete(s.pending, cep)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CEP < messages[j].CEP })
+	return messages
+}
+
+func (s *wsSession) write(msg wsServerMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return s.conn.WriteJSON(msg)
+}
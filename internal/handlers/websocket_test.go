@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+type wsTestMessage struct {
+	Type    string `json:"type"`
+	CEP     string `json:"cep"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Weather struct {
+		Temperature struct {
+			Celsius float64 `json:"celsius"`
+		} `json:"temperature"`
+	} `json:"weather"`
+}
+
+func newWebSocketServer(t *testing.T, weather services.WeatherServiceInterface, settings stream.Settings) (*stream.Hub, *websocket.Conn) {
+	t.Helper()
+	hub := stream.NewHub(services.NewLookup(streamCEPService{}, weather), settings)
+	server := httptest.NewServer(NewWebSocketHandler(hub))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return hub, conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) wsTestMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg wsTestMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return msg
+}
+
+// waitFor polls until the condition holds, as the server reacts asynchronously
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebSocketHandler_Subscriptions(t *testing.T) {
+	weather := &liveWeatherService{tempC: 25}
+	hub, conn := newWebSocketServer(t, weather, stream.Settings{PollInterval: 10 * time.Millisecond, Heartbeat: time.Minute, MaxStreams: 10, MaxSubscriptions: 10})
+
+	conn.WriteJSON(map[string]interface{}{"type": "subscribe", "ceps": []string{"01310-100", "20040020", "01310100"}})
+	received := map[string]float64{}
+	for len(received) < 2 {
+		msg := readMessage(t, conn)
+		if msg.Type != "weather" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+		received[msg.CEP] = msg.Weather.Temperature.Celsius
+	}
+	if received["01310100"] != 25 || received["20040020"] != 25 {
+		t.Errorf("unexpected readings %v", received)
+	}
+	if _, streams := hub.Stats(); streams != 2 {
+		t.Errorf("expected 2 streams, got %d", streams)
+	}
+
+	conn.WriteJSON(map[string]interface{}{"type": "unsubscribe", "ceps": []string{"20040-020"}})
+	waitFor(t, func() bool { _, streams := hub.Stats(); return streams == 1 })
+
+	weather.set(30)
+	if msg := readMessage(t, conn); msg.CEP != "01310100" || msg.Weather.Temperature.Celsius != 30 {
+		t.Errorf("unexpected update %+v", msg)
+	}
+
+	conn.Close()
+	waitFor(t, func() bool { topics, streams := hub.Stats(); return topics == 0 && streams == 0 })
+}
+
+func TestWebSocketHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		message      string
+		expectedCode string
+	}{
+		{"invalid json", `{`, wsCodeBadRequest},
+		{"unknown type", `{"type": "watch", "ceps": ["01310100"]}`, wsCodeBadRequest},
+		{"invalid cep", `{"type": "subscribe", "ceps": ["0131"]}`, wsCodeInvalidCEP},
+		{"unknown cep", `{"type": "subscribe", "ceps": ["99999999"]}`, wsCodeNotFound},
+		{"subscription limit", `{"type": "subscribe", "ceps": ["01310100", "01311000"]}`, wsCodeLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, conn := newWebSocketServer(t, &liveWeatherService{}, stream.Settings{PollInterval: time.Minute, Heartbeat: time.Minute, MaxStreams: 10, MaxSubscriptions: 1})
+
+			conn.WriteMessage(websocket.TextMessage, []byte(tt.message))
+			for {
+				msg := readMessage(t, conn)
+				if msg.Type == "weather" {
+					continue
+				}
+				if msg.Type != "error" || msg.Code != tt.expectedCode {
+					t.Errorf("expected error %s, got %+v", tt.expectedCode, msg)
+				}
+				break
+			}
+		})
+	}
+}
+
+func TestWebSocketHandler_Ping(t *testing.T) {
+	_, conn := newWebSocketServer(t, &liveWeatherService{}, stream.Settings{PollInterval: time.Minute, Heartbeat: 10 * time.Millisecond, MaxStreams: 10, MaxSubscriptions: 1})
+
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	// Control frames are handled while reading
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatal("expected periodic pings")
+		}
+	}
+}
+
+func TestWebSocketHandler_ChargesSubscriptions(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.Settings{Enabled: true, Header: "X-API-Key"}, []auth.Client{{Name: "erp", Key: "erp-key", DailyQuota: 2}})
+	hub := stream.NewHub(services.NewLookup(streamCEPService{}, &liveWeatherService{tempC: 25}), stream.Settings{PollInterval: time.Minute, Heartbeat: time.Minute, MaxStreams: 10, MaxSubscriptions: 10})
+	handler := NewWebSocketHandler(hub)
+	handler.SetAuthenticator(authenticator)
+	server := httptest.NewServer(authenticator.Middleware(handler))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), http.Header{"X-API-Key": {"erp-key"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// The upgrade pays for the first CEP and the quota of 2 for one more
+	conn.WriteJSON(map[string]interface{}{"type": "subscribe", "ceps": []string{"01310100", "01311000", "01312000"}})
+	weather, limited := 0, 0
+	for weather+limited < 3 {
+		msg := readMessage(t, conn)
+		switch {
+		case msg.Type == "weather":
+			weather++
+		case msg.Type == "error" && msg.Code == wsCodeLimitExceeded && msg.CEP == "01312000":
+			limited++
+		default:
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	}
+	if weather != 2 || limited != 1 {
+		t.Errorf("expected 2 readings and 1 refusal, got %d and %d", weather, limited)
+	}
+	if usage := authenticator.Usage()[0]; usage.DailyUsage != 2 {
+		t.Errorf("expected a daily usage of 2, got %d", usage.DailyUsage)
+	}
+}
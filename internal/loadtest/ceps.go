@@ -0,0 +1,77 @@
+package loadtest
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// CEP distributions
+const (
+	// Uniform requests every CEP equally often
+	Uniform = "uniform"
+	// Zipf requests the CEPs by popularity: the first one the most, then quickly fewer
+	// down the list, as real traffic concentrates on a few addresses
+	Zipf = "zipf"
+)
+
+// LoadCEPs reads a CEP file: one CEP per line, with or without the dash. Blank lines,
+// "#" comments and a "cep" header are skipped, and only the first comma-separated field
+// is read, so a CSV whose first column is the CEP works too. The order of the file is
+// the popularity order of the Zipf distribution.
+func LoadCEPs(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CEPs file: %w", err)
+	}
+	defer file.Close()
+
+	var ceps []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		field, _, _ := strings.Cut(scanner.Text(), ",")
+		field = strings.Trim(strings.TrimSpace(strings.TrimPrefix(field, "\ufeff")), `"`)
+		if field == "" || strings.HasPrefix(field, "#") || (line == 1 && strings.EqualFold(field, "cep")) {
+			continue
+		}
+		cep := strings.ReplaceAll(field, "-", "")
+		if !validCEP(cep) {
+			return nil, fmt.Errorf("%s:%d: invalid CEP %q", path, line, field)
+		}
+		ceps = append(ceps, cep)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CEPs file: %w", err)
+	}
+	if len(ceps) == 0 {
+		return nil, fmt.Errorf("%s has no CEPs", path)
+	}
+	return ceps, nil
+}
+
+func validCEP(cep string) bool {
+	if len(cep) != 8 {
+		return false
+	}
+	for _, c := range cep {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// sampler picks the CEP of each request; each worker has its own, as rand.Rand is not
+// safe for concurrent use
+type sampler func() string
+
+func newSampler(ceps []string, distribution string, zipfS float64, seed int64) sampler {
+	rng := rand.New(rand.NewSource(seed))
+	if distribution == Zipf && len(ceps) > 1 {
+		zipf := rand.NewZipf(rng, zipfS, 1, uint64(len(ceps)-1))
+		return func() string { return ceps[zipf.Uint64()] }
+	}
+	return func() string { return ceps[rng.Intn(len(ceps))] }
+}
@@ -0,0 +1,287 @@
+// Package loadtest drives the weather endpoints of a running instance with a fixed
+// concurrency, an optional request rate and a distribution of CEPs, and reports the
+// latency percentiles, throughput and errors it saw
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DefaultPath is the route requested for each CEP
+const DefaultPath = "/weather/{cep}"
+
+// Options describes a load test
+type Options struct {
+	// Target is the base URL of the instance, e.g. http://localhost:8080
+	Target string
+	// Path is requested with {cep} replaced by each CEP; DefaultPath when empty
+	Path string
+	// Header is sent with every request, e.g. the API key
+	Header http.Header
+	// Concurrency is the number of requests in flight at most
+	Concurrency int
+	// Rate is the target of requests per second across all workers; 0 sends as fast as
+	// the workers go. With a rate, latency counts from when each request was due, so a
+	// saturated instance shows up in the percentiles instead of lowering the rate.
+	Rate float64
+	// Duration bounds the test; Requests, when set, stops it earlier
+	Duration time.Duration
+	Requests int
+	// CEPs are requested with the Distribution, uniform or zipf with exponent ZipfS (> 1)
+	CEPs         []string
+	Distribution string
+	ZipfS        float64
+	// Timeout bounds each request
+	Timeout time.Duration
+	// Progress, when set, is called every ProgressInterval while the test runs
+	Progress         func(Progress)
+	ProgressInterval time.Duration
+	// Seed makes the CEP sequence of each worker reproducible
+	Seed int64
+}
+
+// Progress is a snapshot of a running test
+type Progress struct {
+	Elapsed   time.Duration
+	Requests  int64
+	Failed    int64
+	InFlight  int64
+	Remaining time.Duration
+}
+
+// Validate checks the options, filling in the defaults
+func (o *Options) Validate() error {
+	var errs []error
+	u, err := url.Parse(o.Target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("target must be an http or https URL, got %q", o.Target))
+	}
+	if o.Path == "" {
+		o.Path = DefaultPath
+	}
+	if !strings.HasPrefix(o.Path, "/") || !strings.Contains(o.Path, "{cep}") {
+		errs = append(errs, fmt.Errorf("path must start with / and contain {cep}, got %q", o.Path))
+	}
+	if o.Concurrency < 1 {
+		errs = append(errs, errors.New("concurrency must be at least 1"))
+	}
+	if o.Rate < 0 {
+		errs = append(errs, errors.New("rate must not be negative"))
+	}
+	if o.Duration <= 0 && o.Requests <= 0 {
+		errs = append(errs, errors.New("a duration or a number of requests is required"))
+	}
+	if o.Duration < 0 || o.Requests < 0 {
+		errs = append(errs, errors.New("duration and requests must not be negative"))
+	}
+	if len(o.CEPs) == 0 {
+		errs = append(errs, errors.New("at least one CEP is required"))
+	}
+	switch o.Distribution {
+	case "":
+		o.Distribution = Uniform
+	case Uniform:
+	case Zipf:
+		if o.ZipfS <= 1 {
+			errs = append(errs, errors.New("the zipf exponent must be greater than 1"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("distribution must be %s or %s, got %q", Uniform, Zipf, o.Distribution))
+	}
+	if o.Timeout <= 0 {
+		errs = append(errs, errors.New("timeout must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// NewClient returns an HTTP client keeping a connection per worker alive, so the test
+// measures the instance rather than connection setup
+func NewClient(opts Options) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = opts.Concurrency
+	transport.MaxIdleConnsPerHost = opts.Concurrency
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}
+}
+
+// sample is the outcome of one request
+type sample struct {
+	latency time.Duration
+	status  int
+	err     string
+}
+
+// Run executes the test and reports its results. Cancelling ctx stops it early; the
+// report then covers the requests completed so far. client may be nil.
+func Run(ctx context.Context, opts Options, client *http.Client) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = NewClient(opts)
+	}
+
+	// The schedule stops at the end of the duration; requests in flight are let finish
+	schedule := ctx
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		schedule, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	var requests, failed, inFlight atomic.Int64
+	due := make(chan time.Time)
+	start := time.Now()
+	go produce(schedule, opts, start, due)
+
+	stopProgress := make(chan struct{})
+	var progressDone sync.WaitGroup
+	if opts.Progress != nil && opts.ProgressInterval > 0 {
+		progressDone.Add(1)
+		go func() {
+			defer progressDone.Done()
+			ticker := time.NewTicker(opts.ProgressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					elapsed := time.Since(start)
+					p := Progress{Elapsed: elapsed, Requests: requests.Load(), Failed: failed.Load(), InFlight: inFlight.Load()}
+					if opts.Duration > elapsed {
+						p.Remaining = opts.Duration - elapsed
+					}
+					opts.Progress(p)
+				case <-stopProgress:
+					return
+				}
+			}
+		}()
+	}
+
+	samples := make([][]sample, opts.Concurrency)
+	var workers sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		workers.Add(1)
+		go func(w int) {
+			defer workers.Done()
+			next := newSampler(opts.CEPs, opts.Distribution, opts.ZipfS, opts.Seed+int64(w))
+			for scheduled := range due {
+				inFlight.Add(1)
+				s := request(ctx, client, opts, next(), scheduled)
+				inFlight.Add(-1)
+				if ctx.Err() != nil {
+					// Interrupted: the request says nothing about the instance
+					continue
+				}
+				requests.Add(1)
+				if s.err != "" {
+					failed.Add(1)
+				}
+				samples[w] = append(samples[w], s)
+			}
+		}(w)
+	}
+	workers.Wait()
+	elapsed := time.Since(start)
+	close(stopProgress)
+	progressDone.Wait()
+
+	var all []sample
+	for _, s := range samples {
+		all = append(all, s...)
+	}
+	return newReport(opts, all, elapsed), nil
+}
+
+// produce hands the due time of each request to the workers, at the rate when there is
+// one, until the schedule ends or enough requests were sent
+func produce(ctx context.Context, opts Options, start time.Time, due chan<- time.Time) {
+	defer close(due)
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+	next := start
+	for n := 0; opts.Requests == 0 || n < opts.Requests; n++ {
+		at := time.Now()
+		if interval > 0 {
+			if wait := time.Until(next); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+			at = next
+			next = next.Add(interval)
+		}
+		select {
+		case due <- at:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func request(ctx context.Context, client *http.Client, opts Options, cep string, scheduled time.Time) sample {
+	target := strings.TrimSuffix(opts.Target, "/") + strings.ReplaceAll(opts.Path, "{cep}", cep)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return sample{err: err.Error()}
+	}
+	for name, values := range opts.Header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return sample{latency: time.Since(scheduled), err: classify(err)}
+	}
+	// Reading the whole body is part of the response time, and lets the connection be reused
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	s := sample{latency: time.Since(scheduled), status: resp.StatusCode}
+	switch {
+	case err != nil:
+		s.err = classify(err)
+	case resp.StatusCode >= 400:
+		s.err = fmt.Sprintf("HTTP %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return s
+}
+
+// classify names a transport error without the details that differ between requests,
+// so the errors can be counted by kind
+func classify(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return "connection closed mid-response"
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,351 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/handlers"
+	"github.com/lhespanhol/weather-by-cep/internal/mockupstream"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// counting answers 200 for every CEP but 99999999, which answers 503, and counts the
+// requests by CEP
+type counting struct {
+	mu    sync.Mutex
+	byCEP map[string]int
+}
+
+func (c *counting) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cep := strings.TrimPrefix(r.URL.Path, "/weather/")
+	c.mu.Lock()
+	c.byCEP[cep]++
+	c.mu.Unlock()
+	if r.Header.Get("X-API-Key") != "secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if cep == "99999999" {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte(`{"temp_C":25}`))
+}
+
+func options(target string) Options {
+	return Options{
+		Target:      target,
+		Header:      http.Header{"X-Api-Key": {"secret"}},
+		Concurrency: 4,
+		CEPs:        []string{"01310100", "99999999"},
+		Timeout:     time.Second,
+	}
+}
+
+func TestRun_Requests(t *testing.T) {
+	handler := &counting{byCEP: map[string]int{}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	opts := options(server.URL)
+	opts.Requests = 200
+	report, err := Run(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.Requests != 200 || report.Succeeded+report.Failed != 200 {
+		t.Fatalf("requests = %d (%d succeeded, %d failed), want 200", report.Requests, report.Succeeded, report.Failed)
+	}
+	if handler.byCEP["01310100"] != report.Succeeded || handler.byCEP["99999999"] != report.Failed {
+		t.Errorf("served %v, report %d succeeded and %d failed", handler.byCEP, report.Succeeded, report.Failed)
+	}
+	if report.Statuses["200"] != report.Succeeded || report.Statuses["503"] != report.Failed {
+		t.Errorf("statuses = %v", report.Statuses)
+	}
+	if report.Errors["HTTP 503 Service Unavailable"] != report.Failed || len(report.Errors) != 1 {
+		t.Errorf("errors = %v", report.Errors)
+	}
+	if report.Distribution != Uniform || report.Path != DefaultPath {
+		t.Errorf("defaults = %q, %q", report.Distribution, report.Path)
+	}
+	l := report.Latency
+	if l.Min <= 0 || l.Min > l.P50 || l.P50 > l.P95 || l.P95 > l.P99 || l.P99 > l.Max {
+		t.Errorf("latency = %+v, want increasing percentiles", l)
+	}
+}
+
+func TestRun_Rate(t *testing.T) {
+	server := httptest.NewServer(&counting{byCEP: map[string]int{}})
+	defer server.Close()
+
+	opts := options(server.URL)
+	opts.Rate = 200
+	opts.Duration = 500 * time.Millisecond
+	report, err := Run(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// 100 requests are due in the half second
+	if report.Requests < 80 || report.Requests > 102 {
+		t.Errorf("requests = %d, want about 100", report.Requests)
+	}
+	if report.Throughput < 150 || report.Throughput > 210 {
+		t.Errorf("throughput = %v, want about 200", report.Throughput)
+	}
+}
+
+func TestRun_LatencyCountsFromTheSchedule(t *testing.T) {
+	// One worker at 100 req/s against an instance taking 50ms: the requests queue up,
+	// and the latency must show the wait
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	opts := options(server.URL)
+	opts.Concurrency = 1
+	opts.Rate = 100
+	opts.Requests = 6
+	report, err := Run(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Latency.Max < 200 {
+		t.Errorf("max latency = %vms, want the queueing of the last request (about 250ms)", report.Latency.Max)
+	}
+}
+
+func TestRun_CancelKeepsCompletedRequests(t *testing.T) {
+	var served atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served.Add(1) > 10 {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	opts := options(server.URL)
+	opts.Concurrency = 1
+	opts.Duration = time.Minute
+	start := time.Now()
+	report, err := Run(ctx, opts, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %v after the cancellation", elapsed)
+	}
+	if report.Requests != 10 || report.Failed != 0 {
+		t.Errorf("requests = %d (%d failed), want the 10 completed before the cancellation", report.Requests, report.Failed)
+	}
+}
+
+func TestRun_ConnectionRefused(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	target := server.URL
+	server.Close()
+
+	opts := options(target)
+	opts.Requests = 5
+	report, err := Run(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Errors["connection refused"] != 5 {
+		t.Errorf("errors = %v, want 5 connection refused", report.Errors)
+	}
+}
+
+func TestRun_AgainstTheMockUpstreams(t *testing.T) {
+	upstreams := mockupstream.Start(nil)
+	defer upstreams.Close()
+	viaCEP := services.NewViaCEPService()
+	viaCEP.Reconfigure(mockupstream.ViaCEPURL(upstreams.URL), 5*time.Second)
+	weather := services.NewWeatherService("mock")
+	weather.Reconfigure(mockupstream.WeatherURL(upstreams.URL), 5*time.Second)
+	server := httptest.NewServer(http.HandlerFunc(handlers.NewWeatherHandler(viaCEP, weather).GetWeatherByCEP))
+	defer server.Close()
+
+	report, err := Run(context.Background(), Options{
+		Target:       server.URL,
+		Concurrency:  8,
+		Requests:     100,
+		CEPs:         []string{"01310100", "20040020", "80010000", "12345678"},
+		Distribution: Zipf,
+		ZipfS:        1.5,
+		Timeout:      5 * time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Requests != 100 || report.Statuses["200"] == 0 {
+		t.Errorf("report = %+v, want 100 requests, mostly successful", report)
+	}
+	// 12345678 is not in the fixture: its requests answer 404
+	if report.Statuses["200"]+report.Statuses["404"] != 100 || report.Errors["HTTP 404 Not Found"] != report.Statuses["404"] {
+		t.Errorf("statuses = %v, errors = %v", report.Statuses, report.Errors)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Options)
+		wantErr string
+	}{
+		{"valid", func(o *Options) {}, ""},
+		{"relative target", func(o *Options) { o.Target = "localhost:8080" }, "target must be an http or https URL"},
+		{"path without a CEP", func(o *Options) { o.Path = "/weather" }, "must start with / and contain {cep}"},
+		{"no workers", func(o *Options) { o.Concurrency = 0 }, "concurrency must be at least 1"},
+		{"negative rate", func(o *Options) { o.Rate = -1 }, "rate must not be negative"},
+		{"unbounded", func(o *Options) { o.Requests = 0 }, "a duration or a number of requests is required"},
+		{"no CEPs", func(o *Options) { o.CEPs = nil }, "at least one CEP is required"},
+		{"unknown distribution", func(o *Options) { o.Distribution = "normal" }, `distribution must be uniform or zipf, got "normal"`},
+		{"flat zipf", func(o *Options) { o.Distribution, o.ZipfS = Zipf, 1 }, "the zipf exponent must be greater than 1"},
+		{"no timeout", func(o *Options) { o.Timeout = 0 }, "timeout must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := options("http://localhost:8080")
+			opts.Requests = 1
+			tt.change(&opts)
+			err := opts.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSampler_Zipf(t *testing.T) {
+	ceps := []string{"01310100", "01001000", "20040020", "30130010", "70040010", "80010000"}
+	counts := map[string]int{}
+	next := newSampler(ceps, Zipf, 1.1, 1)
+	for i := 0; i < 10000; i++ {
+		counts[next()]++
+	}
+	for i := 1; i < len(ceps); i++ {
+		if counts[ceps[i-1]] <= counts[ceps[i]] {
+			t.Errorf("counts = %v, want fewer requests down the list", counts)
+			break
+		}
+	}
+	if counts[ceps[0]] < 3500 {
+		t.Errorf("first CEP requested %d times, want over twice its uniform share", counts[ceps[0]])
+	}
+
+	counts = map[string]int{}
+	next = newSampler(ceps, Uniform, 0, 1)
+	for i := 0; i < 6000; i++ {
+		counts[next()]++
+	}
+	for _, cep := range ceps {
+		if counts[cep] < 800 || counts[cep] > 1200 {
+			t.Errorf("uniform counts = %v, want about 1000 each", counts)
+			break
+		}
+	}
+}
+
+func TestLoadCEPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{"plain", "01310-100\n20040020\n", []string{"01310100", "20040020"}, ""},
+		{"csv with a header", "\ufeffcep,city\n\"01310-100\",São Paulo\n\n# Rio\n20040020,Rio\n", []string{"01310100", "20040020"}, ""},
+		{"invalid", "01310100\n0131\n", nil, ":2: invalid CEP \"0131\""},
+		{"empty", "cep\n# none\n", nil, "has no CEPs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ceps.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadCEPs(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("LoadCEPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	var samples []sample
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, sample{latency: time.Duration(i) * time.Millisecond, status: 200})
+	}
+	samples[98] = sample{latency: 99 * time.Millisecond, status: 503, err: "HTTP 503 Service Unavailable"}
+	samples[99] = sample{latency: 5 * time.Second, err: "timeout"}
+	opts := Options{Target: "http://localhost:8080", Path: DefaultPath, Concurrency: 4, Rate: 50, CEPs: []string{"01310100"}, Distribution: Zipf}
+
+	report := newReport(opts, samples, 2*time.Second)
+	want := Latency{Min: 1, Mean: 99.5, P50: 50, P90: 90, P95: 95, P99: 99, Max: 5000}
+	if report.Latency != want {
+		t.Errorf("latency = %+v, want %+v", report.Latency, want)
+	}
+	if report.Throughput != 50 || report.SuccessRate != 49 {
+		t.Errorf("throughput = %v, success rate = %v", report.Throughput, report.SuccessRate)
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"Target:      http://localhost:8080/weather/{cep}\n",
+		"Load:        4 workers, 50 req/s, zipf over 1 CEPs\n",
+		"Requests:    100 in 2.0s: 98 succeeded, 2 failed\n",
+		"Throughput:  50.0 req/s (49.0 successful req/s)\n",
+		"p50 50.0ms  p90 90.0ms  p95 95.0ms  p99 99.0ms  max 5000.0ms\n",
+		"Statuses:    200 × 98 503 × 1\n",
+		"Errors:\n  1 × HTTP 503 Service Unavailable\n  1 × timeout\n",
+	} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("text report misses %q:\n%s", line, text.String())
+		}
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"throughput":50`, `"latency_ms":{"min":1,"mean":99.5,"p50":50`, `"statuses":{"200":98,"503":1}`, `"errors":{"HTTP 503 Service Unavailable":1,"timeout":1}`} {
+		if !strings.Contains(string(encoded), field) {
+			t.Errorf("JSON report misses %s: %s", field, encoded)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// reportedErrors caps the distinct errors printed by WriteText
+const reportedErrors = 10
+
+// Report is the outcome of a load test
+type Report struct {
+	Target       string  `json:"target"`
+	Path         string  `json:"path"`
+	Distribution string  `json:"distribution"`
+	CEPs         int     `json:"ceps"`
+	Concurrency  int     `json:"concurrency"`
+	Rate         float64 `json:"rate,omitempty"`
+	// Elapsed is in seconds
+	Elapsed   float64 `json:"elapsed"`
+	Requests  int     `json:"requests"`
+	Succeeded int     `json:"succeeded"`
+	Failed    int     `json:"failed"`
+	// Throughput counts every completed request per second, SuccessRate only the successful ones
+	Throughput  float64 `json:"throughput"`
+	SuccessRate float64 `json:"success_rate"`
+	Latency     Latency `json:"latency_ms"`
+	// Statuses counts the responses by status code; Errors counts the failures by kind
+	Statuses map[string]int `json:"statuses"`
+	Errors   map[string]int `json:"errors"`
+}
+
+// Latency summarizes the response times, in milliseconds
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+func newReport(opts Options, samples []sample, elapsed time.Duration) *Report {
+	r := &Report{
+		Target:       opts.Target,
+		Path:         opts.Path,
+		Distribution: opts.Distribution,
+		CEPs:         len(opts.CEPs),
+		Concurrency:  opts.Concurrency,
+		Rate:         opts.Rate,
+		Elapsed:      round(elapsed.Seconds()),
+		Requests:     len(samples),
+		Statuses:     map[string]int{},
+		Errors:       map[string]int{},
+	}
+
+	latencies := make([]time.Duration, 0, len(samples))
+	var total time.Duration
+	for _, s := range samples {
+		if s.status != 0 {
+			r.Statuses[strconv.Itoa(s.status)]++
+		}
+		if s.err != "" {
+			r.Failed++
+			r.Errors[s.err]++
+		} else {
+			r.Succeeded++
+		}
+		latencies = append(latencies, s.latency)
+		total += s.latency
+	}
+	if elapsed > 0 {
+		r.Throughput = round(float64(r.Requests) / elapsed.Seconds())
+		r.SuccessRate = round(float64(r.Succeeded) / elapsed.Seconds())
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(a, b int) bool { return latencies[a] < latencies[b] })
+		r.Latency = Latency{
+			Min:  millis(latencies[0]),
+			Mean: millis(total / time.Duration(len(latencies))),
+			P50:  millis(percentile(latencies, 50)),
+			P90:  millis(percentile(latencies, 90)),
+			P95:  millis(percentile(latencies, 95)),
+			P99:  millis(percentile(latencies, 99)),
+			Max:  millis(latencies[len(latencies)-1]),
+		}
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func millis(d time.Duration) float64 {
+	return round(float64(d) / float64(time.Millisecond))
+}
+
+// round keeps three decimals, enough for microseconds in milliseconds
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// WriteText prints the report for a terminal
+func (r *Report) WriteText(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("Target:      %s%s\n", r.Target, r.Path)
+	load := fmt.Sprintf("%d workers", r.Concurrency)
+	if r.Rate > 0 {
+		load += fmt.Sprintf(", %g req/s", r.Rate)
+	}
+	ew.printf("Load:        %s, %s over %d CEPs\n", load, r.Distribution, r.CEPs)
+	ew.printf("Requests:    %d in %.1fs: %d succeeded, %d failed\n", r.Requests, r.Elapsed, r.Succeeded, r.Failed)
+	ew.printf("Throughput:  %.1f req/s (%.1f successful req/s)\n", r.Throughput, r.SuccessRate)
+	l := r.Latency
+	ew.printf("Latency:     min %s  mean %s  p50 %s  p90 %s  p95 %s  p99 %s  max %s\n",
+		ms(l.Min), ms(l.Mean), ms(l.P50), ms(l.P90), ms(l.P95), ms(l.P99), ms(l.Max))
+	if len(r.Statuses) > 0 {
+		ew.printf("Statuses:   ")
+		for _, status := range sortedKeys(r.Statuses, func(a, b string) bool { return a < b }) {
+			ew.printf(" %s × %d", status, r.Statuses[status])
+		}
+		ew.printf("\n")
+	}
+	if len(r.Errors) > 0 {
+		ew.printf("Errors:\n")
+		messages := sortedKeys(r.Errors, func(a, b string) bool {
+			if r.Errors[a] != r.Errors[b] {
+				return r.Errors[a] > r.Errors[b]
+			}
+			return a < b
+		})
+		for i, message := range messages {
+			if i == reportedErrors {
+				ew.printf("  ... %d more distinct errors\n", len(messages)-i)
+				break
+			}
+			ew.printf("  %d × %s\n", r.Errors[message], message)
+		}
+	}
+	return ew.err
+}
+
+func ms(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64) + "ms"
+}
+
+func sortedKeys(m map[string]int, less func(a, b string) bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool { return less(keys[a], keys[b]) })
+	return keys
+}
+
+// errWriter keeps the first write error, so the report is written without a check per line
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, args ...any) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintf(e.w, format, args...)
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+const jsonBody = `{"temp_C": 28.5, "temp_F": 83.3, "temp_K": 301.5}`
+
+func jsonHandler(contentType string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(jsonBody))
+	})
+}
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		contentType      string
+		expectedEncoding string
+	}{
+		{"brotli preferred", "gzip, deflate, br", "application/json", "br"},
+		{"gzip only", "gzip", "application/json; charset=utf-8", "gzip"},
+		{"q-values", "br;q=0.5, gzip;q=0.8", "application/json", "gzip"},
+		{"refused encoding", "br;q=0, gzip;q=0", "application/json", ""},
+		{"no accept-encoding", "", "application/json", ""},
+		{"event streams are not compressed", "gzip", "text/event-stream", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			Compress(jsonHandler(tt.contentType)).ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Fatalf("expected Content-Encoding %q, got %q", tt.expectedEncoding, got)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected Vary: Accept-Encoding, got %q", rec.Header().Get("Vary"))
+			}
+
+			var body io.Reader = rec.Body
+			switch tt.expectedEncoding {
+			case "gzip":
+				gz, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("invalid gzip body: %v", err)
+				}
+				body = gz
+			case "br":
+				body = brotli.NewReader(rec.Body)
+			}
+
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if string(decoded) != jsonBody {
+				t.Errorf("unexpected body %q", decoded)
+			}
+		})
+	}
+}
+
+func TestCompress_WeakensETag(t *testing.T) {
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(jsonBody))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("expected weak ETag on compressed response, got %q", got)
+	}
+}
+
+func TestCompress_NotModified(t *testing.T) {
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotModified)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 0 {
+		t.Errorf("expected empty uncompressed 304, got encoding %q and %d bytes", rec.Header().Get("Content-Encoding"), rec.Body.Len())
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                "",
+		"identity":        "",
+		"*":               "br",
+		"GZIP":            "gzip",
+		"gzip;q=1.0, br":  "br",
+		"gzip;q=bad, br":  "br",
+		"deflate, gzip":   "gzip",
+		"br;q=0.1, gzip;": "gzip",
+	}
+
+	for header, expected := range tests {
+		if got := negotiateEncoding(header); got != expected {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, expected)
+		}
+	}
+}
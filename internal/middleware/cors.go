@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CORSOptions configures cross-origin access. CORS is disabled when AllowedOrigins is empty;
+// the origin "*" allows any origin.
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// CORS answers preflight requests and adds the CORS headers to allowed origins
+type CORS struct {
+	mu   sync.RWMutex
+	opts CORSOptions
+}
+
+// NewCORS creates a CORS middleware
+func NewCORS(opts CORSOptions) *CORS {
+	c := &CORS{}
+	c.Configure(opts)
+	return c
+}
+
+// Configure replaces the options, e.g. after a configuration reload
+func (c *CORS) Configure(opts CORSOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts = opts
+}
+
+// Middleware applies the CORS policy
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.RLock()
+		opts := c.opts
+		c.mu.RUnlock()
+
+		origin := r.Header.Get("Origin")
+		if len(opts.AllowedOrigins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		allowed, wildcard := originAllowed(opts.AllowedOrigins, origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !allowed {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Credentials can't be combined with a literal "*", so echo the origin instead
+		if wildcard && !opts.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(opts.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !containsFold(opts.AllowedMethods, method) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			for _, header := range strings.Split(requested, ",") {
+				if !containsFold(opts.AllowedHeaders, strings.TrimSpace(header)) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			}
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+
+		if opts.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func originAllowed(allowed []string, origin string) (ok, wildcard bool) {
+	for _, o := range allowed {
+		if o == "*" {
+			return true, true
+		}
+		if strings.EqualFold(o, origin) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if v == "*" || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
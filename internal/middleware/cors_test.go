@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/config"
+)
+
+func newTestCORS(origins ...string) http.Handler {
+	cors := NewCORS(CORSOptions{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "X-API-Key"},
+		ExposedHeaders: []string{"RateLimit-Remaining"},
+		MaxAge:         10 * time.Minute,
+	})
+	return cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestCORS_SimpleRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowed        []string
+		origin         string
+		expectedOrigin string
+	}{
+		{"allowed origin", []string{"https://dashboard.example.com"}, "https://dashboard.example.com", "https://dashboard.example.com"},
+		{"wildcard", []string{"*"}, "https://any.example.com", "*"},
+		{"other origin", []string{"https://dashboard.example.com"}, "https://evil.example.com", ""},
+		{"cors disabled", nil, "https://dashboard.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+
+			newTestCORS(tt.allowed...).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected request to reach the handler, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+			if tt.expectedOrigin != "" && rec.Header().Get("Access-Control-Expose-Headers") != "RateLimit-Remaining" {
+				t.Errorf("expected exposed headers, got %q", rec.Header().Get("Access-Control-Expose-Headers"))
+			}
+		})
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	tests := []struct {
+		name           string
+		origin         string
+		method         string
+		headers        string
+		expectedStatus int
+	}{
+		{"allowed", "https://dashboard.example.com", "GET", "x-api-key", http.StatusNoContent},
+		{"method not allowed", "https://dashboard.example.com", "DELETE", "", http.StatusForbidden},
+		{"header not allowed", "https://dashboard.example.com", "GET", "X-Custom", http.StatusForbidden},
+		{"origin not allowed", "https://evil.example.com", "GET", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/weather/01310100", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rec := httptest.NewRecorder()
+
+			newTestCORS("https://dashboard.example.com").ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusNoContent && rec.Header().Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("expected preflight max age 600, got %q", rec.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestCORS_DefaultsAllowEveryRoute(t *testing.T) {
+	defaults := config.Default().CORS
+	cors := NewCORS(CORSOptions{
+		AllowedOrigins: []string{"https://dashboard.example.com"},
+		AllowedMethods: defaults.AllowedMethods,
+		AllowedHeaders: defaults.AllowedHeaders,
+		MaxAge:         defaults.MaxAge.Std(),
+	})
+	handler := cors.Middleware(http.NotFoundHandler())
+
+	tests := []struct {
+		path    string
+		method  string
+		headers string
+	}{
+		{"/v1/weather/01310100", "GET", "x-api-key"},
+		{"/graphql", "POST", "content-type, x-api-key"},
+		{"/alerts/42", "DELETE", "x-api-key"},
+		{"/admin/prewarm", "PUT", "authorization, content-type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			req.Header.Set("Origin", "https://dashboard.example.com")
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("expected the preflight to be allowed, got %d", rec.Code)
+			}
+		})
+	}
+}
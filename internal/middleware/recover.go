@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+)
+
+// Recover turns a panic in a handler into a JSON 500 response instead of a dropped connection
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracker := &headerTracker{ResponseWriter: w}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// Deliberate abort: let net/http drop the connection silently
+				panic(err)
+			}
+
+			log.Printf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+			if !tracker.wroteHeader {
+				render.JSONError(w, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+
+		next.ServeHTTP(tracker, r)
+	})
+}
+
+// headerTracker records whether the response status has already been sent
+type headerTracker struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (t *headerTracker) WriteHeader(statusCode int) {
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (t *headerTracker) Write(b []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *headerTracker) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		t.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, e.g. for WebSocket upgrades; the response then
+// belongs to the handler
+func (t *headerTracker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(t.ResponseWriter).Hijack()
+	if err == nil {
+		t.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (t *headerTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
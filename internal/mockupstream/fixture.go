@@ -0,0 +1,213 @@
+package mockupstream
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lhespanhol/weather-by-cep/internal/config"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+// Upstreams a behaviour applies to
+const (
+	UpstreamViaCEP  = "viacep"
+	UpstreamWeather = "weather"
+)
+
+// Faults a behaviour injects
+const (
+	// FaultError answers with a server error (Status, 500 by default)
+	FaultError = "error"
+	// FaultRateLimit answers 429 Too Many Requests with Retry-After
+	FaultRateLimit = "rate_limit"
+	// FaultMalformed answers 200 with truncated JSON
+	FaultMalformed = "malformed"
+	// FaultNotFound answers {"erro": true} from ViaCEP and "no matching location" from WeatherAPI
+	FaultNotFound = "not_found"
+)
+
+//go:embed default.yaml
+var defaultFixture []byte
+
+// Fixture is the data served by the mock upstreams and the behaviours scripted on them
+type Fixture struct {
+	// CEPs are the ViaCEP addresses by CEP; other CEPs answer {"erro": true}
+	CEPs map[string]models.ViaCEPResponse `json:"ceps"`
+	// Weather is the current weather by the city WeatherAPI is queried with
+	Weather map[string]Weather `json:"weather"`
+	// APIKeys are the WeatherAPI keys accepted; any key is accepted when empty
+	APIKeys    []string    `json:"api_keys"`
+	Behaviours []Behaviour `json:"behaviours"`
+}
+
+// Weather is the reading served for a city
+type Weather struct {
+	// Name is the location WeatherAPI reports; the query when empty
+	Name      string  `json:"name"`
+	Region    string  `json:"region"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	TempC     float64 `json:"temp_c"`
+	Condition string  `json:"condition"`
+	Humidity  int     `json:"humidity"`
+}
+
+// Behaviour delays or breaks the responses to matching requests
+type Behaviour struct {
+	// Upstream is viacep or weather; empty applies to both
+	Upstream string `json:"upstream"`
+	// Match is a CEP or a city; empty matches every request
+	Match string `json:"match"`
+	// Latency delays the response, plus a random delay of up to Jitter
+	Latency config.Duration `json:"latency"`
+	Jitter  config.Duration `json:"jitter"`
+	// Fault is error, rate_limit, malformed or not_found; empty only adds latency
+	Fault string `json:"fault"`
+	// Status is the status of an error fault, 500 by default
+	Status int `json:"status"`
+	// Rate is the probability of the fault, from 0 to 1; zero means always
+	Rate float64 `json:"rate"`
+}
+
+// LoadFixture reads a YAML or JSON fixture file
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	return parseFixture(data, path)
+}
+
+// DefaultFixture returns the fixture served when none is given: a few CEPs of state
+// capitals and their weather
+func DefaultFixture() *Fixture {
+	fixture, err := parseFixture(defaultFixture, "default.yaml")
+	if err != nil {
+		panic(err)
+	}
+	return fixture
+}
+
+func parseFixture(data []byte, name string) (*Fixture, error) {
+	var fixture Fixture
+	if err := config.Decode(&fixture, data); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", name, err)
+	}
+	if err := fixture.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", name, err)
+	}
+	return &fixture, nil
+}
+
+// Validate checks the fixture and normalizes its CEPs, reporting every problem found
+func (f *Fixture) Validate() error {
+	var errs []error
+
+	ceps := make(map[string]models.ViaCEPResponse, len(f.CEPs))
+	for cep, location := range f.CEPs {
+		normalized := normalizeCEP(cep)
+		if !validCEP(normalized) {
+			errs = append(errs, fmt.Errorf("ceps: invalid CEP %q", cep))
+			continue
+		}
+		if location.CEP == "" {
+			location.CEP = normalized[:5] + "-" + normalized[5:]
+		}
+		ceps[normalized] = location
+	}
+	f.CEPs = ceps
+
+	for i, b := range f.Behaviours {
+		switch b.Upstream {
+		case "", UpstreamViaCEP, UpstreamWeather:
+		default:
+			errs = append(errs, fmt.Errorf("behaviours[%d].upstream must be %s or %s", i, UpstreamViaCEP, UpstreamWeather))
+		}
+		switch b.Fault {
+		case "", FaultError, FaultRateLimit, FaultMalformed, FaultNotFound:
+		default:
+			errs = append(errs, fmt.Errorf("behaviours[%d].fault: unknown fault %q", i, b.Fault))
+		}
+		if b.Status != 0 && (b.Fault != FaultError || b.Status < 400 || b.Status > 599) {
+			errs = append(errs, fmt.Errorf("behaviours[%d].status must be an error status of an error fault", i))
+		}
+		if b.Rate < 0 || b.Rate > 1 {
+			errs = append(errs, fmt.Errorf("behaviours[%d].rate must be between 0 and 1", i))
+		}
+		if b.Latency < 0 || b.Jitter < 0 {
+			errs = append(errs, fmt.Errorf("behaviours[%d]: latency and jitter must not be negative", i))
+		}
+		if b.Upstream == UpstreamViaCEP && b.Match != "" {
+			f.Behaviours[i].Match = normalizeCEP(b.Match)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// matches reports whether the behaviour applies to a request for key (a CEP or a city)
+func (b Behaviour) matches(upstream, key string) bool {
+	if b.Upstream != "" && b.Upstream != upstream {
+		return false
+	}
+	if b.Match == "" {
+		return true
+	}
+	if upstream == UpstreamViaCEP {
+		return normalizeCEP(b.Match) == key
+	}
+	return strings.EqualFold(b.Match, key)
+}
+
+// status returns the status of an error fault
+func (b Behaviour) status() int {
+	if b.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return b.Status
+}
+
+// weather returns the reading of a city, matched case-insensitively as WeatherAPI does
+func (f *Fixture) weather(city string) (Weather, bool) {
+	if w, ok := f.Weather[city]; ok {
+		return w, true
+	}
+	for name, w := range f.Weather {
+		if strings.EqualFold(name, city) {
+			return w, true
+		}
+	}
+	return Weather{}, false
+}
+
+func (f *Fixture) acceptsKey(key string) bool {
+	if len(f.APIKeys) == 0 {
+		return true
+	}
+	for _, accepted := range f.APIKeys {
+		if key == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeCEP(cep string) string {
+	return strings.ReplaceAll(strings.TrimSpace(cep), "-", "")
+}
+
+func validCEP(cep string) bool {
+	if len(cep) != 8 {
+		return false
+	}
+	for _, c := range cep {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
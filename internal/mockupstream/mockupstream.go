@@ -0,0 +1,299 @@
+// Package mockupstream serves ViaCEP- and WeatherAPI-compatible endpoints from a
+// fixture, with scripted latency and faults, for tests and an offline development stack
+package mockupstream
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+// Base paths of the mock upstreams, to append to the server URL
+const (
+	ViaCEPPath  = "/ws"
+	WeatherPath = "/v1"
+)
+
+// WeatherAPI error codes answered by the mock
+const (
+	codeKeyNotProvided = 1002
+	codeQueryMissing   = 1003
+	codeNoLocation     = 1006
+	codeKeyInvalid     = 2006
+	codeInternal       = 9999
+)
+
+// Server answers ViaCEP requests under /ws and WeatherAPI requests under /v1
+type Server struct {
+	fixture *Fixture
+	mux     *http.ServeMux
+	// random draws the fault probabilities and jitter; replaced in tests
+	random func() float64
+}
+
+// New returns a server for the fixture; nil serves DefaultFixture
+func New(fixture *Fixture) *Server {
+	if fixture == nil {
+		fixture = DefaultFixture()
+	}
+	s := &Server{fixture: fixture, mux: http.NewServeMux(), random: rand.Float64}
+	s.mux.HandleFunc(ViaCEPPath+"/", s.viaCEP)
+	s.mux.HandleFunc(WeatherPath+"/current.json", s.current)
+	s.mux.HandleFunc(WeatherPath+"/forecast.json", s.forecast)
+	return s
+}
+
+// Start runs a server for the fixture on a random local port; close it when done
+func Start(fixture *Fixture) *httptest.Server {
+	return httptest.NewServer(New(fixture))
+}
+
+// ViaCEPURL returns the ViaCEP base URL of a server started at serverURL
+func ViaCEPURL(serverURL string) string {
+	return strings.TrimSuffix(serverURL, "/") + ViaCEPPath
+}
+
+// WeatherURL returns the WeatherAPI base URL of a server started at serverURL
+func WeatherURL(serverURL string) string {
+	return strings.TrimSuffix(serverURL, "/") + WeatherPath
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// viaCEP answers /ws/{cep}/json/
+func (s *Server) viaCEP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ViaCEPPath), "/"), "/")
+	if len(parts) != 2 || parts[1] != "json" {
+		http.NotFound(w, r)
+		return
+	}
+	cep := normalizeCEP(parts[0])
+	if !validCEP(cep) {
+		// ViaCEP answers malformed CEPs with an HTML 400 page
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	fault, ok := s.apply(r, UpstreamViaCEP, cep)
+	if !ok {
+		return
+	}
+	switch fault.Fault {
+	case FaultError:
+		http.Error(w, http.StatusText(fault.status()), fault.status())
+		return
+	case FaultRateLimit:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	case FaultMalformed:
+		writeMalformed(w)
+		return
+	}
+
+	location, found := s.fixture.CEPs[cep]
+	if !found || fault.Fault == FaultNotFound {
+		writeJSON(w, http.StatusOK, map[string]bool{"erro": true})
+		return
+	}
+	writeJSON(w, http.StatusOK, location)
+}
+
+// current answers /v1/current.json?key=...&q=...
+func (s *Server) current(w http.ResponseWriter, r *http.Request) {
+	weather, city, ok := s.weather(w, r)
+	if !ok {
+		return
+	}
+	var resp currentResponse
+	resp.Location = location(weather, city)
+	resp.Current = current(weather)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// forecast answers /v1/forecast.json?key=...&q=...&days=N, varying the fixture
+// temperature by a few degrees around it
+func (s *Server) forecast(w http.ResponseWriter, r *http.Request) {
+	weather, city, ok := s.weather(w, r)
+	if !ok {
+		return
+	}
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = 1
+	}
+	if days > 14 {
+		days = 14
+	}
+
+	var resp models.WeatherAPIForecastResponse
+	resp.Location = location(weather, city)
+	today := time.Now().UTC()
+	for i := 0; i < days; i++ {
+		var day models.WeatherAPIForecastDay
+		day.Date = today.AddDate(0, 0, i).Format("2006-01-02")
+		day.Day.AvgTempC = weather.TempC
+		day.Day.MaxTempC = weather.TempC + 4
+		day.Day.MinTempC = weather.TempC - 4
+		day.Day.Condition.Text = weather.Condition
+		resp.Forecast.ForecastDay = append(resp.Forecast.ForecastDay, day)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// weather checks the key and the query of a WeatherAPI request and applies the
+// behaviours, answering the request itself unless ok
+func (s *Server) weather(w http.ResponseWriter, r *http.Request) (weather Weather, city string, ok bool) {
+	query := r.URL.Query()
+	key := query.Get("key")
+	city = strings.TrimSpace(query.Get("q"))
+	switch {
+	case key == "":
+		writeWeatherError(w, http.StatusUnauthorized, codeKeyNotProvided, "API key is invalid or not provided.")
+		return Weather{}, "", false
+	case !s.fixture.acceptsKey(key):
+		writeWeatherError(w, http.StatusUnauthorized, codeKeyInvalid, "API key provided is invalid")
+		return Weather{}, "", false
+	case city == "":
+		writeWeatherError(w, http.StatusBadRequest, codeQueryMissing, "Parameter q is missing.")
+		return Weather{}, "", false
+	}
+
+	fault, ok := s.apply(r, UpstreamWeather, city)
+	if !ok {
+		return Weather{}, "", false
+	}
+	switch fault.Fault {
+	case FaultError:
+		writeWeatherError(w, fault.status(), codeInternal, "Internal application error.")
+		return Weather{}, "", false
+	case FaultRateLimit:
+		// Not 2007 (quota exceeded), which would take the key out of rotation
+		w.Header().Set("Retry-After", "1")
+		writeWeatherError(w, http.StatusTooManyRequests, codeInternal, "Too many requests.")
+		return Weather{}, "", false
+	case FaultMalformed:
+		writeMalformed(w)
+		return Weather{}, "", false
+	}
+
+	weather, found := s.fixture.weather(city)
+	if !found || fault.Fault == FaultNotFound {
+		writeWeatherError(w, http.StatusBadRequest, codeNoLocation, "No matching location found.")
+		return Weather{}, "", false
+	}
+	return weather, city, true
+}
+
+// apply waits the latency of the behaviours matching the request and returns the first
+// one whose fault fires, a zero Behaviour when none does. ok is false when the client
+// went away while waiting.
+func (s *Server) apply(r *http.Request, upstream, key string) (fault Behaviour, ok bool) {
+	var delay time.Duration
+	for _, b := range s.fixture.Behaviours {
+		if !b.matches(upstream, key) {
+			continue
+		}
+		delay += b.Latency.Std()
+		if b.Jitter > 0 {
+			delay += time.Duration(s.random() * float64(b.Jitter.Std()))
+		}
+		if fault.Fault == "" && b.Fault != "" && (b.Rate == 0 || s.random() < b.Rate) {
+			fault = b
+		}
+	}
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return Behaviour{}, false
+		}
+	}
+	return fault, true
+}
+
+type currentResponse struct {
+	Location models.WeatherAPILocation `json:"location"`
+	Current  currentWeather            `json:"current"`
+}
+
+type currentWeather struct {
+	LastUpdatedEpoch int64   `json:"last_updated_epoch"`
+	LastUpdated      string  `json:"last_updated"`
+	TempC            float64 `json:"temp_c"`
+	TempF            float64 `json:"temp_f"`
+	IsDay            int     `json:"is_day"`
+	Condition        struct {
+		Text string `json:"text"`
+	} `json:"condition"`
+	Humidity int `json:"humidity"`
+}
+
+func location(weather Weather, city string) models.WeatherAPILocation {
+	name := weather.Name
+	if name == "" {
+		name = city
+	}
+	return models.WeatherAPILocation{
+		Name:    name,
+		Region:  weather.Region,
+		Country: "Brazil",
+		Lat:     weather.Lat,
+		Lon:     weather.Lon,
+	}
+}
+
+// current reports the weather as observed at the last quarter hour, as WeatherAPI
+// updates its readings
+func current(weather Weather) currentWeather {
+	observed := time.Now().UTC().Truncate(15 * time.Minute)
+	c := currentWeather{
+		LastUpdatedEpoch: observed.Unix(),
+		LastUpdated:      observed.Format("2006-01-02 15:04"),
+		TempC:            weather.TempC,
+		TempF:            weather.TempC*1.8 + 32,
+		Humidity:         weather.Humidity,
+	}
+	if hour := observed.Hour(); hour >= 9 && hour < 21 {
+		c.IsDay = 1
+	}
+	c.Condition.Text = weather.Condition
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeWeatherError(w http.ResponseWriter, status, code int, message string) {
+	var body models.WeatherAPIError
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
+
+// writeMalformed answers 200 with a JSON body cut in the middle
+func writeMalformed(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"cep": "01310-100", "localidade": "São Pa`))
+}
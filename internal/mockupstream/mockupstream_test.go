@@ -0,0 +1,287 @@
+package mockupstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/config"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+func newLookup(serverURL string) *services.Lookup {
+	viaCEP := services.NewViaCEPService()
+	viaCEP.Reconfigure(ViaCEPURL(serverURL), 5*time.Second)
+	weather := services.NewWeatherService("mock")
+	weather.Reconfigure(WeatherURL(serverURL), 5*time.Second)
+	return services.NewLookup(viaCEP, weather)
+}
+
+func TestServer_DefaultFixtureWithRealClients(t *testing.T) {
+	server := Start(nil)
+	defer server.Close()
+	lookup := newLookup(server.URL)
+
+	result, err := lookup.ByCEP(context.Background(), "01310-100")
+	if err != nil {
+		t.Fatalf("ByCEP() error = %v", err)
+	}
+	if result.Location.Localidade != "São Paulo" || result.Location.CEP != "01310-100" {
+		t.Errorf("location = %+v", result.Location)
+	}
+	if c, _, _ := result.Temperatures(); c != 24.3 {
+		t.Errorf("temp_c = %v, want 24.3", c)
+	}
+	if result.Weather.Location.Name != "Sao Paulo" {
+		t.Errorf("weather location = %q, want Sao Paulo", result.Weather.Location.Name)
+	}
+	if result.ObservedAt.IsZero() || time.Since(result.ObservedAt) > 15*time.Minute {
+		t.Errorf("observed at = %v, want the last quarter hour", result.ObservedAt)
+	}
+
+	if _, err := lookup.ByCEP(context.Background(), "99999999"); !errors.Is(err, services.ErrCEPNotFound) {
+		t.Errorf("unknown CEP error = %v, want ErrCEPNotFound", err)
+	}
+
+	forecast := services.NewWeatherService("mock")
+	forecast.Reconfigure(WeatherURL(server.URL), 5*time.Second)
+	days, err := forecast.GetForecast(context.Background(), "Curitiba", 3)
+	if err != nil {
+		t.Fatalf("GetForecast() error = %v", err)
+	}
+	if len(days.Forecast.ForecastDay) != 3 || days.Forecast.ForecastDay[0].Day.MaxTempC != 21.8 {
+		t.Errorf("forecast = %+v", days.Forecast.ForecastDay)
+	}
+}
+
+func TestServer_Responses(t *testing.T) {
+	fixture := DefaultFixture()
+	fixture.APIKeys = []string{"good"}
+	server := Start(fixture)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"viacep known", "/ws/20040020/json/", http.StatusOK, `"localidade":"Rio de Janeiro"`},
+		{"viacep dashed", "/ws/20040-020/json/", http.StatusOK, `"cep":"20040-020"`},
+		{"viacep unknown", "/ws/12345678/json/", http.StatusOK, `{"erro":true}`},
+		{"viacep invalid", "/ws/123/json/", http.StatusBadRequest, "Bad Request"},
+		{"viacep other path", "/ws/01310100/xml/", http.StatusNotFound, ""},
+		{"weather", "/v1/current.json?key=good&q=rio+de+janeiro", http.StatusOK, `"temp_c":28.9`},
+		{"weather no key", "/v1/current.json?q=Curitiba", http.StatusUnauthorized, `"code":1002`},
+		{"weather wrong key", "/v1/current.json?key=bad&q=Curitiba", http.StatusUnauthorized, `"code":2006`},
+		{"weather no query", "/v1/current.json?key=good", http.StatusBadRequest, `"code":1003`},
+		{"weather unknown city", "/v1/current.json?key=good&q=Atlantis", http.StatusBadRequest, `"code":1006`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := get(t, server.URL+tt.path)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_Behaviours(t *testing.T) {
+	tests := []struct {
+		name       string
+		behaviour  Behaviour
+		path       string
+		random     float64
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "viacep error with status",
+			behaviour:  Behaviour{Upstream: UpstreamViaCEP, Fault: FaultError, Status: http.StatusBadGateway},
+			path:       "/ws/01310100/json/",
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "viacep rate limit",
+			behaviour:  Behaviour{Upstream: UpstreamViaCEP, Fault: FaultRateLimit},
+			path:       "/ws/01310100/json/",
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "viacep not found for a matching CEP",
+			behaviour:  Behaviour{Upstream: UpstreamViaCEP, Match: "01310-100", Fault: FaultNotFound},
+			path:       "/ws/01310100/json/",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"erro":true}`,
+		},
+		{
+			name:       "viacep other CEP untouched",
+			behaviour:  Behaviour{Upstream: UpstreamViaCEP, Match: "01310-100", Fault: FaultNotFound},
+			path:       "/ws/20040020/json/",
+			wantStatus: http.StatusOK,
+			wantBody:   `"uf":"RJ"`,
+		},
+		{
+			name:       "weather malformed",
+			behaviour:  Behaviour{Upstream: UpstreamWeather, Fault: FaultMalformed},
+			path:       "/v1/current.json?key=k&q=Curitiba",
+			wantStatus: http.StatusOK,
+			wantBody:   `"localidade": "São Pa`,
+		},
+		{
+			name:       "weather error by city",
+			behaviour:  Behaviour{Match: "curitiba", Fault: FaultError},
+			path:       "/v1/current.json?key=k&q=Curitiba",
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `"code":9999`,
+		},
+		{
+			name:       "rate below the draw does not fire",
+			behaviour:  Behaviour{Fault: FaultRateLimit, Rate: 0.25},
+			path:       "/v1/current.json?key=k&q=Curitiba",
+			random:     0.5,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "rate above the draw fires",
+			behaviour:  Behaviour{Fault: FaultRateLimit, Rate: 0.75},
+			path:       "/v1/current.json?key=k&q=Curitiba",
+			random:     0.5,
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := DefaultFixture()
+			fixture.Behaviours = []Behaviour{tt.behaviour}
+			if err := fixture.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			mock := New(fixture)
+			mock.random = func() float64 { return tt.random }
+			server := httptest.NewServer(mock)
+			defer server.Close()
+
+			status, body := get(t, server.URL+tt.path)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_Latency(t *testing.T) {
+	fixture := DefaultFixture()
+	fixture.Behaviours = []Behaviour{{
+		Upstream: UpstreamWeather,
+		Latency:  config.Duration(50 * time.Millisecond),
+		Jitter:   config.Duration(100 * time.Millisecond),
+	}}
+	mock := New(fixture)
+	mock.random = func() float64 { return 0.5 }
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	start := time.Now()
+	get(t, server.URL+"/v1/current.json?key=k&q=Curitiba")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("weather answered in %v, want at least 100ms", elapsed)
+	}
+
+	start = time.Now()
+	get(t, server.URL+"/ws/01310100/json/")
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("viacep answered in %v, want no latency", elapsed)
+	}
+}
+
+func TestLoadFixture(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			content: `
+ceps:
+  "01310-100": {localidade: São Paulo, uf: SP}
+weather:
+  São Paulo: {temp_c: 20}
+behaviours:
+  - upstream: viacep
+    latency: 10ms
+    fault: error
+    status: 503
+    rate: 0.1
+`,
+		},
+		{name: "invalid CEP", content: `ceps: {"123": {}}`, wantErr: `invalid CEP "123"`},
+		{name: "unknown field", content: `cities: {}`, wantErr: "cities"},
+		{name: "unknown upstream", content: `behaviours: [{upstream: cep}]`, wantErr: "upstream must be"},
+		{name: "unknown fault", content: `behaviours: [{fault: slow}]`, wantErr: `unknown fault "slow"`},
+		{name: "status without error", content: `behaviours: [{fault: malformed, status: 500}]`, wantErr: "status must be"},
+		{name: "rate", content: `behaviours: [{fault: error, rate: 2}]`, wantErr: "rate must be between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixture.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			fixture, err := LoadFixture(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadFixture() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFixture() error = %v", err)
+			}
+			if _, ok := fixture.CEPs["01310100"]; !ok {
+				t.Errorf("CEPs = %v, want the CEP normalized", fixture.CEPs)
+			}
+		})
+	}
+}
+
+func TestDefaultFixture(t *testing.T) {
+	fixture := DefaultFixture()
+	for cep, location := range fixture.CEPs {
+		if _, ok := fixture.weather(location.Localidade); !ok {
+			t.Errorf("CEP %s: no weather for %s", cep, location.Localidade)
+		}
+	}
+	if len(fixture.Behaviours) != 0 {
+		t.Errorf("behaviours = %v, want none", fixture.Behaviours)
+	}
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
 // ViaCEPResponse represents the response from viaCEP API
 type ViaCEPResponse struct {
 	CEP         string `json:"cep"`
@@ -15,21 +21,185 @@ type ViaCEPResponse struct {
 	Erro        bool   `json:"erro"`
 }
 
+// WeatherAPILocation is the location WeatherAPI matched for a query
+type WeatherAPILocation struct {
+	Name    string  `json:"name"`
+	Region  string  `json:"region"`
+	Country string  `json:"country"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
 // WeatherAPIResponse represents the response from WeatherAPI
 type WeatherAPIResponse struct {
-	Current struct {
-		TempC float64 `json:"temp_c"`
+	Location WeatherAPILocation `json:"location"`
+	Current  struct {
+		TempC            float64 `json:"temp_c"`
+		LastUpdatedEpoch int64   `json:"last_updated_epoch"`
 	} `json:"current"`
 }
 
+// WeatherAPIForecastResponse represents the forecast.json response from WeatherAPI
+type WeatherAPIForecastResponse struct {
+	Location WeatherAPILocation `json:"location"`
+	Forecast struct {
+		ForecastDay []WeatherAPIForecastDay `json:"forecastday"`
+	} `json:"forecast"`
+}
+
+// WeatherAPIForecastDay is one day of a WeatherAPI forecast
+type WeatherAPIForecastDay struct {
+	// Date is the local date as YYYY-MM-DD
+	Date string `json:"date"`
+	Day  struct {
+		MaxTempC          float64 `json:"maxtemp_c"`
+		MinTempC          float64 `json:"mintemp_c"`
+		AvgTempC          float64 `json:"avgtemp_c"`
+		TotalPrecipMM     float64 `json:"totalprecip_mm"`
+		DailyChanceOfRain int     `json:"daily_chance_of_rain"`
+		Condition         struct {
+			Text string `json:"text"`
+		} `json:"condition"`
+	} `json:"day"`
+}
+
+// WeatherAPIError represents the error body returned by WeatherAPI
+type WeatherAPIError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
 // WeatherResponse represents the response returned by our API
 type WeatherResponse struct {
-	TempC float64 `json:"temp_C"`
-	TempF float64 `json:"temp_F"`
-	TempK float64 `json:"temp_K"`
+	TempC    float64          `json:"temp_C"`
+	TempF    float64          `json:"temp_F"`
+	TempK    float64          `json:"temp_K"`
+	Location *LocationDetails `json:"location,omitempty"`
+}
+
+// LocationDetails describes the address resolved from the CEP and the location
+// the weather provider matched, returned with ?include=location
+type LocationDetails struct {
+	CEP          string           `json:"cep"`
+	Logradouro   string           `json:"logradouro"`
+	Bairro       string           `json:"bairro"`
+	City         string           `json:"city"`
+	UF           string           `json:"uf"`
+	IBGE         string           `json:"ibge"`
+	DDD          string           `json:"ddd"`
+	WeatherQuery ProviderLocation `json:"weather_query"`
+}
+
+// ProviderLocation is the query sent to the weather provider and the place it resolved to
+type ProviderLocation struct {
+	Query   string  `json:"query"`
+	Name    string  `json:"name"`
+	Region  string  `json:"region"`
+	Country string  `json:"country"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+// WeatherResponseV2 is the /v2 weather response, with the location and observation time
+type WeatherResponseV2 struct {
+	Location    LocationV2    `json:"location"`
+	Temperature TemperatureV2 `json:"temperature"`
+	Units       UnitsV2       `json:"units"`
+	ObservedAt  *time.Time    `json:"observed_at,omitempty"`
+}
+
+// LocationV2 identifies where the temperature was measured
+type LocationV2 struct {
+	CEP     string           `json:"cep"`
+	City    string           `json:"city"`
+	State   string           `json:"state"`
+	Details *LocationDetails `json:"details,omitempty"`
+}
+
+// TemperatureV2 holds the temperature in every supported scale
+type TemperatureV2 struct {
+	Celsius    float64 `json:"celsius"`
+	Fahrenheit float64 `json:"fahrenheit"`
+	Kelvin     float64 `json:"kelvin"`
 }
 
+// UnitsV2 names the unit symbol of each temperature field
+type UnitsV2 struct {
+	Celsius    string `json:"celsius"`
+	Fahrenheit string `json:"fahrenheit"`
+	Kelvin     string `json:"kelvin"`
+}
+
+// TemperatureUnits are the unit symbols used by TemperatureV2
+var TemperatureUnits = UnitsV2{Celsius: "°C", Fahrenheit: "°F", Kelvin: "K"}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
+
+// Text formats the temperatures as "São Paulo/SP: 25.5°C / 77.9°F / 298.5K",
+// without the place when the location was not requested
+func (r WeatherResponse) Text() string {
+	temperatures := formatTemperatures(r.TempC, r.TempF, r.TempK)
+	if r.Location == nil {
+		return temperatures
+	}
+	return r.Location.City + "/" + r.Location.UF + ": " + temperatures
+}
+
+// Text formats the reading as "São Paulo/SP: 25.5°C / 77.9°F / 298.5K"
+func (r WeatherResponseV2) Text() string {
+	return r.Location.City + "/" + r.Location.State + ": " +
+		formatTemperatures(r.Temperature.Celsius, r.Temperature.Fahrenheit, r.Temperature.Kelvin)
+}
+
+// Text returns the error message
+func (e ErrorResponse) Text() string {
+	return e.Message
+}
+
+// CSV returns the response with the temperatures at the precision of the text format,
+// without the float noise of the conversions (83.30000000000001)
+func (r WeatherResponse) CSV() interface{} {
+	return struct {
+		TempC    oneDecimal       `json:"temp_C"`
+		TempF    oneDecimal       `json:"temp_F"`
+		TempK    oneDecimal       `json:"temp_K"`
+		Location *LocationDetails `json:"location,omitempty"`
+	}{oneDecimal(r.TempC), oneDecimal(r.TempF), oneDecimal(r.TempK), r.Location}
+}
+
+// CSV returns the response with the temperatures at the precision of the text format
+func (r WeatherResponseV2) CSV() interface{} {
+	type temperature struct {
+		Celsius    oneDecimal `json:"celsius"`
+		Fahrenheit oneDecimal `json:"fahrenheit"`
+		Kelvin     oneDecimal `json:"kelvin"`
+	}
+	return struct {
+		Location    LocationV2  `json:"location"`
+		Temperature temperature `json:"temperature"`
+		Units       UnitsV2     `json:"units"`
+		ObservedAt  *time.Time  `json:"observed_at,omitempty"`
+	}{
+		Location:    r.Location,
+		Temperature: temperature{oneDecimal(r.Temperature.Celsius), oneDecimal(r.Temperature.Fahrenheit), oneDecimal(r.Temperature.Kelvin)},
+		Units:       r.Units,
+		ObservedAt:  r.ObservedAt,
+	}
+}
+
+// oneDecimal is a number encoded with one decimal, as the temperatures of the text format
+type oneDecimal float64
+
+func (d oneDecimal) MarshalJSON() ([]byte, error) {
+	return strconv.AppendFloat(nil, float64(d), 'f', 1, 64), nil
+}
+
+func formatTemperatures(c, f, k float64) string {
+	return fmt.Sprintf("%.1f%s / %.1f%s / %.1f%s",
+		c, TemperatureUnits.Celsius, f, TemperatureUnits.Fahrenheit, k, TemperatureUnits.Kelvin)
+}
@@ -0,0 +1,170 @@
+package observations
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the bolt file. Each observation is stored twice: keyed by CEP then time,
+// for per-CEP range queries, and by time then CEP, for range queries across CEPs and
+// for retention.
+var (
+	bucketByCEP  = []byte("observations_by_cep")
+	bucketByTime = []byte("observations_by_time")
+)
+
+// scanCheckEvery is how many records a scan reads between context checks
+const scanCheckEvery = 1024
+
+// BoltStore keeps the observations in a bbolt key-value file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens, or creates, the store file at path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketByCEP, bucketByTime} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Record saves the observations in one transaction, replacing the ones of the same CEP
+// and instant
+func (s *BoltStore) Record(ctx context.Context, observations ...Observation) error {
+	values := make([][]byte, len(observations))
+	for i, o := range observations {
+		value, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		byCEP, byTime := tx.Bucket(bucketByCEP), tx.Bucket(bucketByTime)
+		for i, o := range observations {
+			if err := byCEP.Put(cepKey(o.CEP, o.ObservedAt), values[i]); err != nil {
+				return err
+			}
+			if err := byTime.Put(timeKey(o.ObservedAt, o.CEP), values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Scan calls fn for each matching observation, oldest first. A CEP filter reads only
+// that CEP's range; other filters read the time range.
+func (s *BoltStore) Scan(ctx context.Context, filter Filter, fn func(Observation) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		var cursor *bolt.Cursor
+		var start, prefix []byte
+		if filter.CEP != "" {
+			cursor = tx.Bucket(bucketByCEP).Cursor()
+			prefix = []byte(filter.CEP)
+			start = cepKey(filter.CEP, filter.From)
+		} else {
+			cursor = tx.Bucket(bucketByTime).Cursor()
+			start = encodeTime(filter.From)
+		}
+
+		n := 0
+		for k, v := cursor.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			if n++; n%scanCheckEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			var o Observation
+			if err := json.Unmarshal(v, &o); err != nil {
+				return fmt.Errorf("decoding observation %x: %w", k, err)
+			}
+			if !filter.To.IsZero() && !o.ObservedAt.Before(filter.To) {
+				return nil
+			}
+			if !filter.Matches(o) {
+				continue
+			}
+			if err := fn(o); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+}
+
+// DeleteBefore removes the observations older than t
+func (s *BoltStore) DeleteBefore(ctx context.Context, t time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		byCEP, byTime := tx.Bucket(bucketByCEP), tx.Bucket(bucketByTime)
+		limit := encodeTime(t)
+		cursor := byTime.Cursor()
+		for k, _ := cursor.First(); k != nil && bytes.Compare(k[:8], limit) < 0; k, _ = cursor.Next() {
+			observed, cep := decodeTime(k[:8]), string(k[8:])
+			if err := byCEP.Delete(cepKey(cep, observed)); err != nil {
+				return err
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// Close closes the file
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func cepKey(cep string, t time.Time) []byte {
+	return append([]byte(cep), encodeTime(t)...)
+}
+
+func timeKey(t time.Time, cep string) []byte {
+	return append(encodeTime(t), cep...)
+}
+
+// encodeTime returns the big-endian Unix nanoseconds, which sort like the times;
+// the zero time maps to the smallest key
+func encodeTime(t time.Time) []byte {
+	key := make([]byte, 8)
+	if !t.IsZero() && t.UnixNano() > 0 {
+		binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	}
+	return key
+}
+
+func decodeTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key))).UTC()
+}
@@ -0,0 +1,89 @@
+package observations
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the observations in memory, e.g. for tests
+type MemoryStore struct {
+	mu           sync.RWMutex
+	observations []Observation
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Record saves the observations
+func (s *MemoryStore) Record(ctx context.Context, observations ...Observation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range observations {
+		s.insert(o)
+	}
+	return nil
+}
+
+// insert keeps the observations sorted, replacing the one of the same CEP and instant
+func (s *MemoryStore) insert(o Observation) {
+	i := sort.Search(len(s.observations), func(i int) bool {
+		return !less(s.observations[i], o)
+	})
+	if i < len(s.observations) && !less(o, s.observations[i]) {
+		s.observations[i] = o
+		return
+	}
+	s.observations = append(s.observations, Observation{})
+	copy(s.observations[i+1:], s.observations[i:])
+	s.observations[i] = o
+}
+
+// Scan calls fn for each matching observation, oldest first
+func (s *MemoryStore) Scan(ctx context.Context, filter Filter, fn func(Observation) error) error {
+	s.mu.RLock()
+	matches := make([]Observation, 0)
+	for _, o := range s.observations {
+		if filter.Matches(o) {
+			matches = append(matches, o)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, o := range matches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBefore removes the observations older than t
+func (s *MemoryStore) DeleteBefore(ctx context.Context, t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := sort.Search(len(s.observations), func(i int) bool {
+		return !s.observations[i].ObservedAt.Before(t)
+	})
+	s.observations = append(s.observations[:0], s.observations[n:]...)
+	return n, nil
+}
+
+// Close does nothing
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// less orders observations by time, then CEP
+func less(a, b Observation) bool {
+	if !a.ObservedAt.Equal(b.ObservedAt) {
+		return a.ObservedAt.Before(b.ObservedAt)
+	}
+	return a.CEP < b.CEP
+}
@@ -0,0 +1,75 @@
+package observations
+
+import (
+	"context"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// Observation is one temperature reading of a CEP
+type Observation struct {
+	CEP        string    `json:"cep"`
+	IBGE       string    `json:"ibge,omitempty"`
+	City       string    `json:"city"`
+	UF         string    `json:"uf"`
+	Provider   string    `json:"provider"`
+	TempC      float64   `json:"temp_C"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// Filter selects observations in the [From, To) range. A zero From or To leaves that
+// side open; CEP, IBGE and UF narrow the selection when set.
+type Filter struct {
+	CEP  string
+	IBGE string
+	UF   string
+	From time.Time
+	To   time.Time
+}
+
+// Matches reports whether the observation passes the filter
+func (f Filter) Matches(o Observation) bool {
+	switch {
+	case f.CEP != "" && o.CEP != f.CEP,
+		f.IBGE != "" && o.IBGE != f.IBGE,
+		f.UF != "" && o.UF != f.UF,
+		!f.From.IsZero() && o.ObservedAt.Before(f.From),
+		!f.To.IsZero() && !o.ObservedAt.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// Store records observations. A CEP has at most one observation per instant, so
+// recording the same reading twice keeps a single copy.
+type Store interface {
+	// Record saves the observations in one write
+	Record(ctx context.Context, observations ...Observation) error
+	// Scan calls fn for each observation matching the filter, oldest first, until fn
+	// returns an error, which Scan returns
+	Scan(ctx context.Context, filter Filter, fn func(Observation) error) error
+	// DeleteBefore removes the observations older than t, returning how many were removed
+	DeleteBefore(ctx context.Context, t time.Time) (int, error)
+	// Close releases the store
+	Close() error
+}
+
+// FromLookup builds the observation of a lookup; readings without an observation
+// time are stamped with now
+func FromLookup(result *services.LookupResult, provider string, now time.Time) Observation {
+	observed := result.ObservedAt
+	if observed.IsZero() {
+		observed = now
+	}
+	tempC, _, _ := result.Temperatures()
+	return Observation{
+		CEP:        result.CEP,
+		IBGE:       result.Location.IBGE,
+		City:       result.Location.Localidade,
+		UF:         result.Location.UF,
+		Provider:   provider,
+		TempC:      tempC,
+		ObservedAt: observed.UTC(),
+	}
+}
@@ -0,0 +1,130 @@
+package observations
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+const (
+	// queueSize is how many observations may wait for the store before new ones are dropped
+	queueSize = 1024
+	// maxBatch bounds the observations written in one transaction
+	maxBatch = 256
+	// retentionEvery is how often old observations are deleted
+	retentionEvery = time.Hour
+)
+
+// Recorder writes observations in the background, so requests never wait for the
+// store, and deletes the ones older than the retention period
+type Recorder struct {
+	store     Store
+	provider  string
+	queue     chan Observation
+	retention atomic.Int64
+	dropped   atomic.Int64
+	now       func() time.Time
+}
+
+// NewRecorder creates a recorder for readings of the provider; a zero retention keeps
+// observations forever
+func NewRecorder(store Store, provider string, retention time.Duration) *Recorder {
+	r := &Recorder{
+		store:    store,
+		provider: provider,
+		queue:    make(chan Observation, queueSize),
+		now:      time.Now,
+	}
+	r.SetRetention(retention)
+	return r
+}
+
+// SetRetention replaces the retention period
+func (r *Recorder) SetRetention(retention time.Duration) {
+	r.retention.Store(int64(retention))
+}
+
+// Record queues the reading of a lookup, dropping it when the store falls behind
+func (r *Recorder) Record(result *services.LookupResult) {
+	select {
+	case r.queue <- FromLookup(result, r.provider, r.now()):
+	default:
+		if r.dropped.Add(1) == 1 {
+			log.Printf("Observation queue full, dropping readings")
+		}
+	}
+}
+
+// Run writes the queued observations and applies the retention until ctx is cancelled,
+// then writes the observations still queued
+func (r *Recorder) Run(ctx context.Context) {
+	r.applyRetention(ctx)
+	ticker := time.NewTicker(retentionEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.flush(context.WithoutCancel(ctx))
+			return
+		case o := <-r.queue:
+			r.write(ctx, r.drain(o))
+		case <-ticker.C:
+			r.applyRetention(ctx)
+		}
+	}
+}
+
+func (r *Recorder) write(ctx context.Context, batch []Observation) {
+	if err := r.store.Record(ctx, batch...); err != nil {
+		log.Printf("Error recording %d observations: %v", len(batch), err)
+	}
+	if dropped := r.dropped.Swap(0); dropped > 0 {
+		log.Printf("Dropped %d observations while the queue was full", dropped)
+	}
+}
+
+// flush writes the observations queued when Run stops
+func (r *Recorder) flush(ctx context.Context) {
+	for {
+		select {
+		case o := <-r.queue:
+			r.write(ctx, r.drain(o))
+		default:
+			return
+		}
+	}
+}
+
+// drain returns first with the observations already queued behind it, so a burst of
+// readings costs one transaction instead of one each
+func (r *Recorder) drain(first Observation) []Observation {
+	batch := []Observation{first}
+	for len(batch) < maxBatch {
+		select {
+		case o := <-r.queue:
+			batch = append(batch, o)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (r *Recorder) applyRetention(ctx context.Context) {
+	retention := time.Duration(r.retention.Load())
+	if retention <= 0 {
+		return
+	}
+	deleted, err := r.store.DeleteBefore(ctx, r.now().Add(-retention))
+	if err != nil {
+		log.Printf("Error deleting old observations: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d observations older than %s", deleted, retention)
+	}
+}
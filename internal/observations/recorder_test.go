@@ -0,0 +1,130 @@
+package observations
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+func lookupResult(tempC float64, observed time.Time) *services.LookupResult {
+	weather := &models.WeatherAPIResponse{}
+	weather.Current.TempC = tempC
+	return &services.LookupResult{
+		CEP:        "01310100",
+		Query:      "São Paulo",
+		Location:   &models.ViaCEPResponse{CEP: "01310-100", Localidade: "São Paulo", UF: "SP", IBGE: "3550308"},
+		Weather:    weather,
+		ObservedAt: observed,
+	}
+}
+
+func TestFromLookup(t *testing.T) {
+	now := at(5)
+	o := FromLookup(lookupResult(25, at(1)), "weatherapi", now)
+	expected := Observation{CEP: "01310100", IBGE: "3550308", City: "São Paulo", UF: "SP", Provider: "weatherapi", TempC: 25, ObservedAt: at(1)}
+	if o != expected {
+		t.Errorf("expected %+v, got %+v", expected, o)
+	}
+
+	if o := FromLookup(lookupResult(25, time.Time{}), "weatherapi", now); !o.ObservedAt.Equal(now) {
+		t.Errorf("expected readings without a time to be stamped now, got %v", o.ObservedAt)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	store := NewMemoryStore()
+	store.Record(context.Background(), Observation{CEP: "01310100", TempC: 10, ObservedAt: at(-48)})
+
+	recorder := NewRecorder(store, "weatherapi", 24*time.Hour)
+	recorder.now = func() time.Time { return at(0) }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go recorder.Run(ctx)
+
+	recorder.Record(lookupResult(25, at(-1)))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var temps []float64
+		store.Scan(context.Background(), Filter{}, func(o Observation) error {
+			temps = append(temps, o.TempC)
+			return nil
+		})
+		// The old observation goes on start, the new one is written in the background
+		if len(temps) == 1 && temps[0] == 25 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected only the new observation, got %v", temps)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// countingStore counts the writes reaching the store
+type countingStore struct {
+	*MemoryStore
+	writes atomic.Int32
+}
+
+func (s *countingStore) Record(ctx context.Context, observations ...Observation) error {
+	s.writes.Add(1)
+	return s.MemoryStore.Record(ctx, observations...)
+}
+
+func TestRecorder_BatchesQueuedObservations(t *testing.T) {
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	recorder := NewRecorder(store, "weatherapi", 0)
+
+	// Queued before Run starts, so the first write finds them all
+	for hours := 0; hours < 50; hours++ {
+		recorder.Record(lookupResult(25, at(hours)))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go recorder.Run(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		count := 0
+		store.Scan(context.Background(), Filter{}, func(Observation) error {
+			count++
+			return nil
+		})
+		if count == 50 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 50 observations, got %d", count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if writes := store.writes.Load(); writes != 1 {
+		t.Errorf("expected one write, got %d", writes)
+	}
+}
+
+func TestRecorder_FlushesOnStop(t *testing.T) {
+	store := NewMemoryStore()
+	recorder := NewRecorder(store, "weatherapi", 0)
+	recorder.Record(lookupResult(25, at(0)))
+	recorder.Record(lookupResult(26, at(1)))
+
+	// Cancelled before it starts: Run only writes what is queued
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder.Run(ctx)
+
+	count := 0
+	store.Scan(context.Background(), Filter{}, func(Observation) error {
+		count++
+		return nil
+	})
+	if count != 2 {
+		t.Errorf("expected the 2 queued observations written, got %d", count)
+	}
+}
@@ -0,0 +1,213 @@
+package observations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// Interval is the width of the buckets of a report
+type Interval string
+
+const (
+	Hour Interval = "hour"
+	Day  Interval = "day"
+	// Week buckets start on Monday
+	Week Interval = "week"
+)
+
+// ParseInterval validates an interval name
+func ParseInterval(name string) (Interval, error) {
+	switch interval := Interval(name); interval {
+	case Hour, Day, Week:
+		return interval, nil
+	}
+	return "", fmt.Errorf("bucket must be hour, day or week, got %q", name)
+}
+
+// Start returns the start of the bucket holding t, in UTC
+func (i Interval) Start(t time.Time) time.Time {
+	t = t.UTC()
+	switch i {
+	case Hour:
+		return t.Truncate(time.Hour)
+	case Week:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Duration is the width of the buckets; buckets are in UTC, so days and weeks have
+// a fixed length
+func (i Interval) Duration() time.Duration {
+	switch i {
+	case Hour:
+		return time.Hour
+	case Week:
+		return 7 * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// Buckets counts the buckets that overlap [from, to)
+func (i Interval) Buckets(from, to time.Time) int {
+	span := to.Sub(i.Start(from))
+	return int((span + i.Duration() - 1) / i.Duration())
+}
+
+// Summary describes the temperatures of a bucket in one scale
+type Summary struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+}
+
+// BucketStats summarizes the observations of one bucket in Celsius, Fahrenheit and Kelvin
+type BucketStats struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Count int       `json:"count"`
+	TempC Summary   `json:"temp_C"`
+	TempF Summary   `json:"temp_F"`
+	TempK Summary   `json:"temp_K"`
+}
+
+// Report is the aggregation of the observations selected by a filter
+type Report struct {
+	CEP     string        `json:"cep,omitempty"`
+	IBGE    string        `json:"ibge,omitempty"`
+	UF      string        `json:"uf,omitempty"`
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Bucket  Interval      `json:"bucket"`
+	Buckets []BucketStats `json:"buckets"`
+}
+
+// resolution is the width of the histogram bins, in degrees Celsius. Providers report
+// tenths of a degree, so percentiles are exact for their readings.
+const resolution = 0.1
+
+// histogram accumulates the temperatures of a bucket. It keeps one counter per
+// distinct tenth of a degree, so its size does not grow with the number of readings.
+type histogram struct {
+	bins  map[int64]int
+	count int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{bins: make(map[int64]int)}
+}
+
+func (h *histogram) add(tempC float64) {
+	if h.count == 0 || tempC < h.min {
+		h.min = tempC
+	}
+	if h.count == 0 || tempC > h.max {
+		h.max = tempC
+	}
+	h.bins[int64(math.Round(tempC/resolution))]++
+	h.count++
+	h.sum += tempC
+}
+
+// summary returns the Celsius summary; percentiles use the nearest rank
+func (h *histogram) summary() Summary {
+	bins := make([]int64, 0, len(h.bins))
+	for bin := range h.bins {
+		bins = append(bins, bin)
+	}
+	sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p / 100 * float64(h.count)))
+		seen := 0
+		for _, bin := range bins {
+			seen += h.bins[bin]
+			if seen >= rank {
+				return float64(bin) * resolution
+			}
+		}
+		return h.max
+	}
+
+	return Summary{
+		Min:  h.min,
+		Max:  h.max,
+		Mean: h.sum / float64(h.count),
+		P50:  percentile(50),
+		P90:  percentile(90),
+		P95:  percentile(95),
+		P99:  percentile(99),
+	}
+}
+
+// convert applies a temperature scale conversion to every field of the summary,
+// which works because the conversions preserve order
+func (s Summary) convert(fn func(float64) float64) Summary {
+	return Summary{
+		Min:  round(fn(s.Min)),
+		Max:  round(fn(s.Max)),
+		Mean: round(fn(s.Mean)),
+		P50:  round(fn(s.P50)),
+		P90:  round(fn(s.P90)),
+		P95:  round(fn(s.P95)),
+		P99:  round(fn(s.P99)),
+	}
+}
+
+// round drops floating point noise such as 83.30000000000001
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Aggregate summarizes the observations matching the filter per bucket of the interval,
+// skipping buckets without observations. Observations arrive oldest first, so only the
+// histogram of the current bucket is kept while scanning.
+func Aggregate(ctx context.Context, store Store, filter Filter, interval Interval) ([]BucketStats, error) {
+	buckets := make([]BucketStats, 0)
+	var start time.Time
+	var current *histogram
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		celsius := current.summary()
+		buckets = append(buckets, BucketStats{
+			Start: start,
+			End:   start.Add(interval.Duration()),
+			Count: current.count,
+			TempC: celsius.convert(func(c float64) float64 { return c }),
+			TempF: celsius.convert(services.ConvertCelsiusToFahrenheit),
+			TempK: celsius.convert(services.ConvertCelsiusToKelvin),
+		})
+	}
+
+	err := store.Scan(ctx, filter, func(o Observation) error {
+		if bucket := interval.Start(o.ObservedAt); current == nil || !bucket.Equal(start) {
+			flush()
+			start, current = bucket, newHistogram()
+		}
+		current.add(o.TempC)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush()
+	return buckets, nil
+}
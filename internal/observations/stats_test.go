@@ -0,0 +1,83 @@
+package observations
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInterval(t *testing.T) {
+	// 2026-03-10 is a Tuesday
+	moment := time.Date(2026, 3, 10, 14, 35, 0, 0, time.FixedZone("BRT", -3*60*60))
+	tests := []struct {
+		interval Interval
+		start    time.Time
+		buckets  int
+	}{
+		{Hour, time.Date(2026, 3, 10, 17, 0, 0, 0, time.UTC), 48},
+		{Day, time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC), 3},
+		{Week, time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.interval), func(t *testing.T) {
+			if got := tt.interval.Start(moment); !got.Equal(tt.start) {
+				t.Errorf("expected start %v, got %v", tt.start, got)
+			}
+			// From 17:35 UTC to the same time two days later
+			if got := tt.interval.Buckets(moment, moment.Add(47*time.Hour)); got != tt.buckets {
+				t.Errorf("expected %d buckets, got %d", tt.buckets, got)
+			}
+		})
+	}
+
+	if _, err := ParseInterval("month"); err == nil {
+		t.Error("expected an error for an unknown interval")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	store := NewMemoryStore()
+	// 100 readings of 0.0 to 9.9 °C on the first day, two readings on the third
+	for i := 0; i < 100; i++ {
+		store.Record(context.Background(), Observation{CEP: "01310100", UF: "SP", TempC: float64(i) / 10, ObservedAt: at(0).Add(time.Duration(i) * time.Minute)})
+	}
+	store.Record(context.Background(), Observation{CEP: "01310100", UF: "SP", TempC: 28.5, ObservedAt: at(50)})
+	store.Record(context.Background(), Observation{CEP: "01311000", UF: "SP", TempC: 31.5, ObservedAt: at(51)})
+	store.Record(context.Background(), Observation{CEP: "20040020", UF: "RJ", TempC: 40, ObservedAt: at(51)})
+
+	buckets, err := Aggregate(context.Background(), store, Filter{UF: "SP"}, Day)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("expected 2 buckets, got %+v", buckets)
+	}
+
+	first := buckets[0]
+	if !first.Start.Equal(at(0)) || !first.End.Equal(at(24)) || first.Count != 100 {
+		t.Errorf("unexpected first bucket %+v", first)
+	}
+	expected := Summary{Min: 0, Max: 9.9, Mean: 4.95, P50: 4.9, P90: 8.9, P95: 9.4, P99: 9.8}
+	if first.TempC != expected {
+		t.Errorf("expected %+v, got %+v", expected, first.TempC)
+	}
+	if first.TempF.Max != 49.82 || first.TempK.Max != 282.9 {
+		t.Errorf("unexpected conversions %+v %+v", first.TempF, first.TempK)
+	}
+
+	second := buckets[1]
+	if !second.Start.Equal(at(48)) || second.Count != 2 || second.TempC.Mean != 30 || second.TempC.P50 != 28.5 || second.TempC.P99 != 31.5 {
+		t.Errorf("unexpected second bucket %+v", second)
+	}
+	if second.TempF.Mean != 86 {
+		t.Errorf("expected mean 86 °F, got %v", second.TempF.Mean)
+	}
+}
+
+func TestAggregate_Empty(t *testing.T) {
+	buckets, err := Aggregate(context.Background(), NewMemoryStore(), Filter{CEP: "01310100"}, Hour)
+	if err != nil || buckets == nil || len(buckets) != 0 {
+		t.Errorf("expected no buckets, got %v (%v)", buckets, err)
+	}
+}
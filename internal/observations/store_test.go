@@ -0,0 +1,163 @@
+package observations
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+func at(hours int) time.Time {
+	return base.Add(time.Duration(hours) * time.Hour)
+}
+
+// testStore runs the behavior every Store implementation must have
+func testStore(t *testing.T, open func(t *testing.T) Store) {
+	seed := func(t *testing.T) Store {
+		store := open(t)
+		records := []Observation{
+			{CEP: "01310100", IBGE: "3550308", UF: "SP", TempC: 20, ObservedAt: at(0)},
+			{CEP: "01310100", IBGE: "3550308", UF: "SP", TempC: 22, ObservedAt: at(2)},
+			{CEP: "01310100", IBGE: "3550308", UF: "SP", TempC: 24, ObservedAt: at(4)},
+			{CEP: "01311000", IBGE: "3550308", UF: "SP", TempC: 21, ObservedAt: at(1)},
+			{CEP: "20040020", IBGE: "3304557", UF: "RJ", TempC: 30, ObservedAt: at(3)},
+			// Same CEP and instant: replaces the earlier record
+			{CEP: "01310100", IBGE: "3550308", UF: "SP", TempC: 23, ObservedAt: at(2)},
+		}
+		for _, o := range records {
+			if err := store.Record(context.Background(), o); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		return store
+	}
+
+	scan := func(t *testing.T, store Store, filter Filter) []float64 {
+		t.Helper()
+		var temps []float64
+		err := store.Scan(context.Background(), filter, func(o Observation) error {
+			temps = append(temps, o.TempC)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return temps
+	}
+
+	t.Run("scan", func(t *testing.T) {
+		store := seed(t)
+		tests := []struct {
+			name     string
+			filter   Filter
+			expected []float64
+		}{
+			{"everything", Filter{}, []float64{20, 21, 23, 30, 24}},
+			{"by cep", Filter{CEP: "01310100"}, []float64{20, 23, 24}},
+			{"by cep and range", Filter{CEP: "01310100", From: at(1), To: at(4)}, []float64{23}},
+			{"by ibge", Filter{IBGE: "3550308", From: at(1)}, []float64{21, 23, 24}},
+			{"by uf", Filter{UF: "RJ"}, []float64{30}},
+			{"range end is exclusive", Filter{To: at(1)}, []float64{20}},
+			{"unknown cep", Filter{CEP: "99999999"}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got := scan(t, store, tt.filter)
+				if len(got) != len(tt.expected) {
+					t.Fatalf("expected %v, got %v", tt.expected, got)
+				}
+				for i := range got {
+					if got[i] != tt.expected[i] {
+						t.Fatalf("expected %v, got %v", tt.expected, got)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("scan stops on error", func(t *testing.T) {
+		store := seed(t)
+		stop := errors.New("stop")
+		calls := 0
+		err := store.Scan(context.Background(), Filter{}, func(o Observation) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("expected the scan to stop after one call, got %d calls and %v", calls, err)
+		}
+	})
+
+	t.Run("record many at once", func(t *testing.T) {
+		store := open(t)
+		err := store.Record(context.Background(),
+			Observation{CEP: "01310100", TempC: 20, ObservedAt: at(2)},
+			Observation{CEP: "20040020", TempC: 30, ObservedAt: at(1)},
+			Observation{CEP: "01310100", TempC: 21, ObservedAt: at(2)},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := scan(t, store, Filter{}); len(got) != 2 || got[0] != 30 || got[1] != 21 {
+			t.Errorf("expected [30 21], got %v", got)
+		}
+	})
+
+	t.Run("delete before", func(t *testing.T) {
+		store := seed(t)
+		deleted, err := store.DeleteBefore(context.Background(), at(2))
+		if err != nil || deleted != 2 {
+			t.Fatalf("expected 2 deletions, got %d (%v)", deleted, err)
+		}
+		if got := scan(t, store, Filter{}); len(got) != 3 {
+			t.Errorf("expected 3 observations left, got %v", got)
+		}
+		if got := scan(t, store, Filter{CEP: "01310100"}); len(got) != 2 {
+			t.Errorf("expected 2 observations left for the CEP, got %v", got)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return NewMemoryStore()
+	})
+}
+
+func TestBoltStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		store, err := OpenBoltStore(filepath.Join(t.TempDir(), "data", "observations.db"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+
+	t.Run("persists across reopen", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "observations.db")
+		store, err := OpenBoltStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		store.Record(context.Background(), Observation{CEP: "01310100", TempC: 25, ObservedAt: at(0)})
+		store.Close()
+
+		store, err = OpenBoltStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer store.Close()
+		var found []Observation
+		store.Scan(context.Background(), Filter{CEP: "01310100"}, func(o Observation) error {
+			found = append(found, o)
+			return nil
+		})
+		if len(found) != 1 || found[0].TempC != 25 || !found[0].ObservedAt.Equal(at(0)) {
+			t.Errorf("unexpected observations %+v", found)
+		}
+	})
+}
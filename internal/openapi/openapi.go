@@ -0,0 +1,26 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// spec is the OpenAPI 3 document describing every route of the service
+//
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the embedded OpenAPI document
+func Spec() []byte {
+	return spec
+}
+
+// Handler serves the OpenAPI document at GET /openapi.json
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(spec)
+	}
+}
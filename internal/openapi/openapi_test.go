@@ -0,0 +1,493 @@
+package openapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/alerts"
+	"github.com/lhespanhol/weather-by-cep/internal/auth"
+	"github.com/lhespanhol/weather-by-cep/internal/graphqlapi"
+	"github.com/lhespanhol/weather-by-cep/internal/handlers"
+	"github.com/lhespanhol/weather-by-cep/internal/observations"
+	"github.com/lhespanhol/weather-by-cep/internal/openapi"
+	"github.com/lhespanhol/weather-by-cep/internal/prewarm"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+	"github.com/lhespanhol/weather-by-cep/internal/stream"
+)
+
+// contract checks recorded responses against the embedded OpenAPI document. It
+// implements the subset of OpenAPI 3.0 schemas the document uses: $ref, type,
+// properties, required, additionalProperties, items, enum, nullable and date-time.
+type contract struct {
+	doc map[string]interface{}
+}
+
+func loadContract(t *testing.T) *contract {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openapi.Spec(), &doc); err != nil {
+		t.Fatalf("embedded spec is not valid JSON: %v", err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Fatalf("unexpected openapi version %v", doc["openapi"])
+	}
+	return &contract{doc: doc}
+}
+
+func (c *contract) paths() map[string]interface{} {
+	return c.doc["paths"].(map[string]interface{})
+}
+
+// resolve follows local $ref pointers such as #/components/schemas/WeatherResponse
+func (c *contract) resolve(node map[string]interface{}) map[string]interface{} {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var target interface{} = c.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			target = target.(map[string]interface{})[part]
+		}
+		node = target.(map[string]interface{})
+	}
+}
+
+// template returns the spec path matching a request path, e.g. /weather/{cep}.
+// Literal segments win over parameters, so /v2/weather/ws is not /v2/weather/{cep}.
+func (c *contract) template(path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	best, bestParams := "", len(segments)+1
+	for template := range c.paths() {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		match, params := true, 0
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") {
+				params++
+			} else if part != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match && params < bestParams {
+			best, bestParams = template, params
+		}
+	}
+	return best, best != ""
+}
+
+// check returns every way the response diverges from the documented operation
+func (c *contract) check(r *http.Request, rec *httptest.ResponseRecorder) []string {
+	template, ok := c.template(r.URL.Path)
+	if !ok {
+		return []string{fmt.Sprintf("path %s is not documented", r.URL.Path)}
+	}
+	operation, ok := c.paths()[template].(map[string]interface{})[strings.ToLower(r.Method)].(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("%s %s is not documented", r.Method, template)}
+	}
+	responses := operation["responses"].(map[string]interface{})
+	documented, ok := responses[strconv.Itoa(rec.Code)].(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("status %d of %s %s is not documented", rec.Code, r.Method, template)}
+	}
+	response := c.resolve(documented)
+
+	var problems []string
+	if headers, ok := response["headers"].(map[string]interface{}); ok {
+		for name, h := range headers {
+			header := c.resolve(h.(map[string]interface{}))
+			value := rec.Header().Get(name)
+			if value == "" {
+				if header["required"] == true {
+					problems = append(problems, fmt.Sprintf("missing required header %s", name))
+				}
+				continue
+			}
+			if schema, ok := header["schema"].(map[string]interface{}); ok && c.resolve(schema)["type"] == "integer" {
+				if _, err := strconv.Atoi(value); err != nil {
+					problems = append(problems, fmt.Sprintf("header %s: %q is not an integer", name, value))
+				}
+			}
+		}
+	}
+
+	content, ok := response["content"].(map[string]interface{})
+	if !ok {
+		if rec.Body.Len() != 0 {
+			problems = append(problems, fmt.Sprintf("undocumented body %q", rec.Body.String()))
+		}
+		return problems
+	}
+
+	mediaType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil {
+		return append(problems, fmt.Sprintf("invalid Content-Type %q", rec.Header().Get("Content-Type")))
+	}
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return append(problems, fmt.Sprintf("Content-Type %s is not documented", mediaType))
+	}
+	schema := media["schema"].(map[string]interface{})
+
+	var body interface{} = rec.Body.String()
+	if mediaType == "application/json" {
+		decoder := json.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			return append(problems, fmt.Sprintf("invalid JSON body: %v", err))
+		}
+	}
+	return append(problems, c.validate(schema, body, "body")...)
+}
+
+func (c *contract) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	schema = c.resolve(schema)
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+
+	var problems []string
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: expected object, got %T", at, value))
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := object[name.(string)]; !present {
+					problems = append(problems, fmt.Sprintf("%s: missing required property %s", at, name))
+				}
+			}
+		}
+		for name, v := range object {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if schema["additionalProperties"] == false {
+					problems = append(problems, fmt.Sprintf("%s: undocumented property %s", at, name))
+				}
+				continue
+			}
+			problems = append(problems, c.validate(property, v, at+"."+name)...)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: expected array, got %T", at, value))
+		}
+		items := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			problems = append(problems, c.validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: expected string, got %T", at, value))
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date-time", at, s))
+			}
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected number, got %T", at, value))
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if _, err := n.Int64(); !ok || err != nil {
+			problems = append(problems, fmt.Sprintf("%s: expected integer, got %v", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected boolean, got %T", at, value))
+		}
+	}
+	return problems
+}
+
+// newUpstreams fakes ViaCEP and WeatherAPI: CEP 99999999 does not exist and the
+// weather lookup for CEP 00000000 fails.
+func newUpstreams(t *testing.T) (viaCEP, weather *httptest.Server) {
+	viaCEP = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(r.URL.Path, "99999999"):
+			w.Write([]byte(`{"erro": true}`))
+		case strings.Contains(r.URL.Path, "00000000"):
+			w.Write([]byte(`{"cep": "00000-000", "localidade": "Broken", "uf": "SP"}`))
+		default:
+			w.Write([]byte(`{"cep": "01310-100", "localidade": "São Paulo", "uf": "SP"}`))
+		}
+	}))
+	t.Cleanup(viaCEP.Close)
+
+	weather = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("q") == "Broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": {"code": 9999, "message": "Internal application error."}}`))
+			return
+		}
+		fmt.Fprintf(w, `{
+			"location": {"name": "Sao Paulo", "region": "Sao Paulo", "country": "Brazil", "lat": -23.53, "lon": -46.62},
+			"current": {"temp_c": 28.5, "last_updated_epoch": %d}
+		}`, time.Now().Add(-time.Minute).Unix())
+	}))
+	t.Cleanup(weather.Close)
+	return viaCEP, weather
+}
+
+// newRouter builds the service routes with the real handlers
+func newRouter(viaCEP, weather *httptest.Server, authSettings auth.Settings, clients []auth.Client, adminToken string) http.Handler {
+	keyPool := services.NewKeyPool([]string{"weather-key-0001"}, services.KeyStrategyRoundRobin, 0)
+	weatherService := services.NewWeatherServiceWithKeyPool(weather.URL, keyPool, weather.Client())
+	cepService := services.NewViaCEPServiceWithClient(viaCEP.URL, viaCEP.Client())
+	authenticator := auth.NewAuthenticator(authSettings, clients)
+	hub := stream.NewHub(services.NewLookup(cepService, weatherService), stream.Settings{PollInterval: time.Minute, Heartbeat: time.Minute, MaxStreams: 1})
+	history := observations.NewMemoryStore()
+	for hours := 1; hours <= 2; hours++ {
+		history.Record(context.Background(), observations.Observation{
+			CEP: "01310100", IBGE: "3550308", City: "São Paulo", UF: "SP", Provider: "weatherapi",
+			TempC: 28.5, ObservedAt: time.Now().Add(-time.Duration(hours) * time.Hour),
+		})
+	}
+
+	return handlers.NewRouter(handlers.Routes{
+		Weather:       handlers.NewWeatherHandler(cepService, weatherService),
+		Stream:        handlers.NewStreamHandler(hub),
+		WebSocket:     handlers.NewWebSocketHandler(hub),
+		Observations:  handlers.NewObservationsHandler(history),
+		Stats:         handlers.NewStatsHandler(history),
+		Alerts:        handlers.NewAlertsHandler(alerts.NewStore(10), alerts.NewDispatcher(alerts.Settings{MaxAttempts: 1, RetryBackoff: time.Second, Timeout: time.Second}), cepService),
+		GraphQL:       graphqlapi.NewHandler(cepService, weatherService, weatherService),
+		Admin:         handlers.NewAdminHandler(adminToken, keyPool, authenticator, prewarm.New(cepService, services.NewCachedWeatherService(weatherService, time.Minute), prewarm.Settings{Concurrency: 1})),
+		Authenticator: authenticator,
+	})
+}
+
+func TestContract(t *testing.T) {
+	c := loadContract(t)
+	viaCEP, weather := newUpstreams(t)
+
+	open := newRouter(viaCEP, weather, auth.Settings{Header: "X-API-Key", QueryParam: "api_key"},
+		[]auth.Client{{Name: "erp", Key: "erp-key"}}, "admin-secret")
+	protected := newRouter(viaCEP, weather, auth.Settings{Enabled: true, Header: "X-API-Key", QueryParam: "api_key"},
+		[]auth.Client{
+			{Name: "dashboard", Key: "dashboard-key", DailyQuota: 1},
+			{Name: "legacy", Key: "legacy-key", Disabled: true},
+			{Name: "erp", Key: "erp-key"},
+		}, "")
+
+	etag := func() string {
+		rec := httptest.NewRecorder()
+		open.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/01310100", nil))
+		return rec.Header().Get("ETag")
+	}()
+
+	tests := []struct {
+		name           string
+		router         http.Handler
+		target         string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{"root", open, "/", nil, http.StatusOK},
+		{"health", open, "/health", nil, http.StatusOK},
+		{"openapi document", open, "/openapi.json", nil, http.StatusOK},
+		{"weather v1", open, "/v1/weather/01310100", nil, http.StatusOK},
+		{"weather v1 with location", open, "/v1/weather/01310100?include=location", nil, http.StatusOK},
+		{"weather v2", open, "/v2/weather/01310100", nil, http.StatusOK},
+		{"weather v2 with location", open, "/v2/weather/01310100?include=location", nil, http.StatusOK},
+		{"weather v2 invalid zipcode", open, "/v2/weather/0131", nil, http.StatusUnprocessableEntity},
+		{"weather v2 not modified", open, "/v2/weather/01310100", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"legacy weather", open, "/weather/01310100", nil, http.StatusOK},
+		{"weather v1 stream", open, "/v1/weather/01310100/stream", nil, http.StatusOK},
+		{"weather v2 stream", open, "/v2/weather/01310100/stream?include=location", nil, http.StatusOK},
+		{"websocket without handshake", open, "/v2/weather/ws", nil, http.StatusBadRequest},
+		{"weather stream invalid zipcode", open, "/v1/weather/0131/stream", nil, http.StatusUnprocessableEntity},
+		{"weather stream unknown zipcode", open, "/v2/weather/99999999/stream", nil, http.StatusNotFound},
+		{"weather as xml", open, "/v1/weather/01310100?format=xml", nil, http.StatusOK},
+		{"weather as csv", open, "/v2/weather/01310100", map[string]string{"Accept": "text/csv"}, http.StatusOK},
+		{"weather as yaml", open, "/v2/weather/01310100?format=yaml", nil, http.StatusOK},
+		{"weather as text", open, "/v1/weather/01310100?include=location", map[string]string{"Accept": "text/plain"}, http.StatusOK},
+		{"error as text", open, "/v1/weather/99999999?format=text", nil, http.StatusNotFound},
+		{"unsupported format", open, "/v1/weather/01310100", map[string]string{"Accept": "application/pdf"}, http.StatusNotAcceptable},
+		{"graphql", open, "/graphql?query=" + url.QueryEscape(`{ weather(cep: "01310100") { temperature { celsius } } }`), nil, http.StatusOK},
+		{"graphql field error", open, "/graphql?query=" + url.QueryEscape(`{ location(cep: "99999999") { city } }`), nil, http.StatusOK},
+		{"graphql without query", open, "/graphql", nil, http.StatusBadRequest},
+		{"admin keys as yaml", open, "/admin/keys?format=yaml", map[string]string{"Authorization": "Bearer admin-secret"}, http.StatusOK},
+		{"weather with dash", open, "/weather/01310-100", nil, http.StatusOK},
+		{"weather not modified", open, "/weather/01310100", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"invalid zipcode", open, "/weather/123", nil, http.StatusUnprocessableEntity},
+		{"unknown zipcode", open, "/weather/99999999", nil, http.StatusNotFound},
+		{"upstream failure", open, "/weather/00000000", nil, http.StatusInternalServerError},
+		{"missing api key", protected, "/weather/01310100", nil, http.StatusUnauthorized},
+		{"invalid api key", protected, "/weather/01310100", map[string]string{"X-API-Key": "nope"}, http.StatusUnauthorized},
+		{"disabled api key", protected, "/weather/01310100", map[string]string{"X-API-Key": "legacy-key"}, http.StatusForbidden},
+		{"authenticated", protected, "/weather/01310100?api_key=dashboard-key", nil, http.StatusOK},
+		{"quota exceeded", protected, "/weather/01310100", map[string]string{"X-API-Key": "dashboard-key"}, http.StatusTooManyRequests},
+		{"admin keys", open, "/admin/keys", map[string]string{"Authorization": "Bearer admin-secret"}, http.StatusOK},
+		{"admin keys unauthorized", open, "/admin/keys", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{"admin keys disabled", protected, "/admin/keys", nil, http.StatusNotFound},
+		{"admin clients", open, "/admin/clients", map[string]string{"Authorization": "Bearer admin-secret"}, http.StatusOK},
+		{"admin clients unauthorized", open, "/admin/clients", nil, http.StatusUnauthorized},
+		{"admin clients disabled", protected, "/admin/clients", nil, http.StatusNotFound},
+	}
+
+	covered := make(map[string]bool)
+	exercise := func(t *testing.T, router http.Handler, method, target, body string, headers map[string]string, expectedStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if strings.HasSuffix(req.URL.Path, "/stream") {
+			// Streams end when the client goes away
+			ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != expectedStatus {
+			t.Fatalf("expected status %d, got %d: %s", expectedStatus, rec.Code, rec.Body.String())
+		}
+		for _, problem := range c.check(req, rec) {
+			t.Error(problem)
+		}
+		if template, ok := c.template(req.URL.Path); ok {
+			covered[template] = true
+		}
+		return rec
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exercise(t, tt.router, http.MethodGet, tt.target, "", tt.headers, tt.expectedStatus)
+		})
+	}
+
+	t.Run("alerts", func(t *testing.T) {
+		alert := `{"cep": "01310-100", "condition": {"field": "temp_C", "operator": "gt", "value": 35}, "webhook_url": "https://example.com/hooks"}`
+		erp := map[string]string{"X-API-Key": "erp-key"}
+		rec := exercise(t, protected, http.MethodPost, "/alerts", alert, erp, http.StatusCreated)
+		location := rec.Header().Get("Location")
+
+		exercise(t, protected, http.MethodPost, "/alerts", strings.Replace(alert, "https://", "", 1), erp, http.StatusUnprocessableEntity)
+		exercise(t, protected, http.MethodPost, "/alerts", strings.Replace(alert, "01310-100", "99999999", 1), erp, http.StatusNotFound)
+		exercise(t, protected, http.MethodGet, "/alerts", "", erp, http.StatusOK)
+		exercise(t, protected, http.MethodGet, location, "", erp, http.StatusOK)
+		exercise(t, protected, http.MethodGet, "/alerts/dead-letters", "", erp, http.StatusOK)
+		exercise(t, protected, http.MethodDelete, location, "", erp, http.StatusNoContent)
+		exercise(t, protected, http.MethodDelete, location, "", erp, http.StatusNotFound)
+		exercise(t, protected, http.MethodGet, "/alerts", "", nil, http.StatusUnauthorized)
+	})
+
+	t.Run("observations", func(t *testing.T) {
+		rec := exercise(t, open, http.MethodGet, "/observations/01310-100?limit=1", "", nil, http.StatusOK)
+		if rec.Header().Get("Link") == "" {
+			t.Error("expected a Link to the next page")
+		}
+		exercise(t, open, http.MethodGet, "/observations/01310100?from=2026-03-10&to=2026-03-11", "", nil, http.StatusOK)
+		exercise(t, open, http.MethodGet, "/observations/01310100?limit=0", "", nil, http.StatusBadRequest)
+		exercise(t, open, http.MethodGet, "/observations/0131", "", nil, http.StatusUnprocessableEntity)
+		exercise(t, protected, http.MethodGet, "/observations/01310100", "", nil, http.StatusUnauthorized)
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		exercise(t, open, http.MethodGet, "/stats?cep=01310-100&bucket=hour", "", nil, http.StatusOK)
+		exercise(t, open, http.MethodGet, "/stats?ibge=3550308", "", nil, http.StatusOK)
+		exercise(t, open, http.MethodGet, "/stats?uf=SP&bucket=month", "", nil, http.StatusBadRequest)
+		exercise(t, open, http.MethodGet, "/stats?cep=0131", "", nil, http.StatusUnprocessableEntity)
+		exercise(t, protected, http.MethodGet, "/stats?uf=SP", "", nil, http.StatusUnauthorized)
+	})
+
+	t.Run("admin prewarm", func(t *testing.T) {
+		admin := map[string]string{"Authorization": "Bearer admin-secret"}
+		job := `{"interval": "10m", "jitter": "1m", "ceps": ["01310-100"]}`
+		exercise(t, open, http.MethodPut, "/admin/prewarm/stores", job, admin, http.StatusCreated)
+		exercise(t, open, http.MethodPut, "/admin/prewarm/stores", job, admin, http.StatusOK)
+		exercise(t, open, http.MethodPut, "/admin/prewarm/stores", `{"ceps": []}`, admin, http.StatusUnprocessableEntity)
+		exercise(t, open, http.MethodGet, "/admin/prewarm", "", admin, http.StatusOK)
+		exercise(t, open, http.MethodGet, "/admin/prewarm/stores", "", admin, http.StatusOK)
+		exercise(t, open, http.MethodDelete, "/admin/prewarm/stores", "", admin, http.StatusNoContent)
+		exercise(t, open, http.MethodDelete, "/admin/prewarm/stores", "", admin, http.StatusNotFound)
+		exercise(t, open, http.MethodGet, "/admin/prewarm", "", nil, http.StatusUnauthorized)
+		exercise(t, protected, http.MethodGet, "/admin/prewarm", "", nil, http.StatusNotFound)
+	})
+
+	var missing []string
+	for template := range c.paths() {
+		if !covered[template] {
+			missing = append(missing, template)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("documented paths not exercised by the contract test: %v", missing)
+	}
+}
+
+func TestContract_DetectsDivergence(t *testing.T) {
+	c := loadContract(t)
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"renamed field", http.StatusOK, `{"temp_c": 28.5, "temp_F": 83.3, "temp_K": 301.5}`},
+		{"wrong type", http.StatusOK, `{"temp_C": "28.5", "temp_F": 83.3, "temp_K": 301.5}`},
+		{"undocumented status", http.StatusTeapot, `{"message": "teapot"}`},
+		{"undocumented error field", http.StatusNotFound, `{"message": "can not find zipcode", "code": 404}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Set("Content-Type", "application/json")
+			rec.Header().Set("ETag", `"x"`)
+			rec.Header().Set("Cache-Control", "public, max-age=0")
+			rec.WriteHeader(tt.status)
+			rec.WriteString(tt.body)
+
+			if problems := c.check(httptest.NewRequest(http.MethodGet, "/weather/01310100", nil), rec); len(problems) == 0 {
+				t.Error("expected the contract check to reject the response")
+			}
+		})
+	}
+}
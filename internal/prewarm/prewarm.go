@@ -0,0 +1,422 @@
+package prewarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// Job errors
+var (
+	ErrInvalid    = errors.New("invalid prewarm job")
+	ErrNotFound   = errors.New("prewarm job not found")
+	ErrConfigured = errors.New("prewarm job is defined in the configuration")
+)
+
+// Source tells where a job was defined
+type Source string
+
+const (
+	SourceConfig Source = "config"
+	SourceAdmin  Source = "admin"
+)
+
+// Weather refreshes the cached weather of a city
+type Weather interface {
+	Refresh(ctx context.Context, city string) (*models.WeatherAPIResponse, error)
+}
+
+// Job warms the weather of a list of CEPs on start and then on a cron schedule or
+// every interval
+type Job struct {
+	Name     string
+	Schedule string
+	Interval time.Duration
+	// Jitter is the maximum random delay added to each run; zero uses the default
+	Jitter time.Duration
+	CEPs   []string
+}
+
+// Validate checks the job and normalizes its CEPs
+func (j *Job) Validate() error {
+	if j.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if _, err := j.schedule(); err != nil {
+		return err
+	}
+	if j.Jitter < 0 {
+		return fmt.Errorf("%w: jitter must not be negative", ErrInvalid)
+	}
+	if len(j.CEPs) == 0 {
+		return fmt.Errorf("%w: at least one CEP is required", ErrInvalid)
+	}
+	for i, cep := range j.CEPs {
+		j.CEPs[i] = services.NormalizeCEP(cep)
+		if !services.ValidateCEP(j.CEPs[i]) {
+			return fmt.Errorf("%w: invalid CEP %q", ErrInvalid, cep)
+		}
+	}
+	return nil
+}
+
+func (j *Job) schedule() (cron.Schedule, error) {
+	switch {
+	case j.Schedule != "" && j.Interval != 0:
+		return nil, fmt.Errorf("%w: schedule and interval are mutually exclusive", ErrInvalid)
+	case j.Schedule != "":
+		schedule, err := cron.ParseStandard(j.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: schedule: %v", ErrInvalid, err)
+		}
+		return schedule, nil
+	case j.Interval >= time.Minute:
+		return cron.Every(j.Interval), nil
+	default:
+		return nil, fmt.Errorf("%w: schedule or an interval of at least 1m is required", ErrInvalid)
+	}
+}
+
+// Status reports a job and its last run
+type Status struct {
+	Name           string     `json:"name"`
+	Source         Source     `json:"source"`
+	Schedule       string     `json:"schedule,omitempty"`
+	Interval       string     `json:"interval,omitempty"`
+	CEPs           int        `json:"ceps"`
+	Running        bool       `json:"running"`
+	Runs           int        `json:"runs"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastDurationMS int64      `json:"last_duration_ms"`
+	// LastWarmed counts the cities refreshed by the last run and LastFailed the CEPs it could not warm
+	LastWarmed int    `json:"last_warmed"`
+	LastFailed int    `json:"last_failed"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// Settings are the defaults shared by every job
+type Settings struct {
+	// Jitter is the maximum random delay added to runs of jobs without their own
+	Jitter time.Duration
+	// Concurrency caps the simultaneous lookups of a run
+	Concurrency int
+}
+
+// Prewarmer runs the jobs that keep the weather cache hot
+type Prewarmer struct {
+	cepService services.CEPService
+	weather    Weather
+	now        func() time.Time
+
+	mu       sync.Mutex
+	settings Settings
+	ctx      context.Context
+	jobs     map[string]*runner
+}
+
+// runner is one scheduled job
+type runner struct {
+	job      Job
+	source   Source
+	schedule cron.Schedule
+	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a prewarmer resolving CEPs with cepService and refreshing their weather
+func New(cepService services.CEPService, weather Weather, settings Settings) *Prewarmer {
+	return &Prewarmer{
+		cepService: cepService,
+		weather:    weather,
+		now:        time.Now,
+		settings:   settings,
+		jobs:       make(map[string]*runner),
+	}
+}
+
+// Configure replaces the default jitter and concurrency, applied from the next run
+func (p *Prewarmer) Configure(settings Settings) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settings = settings
+}
+
+// SetConfigJobs replaces the jobs defined in the configuration. Unchanged jobs keep
+// their schedule and status; a configured job replaces an admin job of the same name.
+func (p *Prewarmer) SetConfigJobs(jobs []Job) error {
+	runners := make([]*runner, 0, len(jobs))
+	for _, job := range jobs {
+		r, err := newRunner(job, SourceConfig)
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		runners = append(runners, r)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	configured := make(map[string]bool, len(runners))
+	for _, r := range runners {
+		configured[r.job.Name] = true
+		if current, ok := p.jobs[r.job.Name]; ok {
+			if current.source == SourceConfig && reflect.DeepEqual(current.job, r.job) {
+				continue
+			}
+			current.stop()
+		}
+		p.jobs[r.job.Name] = r
+		p.start(r)
+	}
+	for name, r := range p.jobs {
+		if r.source == SourceConfig && !configured[name] {
+			r.stop()
+			delete(p.jobs, name)
+		}
+	}
+	return nil
+}
+
+// Put creates or replaces an admin job, reporting whether it was created
+func (p *Prewarmer) Put(job Job) (bool, error) {
+	r, err := newRunner(job, SourceAdmin)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current, exists := p.jobs[r.job.Name]
+	if exists {
+		if current.source == SourceConfig {
+			return false, ErrConfigured
+		}
+		current.stop()
+	}
+	p.jobs[r.job.Name] = r
+	p.start(r)
+	return !exists, nil
+}
+
+// Delete removes an admin job
+func (p *Prewarmer) Delete(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, ok := p.jobs[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if r.source == SourceConfig {
+		return ErrConfigured
+	}
+	r.stop()
+	delete(p.jobs, name)
+	return nil
+}
+
+// Status returns the status of every job, sorted by name
+func (p *Prewarmer) Status() []Status {
+	p.mu.Lock()
+	runners := make([]*runner, 0, len(p.jobs))
+	for _, r := range p.jobs {
+		runners = append(runners, r)
+	}
+	p.mu.Unlock()
+
+	statuses := make([]Status, 0, len(runners))
+	for _, r := range runners {
+		r.mu.Lock()
+		statuses = append(statuses, r.status)
+		r.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Run starts the jobs and blocks until ctx is cancelled, then stops them
+func (p *Prewarmer) Run(ctx context.Context) {
+	p.mu.Lock()
+	p.ctx = ctx
+	for _, r := range p.jobs {
+		p.start(r)
+	}
+	p.mu.Unlock()
+
+	<-ctx.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.jobs {
+		r.stop()
+	}
+}
+
+func newRunner(job Job, source Source) (*runner, error) {
+	job.CEPs = append([]string(nil), job.CEPs...)
+	if err := job.Validate(); err != nil {
+		return nil, err
+	}
+	schedule, _ := job.schedule()
+
+	status := Status{Name: job.Name, Source: source, Schedule: job.Schedule, CEPs: len(job.CEPs)}
+	if job.Interval > 0 {
+		status.Interval = job.Interval.String()
+	}
+	return &runner{job: job, source: source, schedule: schedule, status: status}, nil
+}
+
+// start launches the runner once Run has been called; p.mu must be held
+func (p *Prewarmer) start(r *runner) {
+	if p.ctx == nil || r.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(p.ctx)
+	r.cancel = cancel
+	go p.loop(ctx, r)
+}
+
+func (r *runner) stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// loop runs the job on start and then on its schedule, each run delayed by a random jitter
+func (p *Prewarmer) loop(ctx context.Context, r *runner) {
+	next := p.now()
+	for {
+		at := next.Add(p.jitter(r.job))
+		r.mu.Lock()
+		r.status.NextRunAt = &at
+		r.mu.Unlock()
+
+		timer := time.NewTimer(at.Sub(p.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		p.warm(ctx, r)
+		next = r.schedule.Next(p.now())
+	}
+}
+
+func (p *Prewarmer) jitter(job Job) time.Duration {
+	jitter := job.Jitter
+	if jitter == 0 {
+		p.mu.Lock()
+		jitter = p.settings.Jitter
+		p.mu.Unlock()
+	}
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// warm resolves the CEPs of the job and refreshes the weather of each city once
+func (p *Prewarmer) warm(ctx context.Context, r *runner) {
+	started := p.now()
+	r.mu.Lock()
+	r.status.Running = true
+	r.status.NextRunAt = nil
+	r.mu.Unlock()
+
+	p.mu.Lock()
+	concurrency := p.settings.Concurrency
+	p.mu.Unlock()
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	failed, warmed := 0, 0
+	fail := func(count int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed += count
+		errs = append(errs, err)
+	}
+
+	// Several CEPs usually share a city, which is the unit the weather is cached by
+	cities := make(map[string]int)
+	forEach(r.job.CEPs, concurrency, func(cep string) {
+		location, err := p.cepService.GetLocation(ctx, cep)
+		if err == nil && location == nil {
+			err = services.ErrCEPNotFound
+		}
+		if err != nil {
+			fail(1, fmt.Errorf("CEP %s: %w", cep, err))
+			return
+		}
+		mu.Lock()
+		cities[location.Localidade]++
+		mu.Unlock()
+	})
+
+	names := make([]string, 0, len(cities))
+	for city := range cities {
+		names = append(names, city)
+	}
+	forEach(names, concurrency, func(city string) {
+		if _, err := p.weather.Refresh(ctx, city); err != nil {
+			fail(cities[city], fmt.Errorf("city %s: %w", city, err))
+			return
+		}
+		mu.Lock()
+		warmed++
+		mu.Unlock()
+	})
+
+	finished := p.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Running = false
+	r.status.Runs++
+	r.status.LastRunAt = &started
+	r.status.LastDurationMS = finished.Sub(started).Milliseconds()
+	r.status.LastWarmed = warmed
+	r.status.LastFailed = failed
+	r.status.LastError = ""
+	if len(errs) > 0 {
+		r.status.LastError = fmt.Sprintf("%d of %d CEPs failed, first error: %v", failed, len(r.job.CEPs), errs[0])
+		log.Printf("Prewarm job %s: %s", r.job.Name, r.status.LastError)
+	}
+}
+
+// forEach calls fn for every item, at most limit at a time
+func forEach(items []string, limit int, fn func(string)) {
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(item string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(item)
+		}(item)
+	}
+	wg.Wait()
+}
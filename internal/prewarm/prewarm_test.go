@@ -0,0 +1,208 @@
+package prewarm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+type stubCEPService struct{}
+
+func (stubCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	switch cep {
+	case "99999999":
+		return nil, nil
+	case "20040020":
+		return &models.ViaCEPResponse{CEP: cep, Localidade: "Rio de Janeiro", UF: "RJ"}, nil
+	default:
+		return &models.ViaCEPResponse{CEP: cep, Localidade: "São Paulo", UF: "SP"}, nil
+	}
+}
+
+type countingWeather struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	broken string
+}
+
+func (w *countingWeather) Refresh(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.calls == nil {
+		w.calls = make(map[string]int)
+	}
+	w.calls[city]++
+	if city == w.broken {
+		return nil, errors.New("upstream unavailable")
+	}
+	return &models.WeatherAPIResponse{}, nil
+}
+
+func (w *countingWeather) count(city string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.calls[city]
+}
+
+// waitForRun waits until the job has finished at least one run and returns its status
+func waitForRun(t *testing.T, p *Prewarmer, name string) Status {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, status := range p.Status() {
+			if status.Name == name && status.Runs > 0 {
+				return status
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s never ran", name)
+	return Status{}
+}
+
+func TestJob_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     Job
+		wantErr string
+	}{
+		{"cron", Job{Name: "dcs", Schedule: "*/15 * * * *", CEPs: []string{"01310-100"}}, ""},
+		{"interval", Job{Name: "dcs", Interval: 5 * time.Minute, CEPs: []string{"01310100"}}, ""},
+		{"descriptor", Job{Name: "dcs", Schedule: "@hourly", CEPs: []string{"01310100"}}, ""},
+		{"no name", Job{Interval: time.Hour, CEPs: []string{"01310100"}}, "name"},
+		{"no schedule", Job{Name: "dcs", CEPs: []string{"01310100"}}, "schedule or an interval"},
+		{"short interval", Job{Name: "dcs", Interval: time.Second, CEPs: []string{"01310100"}}, "schedule or an interval"},
+		{"both", Job{Name: "dcs", Schedule: "@hourly", Interval: time.Hour, CEPs: []string{"01310100"}}, "mutually exclusive"},
+		{"bad cron", Job{Name: "dcs", Schedule: "every day", CEPs: []string{"01310100"}}, "schedule"},
+		{"no ceps", Job{Name: "dcs", Interval: time.Hour}, "at least one CEP"},
+		{"bad cep", Job{Name: "dcs", Interval: time.Hour, CEPs: []string{"0131"}}, "invalid CEP"},
+		{"negative jitter", Job{Name: "dcs", Interval: time.Hour, Jitter: -time.Second, CEPs: []string{"01310100"}}, "jitter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.job.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an invalid job error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPrewarmer_WarmsEachCityOnce(t *testing.T) {
+	weather := &countingWeather{broken: "Rio de Janeiro"}
+	p := New(stubCEPService{}, weather, Settings{Concurrency: 2})
+	err := p.SetConfigJobs([]Job{{
+		Name:     "dcs",
+		Interval: time.Hour,
+		CEPs:     []string{"01310-100", "01311000", "01001000", "20040020", "99999999"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	status := waitForRun(t, p, "dcs")
+	if calls := weather.count("São Paulo"); calls != 1 {
+		t.Errorf("expected one refresh for the three CEPs of São Paulo, got %d", calls)
+	}
+	if status.Source != SourceConfig || status.Interval != "1h0m0s" || status.CEPs != 5 || status.Running {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if status.LastWarmed != 1 || status.LastFailed != 2 || !strings.Contains(status.LastError, "2 of 5 CEPs failed") {
+		t.Errorf("expected 1 city warmed and 2 CEPs failed, got %+v", status)
+	}
+	if status.LastRunAt == nil || status.NextRunAt == nil || status.NextRunAt.Sub(*status.LastRunAt) < 59*time.Minute {
+		t.Errorf("expected the next run an hour after the last, got %v and %v", status.LastRunAt, status.NextRunAt)
+	}
+}
+
+func TestPrewarmer_Jobs(t *testing.T) {
+	p := New(stubCEPService{}, &countingWeather{}, Settings{Concurrency: 1})
+	configured := Job{Name: "dcs", Schedule: "0 * * * *", CEPs: []string{"01310100"}}
+	if err := p.SetConfigJobs([]Job{configured}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := p.Put(Job{Name: "dcs", Interval: time.Hour, CEPs: []string{"01310100"}}); !errors.Is(err, ErrConfigured) {
+		t.Errorf("expected ErrConfigured when replacing a configured job, got %v", err)
+	}
+	if err := p.Delete("dcs"); !errors.Is(err, ErrConfigured) {
+		t.Errorf("expected ErrConfigured when deleting a configured job, got %v", err)
+	}
+	if _, err := p.Put(Job{Name: "stores", CEPs: []string{"01310100"}}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid, got %v", err)
+	}
+
+	created, err := p.Put(Job{Name: "stores", Interval: time.Hour, CEPs: []string{"01310100"}})
+	if err != nil || !created {
+		t.Fatalf("expected the job to be created, got %v (%v)", created, err)
+	}
+	if created, _ := p.Put(Job{Name: "stores", Interval: 2 * time.Hour, CEPs: []string{"01310100"}}); created {
+		t.Error("expected the second put to replace the job")
+	}
+
+	statuses := p.Status()
+	if len(statuses) != 2 || statuses[0].Name != "dcs" || statuses[1].Source != SourceAdmin || statuses[1].Interval != "2h0m0s" {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+
+	// Reloading the configuration keeps admin jobs and drops removed configured ones
+	if err := p.SetConfigJobs(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if statuses := p.Status(); len(statuses) != 1 || statuses[0].Name != "stores" {
+		t.Errorf("unexpected statuses after reload %+v", statuses)
+	}
+	if err := p.Delete("stores"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := p.Delete("stores"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := p.SetConfigJobs([]Job{{Name: "broken", Interval: time.Hour}}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for an invalid configured job, got %v", err)
+	}
+}
+
+func TestPrewarmer_ReloadKeepsUnchangedJobs(t *testing.T) {
+	weather := &countingWeather{}
+	p := New(stubCEPService{}, weather, Settings{Concurrency: 1})
+	job := Job{Name: "dcs", Interval: time.Hour, CEPs: []string{"01310100"}}
+	p.SetConfigJobs([]Job{job})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+	waitForRun(t, p, "dcs")
+
+	// The same job is not restarted, so it does not run again on reload
+	p.SetConfigJobs([]Job{job})
+	time.Sleep(50 * time.Millisecond)
+	if calls := weather.count("São Paulo"); calls != 1 {
+		t.Errorf("expected the unchanged job to keep its schedule, got %d refreshes", calls)
+	}
+
+	// A changed job starts over
+	job.CEPs = []string{"20040020"}
+	p.SetConfigJobs([]Job{job})
+	waitForRun(t, p, "dcs")
+	if calls := weather.count("Rio de Janeiro"); calls != 1 {
+		t.Errorf("expected the changed job to run, got %d refreshes", calls)
+	}
+}
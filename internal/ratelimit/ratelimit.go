@@ -0,0 +1,264 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/render"
+)
+
+// Key strategies for identifying who a bucket belongs to
+const (
+	KeyByIP     = "ip"
+	KeyByAPIKey = "api_key"
+)
+
+// Rule is the token bucket configuration for requests under a path prefix.
+// A rule with RequestsPerSecond <= 0 leaves its routes unlimited.
+type Rule struct {
+	Prefix            string
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// Settings controls how the limiter identifies clients and which rules apply
+type Settings struct {
+	Enabled bool
+	// Default applies to paths not matched by any rule in Routes
+	Default Rule
+	Routes  []Rule
+	// KeyBy is KeyByIP or KeyByAPIKey. With KeyByAPIKey, requests are keyed by the client
+	// Identify recognizes, and by IP when it does not, so made-up keys get no bucket of their own.
+	KeyBy    string
+	Identify func(r *http.Request) (client string, ok bool)
+	// TrustedProxyHops is the number of proxies in front of the service that append
+	// to X-Forwarded-For (1 on Cloud Run). 0 uses the connection address.
+	TrustedProxyHops int
+	// IdleTimeout is how long an unused bucket is kept before being dropped
+	IdleTimeout time.Duration
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	lastSeen time.Time
+}
+
+// Limiter enforces token bucket limits per route and client
+type Limiter struct {
+	mu       sync.Mutex
+	settings Settings
+	rules    []Rule
+	buckets  map[string]*bucket
+	now      func() time.Time
+}
+
+// New creates a limiter with the given settings
+func New(settings Settings) *Limiter {
+	l := &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	l.Configure(settings)
+	return l
+}
+
+// Configure replaces the settings. Existing buckets are kept and clamped to the new
+// burst on their next use; buckets of removed routes expire with the idle cleanup.
+func (l *Limiter) Configure(settings Settings) {
+	rules := append([]Rule(nil), settings.Routes...)
+	// Longest prefix first, so the most specific rule wins
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Prefix) > len(rules[j].Prefix)
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settings = settings
+	l.rules = rules
+}
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed
+	RetryAfter time.Duration
+}
+
+// Allow takes a token for the client from the bucket of the rule matching path
+func (l *Limiter) Allow(path, client string) (Decision, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.settings.Enabled {
+		return Decision{}, false
+	}
+	rule := l.ruleFor(path)
+	if rule.RequestsPerSecond <= 0 || rule.Burst < 1 {
+		return Decision{}, false
+	}
+
+	now := l.now()
+	key := rule.Prefix + "|" + client
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+elapsed*rule.RequestsPerSecond)
+	b.last = now
+	b.lastSeen = now
+
+	decision := Decision{Limit: rule.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = secondsToDuration((1 - b.tokens) / rule.RequestsPerSecond)
+	}
+	decision.Remaining = int(math.Floor(b.tokens))
+	decision.Reset = secondsToDuration((float64(rule.Burst) - b.tokens) / rule.RequestsPerSecond)
+	return decision, true
+}
+
+func (l *Limiter) ruleFor(path string) Rule {
+	for _, rule := range l.rules {
+		if strings.HasPrefix(path, rule.Prefix) {
+			return rule
+		}
+	}
+	return l.settings.Default
+}
+
+// Cleanup drops buckets that have not been used for the idle timeout
+func (l *Limiter) Cleanup() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idle := l.settings.IdleTimeout
+	if idle <= 0 {
+		idle = 10 * time.Minute
+	}
+
+	now := l.now()
+	removed := 0
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= idle {
+			delete(l.buckets, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Size returns the number of live buckets
+func (l *Limiter) Size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// RunCleanup periodically drops idle buckets until ctx is cancelled
+func (l *Limiter) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Cleanup()
+		}
+	}
+}
+
+// Middleware answers 429 with Retry-After when the client's bucket is empty, and
+// reports the bucket state in RateLimit-Limit/Remaining/Reset headers
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, limited := l.Allow(r.URL.Path, l.clientKey(r))
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+
+		if !decision.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(decision.RetryAfter), 1)))
+			render.JSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) clientKey(r *http.Request) string {
+	l.mu.Lock()
+	settings := l.settings
+	l.mu.Unlock()
+
+	if settings.KeyBy == KeyByAPIKey && settings.Identify != nil {
+		if client, ok := settings.Identify(r); ok {
+			return "client:" + client
+		}
+	}
+	return "ip:" + ClientIP(r, settings.TrustedProxyHops)
+}
+
+// ClientIP returns the address of the client. With trustedHops > 0, it is read from
+// X-Forwarded-For, skipping the entries appended by the trusted proxies, so values
+// forged by the client itself are ignored.
+func ClientIP(r *http.Request, trustedHops int) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if trustedHops <= 0 {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	// Each trusted proxy appends the address it received the request from,
+	// so the client is trustedHops entries from the end
+	index := len(hops) - trustedHops
+	if index < 0 || index >= len(hops) {
+		return remote
+	}
+	if ip := net.ParseIP(hops[index]); ip != nil {
+		return ip.String()
+	}
+	return remote
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestLimiter(settings Settings) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(settings)
+	l.now = clock.Now
+	return l, clock
+}
+
+func defaultSettings() Settings {
+	return Settings{
+		Enabled:     true,
+		Default:     Rule{Prefix: "/", RequestsPerSecond: 1, Burst: 2},
+		KeyBy:       KeyByIP,
+		IdleTimeout: time.Minute,
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	l, clock := newTestLimiter(defaultSettings())
+
+	for i := 0; i < 2; i++ {
+		if d, _ := l.Allow("/weather/01310100", "ip:1.1.1.1"); !d.Allowed {
+			t.Fatalf("request %d: expected burst to be allowed", i)
+		}
+	}
+
+	d, limited := l.Allow("/weather/01310100", "ip:1.1.1.1")
+	if !limited || d.Allowed {
+		t.Fatalf("expected request over burst to be rejected, got %+v", d)
+	}
+	if d.RetryAfter != time.Second {
+		t.Errorf("expected retry after 1s, got %v", d.RetryAfter)
+	}
+
+	if d, _ := l.Allow("/weather/01310100", "ip:2.2.2.2"); !d.Allowed {
+		t.Error("expected other clients to have their own bucket")
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if d, _ := l.Allow("/weather/01310100", "ip:1.1.1.1"); !d.Allowed {
+		t.Error("expected a token to be refilled after 1s")
+	}
+}
+
+func TestLimiter_Routes(t *testing.T) {
+	settings := defaultSettings()
+	settings.Routes = []Rule{
+		{Prefix: "/weather/", RequestsPerSecond: 1, Burst: 1},
+		{Prefix: "/health", RequestsPerSecond: 0},
+	}
+	l, _ := newTestLimiter(settings)
+
+	l.Allow("/weather/01310100", "ip:1.1.1.1")
+	if d, _ := l.Allow("/weather/01310100", "ip:1.1.1.1"); d.Allowed {
+		t.Error("expected route rule with burst 1 to apply")
+	}
+
+	if _, limited := l.Allow("/health", "ip:1.1.1.1"); limited {
+		t.Error("expected route with 0 requests per second to be unlimited")
+	}
+
+	if d, _ := l.Allow("/", "ip:1.1.1.1"); !d.Allowed || d.Limit != 2 {
+		t.Errorf("expected default rule for unmatched paths, got %+v", d)
+	}
+}
+
+func TestLimiter_Cleanup(t *testing.T) {
+	l, clock := newTestLimiter(defaultSettings())
+
+	l.Allow("/", "ip:1.1.1.1")
+	clock.now = clock.now.Add(30 * time.Second)
+	l.Allow("/", "ip:2.2.2.2")
+	clock.now = clock.now.Add(45 * time.Second)
+
+	if removed := l.Cleanup(); removed != 1 {
+		t.Errorf("expected 1 idle bucket removed, got %d", removed)
+	}
+	if l.Size() != 1 {
+		t.Errorf("expected 1 bucket left, got %d", l.Size())
+	}
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	l, _ := newTestLimiter(defaultSettings())
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("unexpected rate limit headers: %v", rec.Header())
+	}
+
+	request()
+	rec = request()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected 0 remaining, got %q", rec.Header().Get("RateLimit-Remaining"))
+	}
+}
+
+func TestLimiter_Middleware_KeyByAPIKey(t *testing.T) {
+	settings := defaultSettings()
+	settings.KeyBy = KeyByAPIKey
+	// Only the keys of client-a and client-b are valid
+	settings.Identify = func(r *http.Request) (string, bool) {
+		switch key := r.Header.Get("X-API-Key"); key {
+		case "key-a", "key-b":
+			return "client" + strings.TrimPrefix(key, "key"), true
+		}
+		return "", false
+	}
+	settings.Default.Burst = 1
+	l, _ := newTestLimiter(settings)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(key, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/weather/01310100", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		key, ip  string
+		wantCode int
+	}{
+		{"key-a", "10.0.0.1", http.StatusOK},
+		{"key-b", "10.0.0.1", http.StatusOK},
+		{"key-a", "10.0.0.2", http.StatusTooManyRequests},
+		// Unknown keys share the bucket of their IP, however many are made up
+		{"made-up-1", "10.0.0.3", http.StatusOK},
+		{"made-up-2", "10.0.0.3", http.StatusTooManyRequests},
+		{"", "10.0.0.3", http.StatusTooManyRequests},
+		{"made-up-3", "10.0.0.4", http.StatusOK},
+	}
+	for i, tt := range tests {
+		if code := request(tt.key, tt.ip); code != tt.wantCode {
+			t.Errorf("request %d (key %q from %s): expected %d, got %d", i, tt.key, tt.ip, tt.wantCode, code)
+		}
+	}
+	if size := l.Size(); size != 4 {
+		t.Errorf("expected buckets for 2 clients and 2 IPs, got %d", size)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		forwardedFor []string
+		trustedHops  int
+		expectedIP   string
+	}{
+		{
+			name:         "no trusted proxies ignores header",
+			forwardedFor: []string{"1.2.3.4"},
+			trustedHops:  0,
+			expectedIP:   "10.0.0.1",
+		},
+		{
+			name:         "one trusted proxy",
+			forwardedFor: []string{"6.6.6.6, 1.2.3.4"},
+			trustedHops:  1,
+			expectedIP:   "1.2.3.4",
+		},
+		{
+			name:         "two trusted proxies across headers",
+			forwardedFor: []string{"6.6.6.6, 1.2.3.4", "35.191.0.1"},
+			trustedHops:  2,
+			expectedIP:   "1.2.3.4",
+		},
+		{
+			name:         "fewer hops than trusted falls back to remote address",
+			forwardedFor: nil,
+			trustedHops:  1,
+			expectedIP:   "10.0.0.1",
+		},
+		{
+			name:         "invalid entry falls back to remote address",
+			forwardedFor: []string{"not-an-ip"},
+			trustedHops:  1,
+			expectedIP:   "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := ClientIP(req, tt.trustedHops); got != tt.expectedIP {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.expectedIP)
+			}
+		})
+	}
+}
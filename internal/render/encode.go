@@ -0,0 +1,348 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Texter is implemented by values with a human-readable one-line representation
+type Texter interface {
+	Text() string
+}
+
+// CSVer is implemented by values whose CSV rows differ from their JSON form, e.g. to
+// round numbers to a readable precision
+type CSVer interface {
+	CSV() interface{}
+}
+
+// xmlRoot and xmlItem name the document element and the elements of arrays
+const (
+	xmlRoot = "response"
+	xmlItem = "item"
+)
+
+// node is a JSON value that keeps the order of object keys, so every format lists
+// fields in the order of the Go struct
+type node struct {
+	keys   []string
+	fields map[string]*node
+	items  []*node
+	array  bool
+	scalar string
+	raw    string
+	null   bool
+}
+
+func (n *node) object() bool {
+	return n.fields != nil
+}
+
+// toTree marshals v to JSON and parses it back as an ordered tree
+func toTree(v interface{}) (*node, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return parseNode(decoder)
+}
+
+func parseNode(decoder *json.Decoder) (*node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			n := &node{array: true}
+			for decoder.More() {
+				item, err := parseNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, item)
+			}
+			_, err := decoder.Token()
+			return n, err
+		}
+		n := &node{fields: make(map[string]*node)}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key.(string))
+			n.fields[key.(string)] = value
+		}
+		_, err := decoder.Token()
+		return n, err
+	case nil:
+		return &node{null: true}, nil
+	case string:
+		raw, _ := json.Marshal(t)
+		return &node{scalar: t, raw: string(raw)}, nil
+	default:
+		return &node{scalar: fmt.Sprint(t), raw: fmt.Sprint(t)}, nil
+	}
+}
+
+func encodeXML(v interface{}) ([]byte, error) {
+	tree, err := toTree(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := writeXMLElement(encoder, xmlRoot, tree); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(encoder *xml.Encoder, name string, n *node) error {
+	if n.null {
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch {
+	case n.object():
+		for _, key := range n.keys {
+			if err := writeXMLElement(encoder, key, n.fields[key]); err != nil {
+				return err
+			}
+		}
+	case n.array:
+		for _, item := range n.items {
+			if err := writeXMLElement(encoder, xmlItem, item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := encoder.EncodeToken(xml.CharData(n.scalar)); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlName turns a JSON key into a valid XML element name
+func xmlName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "" || !unicode.IsLetter(rune(name[0])) && name[0] != '_' {
+		name = "_" + name
+	}
+	return name
+}
+
+// encodeCSV writes one row per array element (or a single row for an object), with
+// nested fields flattened into dotted column names such as location.city
+func encodeCSV(v interface{}) ([]byte, error) {
+	if c, ok := v.(CSVer); ok {
+		v = c.CSV()
+	}
+	tree, err := toTree(v)
+	if err != nil {
+		return nil, err
+	}
+	columns, rows := table(tree)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// table flattens the tree into rows, returning the union of columns in first-seen order
+func table(tree *node) ([]string, []map[string]string) {
+	records := []*node{tree}
+	if tree.array {
+		records = tree.items
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	rows := make([]map[string]string, 0, len(records))
+	for _, record := range records {
+		row := make(map[string]string)
+		var keys []string
+		flatten("", record, row, &keys)
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+func flatten(prefix string, n *node, row map[string]string, keys *[]string) {
+	switch {
+	case n.object():
+		for _, key := range n.keys {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flatten(name, n.fields[key], row, keys)
+		}
+	case n.array:
+		// Nested lists don't fit in columns, keep them as JSON in a single cell
+		set(prefix, n.json(), row, keys)
+	case n.null:
+		set(prefix, "", row, keys)
+	default:
+		if prefix == "" {
+			prefix = "value"
+		}
+		set(prefix, n.scalar, row, keys)
+	}
+}
+
+// json re-encodes the node as compact JSON
+func (n *node) json() string {
+	switch {
+	case n.null:
+		return "null"
+	case n.object():
+		parts := make([]string, len(n.keys))
+		for i, key := range n.keys {
+			name, _ := json.Marshal(key)
+			parts[i] = string(name) + ":" + n.fields[key].json()
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case n.array:
+		parts := make([]string, len(n.items))
+		for i, item := range n.items {
+			parts[i] = item.json()
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	default:
+		return n.raw
+	}
+}
+
+func set(key, value string, row map[string]string, keys *[]string) {
+	if _, ok := row[key]; !ok {
+		*keys = append(*keys, key)
+	}
+	row[key] = value
+}
+
+// encodeYAML renders v with the JSON field names, in block style
+func encodeYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML, so parsing it keeps key order and scalar types
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
+
+// encodeText uses the value's Text method, or lists the flattened fields as key: value lines
+func encodeText(v interface{}) ([]byte, error) {
+	if texter, ok := v.(Texter); ok {
+		return []byte(texter.Text() + "\n"), nil
+	}
+	if lines, ok := textLines(v); ok {
+		return []byte(strings.Join(lines, "\n") + "\n"), nil
+	}
+
+	tree, err := toTree(v)
+	if err != nil {
+		return nil, err
+	}
+	columns, rows := table(tree)
+
+	var buf bytes.Buffer
+	for i, row := range rows {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		for _, column := range columns {
+			if value, ok := row[column]; ok {
+				fmt.Fprintf(&buf, "%s: %s\n", column, value)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// textLines returns one line per element when v is a slice of Texters
+func textLines(v interface{}) ([]string, bool) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice || value.Len() == 0 {
+		return nil, false
+	}
+	lines := make([]string, value.Len())
+	for i := range lines {
+		texter, ok := value.Index(i).Interface().(Texter)
+		if !ok {
+			return nil, false
+		}
+		lines[i] = texter.Text()
+	}
+	return lines, true
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+func sampleV2() models.WeatherResponseV2 {
+	return models.WeatherResponseV2{
+		Location:    models.LocationV2{CEP: "01310-100", City: "São Paulo", State: "SP"},
+		Temperature: models.TemperatureV2{Celsius: 25.5, Fahrenheit: 77.9, Kelvin: 298.5},
+		Units:       models.TemperatureUnits,
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		value    interface{}
+		expected string
+	}{
+		{
+			name:     "json",
+			format:   FormatJSON,
+			value:    models.WeatherResponse{TempC: 25.5, TempF: 77.9, TempK: 298.5},
+			expected: "{\"temp_C\":25.5,\"temp_F\":77.9,\"temp_K\":298.5}\n",
+		},
+		{
+			name:   "xml",
+			format: FormatXML,
+			value:  models.WeatherResponse{TempC: 25.5, TempF: 77.9, TempK: 298.5},
+			expected: `<?xml version="1.0" encoding="UTF-8"?>
+<response>
+  <temp_C>25.5</temp_C>
+  <temp_F>77.9</temp_F>
+  <temp_K>298.5</temp_K>
+</response>
+`,
+		},
+		{
+			name:   "xml escapes and lists",
+			format: FormatXML,
+			value:  []models.ErrorResponse{{Message: "a < b"}},
+			expected: `<?xml version="1.0" encoding="UTF-8"?>
+<response>
+  <item>
+    <message>a &lt; b</message>
+  </item>
+</response>
+`,
+		},
+		{
+			name:     "csv object",
+			format:   FormatCSV,
+			value:    sampleV2(),
+			expected: "location.cep,location.city,location.state,temperature.celsius,temperature.fahrenheit,temperature.kelvin,units.celsius,units.fahrenheit,units.kelvin\n01310-100,São Paulo,SP,25.5,77.9,298.5,°C,°F,K\n",
+		},
+		{
+			name:     "csv rounds temperatures",
+			format:   FormatCSV,
+			value:    models.WeatherResponse{TempC: 28.5, TempF: 83.30000000000001, TempK: 301},
+			expected: "temp_C,temp_F,temp_K\n28.5,83.3,301.0\n",
+		},
+		{
+			name:   "csv rows",
+			format: FormatCSV,
+			value: []map[string]interface{}{
+				{"cep": "01310-100", "temp_C": 25.5},
+				{"cep": "99999999", "error": "can not find zipcode, sorry"},
+			},
+			expected: "cep,temp_C,error\n01310-100,25.5,\n99999999,,\"can not find zipcode, sorry\"\n",
+		},
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			value:  sampleV2(),
+			expected: `location:
+  cep: 01310-100
+  city: São Paulo
+  state: SP
+temperature:
+  celsius: 25.5
+  fahrenheit: 77.9
+  kelvin: 298.5
+units:
+  celsius: °C
+  fahrenheit: °F
+  kelvin: K
+`,
+		},
+		{
+			name:     "text",
+			format:   FormatText,
+			value:    sampleV2(),
+			expected: "São Paulo/SP: 25.5°C / 77.9°F / 298.5K\n",
+		},
+		{
+			name:     "text list",
+			format:   FormatText,
+			value:    []models.ErrorResponse{{Message: "first"}, {Message: "second"}},
+			expected: "first\nsecond\n",
+		},
+		{
+			name:     "text fallback",
+			format:   FormatText,
+			value:    map[string]interface{}{"strategy": "round_robin"},
+			expected: "strategy: round_robin\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.format, tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+// Format is a response representation supported by the renderer
+type Format string
+
+// Supported formats, selectable with ?format= or the Accept header
+const (
+	FormatJSON Format = "json"
+	FormatXML  Format = "xml"
+	FormatCSV  Format = "csv"
+	FormatYAML Format = "yaml"
+	FormatText Format = "text"
+)
+
+// ErrNotAcceptable means none of the formats asked for by the client is supported
+var ErrNotAcceptable = errors.New("not acceptable")
+
+// formats lists the supported formats in order of preference for wildcard Accept ranges
+var formats = []Format{FormatJSON, FormatXML, FormatYAML, FormatText, FormatCSV}
+
+// mediaTypes maps every accepted media type to its format
+var mediaTypes = map[string]Format{
+	"application/json":   FormatJSON,
+	"application/xml":    FormatXML,
+	"text/xml":           FormatXML,
+	"text/csv":           FormatCSV,
+	"application/yaml":   FormatYAML,
+	"application/x-yaml": FormatYAML,
+	"text/yaml":          FormatYAML,
+	"text/plain":         FormatText,
+}
+
+// ContentType returns the Content-Type header value of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatXML:
+		return "application/xml; charset=utf-8"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatYAML:
+		return "application/yaml; charset=utf-8"
+	case FormatText:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Negotiate picks the response format from the format query parameter or, when it is
+// absent, the Accept header. JSON is used when the client expresses no preference.
+func Negotiate(r *http.Request) (Format, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		name = strings.ToLower(name)
+		if name == "txt" {
+			name = string(FormatText)
+		}
+		for _, f := range formats {
+			if string(f) == name {
+				return f, nil
+			}
+		}
+		return "", ErrNotAcceptable
+	}
+	return negotiateAccept(r.Header.Get("Accept"))
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func negotiateAccept(accept string) (Format, error) {
+	if strings.TrimSpace(accept) == "" {
+		return FormatJSON, nil
+	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	// Highest q first; on ties the more specific range wins
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	for _, ar := range ranges {
+		if f, ok := mediaTypes[ar.mediaType]; ok {
+			return f, nil
+		}
+		prefix, wildcard := strings.CutSuffix(ar.mediaType, "/*")
+		if !wildcard {
+			continue
+		}
+		for _, f := range formats {
+			if prefix == "*" || strings.HasPrefix(f.ContentType(), prefix+"/") {
+				return f, nil
+			}
+		}
+	}
+	return "", ErrNotAcceptable
+}
+
+// Encode renders v in the given format. Field names follow the JSON tags of v in every format.
+func Encode(f Format, v interface{}) ([]byte, error) {
+	switch f {
+	case FormatXML:
+		return encodeXML(v)
+	case FormatCSV:
+		return encodeCSV(v)
+	case FormatYAML:
+		return encodeYAML(v)
+	case FormatText:
+		return encodeText(v)
+	default:
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// Write negotiates the format, then writes v with the status code. It answers
+// 406 Not Acceptable, in JSON, when no supported format is acceptable.
+func Write(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}) {
+	f, ok := Acceptable(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := Encode(f, v)
+	if err != nil {
+		log.Printf("Error rendering %s response: %v", f, err)
+		f, statusCode = FormatJSON, http.StatusInternalServerError
+		body, _ = Encode(f, models.ErrorResponse{Message: "internal server error"})
+	}
+
+	w.Header().Set("Content-Type", f.ContentType())
+	w.WriteHeader(statusCode)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// Error writes an ErrorResponse in the negotiated format
+func Error(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	Write(w, r, statusCode, models.ErrorResponse{Message: message})
+}
+
+// JSON writes v as JSON whatever the Accept header says, for responses outside format
+// negotiation: middleware errors, event streams and GraphQL
+func JSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", FormatJSON.ContentType())
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+// JSONError writes an ErrorResponse as JSON whatever the Accept header says
+func JSONError(w http.ResponseWriter, statusCode int, message string) {
+	JSON(w, statusCode, models.ErrorResponse{Message: message})
+}
+
+// Acceptable negotiates the format and adds Vary: Accept. When nothing acceptable is
+// supported it writes the 406 response and returns false, so handlers can bail out
+// before doing any work.
+func Acceptable(w http.ResponseWriter, r *http.Request) (Format, bool) {
+	addVary(w.Header(), "Accept")
+
+	f, err := Negotiate(r)
+	if err != nil {
+		body, _ := Encode(FormatJSON, models.ErrorResponse{
+			Message: "not acceptable, supported formats: json, xml, csv, yaml, text",
+		})
+		w.Header().Set("Content-Type", FormatJSON.ContentType())
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write(body)
+		return "", false
+	}
+	return f, true
+}
+
+// addVary adds a field to Vary unless an earlier negotiation already did
+func addVary(h http.Header, field string) {
+	for _, value := range h.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		accept   string
+		expected Format
+		wantErr  bool
+	}{
+		{name: "no preference", expected: FormatJSON},
+		{name: "browser default", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expected: FormatXML},
+		{name: "any", accept: "*/*", expected: FormatJSON},
+		{name: "csv", accept: "text/csv", expected: FormatCSV},
+		{name: "legacy xml", accept: "text/xml", expected: FormatXML},
+		{name: "yaml", accept: "application/x-yaml", expected: FormatYAML},
+		{name: "plain text", accept: "text/plain", expected: FormatText},
+		{name: "text wildcard", accept: "text/*", expected: FormatText},
+		{name: "q-values", accept: "application/json;q=0.5, text/csv", expected: FormatCSV},
+		{name: "specific range wins ties", accept: "*/*, text/csv", expected: FormatCSV},
+		{name: "format parameter overrides accept", query: "format=yaml", accept: "application/json", expected: FormatYAML},
+		{name: "txt alias", query: "format=TXT", expected: FormatText},
+		{name: "unsupported accept", accept: "application/pdf", wantErr: true},
+		{name: "refused json", accept: "application/json;q=0", wantErr: true},
+		{name: "unsupported format parameter", query: "format=pdf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/weather/01310100?"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			got, err := Negotiate(req)
+			if tt.wantErr {
+				if err != ErrNotAcceptable {
+					t.Fatalf("expected ErrNotAcceptable, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("expected %q, got %q (err %v)", tt.expected, got, err)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/weather/01310100", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec := httptest.NewRecorder()
+
+	Error(rec, req, http.StatusNotFound, "can not find zipcode")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected Content-Type %q", got)
+	}
+	if got := rec.Body.String(); got != "can not find zipcode\n" {
+		t.Errorf("unexpected body %q", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("expected Vary: Accept, got %q", got)
+	}
+}
+
+func TestWrite_NotAcceptable(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/weather/01310100", nil)
+	req.Header.Set("Accept", "application/pdf")
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, http.StatusOK, models.WeatherResponse{TempC: 20})
+
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected status 406, got %d", rec.Code)
+	}
+	var response models.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("expected a JSON error body: %v", err)
+	}
+	if response.Message == "" {
+		t.Error("expected an error message")
+	}
+}
+
+func TestAcceptable_VaryOnce(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	Acceptable(rec, req)
+	Acceptable(rec, req)
+
+	if got := rec.Header().Values("Vary"); len(got) != 1 {
+		t.Errorf("expected a single Vary value, got %v", got)
+	}
+}
+
+func TestJSONError_IgnoresAccept(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	JSONError(rec, http.StatusTooManyRequests, "rate limit exceeded")
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != FormatJSON.ContentType() {
+		t.Errorf("expected Content-Type %q, got %q", FormatJSON.ContentType(), ct)
+	}
+	if body := rec.Body.String(); body != "{\"message\":\"rate limit exceeded\"}\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
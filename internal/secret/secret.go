@@ -0,0 +1,13 @@
+// Package secret masks API keys and tokens before they are logged or reported
+package secret
+
+// Mask hides a secret, keeping only its last characters when it is long enough to stay unguessable
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 12 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
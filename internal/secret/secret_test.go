@@ -0,0 +1,20 @@
+package secret
+
+import "testing"
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		secret   string
+		expected string
+	}{
+		{"", ""},
+		{"short", "****"},
+		{"abcdefghijkl1234", "****1234"},
+	}
+
+	for _, tt := range tests {
+		if got := Mask(tt.secret); got != tt.expected {
+			t.Errorf("Mask(%q) = %q, want %q", tt.secret, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+const (
+	// maxCacheEntries bounds each cache; when full, an insert evicts an arbitrary entry
+	maxCacheEntries = 100_000
+	// minSweepInterval is the fewest inserts between two scans for expired entries
+	minSweepInterval = 1024
+)
+
+type cacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// ttlCache is a small concurrency-safe in-memory cache with per-entry expiration
+type ttlCache[V any] struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	entries    map[string]cacheEntry[V]
+	maxEntries int
+	// inserts counts the new keys since the last sweep of expired entries
+	inserts int
+	now     func() time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:        ttl,
+		entries:    make(map[string]cacheEntry[V]),
+		maxEntries: maxCacheEntries,
+		now:        time.Now,
+	}
+}
+
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || c.now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *ttlCache[V]) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl = ttl
+	if ttl <= 0 {
+		c.entries = make(map[string]cacheEntry[V])
+	}
+}
+
+func (c *ttlCache[V]) set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return
+	}
+
+	now := c.now()
+	if _, ok := c.entries[key]; !ok {
+		// Sweeping once per as many inserts as there are entries keeps inserts O(1) on average
+		c.inserts++
+		if c.inserts >= max(minSweepInterval, len(c.entries)) {
+			c.sweep(now)
+		}
+		if len(c.entries) >= c.maxEntries {
+			for k := range c.entries {
+				delete(c.entries, k)
+				break
+			}
+		}
+	}
+	c.entries[key] = cacheEntry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// sweep drops the expired entries; callers hold c.mu
+func (c *ttlCache[V]) sweep(now time.Time) {
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.inserts = 0
+}
+
+// CachedCEPService caches CEP lookups, including "not found" answers
+type CachedCEPService struct {
+	next  CEPService
+	cache *ttlCache[*models.ViaCEPResponse]
+}
+
+// NewCachedCEPService wraps a CEP service with a TTL cache (ttl <= 0 disables caching)
+func NewCachedCEPService(next CEPService, ttl time.Duration) *CachedCEPService {
+	return &CachedCEPService{
+		next:  next,
+		cache: newTTLCache[*models.ViaCEPResponse](ttl),
+	}
+}
+
+// GetLocation returns the cached location for the CEP or fetches it
+func (s *CachedCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	if location, ok := s.cache.get(cep); ok {
+		return location, nil
+	}
+
+	location, err := s.next.GetLocation(ctx, cep)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.set(cep, location)
+	return location, nil
+}
+
+// SetTTL changes the TTL used for new entries; a TTL <= 0 also drops cached entries
+func (s *CachedCEPService) SetTTL(ttl time.Duration) {
+	s.cache.setTTL(ttl)
+}
+
+// CachedWeatherService caches weather lookups per city
+type CachedWeatherService struct {
+	next  WeatherServiceInterface
+	cache *ttlCache[*models.WeatherAPIResponse]
+}
+
+// NewCachedWeatherService wraps a weather service with a TTL cache (ttl <= 0 disables caching)
+func NewCachedWeatherService(next WeatherServiceInterface, ttl time.Duration) *CachedWeatherService {
+	return &CachedWeatherService{
+		next:  next,
+		cache: newTTLCache[*models.WeatherAPIResponse](ttl),
+	}
+}
+
+// GetTemperature returns the cached temperature for the city or fetches it
+func (s *CachedWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	if weather, ok := s.cache.get(city); ok {
+		return weather, nil
+	}
+
+	weather, err := s.next.GetTemperature(ctx, city)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.set(city, weather)
+	return weather, nil
+}
+
+// Refresh fetches the temperature for the city even if it is cached, replacing the cached entry
+func (s *CachedWeatherService) Refresh(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	weather, err := s.next.GetTemperature(ctx, city)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.set(city, weather)
+	return weather, nil
+}
+
+// SetTTL changes the TTL used for new entries; a TTL <= 0 also drops cached entries
+func (s *CachedWeatherService) SetTTL(ttl time.Duration) {
+	s.cache.setTTL(ttl)
+}
+
+// CachedForecastService caches forecast lookups per city and number of days
+type CachedForecastService struct {
+	next  ForecastService
+	cache *ttlCache[*models.WeatherAPIForecastResponse]
+}
+
+// NewCachedForecastService wraps a forecast service with a TTL cache (ttl <= 0 disables caching)
+func NewCachedForecastService(next ForecastService, ttl time.Duration) *CachedForecastService {
+	return &CachedForecastService{
+		next:  next,
+		cache: newTTLCache[*models.WeatherAPIForecastResponse](ttl),
+	}
+}
+
+// GetForecast returns the cached forecast for the city or fetches it
+func (s *CachedForecastService) GetForecast(ctx context.Context, city string, days int) (*models.WeatherAPIForecastResponse, error) {
+	key := fmt.Sprintf("%s|%d", city, days)
+	if forecast, ok := s.cache.get(key); ok {
+		return forecast, nil
+	}
+
+	forecast, err := s.next.GetForecast(ctx, city, days)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.set(key, forecast)
+	return forecast, nil
+}
+
+// SetTTL changes the TTL used for new entries; a TTL <= 0 also drops cached entries
+func (s *CachedForecastService) SetTTL(ttl time.Duration) {
+	s.cache.setTTL(ttl)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+type countingCEPService struct {
+	calls    int
+	location *models.ViaCEPResponse
+}
+
+func (s *countingCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	s.calls++
+	return s.location, nil
+}
+
+type countingWeatherService struct {
+	calls int
+}
+
+func (s *countingWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	s.calls++
+	resp := &models.WeatherAPIResponse{}
+	resp.Current.TempC = 20
+	return resp, nil
+}
+
+func TestCachedCEPService_GetLocation(t *testing.T) {
+	t.Run("caches found and not found lookups", func(t *testing.T) {
+		next := &countingCEPService{}
+		cached := NewCachedCEPService(next, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			location, err := cached.GetLocation(context.Background(), "99999999")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if location != nil {
+				t.Errorf("expected nil location, got %+v", location)
+			}
+		}
+
+		if next.calls != 1 {
+			t.Errorf("expected 1 upstream call, got %d", next.calls)
+		}
+	})
+
+	t.Run("expired entries are fetched again", func(t *testing.T) {
+		next := &countingCEPService{location: &models.ViaCEPResponse{Localidade: "São Paulo"}}
+		cached := NewCachedCEPService(next, time.Minute)
+
+		now := time.Now()
+		cached.cache.now = func() time.Time { return now }
+		cached.GetLocation(context.Background(), "01310100")
+
+		now = now.Add(2 * time.Minute)
+		cached.GetLocation(context.Background(), "01310100")
+
+		if next.calls != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", next.calls)
+		}
+	})
+}
+
+type countingForecastService struct {
+	calls int
+}
+
+func (s *countingForecastService) GetForecast(ctx context.Context, city string, days int) (*models.WeatherAPIForecastResponse, error) {
+	s.calls++
+	return &models.WeatherAPIForecastResponse{}, nil
+}
+
+func TestCachedWeatherService_GetTemperature(t *testing.T) {
+	t.Run("caches per city", func(t *testing.T) {
+		next := &countingWeatherService{}
+		cached := NewCachedWeatherService(next, time.Minute)
+
+		cached.GetTemperature(context.Background(), "São Paulo")
+		cached.GetTemperature(context.Background(), "São Paulo")
+		cached.GetTemperature(context.Background(), "Campinas")
+
+		if next.calls != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", next.calls)
+		}
+	})
+
+	t.Run("zero ttl disables caching", func(t *testing.T) {
+		next := &countingWeatherService{}
+		cached := NewCachedWeatherService(next, 0)
+
+		cached.GetTemperature(context.Background(), "São Paulo")
+		cached.GetTemperature(context.Background(), "São Paulo")
+
+		if next.calls != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", next.calls)
+		}
+	})
+
+	t.Run("refresh bypasses and refills the cache", func(t *testing.T) {
+		next := &countingWeatherService{}
+		cached := NewCachedWeatherService(next, time.Minute)
+
+		cached.GetTemperature(context.Background(), "São Paulo")
+		cached.Refresh(context.Background(), "São Paulo")
+		cached.GetTemperature(context.Background(), "São Paulo")
+
+		if next.calls != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", next.calls)
+		}
+	})
+}
+
+func TestCachedForecastService_GetForecast(t *testing.T) {
+	next := &countingForecastService{}
+	cached := NewCachedForecastService(next, time.Minute)
+
+	cached.GetForecast(context.Background(), "São Paulo", 3)
+	cached.GetForecast(context.Background(), "São Paulo", 3)
+	cached.GetForecast(context.Background(), "São Paulo", 5)
+
+	if next.calls != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", next.calls)
+	}
+}
+
+func TestTTLCache_Bounds(t *testing.T) {
+	cache := newTTLCache[int](time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	// Expired entries are swept after enough inserts, not on every insert
+	for i := 0; i < minSweepInterval-1; i++ {
+		cache.set(fmt.Sprintf("old-%d", i), i)
+	}
+	now = now.Add(2 * time.Minute)
+	cache.set("new-0", 0)
+	if len(cache.entries) != 1 {
+		t.Errorf("expected the expired entries to be swept, got %d entries", len(cache.entries))
+	}
+
+	cache.maxEntries = 10
+	for i := 1; i < 50; i++ {
+		cache.set(fmt.Sprintf("new-%d", i), i)
+	}
+	if len(cache.entries) != 10 {
+		t.Errorf("expected the cache to hold at most 10 entries, got %d", len(cache.entries))
+	}
+	if v, ok := cache.get("new-49"); !ok || v != 49 {
+		t.Errorf("expected the last entry to be cached, got %d, %t", v, ok)
+	}
+	cache.set("new-49", 50)
+	if len(cache.entries) != 10 {
+		t.Errorf("expected updating an entry to evict nothing, got %d entries", len(cache.entries))
+	}
+}
@@ -18,6 +18,11 @@ type WeatherServiceInterface interface {
 	GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error)
 }
 
+// ForecastService defines the interface for daily forecast lookups
+type ForecastService interface {
+	GetForecast(ctx context.Context, city string, days int) (*models.WeatherAPIForecastResponse, error)
+}
+
 // NewViaCEPServiceWithClient creates a new ViaCEP service with custom base URL and client
 func NewViaCEPServiceWithClient(baseURL string, client *http.Client) *ViaCEPService {
 	if client == nil {
@@ -36,7 +41,7 @@ func NewWeatherServiceWithClient(baseURL, apiKey string, client *http.Client) *W
 	}
 	return &WeatherService{
 		baseURL:    baseURL,
-		apiKey:     apiKey,
+		keys:       NewKeyPool([]string{apiKey}, KeyStrategyRoundRobin, 0),
 		httpClient: client,
 	}
 }
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/secret"
+)
+
+// KeyStrategy selects which API key of a pool serves the next request
+type KeyStrategy string
+
+// Supported key selection strategies
+const (
+	KeyStrategyRoundRobin KeyStrategy = "round_robin"
+	KeyStrategyLeastUsed  KeyStrategy = "least_used"
+)
+
+// ErrNoAPIKeyAvailable is returned when every key of the pool is out of rotation
+var ErrNoAPIKeyAvailable = errors.New("no weather API key available")
+
+// KeyStatus is a snapshot of one pooled key, safe to expose (the key itself is masked)
+type KeyStatus struct {
+	Key            string     `json:"key"`
+	Enabled        bool       `json:"enabled"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	DisabledUntil  *time.Time `json:"disabled_until,omitempty"`
+	MonthlyUsage   int        `json:"monthly_usage"`
+	TotalRequests  int        `json:"total_requests"`
+	TotalFailures  int        `json:"total_failures"`
+	LastUsed       *time.Time `json:"last_used,omitempty"`
+}
+
+// KeyPoolStatus is a snapshot of the whole pool
+type KeyPoolStatus struct {
+	Strategy     KeyStrategy `json:"strategy"`
+	MonthlyQuota int         `json:"monthly_quota"`
+	Keys         []KeyStatus `json:"keys"`
+}
+
+type pooledKey struct {
+	value          string
+	monthlyUsage   int
+	usageMonth     time.Month
+	usageYear      int
+	totalRequests  int
+	totalFailures  int
+	lastUsed       time.Time
+	disabledReason string
+	// disabledUntil is zero while the key is in rotation
+	disabledUntil time.Time
+}
+
+// KeyPool spreads requests across several API keys and tracks their usage
+type KeyPool struct {
+	mu           sync.Mutex
+	keys         []*pooledKey
+	strategy     KeyStrategy
+	monthlyQuota int
+	next         int
+	now          func() time.Time
+}
+
+// NewKeyPool creates a key pool; monthlyQuota <= 0 means keys have no local quota
+func NewKeyPool(keys []string, strategy KeyStrategy, monthlyQuota int) *KeyPool {
+	p := &KeyPool{now: time.Now}
+	p.SetKeys(keys, strategy, monthlyQuota)
+	return p
+}
+
+// SetKeys replaces the pool contents. Keys that stay in the pool keep their usage and
+// status, except keys disabled for being rejected upstream, which get another chance.
+func (p *KeyPool) SetKeys(keys []string, strategy KeyStrategy, monthlyQuota int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*pooledKey, len(p.keys))
+	for _, k := range p.keys {
+		existing[k.value] = k
+	}
+
+	pooled := make([]*pooledKey, 0, len(keys))
+	for _, value := range keys {
+		k, ok := existing[value]
+		if !ok {
+			k = &pooledKey{value: value}
+		} else if k.disabledReason == disabledRejected {
+			k.disabledReason = ""
+			k.disabledUntil = time.Time{}
+		}
+		pooled = append(pooled, k)
+	}
+
+	p.keys = pooled
+	p.strategy = strategy
+	p.monthlyQuota = monthlyQuota
+	p.next = 0
+}
+
+// Acquire picks the key for the next request and counts it as used
+func (p *KeyPool) Acquire() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var available []*pooledKey
+	for _, k := range p.keys {
+		p.refresh(k, now)
+		if k.disabledUntil.IsZero() {
+			available = append(available, k)
+		}
+	}
+	if len(available) == 0 {
+		return "", ErrNoAPIKeyAvailable
+	}
+
+	var chosen *pooledKey
+	switch p.strategy {
+	case KeyStrategyLeastUsed:
+		for _, k := range available {
+			if chosen == nil || k.monthlyUsage < chosen.monthlyUsage {
+				chosen = k
+			}
+		}
+	default:
+		chosen = available[p.next%len(available)]
+		p.next++
+	}
+
+	chosen.monthlyUsage++
+	chosen.totalRequests++
+	chosen.lastUsed = now
+	if p.monthlyQuota > 0 && chosen.monthlyUsage >= p.monthlyQuota {
+		p.disable(chosen, disabledQuota, startOfNextMonth(now))
+	}
+	return chosen.value, nil
+}
+
+// Reasons a key is taken out of rotation
+const (
+	disabledRejected = "rejected by provider"
+	disabledQuota    = "monthly quota exceeded"
+)
+
+// RejectedCooldown is how long a key refused by the provider stays out of rotation
+// before it is tried again; reloading the configuration brings it back sooner
+const RejectedCooldown = time.Hour
+
+// ReportRejected takes a key out of rotation for RejectedCooldown after the provider refused it (401/403)
+func (p *KeyPool) ReportRejected(key string) {
+	p.report(key, disabledRejected, p.now().Add(RejectedCooldown))
+}
+
+// ReportQuotaExceeded takes a key out of rotation until its monthly quota resets
+func (p *KeyPool) ReportQuotaExceeded(key string) {
+	p.report(key, disabledQuota, startOfNextMonth(p.now()))
+}
+
+func (p *KeyPool) report(key, reason string, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, k := range p.keys {
+		if k.value == key {
+			k.totalFailures++
+			p.disable(k, reason, until)
+			return
+		}
+	}
+}
+
+func (p *KeyPool) disable(k *pooledKey, reason string, until time.Time) {
+	k.disabledReason = reason
+	k.disabledUntil = until
+}
+
+// refresh resets monthly usage when a new month starts and re-enables keys whose ban expired
+func (p *KeyPool) refresh(k *pooledKey, now time.Time) {
+	year, month, _ := now.UTC().Date()
+	if k.usageYear != year || k.usageMonth != month {
+		k.usageYear, k.usageMonth = year, month
+		k.monthlyUsage = 0
+	}
+	if !k.disabledUntil.IsZero() && !now.Before(k.disabledUntil) {
+		k.disabledReason = ""
+		k.disabledUntil = time.Time{}
+	}
+}
+
+// Size returns the number of keys in the pool, in rotation or not
+func (p *KeyPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.keys)
+}
+
+// Status returns a snapshot of the pool with masked keys
+func (p *KeyPool) Status() KeyPoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	status := KeyPoolStatus{
+		Strategy:     p.strategy,
+		MonthlyQuota: p.monthlyQuota,
+		Keys:         make([]KeyStatus, 0, len(p.keys)),
+	}
+	for _, k := range p.keys {
+		p.refresh(k, now)
+		ks := KeyStatus{
+			Key:            secret.Mask(k.value),
+			Enabled:        k.disabledUntil.IsZero(),
+			DisabledReason: k.disabledReason,
+			MonthlyUsage:   k.monthlyUsage,
+			TotalRequests:  k.totalRequests,
+			TotalFailures:  k.totalFailures,
+		}
+		if !k.disabledUntil.IsZero() {
+			until := k.disabledUntil
+			ks.DisabledUntil = &until
+		}
+		if !k.lastUsed.IsZero() {
+			lastUsed := k.lastUsed
+			ks.LastUsed = &lastUsed
+		}
+		status.Keys = append(status.Keys, ks)
+	}
+	return status
+}
+
+func startOfNextMonth(now time.Time) time.Time {
+	year, month, _ := now.UTC().Date()
+	return time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeyPool_Acquire(t *testing.T) {
+	t.Run("round robin", func(t *testing.T) {
+		pool := NewKeyPool([]string{"a", "b", "c"}, KeyStrategyRoundRobin, 0)
+
+		var got []string
+		for i := 0; i < 4; i++ {
+			key, err := pool.Acquire()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got = append(got, key)
+		}
+
+		expected := []string{"a", "b", "c", "a"}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, got)
+			}
+		}
+	})
+
+	t.Run("least used", func(t *testing.T) {
+		pool := NewKeyPool([]string{"a", "b"}, KeyStrategyRoundRobin, 0)
+		pool.Acquire()
+		pool.Acquire()
+		pool.Acquire() // a=2, b=1
+
+		pool.SetKeys([]string{"a", "b"}, KeyStrategyLeastUsed, 0)
+		key, _ := pool.Acquire()
+		if key != "b" {
+			t.Errorf("expected least used key b, got %s", key)
+		}
+	})
+
+	t.Run("rejected keys leave rotation", func(t *testing.T) {
+		pool := NewKeyPool([]string{"a", "b"}, KeyStrategyRoundRobin, 0)
+		pool.ReportRejected("a")
+
+		for i := 0; i < 3; i++ {
+			if key, _ := pool.Acquire(); key != "b" {
+				t.Fatalf("expected only key b, got %s", key)
+			}
+		}
+
+		pool.ReportRejected("b")
+		if _, err := pool.Acquire(); !errors.Is(err, ErrNoAPIKeyAvailable) {
+			t.Errorf("expected ErrNoAPIKeyAvailable, got %v", err)
+		}
+
+		// A reload gives rejected keys another chance
+		pool.SetKeys([]string{"a", "b"}, KeyStrategyRoundRobin, 0)
+		if _, err := pool.Acquire(); err != nil {
+			t.Errorf("expected keys back in rotation after reload, got %v", err)
+		}
+	})
+
+	t.Run("rejected keys come back after the cooldown", func(t *testing.T) {
+		now := time.Date(2024, time.March, 30, 12, 0, 0, 0, time.UTC)
+		pool := NewKeyPool([]string{"a"}, KeyStrategyRoundRobin, 0)
+		pool.now = func() time.Time { return now }
+		pool.ReportRejected("a")
+
+		status := pool.Status().Keys[0]
+		if status.Enabled || status.DisabledUntil == nil || !status.DisabledUntil.Equal(now.Add(RejectedCooldown)) {
+			t.Errorf("expected key disabled for the cooldown, got %+v", status)
+		}
+
+		now = now.Add(RejectedCooldown - time.Second)
+		if _, err := pool.Acquire(); !errors.Is(err, ErrNoAPIKeyAvailable) {
+			t.Errorf("expected key out of rotation during the cooldown, got %v", err)
+		}
+		now = now.Add(time.Second)
+		if key, err := pool.Acquire(); err != nil || key != "a" {
+			t.Errorf("expected key back in rotation after the cooldown, got %q, %v", key, err)
+		}
+	})
+
+	t.Run("monthly quota", func(t *testing.T) {
+		now := time.Date(2024, time.March, 30, 12, 0, 0, 0, time.UTC)
+		pool := NewKeyPool([]string{"a"}, KeyStrategyRoundRobin, 2)
+		pool.now = func() time.Time { return now }
+
+		pool.Acquire()
+		pool.Acquire()
+		if _, err := pool.Acquire(); !errors.Is(err, ErrNoAPIKeyAvailable) {
+			t.Fatalf("expected quota to be enforced, got %v", err)
+		}
+
+		status := pool.Status()
+		if status.Keys[0].Enabled || status.Keys[0].DisabledReason != disabledQuota {
+			t.Errorf("expected key disabled for quota, got %+v", status.Keys[0])
+		}
+
+		now = time.Date(2024, time.April, 1, 0, 0, 1, 0, time.UTC)
+		if _, err := pool.Acquire(); err != nil {
+			t.Errorf("expected key back in rotation next month, got %v", err)
+		}
+		if usage := pool.Status().Keys[0].MonthlyUsage; usage != 1 {
+			t.Errorf("expected monthly usage reset, got %d", usage)
+		}
+	})
+}
+
+func TestKeyPool_Status_MasksKeys(t *testing.T) {
+	pool := NewKeyPool([]string{"abcdefghijkl1234"}, KeyStrategyRoundRobin, 0)
+	pool.Acquire()
+
+	status := pool.Status()
+	if status.Keys[0].Key != "****1234" {
+		t.Errorf("expected masked key, got %q", status.Keys[0].Key)
+	}
+	if status.Keys[0].TotalRequests != 1 || status.Keys[0].LastUsed == nil {
+		t.Errorf("expected usage to be tracked, got %+v", status.Keys[0])
+	}
+}
+
+func TestWeatherService_GetTemperature_KeyRotation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("key") {
+		case "revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"code": 2006, "message": "API key is invalid."}}`))
+		case "exhausted":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": {"code": 2007, "message": "API key has exceeded calls per month quota."}}`))
+		default:
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"current": {"temp_c": 21.0}}`))
+		}
+	}))
+	defer server.Close()
+
+	pool := NewKeyPool([]string{"revoked", "exhausted", "good"}, KeyStrategyRoundRobin, 0)
+	service := NewWeatherServiceWithKeyPool(server.URL, pool, server.Client())
+
+	for i := 0; i < 2; i++ {
+		weather, err := service.GetTemperature(context.Background(), "São Paulo")
+		if err != nil {
+			t.Fatalf("expected the request to succeed with the remaining key, got %v", err)
+		}
+		if weather.Current.TempC != 21.0 {
+			t.Errorf("expected temp_c 21.0, got %v", weather.Current.TempC)
+		}
+	}
+
+	status := pool.Status()
+	if status.Keys[0].Enabled || status.Keys[0].DisabledReason != disabledRejected {
+		t.Errorf("expected revoked key out of rotation, got %+v", status.Keys[0])
+	}
+	if status.Keys[1].Enabled || status.Keys[1].DisabledReason != disabledQuota {
+		t.Errorf("expected exhausted key out of rotation, got %+v", status.Keys[1])
+	}
+	if !status.Keys[2].Enabled {
+		t.Errorf("expected good key in rotation, got %+v", status.Keys[2])
+	}
+}
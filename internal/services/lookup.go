@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+// Lookup errors shared by every API (HTTP, gRPC)
+var (
+	ErrInvalidCEP  = errors.New("invalid zipcode")
+	ErrCEPNotFound = errors.New("can not find zipcode")
+)
+
+// LookupResult is a CEP resolved to its location and current weather
+type LookupResult struct {
+	// CEP is the normalized 8-digit CEP
+	CEP string
+	// Query is the location sent to the weather provider
+	Query    string
+	Location *models.ViaCEPResponse
+	Weather  *models.WeatherAPIResponse
+	// ObservedAt is when the provider observed the reading; zero when unknown
+	ObservedAt time.Time
+}
+
+// Lookup resolves CEPs to their current weather
+type Lookup struct {
+	cepService     CEPService
+	weatherService WeatherServiceInterface
+}
+
+// NewLookup creates a lookup over the CEP and weather services
+func NewLookup(cepService CEPService, weatherService WeatherServiceInterface) *Lookup {
+	return &Lookup{
+		cepService:     cepService,
+		weatherService: weatherService,
+	}
+}
+
+// NormalizeCEP trims the CEP and removes dashes (e.g., "01310-100" -> "01310100")
+func NormalizeCEP(cep string) string {
+	return strings.ReplaceAll(strings.TrimSpace(cep), "-", "")
+}
+
+// ByCEP fetches the location and weather for a CEP. It returns ErrInvalidCEP for
+// malformed CEPs and ErrCEPNotFound when ViaCEP does not know the CEP.
+func (l *Lookup) ByCEP(ctx context.Context, cep string) (*LookupResult, error) {
+	cep = NormalizeCEP(cep)
+	if !ValidateCEP(cep) {
+		return nil, ErrInvalidCEP
+	}
+
+	location, err := l.cepService.GetLocation(ctx, cep)
+	if err != nil {
+		return nil, fmt.Errorf("fetching location: %w", err)
+	}
+	if location == nil {
+		return nil, ErrCEPNotFound
+	}
+
+	query := location.Localidade
+	weather, err := l.weatherService.GetTemperature(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("fetching weather: %w", err)
+	}
+
+	result := &LookupResult{CEP: cep, Query: query, Location: location, Weather: weather}
+	if weather.Current.LastUpdatedEpoch > 0 {
+		result.ObservedAt = time.Unix(weather.Current.LastUpdatedEpoch, 0)
+	}
+	return result, nil
+}
+
+// Temperatures returns the reading in Celsius, Fahrenheit and Kelvin
+func (r *LookupResult) Temperatures() (c, f, k float64) {
+	c = r.Weather.Current.TempC
+	return c, ConvertCelsiusToFahrenheit(c), ConvertCelsiusToKelvin(c)
+}
+
+// Details returns the resolved address and the location matched by the weather provider
+func (r *LookupResult) Details() *models.LocationDetails {
+	provider := r.Weather.Location
+	return &models.LocationDetails{
+		CEP:        FormatCEP(r.CEP),
+		Logradouro: r.Location.Logradouro,
+		Bairro:     r.Location.Bairro,
+		City:       r.Location.Localidade,
+		UF:         r.Location.UF,
+		IBGE:       r.Location.IBGE,
+		DDD:        r.Location.DDD,
+		WeatherQuery: models.ProviderLocation{
+			Query:   r.Query,
+			Name:    provider.Name,
+			Region:  provider.Region,
+			Country: provider.Country,
+			Lat:     provider.Lat,
+			Lon:     provider.Lon,
+		},
+	}
+}
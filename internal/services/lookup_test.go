@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/cassette"
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+)
+
+type fakeCEPService map[string]*models.ViaCEPResponse
+
+func (f fakeCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	if cep == "00000000" {
+		return nil, errors.New("viaCEP unavailable")
+	}
+	return f[cep], nil
+}
+
+type fakeWeatherService struct {
+	tempC    float64
+	observed int64
+}
+
+func (f fakeWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	weather := &models.WeatherAPIResponse{}
+	weather.Location.Name = city
+	weather.Current.TempC = f.tempC
+	weather.Current.LastUpdatedEpoch = f.observed
+	return weather, nil
+}
+
+func TestLookup_ByCEP(t *testing.T) {
+	observed := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	lookup := NewLookup(
+		fakeCEPService{"01310100": {CEP: "01310-100", Localidade: "São Paulo", UF: "SP", IBGE: "3550308"}},
+		fakeWeatherService{tempC: 25, observed: observed.Unix()},
+	)
+
+	t.Run("found", func(t *testing.T) {
+		result, err := lookup.ByCEP(context.Background(), " 01310-100 ")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.CEP != "01310100" || result.Query != "São Paulo" {
+			t.Errorf("unexpected result %+v", result)
+		}
+		if !result.ObservedAt.Equal(observed) {
+			t.Errorf("expected observed at %v, got %v", observed, result.ObservedAt)
+		}
+		if c, f, k := result.Temperatures(); c != 25 || f != 77 || k != 298 {
+			t.Errorf("unexpected temperatures %v %v %v", c, f, k)
+		}
+		if details := result.Details(); details.CEP != "01310-100" || details.IBGE != "3550308" || details.WeatherQuery.Name != "São Paulo" {
+			t.Errorf("unexpected details %+v", details)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		cep     string
+		wantErr error
+	}{
+		{"invalid", "0131", ErrInvalidCEP},
+		{"not found", "99999999", ErrCEPNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lookup.ByCEP(context.Background(), tt.cep); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("upstream failure", func(t *testing.T) {
+		_, err := lookup.ByCEP(context.Background(), "00000000")
+		if err == nil || errors.Is(err, ErrCEPNotFound) {
+			t.Errorf("expected an upstream error, got %v", err)
+		}
+	})
+}
+
+// The cassettes in testdata/cassettes replay real ViaCEP and WeatherAPI payloads offline
+func TestLookup_ReplayedCassettes(t *testing.T) {
+	replay := func(name string) *http.Client {
+		transport, err := cassette.NewTransport(cassette.ModeReplay, filepath.Join("..", "..", "testdata", "cassettes", name+".json"), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return &http.Client{Transport: transport}
+	}
+	lookup := NewLookup(
+		NewViaCEPServiceWithClient("https://viacep.com.br/ws", replay("viacep")),
+		NewWeatherServiceWithKeyPool("https://api.weatherapi.com/v1", NewKeyPool([]string{"any-key"}, KeyStrategyRoundRobin, 0), replay("weather")),
+	)
+
+	result, err := lookup.ByCEP(context.Background(), "20040-020")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Location.Bairro != "Centro" || result.Weather.Current.TempC != 28.9 || result.ObservedAt.IsZero() {
+		t.Errorf("unexpected result %+v %+v", result.Location, result.Weather.Current)
+	}
+
+	if _, err := lookup.ByCEP(context.Background(), "99999-999"); !errors.Is(err, ErrCEPNotFound) {
+		t.Errorf("expected ErrCEPNotFound, got %v", err)
+	}
+	if _, err := lookup.ByCEP(context.Background(), "01001-000"); !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("expected an unrecorded CEP to fail, got %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/lhespanhol/weather-by-cep/internal/models"
@@ -13,6 +14,7 @@ import (
 
 // ViaCEPService handles CEP lookups
 type ViaCEPService struct {
+	mu         sync.RWMutex
 	baseURL    string
 	httpClient *http.Client
 }
@@ -34,16 +36,41 @@ func ValidateCEP(cep string) bool {
 	return re.MatchString(cep)
 }
 
+// FormatCEP formats an 8-digit CEP as 01310-100
+func FormatCEP(cep string) string {
+	if len(cep) != 8 {
+		return cep
+	}
+	return cep[:5] + "-" + cep[5:]
+}
+
+// Reconfigure atomically replaces the base URL and timeout.
+// Requests already in flight keep using the values they started with.
+func (s *ViaCEPService) Reconfigure(baseURL string, timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := *s.httpClient
+	client.Timeout = timeout
+
+	s.baseURL = baseURL
+	s.httpClient = &client
+}
+
 // GetLocation fetches the location for a given CEP
 func (s *ViaCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
-	url := fmt.Sprintf("%s/%s/json/", s.baseURL, cep)
+	s.mu.RLock()
+	baseURL, httpClient := s.baseURL, s.httpClient
+	s.mu.RUnlock()
+
+	url := fmt.Sprintf("%s/%s/json/", baseURL, cep)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := s.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch CEP: %w", err)
 	}
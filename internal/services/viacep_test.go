@@ -65,6 +65,20 @@ func TestValidateCEP(t *testing.T) {
 	}
 }
 
+func TestFormatCEP(t *testing.T) {
+	tests := map[string]string{
+		"01310100": "01310-100",
+		"0131010":  "0131010",
+		"":         "",
+	}
+
+	for cep, expected := range tests {
+		if got := FormatCEP(cep); got != expected {
+			t.Errorf("FormatCEP(%q) = %q, want %q", cep, got, expected)
+		}
+	}
+}
+
 func TestViaCEPService_GetLocation(t *testing.T) {
 	t.Run("successful CEP lookup", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
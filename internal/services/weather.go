@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/lhespanhol/weather-by-cep/internal/models"
@@ -13,8 +15,9 @@ import (
 
 // WeatherService handles weather lookups
 type WeatherService struct {
+	mu         sync.RWMutex
 	baseURL    string
-	apiKey     string
+	keys       *KeyPool
 	httpClient *http.Client
 }
 
@@ -22,40 +25,145 @@ type WeatherService struct {
 func NewWeatherService(apiKey string) *WeatherService {
 	return &WeatherService{
 		baseURL: "https://api.weatherapi.com/v1",
-		apiKey:  apiKey,
+		keys:    NewKeyPool([]string{apiKey}, KeyStrategyRoundRobin, 0),
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
 }
 
+// NewWeatherServiceWithKeyPool creates a new Weather service that spreads requests across a key pool
+func NewWeatherServiceWithKeyPool(baseURL string, keys *KeyPool, client *http.Client) *WeatherService {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &WeatherService{
+		baseURL:    baseURL,
+		keys:       keys,
+		httpClient: client,
+	}
+}
+
+// KeyPool returns the API key pool used by the service
+func (s *WeatherService) KeyPool() *KeyPool {
+	return s.keys
+}
+
+// Reconfigure atomically replaces the base URL and timeout.
+// Requests already in flight keep using the values they started with.
+func (s *WeatherService) Reconfigure(baseURL string, timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := *s.httpClient
+	client.Timeout = timeout
+
+	s.baseURL = baseURL
+	s.httpClient = &client
+}
+
+// WeatherAPI error codes that mean the key itself is the problem
+// https://www.weatherapi.com/docs/#intro-error-codes
+const (
+	weatherAPIKeyInvalid       = 2006
+	weatherAPIQuotaExceeded    = 2007
+	weatherAPIKeyDisabled      = 2008
+	weatherAPIKeyNoAccess      = 2009
+	weatherAPIKeyNotProvided   = 1002
+	weatherAPIKeyInvalidLegacy = 1005
+)
+
 // GetTemperature fetches the current temperature for a location
 func (s *WeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
-	// Encode the city name to handle special characters
-	encodedCity := url.QueryEscape(city)
-	reqURL := fmt.Sprintf("%s/current.json?key=%s&q=%s", s.baseURL, s.apiKey, encodedCity)
+	var weather models.WeatherAPIResponse
+	if err := s.call(ctx, "current.json", url.Values{"q": {city}}, &weather); err != nil {
+		return nil, err
+	}
+	return &weather, nil
+}
+
+// GetForecast fetches the daily forecast for a location, starting today
+func (s *WeatherService) GetForecast(ctx context.Context, city string, days int) (*models.WeatherAPIForecastResponse, error) {
+	var forecast models.WeatherAPIForecastResponse
+	params := url.Values{"q": {city}, "days": {strconv.Itoa(days)}}
+	if err := s.call(ctx, "forecast.json", params, &forecast); err != nil {
+		return nil, err
+	}
+	return &forecast, nil
+}
+
+// call requests a WeatherAPI endpoint and decodes the response into out.
+// When the provider refuses a pooled key, the key is taken out of rotation and the
+// request is retried with the next one.
+func (s *WeatherService) call(ctx context.Context, endpoint string, params url.Values, out interface{}) error {
+	s.mu.RLock()
+	baseURL, httpClient := s.baseURL, s.httpClient
+	s.mu.RUnlock()
+
+	attempts := s.keys.Size()
+	for attempt := 1; ; attempt++ {
+		apiKey, err := s.keys.Acquire()
+		if err != nil {
+			return err
+		}
+
+		keyProblem, err := s.fetch(ctx, httpClient, baseURL, apiKey, endpoint, params, out)
+		switch keyProblem {
+		case disabledRejected:
+			s.keys.ReportRejected(apiKey)
+		case disabledQuota:
+			s.keys.ReportQuotaExceeded(apiKey)
+		}
+		if keyProblem == "" || attempt >= attempts {
+			return err
+		}
+	}
+}
+
+// fetch calls the endpoint with one key. keyProblem is set when the
+// response shows the key was refused or out of quota.
+func (s *WeatherService) fetch(ctx context.Context, httpClient *http.Client, baseURL, apiKey, endpoint string, params url.Values, out interface{}) (keyProblem string, err error) {
+	// Encode the parameters to handle special characters in city names
+	query := url.Values{"key": {apiKey}}
+	for name, values := range params {
+		query[name] = values
+	}
+	reqURL := fmt.Sprintf("%s/%s?%s", baseURL, endpoint, query.Encode())
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := s.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch weather: %w", err)
+		return "", fmt.Errorf("failed to fetch weather: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("weatherAPI returned status %d", resp.StatusCode)
+		var apiErr models.WeatherAPIError
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return classifyKeyProblem(resp.StatusCode, apiErr.Error.Code), fmt.Errorf("weatherAPI returned status %d", resp.StatusCode)
 	}
 
-	var weatherResp models.WeatherAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&weatherResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
+	return "", nil
+}
 
-	return &weatherResp, nil
+func classifyKeyProblem(statusCode, errorCode int) string {
+	switch errorCode {
+	case weatherAPIQuotaExceeded:
+		return disabledQuota
+	case weatherAPIKeyInvalid, weatherAPIKeyDisabled, weatherAPIKeyNoAccess, weatherAPIKeyNotProvided, weatherAPIKeyInvalidLegacy:
+		return disabledRejected
+	}
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return disabledRejected
+	}
+	return ""
 }
 
 // ConvertCelsiusToFahrenheit converts Celsius to Fahrenheit
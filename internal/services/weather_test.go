@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func almostEqual(a, b, tolerance float64) bool {
@@ -111,11 +112,7 @@ func TestWeatherService_GetTemperature(t *testing.T) {
 		}))
 		defer server.Close()
 
-		service := &WeatherService{
-			baseURL:    server.URL,
-			apiKey:     "test-api-key",
-			httpClient: server.Client(),
-		}
+		service := NewWeatherServiceWithClient(server.URL, "test-api-key", server.Client())
 
 		weather, err := service.GetTemperature(context.Background(), "São Paulo")
 		if err != nil {
@@ -137,11 +134,7 @@ func TestWeatherService_GetTemperature(t *testing.T) {
 		}))
 		defer server.Close()
 
-		service := &WeatherService{
-			baseURL:    server.URL,
-			apiKey:     "invalid-key",
-			httpClient: server.Client(),
-		}
+		service := NewWeatherServiceWithClient(server.URL, "invalid-key", server.Client())
 
 		_, err := service.GetTemperature(context.Background(), "São Paulo")
 		if err == nil {
@@ -159,11 +152,7 @@ func TestWeatherService_GetTemperature(t *testing.T) {
 		}))
 		defer server.Close()
 
-		service := &WeatherService{
-			baseURL:    server.URL,
-			apiKey:     "test-key",
-			httpClient: server.Client(),
-		}
+		service := NewWeatherServiceWithClient(server.URL, "test-key", server.Client())
 
 		_, err := service.GetTemperature(context.Background(), "São Paulo")
 		if err != nil {
@@ -176,3 +165,62 @@ func TestWeatherService_GetTemperature(t *testing.T) {
 		}
 	})
 }
+
+func TestWeatherService_GetForecast(t *testing.T) {
+	var receivedPath, receivedDays string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath, receivedDays = r.URL.Path, r.URL.Query().Get("days")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"location": {"name": "Sao Paulo"},
+			"forecast": {"forecastday": [
+				{"date": "2026-03-10", "day": {"maxtemp_c": 29.1, "mintemp_c": 19.4, "condition": {"text": "Patchy rain nearby"}}},
+				{"date": "2026-03-11", "day": {"maxtemp_c": 27.0, "mintemp_c": 18.2}}
+			]}
+		}`))
+	}))
+	defer server.Close()
+
+	service := NewWeatherServiceWithClient(server.URL, "test-key", server.Client())
+	forecast, err := service.GetForecast(context.Background(), "São Paulo", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if receivedPath != "/forecast.json" || receivedDays != "2" {
+		t.Errorf("unexpected request %s?days=%s", receivedPath, receivedDays)
+	}
+	days := forecast.Forecast.ForecastDay
+	if len(days) != 2 || days[0].Date != "2026-03-10" || days[0].Day.MaxTempC != 29.1 || days[0].Day.Condition.Text != "Patchy rain nearby" {
+		t.Errorf("unexpected forecast %+v", days)
+	}
+}
+
+func TestWeatherService_Reconfigure(t *testing.T) {
+	var receivedKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedKeys = append(receivedKeys, r.URL.Query().Get("key"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"current": {"temp_c": 20.0}}`))
+	}))
+	defer server.Close()
+
+	service := NewWeatherServiceWithClient("http://127.0.0.1:1", "old-key", server.Client())
+	service.Reconfigure(server.URL, 5*time.Second)
+	service.KeyPool().SetKeys([]string{"new-key"}, KeyStrategyRoundRobin, 0)
+
+	if _, err := service.GetTemperature(context.Background(), "São Paulo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(receivedKeys) != 1 || receivedKeys[0] != "new-key" {
+		t.Errorf("expected request with new key, got %v", receivedKeys)
+	}
+	if service.httpClient.Timeout != 5*time.Second {
+		t.Errorf("expected timeout 5s, got %v", service.httpClient.Timeout)
+	}
+	if server.Client().Timeout == 5*time.Second {
+		t.Error("expected Reconfigure not to modify the caller's client")
+	}
+}
@@ -0,0 +1,218 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+// ErrTooManyStreams means the hub already serves its maximum number of subscriptions
+var ErrTooManyStreams = errors.New("too many concurrent streams")
+
+// Settings holds the live update settings
+type Settings struct {
+	// PollInterval is how often each watched CEP is looked up
+	PollInterval time.Duration
+	// Heartbeat is how often idle connections get a keep-alive message
+	Heartbeat time.Duration
+	// MaxStreams caps the concurrent subscriptions across all CEPs
+	MaxStreams int
+	// MaxSubscriptions caps the CEPs watched over one WebSocket connection
+	MaxSubscriptions int
+}
+
+// Hub shares one background poller per CEP among all of its subscribers, so the
+// upstream load depends on how many CEPs are watched rather than on how many clients
+type Hub struct {
+	lookup *services.Lookup
+
+	mu       sync.Mutex
+	settings Settings
+	topics   map[string]*topic
+	streams  int
+}
+
+// topic is the poller of one CEP
+type topic struct {
+	cep    string
+	ready  chan struct{}
+	err    error
+	latest *services.LookupResult
+	subs   map[*Subscription]struct{}
+	cancel context.CancelFunc
+}
+
+// Subscription receives the readings of one CEP until it is closed
+type Subscription struct {
+	hub     *Hub
+	topic   *topic
+	updates chan *services.LookupResult
+	once    sync.Once
+}
+
+// NewHub creates a hub polling the lookup
+func NewHub(lookup *services.Lookup, settings Settings) *Hub {
+	return &Hub{
+		lookup:   lookup,
+		settings: settings,
+		topics:   make(map[string]*topic),
+	}
+}
+
+// Configure replaces the settings. Pollers pick up the new interval after their next lookup.
+func (h *Hub) Configure(settings Settings) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settings = settings
+}
+
+// Settings returns the current settings
+func (h *Hub) Settings() Settings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.settings
+}
+
+// Stats returns how many CEPs are being polled and how many subscriptions are open
+func (h *Hub) Stats() (topics, streams int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics), h.streams
+}
+
+// Subscribe starts watching a CEP. It waits for the first reading, so lookup errors
+// (services.ErrInvalidCEP, services.ErrCEPNotFound, upstream failures) are returned
+// here rather than on the subscription.
+func (h *Hub) Subscribe(ctx context.Context, cep string) (*Subscription, error) {
+	cep = services.NormalizeCEP(cep)
+	if !services.ValidateCEP(cep) {
+		return nil, services.ErrInvalidCEP
+	}
+
+	h.mu.Lock()
+	if h.streams >= h.settings.MaxStreams {
+		h.mu.Unlock()
+		return nil, ErrTooManyStreams
+	}
+	t, ok := h.topics[cep]
+	if !ok {
+		pollCtx, cancel := context.WithCancel(context.Background())
+		t = &topic{
+			cep:    cep,
+			ready:  make(chan struct{}),
+			subs:   make(map[*Subscription]struct{}),
+			cancel: cancel,
+		}
+		h.topics[cep] = t
+		go h.poll(pollCtx, t)
+	}
+	sub := &Subscription{hub: h, topic: t, updates: make(chan *services.LookupResult, 1)}
+	t.subs[sub] = struct{}{}
+	h.streams++
+	h.mu.Unlock()
+
+	select {
+	case <-t.ready:
+	case <-ctx.Done():
+		sub.Close()
+		return nil, ctx.Err()
+	}
+	if t.err != nil {
+		sub.Close()
+		return nil, t.err
+	}
+	return sub, nil
+}
+
+// poll looks the CEP up until the last subscriber leaves, publishing readings that changed
+func (h *Hub) poll(ctx context.Context, t *topic) {
+	result, err := h.lookup.ByCEP(ctx, t.cep)
+	h.mu.Lock()
+	t.latest, t.err = result, err
+	if err != nil && h.topics[t.cep] == t {
+		// Let the next subscriber try again instead of inheriting the failure
+		delete(h.topics, t.cep)
+	}
+	interval := h.settings.PollInterval
+	h.mu.Unlock()
+	close(t.ready)
+	if err != nil {
+		t.cancel()
+		return
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		result, err := h.lookup.ByCEP(ctx, t.cep)
+		h.mu.Lock()
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				log.Printf("Error polling weather for CEP %s: %v", t.cep, err)
+			}
+		case !sameReading(t.latest, result):
+			t.latest = result
+			for sub := range t.subs {
+				sub.push(result)
+			}
+		}
+		interval = h.settings.PollInterval
+		h.mu.Unlock()
+		timer.Reset(interval)
+	}
+}
+
+// sameReading reports whether two lookups carry the same observation
+func sameReading(a, b *services.LookupResult) bool {
+	return a.Weather.Current.TempC == b.Weather.Current.TempC && a.ObservedAt.Equal(b.ObservedAt)
+}
+
+// Current returns the latest reading of the CEP
+func (s *Subscription) Current() *services.LookupResult {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.topic.latest
+}
+
+// Updates delivers each new reading. A slow reader only gets the most recent one.
+func (s *Subscription) Updates() <-chan *services.LookupResult {
+	return s.updates
+}
+
+// push replaces any reading the subscriber has not consumed yet; the hub lock is held
+func (s *Subscription) push(result *services.LookupResult) {
+	select {
+	case <-s.updates:
+	default:
+	}
+	s.updates <- result
+}
+
+// Close stops the subscription, stopping the poller when it was the last one
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		h, t := s.hub, s.topic
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(t.subs, s)
+		h.streams--
+		if len(t.subs) == 0 {
+			if h.topics[t.cep] == t {
+				delete(h.topics, t.cep)
+			}
+			t.cancel()
+		}
+	})
+}
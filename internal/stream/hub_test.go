@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lhespanhol/weather-by-cep/internal/models"
+	"github.com/lhespanhol/weather-by-cep/internal/services"
+)
+
+type fakeCEPService struct{}
+
+func (fakeCEPService) GetLocation(ctx context.Context, cep string) (*models.ViaCEPResponse, error) {
+	switch cep {
+	case "99999999":
+		return nil, nil
+	case "00000000":
+		return nil, errors.New("viaCEP unavailable")
+	}
+	return &models.ViaCEPResponse{CEP: cep, Localidade: "São Paulo", UF: "SP"}, nil
+}
+
+// fakeWeatherService returns a temperature the test can change, counting the calls
+type fakeWeatherService struct {
+	mu    sync.Mutex
+	tempC float64
+	calls int
+}
+
+func (f *fakeWeatherService) GetTemperature(ctx context.Context, city string) (*models.WeatherAPIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	weather := &models.WeatherAPIResponse{}
+	weather.Location.Name = city
+	weather.Current.TempC = f.tempC
+	return weather, nil
+}
+
+func (f *fakeWeatherService) set(tempC float64) {
+	f.mu.Lock()
+	f.tempC = tempC
+	f.mu.Unlock()
+}
+
+func (f *fakeWeatherService) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newTestHub(weather *fakeWeatherService, settings Settings) *Hub {
+	return NewHub(services.NewLookup(fakeCEPService{}, weather), settings)
+}
+
+func TestHub_SharesOnePollerPerCEP(t *testing.T) {
+	weather := &fakeWeatherService{tempC: 25}
+	hub := newTestHub(weather, Settings{PollInterval: 10 * time.Millisecond, MaxStreams: 10})
+
+	first, err := hub.Subscribe(context.Background(), "01310-100")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := hub.Subscribe(context.Background(), "01310100")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if topics, streams := hub.Stats(); topics != 1 || streams != 2 {
+		t.Errorf("expected 1 topic and 2 streams, got %d and %d", topics, streams)
+	}
+	if got := first.Current().Weather.Current.TempC; got != 25 {
+		t.Errorf("expected 25, got %v", got)
+	}
+
+	// Unchanged readings are not pushed
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case result := <-first.Updates():
+		t.Fatalf("unexpected update %+v", result)
+	default:
+	}
+
+	weather.set(27)
+	for _, sub := range []*Subscription{first, second} {
+		select {
+		case result := <-sub.Updates():
+			if got := result.Weather.Current.TempC; got != 27 {
+				t.Errorf("expected 27, got %v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no update received")
+		}
+	}
+
+	first.Close()
+	first.Close()
+	if topics, streams := hub.Stats(); topics != 1 || streams != 1 {
+		t.Errorf("expected 1 topic and 1 stream, got %d and %d", topics, streams)
+	}
+	second.Close()
+	if topics, streams := hub.Stats(); topics != 0 || streams != 0 {
+		t.Errorf("expected no topics nor streams, got %d and %d", topics, streams)
+	}
+
+	// The poller stops with its last subscriber
+	calls := weather.count()
+	time.Sleep(50 * time.Millisecond)
+	if weather.count() > calls+1 {
+		t.Errorf("poller still running after the last subscriber left")
+	}
+}
+
+func TestHub_Subscribe_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cep     string
+		wantErr error
+	}{
+		{"invalid cep", "0131", services.ErrInvalidCEP},
+		{"unknown cep", "99999999", services.ErrCEPNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := newTestHub(&fakeWeatherService{}, Settings{PollInterval: time.Minute, MaxStreams: 10})
+			if _, err := hub.Subscribe(context.Background(), tt.cep); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if topics, streams := hub.Stats(); topics != 0 || streams != 0 {
+				t.Errorf("expected no topics nor streams, got %d and %d", topics, streams)
+			}
+		})
+	}
+
+	t.Run("upstream failure", func(t *testing.T) {
+		hub := newTestHub(&fakeWeatherService{}, Settings{PollInterval: time.Minute, MaxStreams: 10})
+		if _, err := hub.Subscribe(context.Background(), "00000000"); err == nil {
+			t.Error("expected an error")
+		}
+		if topics, streams := hub.Stats(); topics != 0 || streams != 0 {
+			t.Errorf("expected no topics nor streams, got %d and %d", topics, streams)
+		}
+	})
+
+	t.Run("too many streams", func(t *testing.T) {
+		hub := newTestHub(&fakeWeatherService{}, Settings{PollInterval: time.Minute, MaxStreams: 1})
+		sub, err := hub.Subscribe(context.Background(), "01310100")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := hub.Subscribe(context.Background(), "01311000"); !errors.Is(err, ErrTooManyStreams) {
+			t.Errorf("expected %v, got %v", ErrTooManyStreams, err)
+		}
+		sub.Close()
+		sub, err = hub.Subscribe(context.Background(), "01311000")
+		if err != nil {
+			t.Errorf("expected a free slot after closing, got %v", err)
+		}
+		sub.Close()
+	})
+}